@@ -0,0 +1,157 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ActivityKind is what a running workflow is doing or waiting on
+type ActivityKind string
+
+const (
+	// ActivityStep is a step function executing
+	ActivityStep ActivityKind = "step"
+	// ActivityRetryBackoff is a failed step waiting to retry
+	ActivityRetryBackoff ActivityKind = "retry_backoff"
+	// ActivityRateLimit is a step waiting for a rate limit
+	ActivityRateLimit ActivityKind = "rate_limit"
+	// ActivityConcurrency is a step waiting for a slot under its
+	// MaxConcurrent
+	ActivityConcurrency ActivityKind = "concurrency"
+	// ActivityTimer is a workflow waiting in Sleep
+	ActivityTimer ActivityKind = "timer"
+	// ActivitySignal and ActivityHumanTask are waits scheduled by a server;
+	// only workflows run remotely report them
+	ActivitySignal    ActivityKind = "signal"
+	ActivityHumanTask ActivityKind = "human_task"
+)
+
+// PendingActivity describes something a running workflow is blocked on
+type PendingActivity struct {
+	WorkflowID string       `json:"workflow_id"`
+	Kind       ActivityKind `json:"kind"`
+	StepID     string       `json:"step_id,omitempty"`
+	StepName   string       `json:"step_name,omitempty"`
+	StepNumber int          `json:"step_number"`
+	Attempt    int          `json:"attempt,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	// LastError is the error of the step's previous attempt
+	LastError string `json:"last_error,omitempty"`
+	// WaitingUntil is when a wait is due to end, if known
+	WaitingUntil *time.Time `json:"waiting_until,omitempty"`
+	// Detail names what is waited on, e.g. a signal name
+	Detail string `json:"detail,omitempty"`
+}
+
+// updateActivity applies update to a step's activity, creating it first
+func (ec *ExecutionContext) updateActivity(stepID, stepName string, update func(*PendingActivity)) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.activities == nil {
+		ec.activities = make(map[string]*PendingActivity)
+	}
+	activity, ok := ec.activities[stepID]
+	if !ok {
+		activity = &PendingActivity{WorkflowID: ec.WorkflowID, StepID: stepID, StepName: stepName}
+		if ec.state != nil {
+			activity.StepNumber = ec.state.StepNumber
+		}
+		ec.activities[stepID] = activity
+	}
+	update(activity)
+}
+
+// clearActivity forgets a step's activity once the step returns
+func (ec *ExecutionContext) clearActivity(stepID string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	delete(ec.activities, stepID)
+}
+
+// PendingActivities returns what the workflow is currently doing, oldest
+// first. Concurrent steps each have an entry.
+func (ec *ExecutionContext) PendingActivities() []PendingActivity {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	activities := make([]PendingActivity, 0, len(ec.activities))
+	for _, activity := range ec.activities {
+		activities = append(activities, *activity)
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		return activities[i].StartedAt.Before(activities[j].StartedAt)
+	})
+	return activities
+}
+
+// runningSet indexes the execution contexts of workflows running locally
+type runningSet struct {
+	mu  sync.Mutex
+	ecs map[string]*ExecutionContext
+}
+
+func (s *runningSet) add(ec *ExecutionContext) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ecs == nil {
+		s.ecs = make(map[string]*ExecutionContext)
+	}
+	s.ecs[ec.WorkflowID] = ec
+}
+
+func (s *runningSet) remove(ec *ExecutionContext) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ecs[ec.WorkflowID] == ec {
+		delete(s.ecs, ec.WorkflowID)
+	}
+}
+
+// pendingActivity reports a locally running workflow's activity
+func (s *runningSet) pendingActivity(workflowID string) ([]PendingActivity, error) {
+	s.mu.Lock()
+	ec, ok := s.ecs[workflowID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, NewWorkflowNotFound(workflowID)
+	}
+	return ec.PendingActivities(), nil
+}
+
+// GetPendingActivity reports what a workflow running on this runner is
+// doing, failing with WorkflowNotFound if it is not running here
+func (r *WorkflowRunner) GetPendingActivity(workflowID string) ([]PendingActivity, error) {
+	return r.tracker.running.pendingActivity(workflowID)
+}
+
+// GetPendingActivity reports what a workflow running in this pool is
+// doing, failing with WorkflowNotFound if it is not running here
+func (p *WorkerPool) GetPendingActivity(workflowID string) ([]PendingActivity, error) {
+	return p.tracker.running.pendingActivity(workflowID)
+}
+
+// GetPendingActivity reports what a running workflow is doing or blocked
+// on, with the attempt count and last error of each pending step
+func (c *Client) GetPendingActivity(ctx context.Context, workflowID string) ([]PendingActivity, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/workflows/%s/pending-activity", workflowID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Activities []PendingActivity `json:"activities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Activities, nil
+}
@@ -0,0 +1,27 @@
+package contd
+
+import "fmt"
+
+// finishApplicationFailure completes a workflow that ended with a business
+// failure, journaling the failure as its result
+func (r *WorkflowRunner) finishApplicationFailure(ec *ExecutionContext, failure *ApplicationFailure) error {
+	failure.WorkflowID = ec.WorkflowID
+	if err := appendEvent(r.engine, ec, "workflow_application_failed", map[string]interface{}{
+		"failure_type": failure.Type,
+		"error":        failure.Message,
+		"failure":      EncodeError(failure),
+	}); err != nil {
+		return err
+	}
+	if err := r.engine.CompleteWorkflow(ec.WorkflowID); err != nil {
+		return err
+	}
+	recordStatus(r.engine, ec.WorkflowID, WorkflowStatusCompleted)
+	r.sticky.retain(ec, nil)
+	notifyLifecycle(r.engine, ec, WebhookWorkflowCompleted, map[string]interface{}{
+		"failure_type": failure.Type,
+		"error":        failure.Message,
+	})
+	fmt.Printf("Workflow %s completed with application failure %s: %s\n", ec.WorkflowID, failure.Type, failure.Message)
+	return failure
+}
@@ -0,0 +1,120 @@
+package contd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ArchiveFormatVersion is the version of the archive format this SDK writes
+const ArchiveFormatVersion = 1
+
+// WorkflowArchive is a portable copy of a workflow's history: its journal,
+// latest snapshot, savepoints, completed steps and offloaded payloads
+type WorkflowArchive struct {
+	FormatVersion int       `json:"format_version"`
+	WorkflowID    string    `json:"workflow_id"`
+	OrgID         string    `json:"org_id,omitempty"`
+	ExportedAt    time.Time `json:"exported_at"`
+
+	Events     []map[string]interface{} `json:"events"`
+	Snapshot   *WorkflowState           `json:"snapshot,omitempty"`
+	Savepoints []ArchivedSavepoint      `json:"savepoints,omitempty"`
+	// CompletedSteps maps step IDs to the state recorded when they completed,
+	// so an imported workflow resumes without re-running them
+	CompletedSteps map[string]*WorkflowState `json:"completed_steps,omitempty"`
+	// Artifacts holds payloads offloaded from the journal, by reference
+	Artifacts map[string][]byte `json:"artifacts,omitempty"`
+	// Memo is the workflow's memo
+	Memo map[string]interface{} `json:"memo,omitempty"`
+}
+
+// ArchivedSavepoint is a savepoint and the state it captured
+type ArchivedSavepoint struct {
+	Info  SavepointInfo  `json:"info"`
+	State *WorkflowState `json:"state"`
+}
+
+// Encode writes the archive as JSON
+func (a *WorkflowArchive) Encode(w io.Writer) error {
+	return json.NewEncoder(w).Encode(a)
+}
+
+// ReadArchive reads an archive written by Encode or ExportWorkflow
+func ReadArchive(r io.Reader) (*WorkflowArchive, error) {
+	var archive WorkflowArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("failed to decode archive: %w", err)
+	}
+	if archive.FormatVersion > ArchiveFormatVersion {
+		return nil, NewConfigurationError(fmt.Sprintf("archive format %d is newer than supported format %d", archive.FormatVersion, ArchiveFormatVersion), "format_version")
+	}
+	return &archive, nil
+}
+
+// Archiver is implemented by engines that can export and import workflows
+type Archiver interface {
+	ExportWorkflow(workflowID string) (*WorkflowArchive, error)
+	ImportWorkflow(archive *WorkflowArchive) error
+}
+
+// ExportLocal exports a workflow from a local engine
+func ExportLocal(engine Engine, workflowID string) (*WorkflowArchive, error) {
+	archiver, ok := engineAs[Archiver](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support export", "archive")
+	}
+	return archiver.ExportWorkflow(workflowID)
+}
+
+// ImportLocal loads an archive into a local engine, e.g. to debug a
+// production failure by resuming it with a WorkflowRunner
+func ImportLocal(engine Engine, archive *WorkflowArchive) error {
+	archiver, ok := engineAs[Archiver](engine)
+	if !ok {
+		return NewConfigurationError("engine does not support import", "archive")
+	}
+	return archiver.ImportWorkflow(archive)
+}
+
+// ExportWorkflow downloads a workflow's archive from the server
+func (c *Client) ExportWorkflow(ctx context.Context, workflowID string) (*WorkflowArchive, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/workflows/%s/export", workflowID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ReadArchive(resp.Body)
+}
+
+// ImportWorkflow uploads an archive to the server and returns the ID of the
+// imported workflow
+func (c *Client) ImportWorkflow(ctx context.Context, archive *WorkflowArchive) (string, error) {
+	var body bytes.Buffer
+	if err := archive.Encode(&body); err != nil {
+		return "", fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "POST", "/v1/workflows/import", body.Bytes())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		WorkflowID string `json:"workflow_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.WorkflowID, nil
+}
@@ -0,0 +1,473 @@
+package contd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider authenticates client requests. Authenticate is called on
+// every request, before request hooks run.
+type AuthProvider interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthRefresher is implemented by providers whose credentials can go stale
+// before they expire. When the server rejects a request with 401, the client
+// calls Invalidate and retries the request once.
+type AuthRefresher interface {
+	Invalidate()
+}
+
+// TLSAuthProvider is implemented by providers that authenticate with a
+// client certificate. The client installs its TLS config on the transport.
+type TLSAuthProvider interface {
+	AuthProvider
+	ClientTLSConfig() *tls.Config
+}
+
+// APIKeyAuth sends a static API key as a bearer token
+type APIKeyAuth string
+
+// Authenticate sets the Authorization header
+func (k APIKeyAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(k))
+	return nil
+}
+
+// tokenExpiryDelta is how long before expiry a cached token is refreshed
+const tokenExpiryDelta = 30 * time.Second
+
+// OAuth2Config configures the OAuth2 client credentials grant
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Audience is sent when set, as some identity providers require it
+	Audience string
+	// HTTPClient fetches tokens (defaults to a client with a 10s timeout)
+	HTTPClient *http.Client
+}
+
+// OAuth2Auth authenticates with access tokens from the OAuth2 client
+// credentials grant. Tokens are cached and refreshed shortly before they
+// expire.
+type OAuth2Auth struct {
+	config OAuth2Config
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewOAuth2Auth returns a provider for the client credentials grant
+func NewOAuth2Auth(config OAuth2Config) *OAuth2Auth {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OAuth2Auth{config: config}
+}
+
+// Authenticate sets the Authorization header, fetching a token if needed
+func (a *OAuth2Auth) Authenticate(req *http.Request) error {
+	token, err := a.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns a valid access token
+func (a *OAuth2Auth) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && (a.expires.IsZero() || time.Now().Add(tokenExpiryDelta).Before(a.expires)) {
+		return a.token, nil
+	}
+
+	token, expires, err := a.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.expires = token, expires
+	return token, nil
+}
+
+// Invalidate drops the cached token so the next request fetches a new one
+func (a *OAuth2Auth) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = ""
+}
+
+func (a *OAuth2Auth) fetch(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.config.Scopes, " "))
+	}
+	if a.config.Audience != "" {
+		form.Set("audience", a.config.Audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+
+	resp, err := a.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return "", time.Time{}, fmt.Errorf("token request returned %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token response has no access_token")
+	}
+
+	var expires time.Time
+	if result.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return result.AccessToken, expires, nil
+}
+
+// AWSCredentials are credentials for AWS request signing
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWSCredentialsFunc returns current credentials. It is called on every
+// request, so providers of temporary credentials should cache them.
+type AWSCredentialsFunc func(ctx context.Context) (AWSCredentials, error)
+
+// StaticAWSCredentials returns fixed credentials
+func StaticAWSCredentials(accessKeyID, secretAccessKey, sessionToken string) AWSCredentialsFunc {
+	creds := AWSCredentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, SessionToken: sessionToken}
+	return func(context.Context) (AWSCredentials, error) {
+		return creds, nil
+	}
+}
+
+// SigV4Config configures AWS Signature Version 4 signing
+type SigV4Config struct {
+	Region string
+	// Service is the signing name (defaults to "execute-api")
+	Service     string
+	Credentials AWSCredentialsFunc
+}
+
+// SigV4Auth signs requests with AWS Signature Version 4, for servers behind
+// API Gateway or other IAM-authenticated endpoints
+type SigV4Auth struct {
+	config SigV4Config
+	now    func() time.Time
+}
+
+// NewSigV4Auth returns a SigV4 signing provider
+func NewSigV4Auth(config SigV4Config) *SigV4Auth {
+	if config.Service == "" {
+		config.Service = "execute-api"
+	}
+	return &SigV4Auth{config: config, now: time.Now}
+}
+
+// Authenticate signs the request
+func (a *SigV4Auth) Authenticate(req *http.Request) error {
+	if a.config.Credentials == nil {
+		return NewConfigurationError("sigv4 credentials are required", "credentials")
+	}
+	creds, err := a.config.Credentials(req.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get aws credentials: %w", err)
+	}
+
+	payload, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+	payloadHash := sha256Hex(payload)
+
+	t := a.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL, a.config.Service),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.config.Region + "/" + a.config.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, a.config.Region)
+	key = hmacSHA256(key, a.config.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// requestBody reads the body of req without consuming it
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	payload, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(payload))
+	return payload, nil
+}
+
+// canonicalPath encodes a request path as SigV4 requires. Every service
+// but S3 signs the path with each segment encoded twice.
+func canonicalPath(u *url.URL, service string) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segment = sigV4Escape(segment)
+		if service != "s3" {
+			segment = sigV4Escape(segment)
+		}
+		segments[i] = segment
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes a query string as SigV4 requires: sorted, with
+// spaces as %20
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, sigV4Escape(k)+"="+sigV4Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func sigV4Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// MTLSConfig configures client certificate authentication
+type MTLSConfig struct {
+	// CertFile and KeyFile hold the PEM client certificate and key. They are
+	// reloaded when they change, so certificates can be rotated in place.
+	CertFile string
+	KeyFile  string
+	// CAFile optionally holds PEM roots for verifying the server
+	CAFile string
+	// Auth optionally adds request credentials, e.g. an APIKeyAuth
+	Auth AuthProvider
+}
+
+// MTLSAuth authenticates with a client certificate
+type MTLSAuth struct {
+	config MTLSConfig
+	roots  *x509.CertPool
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewMTLSAuth loads the client certificate and returns a provider
+func NewMTLSAuth(config MTLSConfig) (*MTLSAuth, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, NewConfigurationError("client certificate and key files are required", "cert_file")
+	}
+	a := &MTLSAuth{config: config}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+		a.roots = x509.NewCertPool()
+		if !a.roots.AppendCertsFromPEM(pem) {
+			return nil, NewConfigurationError("ca file has no certificates", "ca_file")
+		}
+	}
+	if _, err := a.certificate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authenticate applies the optional request credentials
+func (a *MTLSAuth) Authenticate(req *http.Request) error {
+	if a.config.Auth == nil {
+		return nil
+	}
+	return a.config.Auth.Authenticate(req)
+}
+
+// Invalidate forwards to the request credentials when they are refreshable
+func (a *MTLSAuth) Invalidate() {
+	if r, ok := a.config.Auth.(AuthRefresher); ok {
+		r.Invalidate()
+	}
+}
+
+// ClientTLSConfig returns a TLS config presenting the client certificate
+func (a *MTLSAuth) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		RootCAs:    a.roots,
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return a.certificate()
+		},
+	}
+}
+
+// certificate returns the client certificate, reloading it when the
+// certificate file has changed
+func (a *MTLSAuth) certificate() (*tls.Certificate, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, err := os.Stat(a.config.CertFile)
+	if err != nil {
+		if a.cert != nil {
+			return a.cert, nil
+		}
+		return nil, fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	if a.cert != nil && !info.ModTime().After(a.modTime) {
+		return a.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(a.config.CertFile, a.config.KeyFile)
+	if err != nil {
+		if a.cert != nil {
+			// Keep the old certificate while a rotation is half-written
+			return a.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	a.cert, a.modTime = &cert, info.ModTime()
+	return a.cert, nil
+}
+
+// withClientTLS returns transport configured with the provider's TLS config.
+// It fails for transports other than *http.Transport, which have no TLS
+// config to install the client certificate in.
+func withClientTLS(transport http.RoundTripper, provider TLSAuthProvider) (http.RoundTripper, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	t, ok := transport.(*http.Transport)
+	if !ok {
+		return nil, NewConfigurationError(fmt.Sprintf("client certificate auth needs an *http.Transport, got %T", transport), "transport")
+	}
+	config := provider.ClientTLSConfig()
+	if t.TLSClientConfig != nil {
+		// Keep the transport's own TLS settings
+		merged := t.TLSClientConfig.Clone()
+		merged.GetClientCertificate = config.GetClientCertificate
+		if config.RootCAs != nil {
+			merged.RootCAs = config.RootCAs
+		}
+		config = merged
+	}
+	t = t.Clone()
+	t.TLSClientConfig = config
+	return t, nil
+}
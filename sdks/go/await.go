@@ -0,0 +1,130 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is how long GetResult waits between polls
+	DefaultPollInterval = time.Second
+	// maxLongPollWait caps how long the server holds one result request
+	maxLongPollWait = 20 * time.Second
+)
+
+// WaitOptions configures GetResult
+type WaitOptions struct {
+	// Timeout bounds the whole wait (zero waits until ctx is done)
+	Timeout time.Duration
+	// PollInterval is the pause between polls when the server does not hold
+	// the request open
+	PollInterval time.Duration
+}
+
+// IsTerminal reports whether a workflow in this status will not run again
+func (s WorkflowStatus) IsTerminal() bool {
+	return s == WorkflowStatusCompleted || s == WorkflowStatusFailed || s == WorkflowStatusCancelled || s == WorkflowStatusTerminated
+}
+
+// GetResult waits until a workflow reaches a terminal status and returns its
+// result. Each request asks the server to hold it open until the workflow
+// finishes; servers that answer immediately are polled instead. A failed
+// workflow, or one that completed with an ApplicationFailure, returns its
+// result along with the reconstructed typed error.
+func (c *Client) GetResult(ctx context.Context, workflowID string, opts WaitOptions) (*WorkflowResult, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		result, err := c.pollResult(ctx, workflowID, c.longPollWait(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if result.Status.IsTerminal() {
+			return result, result.err()
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// longPollWait is how long the server may hold the next request, leaving
+// room inside both the context deadline and the HTTP client timeout
+func (c *Client) longPollWait(ctx context.Context) time.Duration {
+	wait := maxLongPollWait
+	if limit := c.httpClient.Timeout / 2; limit > 0 && limit < wait {
+		wait = limit
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < wait {
+			wait = remaining
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+func (c *Client) pollResult(ctx context.Context, workflowID string, wait time.Duration) (*WorkflowResult, error) {
+	path := fmt.Sprintf("/v1/workflows/%s/result?wait=%d", workflowID, int(wait.Seconds()))
+	resp, err := c.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result WorkflowResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if result.WorkflowID == "" {
+		result.WorkflowID = workflowID
+	}
+	// Servers that only send the failure chain still locate the failed step
+	if result.FailedStep == "" && result.Failure != nil {
+		result.FailedStep, result.Attempt = result.Failure.StepID, result.Failure.Attempt
+	}
+	result.codec = c.codec
+	return &result, nil
+}
+
+// err returns the typed error of a failed or cancelled workflow
+func (r *WorkflowResult) err() error {
+	switch r.Status {
+	case WorkflowStatusFailed:
+		if r.Failure != nil {
+			return DecodeError(r.Failure)
+		}
+		message := r.Error
+		if message == "" {
+			message = "Workflow failed"
+		}
+		return NewContdError(message, r.WorkflowID, nil)
+	case WorkflowStatusCompleted:
+		if r.Failure != nil {
+			return DecodeError(r.Failure)
+		}
+	case WorkflowStatusCancelled:
+		return NewContdError("Workflow was cancelled", r.WorkflowID, nil)
+	}
+	return nil
+}
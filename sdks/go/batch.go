@@ -0,0 +1,247 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBatchConcurrency is the number of items processed at once by default
+const DefaultBatchConcurrency = 8
+
+// batchItemKey is the state metadata marking a batch item's idempotency
+// record, which holds the item's result rather than workflow state
+const batchItemKey = "batch_item"
+
+// isBatchItem reports whether a completed step's state records a batch item
+func isBatchItem(state *WorkflowState) bool {
+	_, ok := state.Metadata[batchItemKey]
+	return ok
+}
+
+// BatchItemFunc processes a single item of a batch
+type BatchItemFunc func(ctx context.Context, index int, item interface{}) (interface{}, error)
+
+// BatchOptions configures RunBatch
+type BatchOptions struct {
+	// Concurrency bounds in-flight items (0 uses DefaultBatchConcurrency)
+	Concurrency int
+	// Retry is the per-item retry policy (nil falls back to the step's policy)
+	Retry *RetryPolicy
+	// ItemTimeout bounds each item's execution (0 means no timeout)
+	ItemTimeout time.Duration
+}
+
+// RunBatch fans fn out over items with bounded concurrency. Each completed
+// item is journaled, so a resumed workflow only re-executes unfinished items.
+// Once every item succeeds the results are stored in state under name.
+// Partial failures are returned as a *BatchError.
+func (r *StepRunner) RunBatch(ctx context.Context, name string, items []interface{}, fn BatchItemFunc, opts BatchOptions) ([]interface{}, error) {
+	ec, err := Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	batchID := ec.GenerateStepID(name)
+
+	if opts.Retry == nil {
+		opts.Retry = r.config.Retry
+	}
+
+	// The batch as a whole commits like a regular step; retries and timeouts
+	// apply per item instead
+	outer := r.config
+	outer.Retry = nil
+	outer.Timeout = 0
+
+	outerRunner := &StepRunner{config: outer, unthrottled: true}
+	result, err := outerRunner.run(ctx, name, batchID, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		results, err := r.runItems(ctx, ec, name, batchID, items, fn, opts)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{name: results}, nil
+	}, nil)
+	if err != nil {
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			return batchErr.Results, batchErr
+		}
+		return nil, err
+	}
+
+	var stored interface{}
+	switch v := result.(type) {
+	case map[string]interface{}:
+		stored = v[name]
+	case *WorkflowState:
+		stored = v.Variables[name]
+	}
+	results, _ := stored.([]interface{})
+	return results, nil
+}
+
+func (r *StepRunner) runItems(ctx context.Context, ec *ExecutionContext, name, batchID string, items []interface{}, fn BatchItemFunc, opts BatchOptions) ([]interface{}, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	// Items are recorded at the batch step's number, so rewinding to a
+	// savepoint before the batch reruns them
+	stepNumber := 1
+	if state, _ := ec.GetState(); state != nil {
+		stepNumber = state.StepNumber + 1
+	}
+
+	results := make([]interface{}, len(items))
+	failures := make(map[int]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			failures[i] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result, err := r.runItem(ctx, ec, name, fmt.Sprintf("%s[%d]", batchID, i), i, stepNumber, item, fn, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures[i] = err
+			} else {
+				results[i] = result
+			}
+		}(i, item)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return nil, NewBatchError(ec.WorkflowID, batchID, name, len(items), failures, results)
+	}
+	return results, nil
+}
+
+// runItem executes one item, serving it from the idempotency cache if a
+// previous run already completed it
+func (r *StepRunner) runItem(ctx context.Context, ec *ExecutionContext, name, itemID string, index, stepNumber int, item interface{}, fn BatchItemFunc, opts BatchOptions) (interface{}, error) {
+	engine := ec.GetEngine()
+	if engine == nil {
+		return nil, fmt.Errorf("no execution engine in context")
+	}
+
+	cached, err := engine.Idempotency().CheckCompleted(ec.WorkflowID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		return cached.Variables["result"], nil
+	}
+
+	// Retries count the attempts the engine allocated, so a resumed batch
+	// doesn't restart an item's retry budget
+	for {
+		if err := throttle(ctx, engine, ec, itemID, name); err != nil {
+			return nil, err
+		}
+		attemptID, err := engine.Idempotency().AllocateAttempt(ec.WorkflowID, itemID, ec.GetLease())
+		if err != nil {
+			return nil, err
+		}
+		if err := appendEvent(engine, ec, "step_intention", map[string]interface{}{
+			"step_id":    itemID,
+			"step_name":  name,
+			"attempt_id": attemptID,
+			"batch_item": index,
+		}); err != nil {
+			return nil, err
+		}
+
+		startTime := time.Now()
+		itemFn := func(ctx context.Context, input interface{}) (interface{}, error) {
+			return fn(ctx, index, input)
+		}
+		var result interface{}
+		var execErr error
+		if opts.ItemTimeout > 0 {
+			result, execErr = r.executeWithTimeout(ctx, itemFn, item, opts.ItemTimeout, ec.WorkflowID, itemID, name)
+		} else {
+			result, execErr = callStep(ctx, itemFn, item, ec.WorkflowID, itemID, name)
+		}
+		durationMs := time.Since(startTime).Milliseconds()
+
+		if execErr == nil {
+			journaled, overflow, err := truncatePayload(engine, ec.WorkflowID, itemID, result, r.payloadLimit(ec))
+			if err != nil {
+				return nil, err
+			}
+			fields := map[string]interface{}{
+				"step_id":     itemID,
+				"attempt_id":  attemptID,
+				"batch_item":  index,
+				"result":      journaled,
+				"duration_ms": durationMs,
+			}
+			if overflow != nil {
+				fields["overflow_digest"] = overflow.Digest
+				fields["overflow_ref"] = overflow.ArtifactRef
+			}
+			if err := appendEvent(engine, ec, "batch_item_completed", fields); err != nil {
+				return nil, err
+			}
+			state := &WorkflowState{
+				WorkflowID: ec.WorkflowID,
+				StepNumber: stepNumber,
+				Variables:  map[string]interface{}{"result": result},
+				Metadata:   map[string]interface{}{batchItemKey: index},
+				OrgID:      ec.OrgID,
+			}
+			if err := engine.Idempotency().MarkCompleted(ec.WorkflowID, itemID, attemptID, state); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+
+		failed := map[string]interface{}{
+			"step_id":    itemID,
+			"attempt_id": attemptID,
+			"batch_item": index,
+			"error":      execErr.Error(),
+		}
+		var panicErr *StepPanic
+		if errors.As(execErr, &panicErr) {
+			failed["panic"] = true
+			failed["stack"] = panicErr.Stack
+		}
+		appendEvent(engine, ec, "batch_item_failed", failed)
+
+		if opts.Retry == nil || !opts.Retry.ShouldRetry(attemptID, execErr) || ctx.Err() != nil {
+			if deadLettered(opts.Retry, attemptID, execErr) {
+				deadLetter(engine, ec, itemID, name, attemptID, item, execErr)
+				if attemptID >= opts.Retry.MaxAttempts {
+					return nil, NewTooManyAttempts(ec.WorkflowID, itemID, name, opts.Retry.MaxAttempts, execErr.Error())
+				}
+			}
+			return nil, NewStepExecutionFailed(ec.WorkflowID, itemID, name, attemptID, execErr)
+		}
+		timer := time.NewTimer(retryDelay(execErr, opts.Retry.Backoff(attemptID)))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, NewStepExecutionFailed(ec.WorkflowID, itemID, name, attemptID, execErr)
+		}
+	}
+}
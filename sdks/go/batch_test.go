@@ -0,0 +1,46 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestBatchResumeKeepsItemAttempts checks that a batch resumed in the middle
+// of an item's retries spends only what is left of the item's retry budget
+func TestBatchResumeKeepsItemAttempts(t *testing.T) {
+	engine := NewInMemoryEngine()
+	policy := RetryPolicy{MaxAttempts: 3, BackoffBase: 0.001, BackoffMax: 0.001}
+	calls := 0
+	var stop context.CancelFunc
+	workflow := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return NewStepRunner(DefaultStepConfig()).RunBatch(ctx, "import", []interface{}{"poison"},
+			func(context.Context, int, interface{}) (interface{}, error) {
+				calls++
+				if calls == 2 && stop != nil {
+					// The worker stops while the item waits to retry
+					stop()
+				}
+				return nil, errors.New("malformed record")
+			}, BatchOptions{Retry: &policy})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop = cancel
+	if _, err := Execute(ctx, engine, "batch-resume", workflow, nil, WithWorkflowID("batch-resume-1")); err == nil {
+		t.Fatal("first run: expected the batch to fail")
+	}
+	if calls != 2 {
+		t.Fatalf("first run made %d attempts, want 2", calls)
+	}
+
+	stop = nil
+	_, err := Execute(context.Background(), engine, "batch-resume", workflow, nil, WithWorkflowID("batch-resume-1"))
+	var tooMany *TooManyAttempts
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("resumed run: expected TooManyAttempts, got %v", err)
+	}
+	if calls != policy.MaxAttempts {
+		t.Errorf("item ran %d times across both runs, want %d", calls, policy.MaxAttempts)
+	}
+}
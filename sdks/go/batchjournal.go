@@ -0,0 +1,309 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCriticalEvents are the events a BatchingEngine commits before
+// Append returns: a step's intention must be durable before it executes,
+// and its outcome before the next step builds on it
+var DefaultCriticalEvents = []string{"step_intention", "step_completed", "step_failed"}
+
+// BatchAppender is implemented by journals that can write many events in
+// one call, such as remote engines with a bulk endpoint
+type BatchAppender interface {
+	AppendBatch(events []interface{}) error
+}
+
+// BatchConfig configures a BatchingEngine
+type BatchConfig struct {
+	// BatchSize is the most events written at once (defaults to 100)
+	BatchSize int
+	// FlushInterval bounds how long an event waits for a full batch
+	// (defaults to 10ms)
+	FlushInterval time.Duration
+	// BufferSize is how many events may await writing before appends block
+	// (defaults to 10000)
+	BufferSize int
+	// MaxAttempts is how often a failed batch is written before its events
+	// are acknowledged with the error (defaults to 3)
+	MaxAttempts int
+	// CriticalEvents are the event types whose Append waits until they are
+	// written (nil uses DefaultCriticalEvents)
+	CriticalEvents []string
+	// OnAck is called for every event once its batch is written or has
+	// failed, in the order the events were appended
+	OnAck func(event interface{}, err error)
+}
+
+// BatchingEngine wraps an engine so journal appends are written in
+// batches by a background writer, with group commit: an event appended
+// while a batch is being written joins the next one. Critical events, such
+// as step intentions, still block Append until their batch is written, so
+// the journal always records a step before it runs; other events are
+// acknowledged through OnAck. Events are written in append order.
+type BatchingEngine struct {
+	Engine
+	config   BatchConfig
+	critical map[string]bool
+
+	queue   chan *batchedEvent
+	pending int64
+	closed  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// batchedEvent is an event awaiting its batch. A nil event is a flush
+// marker; done is set for events whose appender waits.
+type batchedEvent struct {
+	event interface{}
+	done  chan error
+}
+
+// NewBatchingEngine wraps engine so its journal appends are batched
+func NewBatchingEngine(engine Engine, config BatchConfig) *BatchingEngine {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 10 * time.Millisecond
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 10000
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	if config.CriticalEvents == nil {
+		config.CriticalEvents = DefaultCriticalEvents
+	}
+	critical := make(map[string]bool, len(config.CriticalEvents))
+	for _, eventType := range config.CriticalEvents {
+		critical[eventType] = true
+	}
+	e := &BatchingEngine{
+		Engine:   engine,
+		config:   config,
+		critical: critical,
+		queue:    make(chan *batchedEvent, config.BufferSize),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Unwrap returns the wrapped engine
+func (e *BatchingEngine) Unwrap() Engine {
+	return e.Engine
+}
+
+// Journal returns a journal that queues events for the batch writer
+func (e *BatchingEngine) Journal() Journal {
+	return &batchingJournal{engine: e}
+}
+
+// Flush blocks until every event appended before it is written
+func (e *BatchingEngine) Flush(ctx context.Context) error {
+	marker := &batchedEvent{done: make(chan error, 1)}
+	select {
+	case e.queue <- marker:
+	case <-e.closed:
+		return NewPersistenceError("batching journal is closed", "", nil)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-marker.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes buffered events and stops the writer. Events appended after
+// Close fail, and those still unwritten when ctx is done are dropped.
+func (e *BatchingEngine) Close(ctx context.Context) error {
+	flushErr := e.Flush(ctx)
+	e.once.Do(func() { close(e.closed) })
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return flushErr
+}
+
+// run collects queued events into batches and writes them
+func (e *BatchingEngine) run() {
+	defer close(e.done)
+	var batch []*batchedEvent
+	var flush <-chan time.Time
+	for {
+		select {
+		case queued := <-e.queue:
+			batch = append(batch, queued)
+			// Group whatever else is already waiting
+			urgent := queued.done != nil
+			for len(batch) < e.config.BatchSize {
+				select {
+				case next := <-e.queue:
+					batch = append(batch, next)
+					urgent = urgent || next.done != nil
+					continue
+				default:
+				}
+				break
+			}
+			if !urgent && len(batch) < e.config.BatchSize {
+				if flush == nil {
+					flush = time.After(e.config.FlushInterval)
+				}
+				continue
+			}
+		case <-flush:
+		case <-e.closed:
+			for {
+				select {
+				case queued := <-e.queue:
+					batch = append(batch, queued)
+					continue
+				default:
+				}
+				break
+			}
+			e.write(batch)
+			return
+		}
+		e.write(batch)
+		batch, flush = nil, nil
+	}
+}
+
+// write appends a batch, retrying up to MaxAttempts, then acknowledges
+// its events in order
+func (e *BatchingEngine) write(batch []*batchedEvent) {
+	events := make([]interface{}, 0, len(batch))
+	for _, queued := range batch {
+		if queued.event != nil {
+			events = append(events, queued.event)
+		}
+	}
+
+	var err error
+	if len(events) > 0 {
+		backoff := 10 * time.Millisecond
+		for attempt := 1; attempt <= e.config.MaxAttempts; attempt++ {
+			var written int
+			written, err = e.appendAll(events)
+			if err == nil {
+				break
+			}
+			// Events already written are left out of the retry
+			events = events[written:]
+			fmt.Printf("Failed to write %d journal events (attempt %d): %v\n", len(events), attempt, err)
+			if attempt < e.config.MaxAttempts {
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+		}
+	}
+
+	for _, queued := range batch {
+		if queued.event != nil {
+			atomic.AddInt64(&e.pending, -1)
+			if e.config.OnAck != nil {
+				e.config.OnAck(queued.event, err)
+			}
+		}
+		if queued.done != nil {
+			queued.done <- err
+		}
+	}
+}
+
+// appendAll writes events with one batch call when the journal supports
+// it, returning how many were written before an error
+func (e *BatchingEngine) appendAll(events []interface{}) (int, error) {
+	journal := e.Engine.Journal()
+	if batcher, ok := journal.(BatchAppender); ok {
+		if err := batcher.AppendBatch(events); err != nil {
+			return 0, err
+		}
+		return len(events), nil
+	}
+	for i, event := range events {
+		if err := journal.Append(event); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// isCritical reports whether Append must wait for event to be written
+func (e *BatchingEngine) isCritical(event interface{}) bool {
+	m, ok := event.(map[string]interface{})
+	if !ok {
+		return true
+	}
+	eventType, _ := m["event_type"].(string)
+	return e.critical[eventType]
+}
+
+type batchingJournal struct {
+	engine *BatchingEngine
+}
+
+// Append queues the event, waiting for it to be written if it is critical
+func (j *batchingJournal) Append(event interface{}) error {
+	e := j.engine
+	if m, ok := event.(map[string]interface{}); ok {
+		// Copy so later changes by the caller don't race the writer
+		cp := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			cp[k] = v
+		}
+		event = cp
+	}
+	queued := &batchedEvent{event: event}
+	if e.isCritical(event) {
+		queued.done = make(chan error, 1)
+	}
+	select {
+	case <-e.closed:
+		return NewPersistenceError("batching journal is closed", "", nil)
+	default:
+	}
+	atomic.AddInt64(&e.pending, 1)
+	select {
+	case e.queue <- queued:
+	case <-e.closed:
+		atomic.AddInt64(&e.pending, -1)
+		return NewPersistenceError("batching journal is closed", "", nil)
+	}
+	if queued.done == nil {
+		return nil
+	}
+	select {
+	case err := <-queued.done:
+		return err
+	case <-e.done:
+		// The writer stopped; it may still have written this event last
+		select {
+		case err := <-queued.done:
+			return err
+		default:
+			return NewPersistenceError("batching journal is closed", "", nil)
+		}
+	}
+}
+
+// QueueDepth reports how many events await writing
+func (j *batchingJournal) QueueDepth() int {
+	return int(atomic.LoadInt64(&j.engine.pending))
+}
@@ -0,0 +1,123 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Tags that record a branch's origin on the workflow it creates
+const (
+	BranchNameTag      = "contd.branch"
+	BranchParentTag    = "contd.branch_parent"
+	BranchSavepointTag = "contd.branch_savepoint"
+)
+
+// Branch is a workflow forked from another at a savepoint
+type Branch struct {
+	Name             string         `json:"name"`
+	WorkflowID       string         `json:"workflow_id"`
+	ParentWorkflowID string         `json:"parent_workflow_id"`
+	SavepointID      string         `json:"savepoint_id"`
+	Status           WorkflowStatus `json:"status,omitempty"`
+}
+
+// Branch forks a workflow at a savepoint into a new workflow tagged with
+// the branch name, so an alternative strategy can run from that point
+func (c *Client) Branch(ctx context.Context, workflowID, savepointID, branchName string) (*Branch, error) {
+	if branchName == "" {
+		return nil, NewConfigurationError("branch name is required", "branch_name")
+	}
+	existing, err := c.ListBranches(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range existing {
+		if b.Name == branchName {
+			return nil, NewConfigurationError(fmt.Sprintf("branch %q of workflow %s already exists", branchName, workflowID), "branch_name")
+		}
+	}
+
+	newWorkflowID, err := c.TimeTravel(ctx, workflowID, savepointID)
+	if err != nil {
+		return nil, err
+	}
+	err = c.UpdateTags(ctx, newWorkflowID, map[string]string{
+		BranchNameTag:      branchName,
+		BranchParentTag:    workflowID,
+		BranchSavepointTag: savepointID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Branch{
+		Name:             branchName,
+		WorkflowID:       newWorkflowID,
+		ParentWorkflowID: workflowID,
+		SavepointID:      savepointID,
+	}, nil
+}
+
+// ListBranches lists the branches forked from a workflow, by name
+func (c *Client) ListBranches(ctx context.Context, workflowID string) ([]Branch, error) {
+	workflows, err := c.ListWorkflowsIterator(ctx, ListWorkflowsInput{
+		Tags: map[string]string{BranchParentTag: workflowID},
+	}).All()
+	if err != nil {
+		return nil, err
+	}
+
+	branches := make([]Branch, 0, len(workflows))
+	for _, wf := range workflows {
+		branches = append(branches, Branch{
+			Name:             wf.Tags[BranchNameTag],
+			WorkflowID:       wf.WorkflowID,
+			ParentWorkflowID: workflowID,
+			SavepointID:      wf.Tags[BranchSavepointTag],
+			Status:           wf.Status,
+		})
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+	return branches, nil
+}
+
+// BranchComparison is the difference between the final states of two workflows
+type BranchComparison struct {
+	BaseWorkflowID  string         `json:"base_workflow_id"`
+	OtherWorkflowID string         `json:"other_workflow_id"`
+	BaseState       *WorkflowState `json:"base_state"`
+	OtherState      *WorkflowState `json:"other_state"`
+	// Diff lists what changed from base to other
+	Diff *StateDiff `json:"diff"`
+}
+
+// CompareBranches diffs the final states of two workflows, typically a
+// workflow and one of its branches or two branches of the same workflow
+func (c *Client) CompareBranches(ctx context.Context, baseWorkflowID, otherWorkflowID string) (*BranchComparison, error) {
+	base, err := c.finalState(ctx, baseWorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	other, err := c.finalState(ctx, otherWorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	return &BranchComparison{
+		BaseWorkflowID:  baseWorkflowID,
+		OtherWorkflowID: otherWorkflowID,
+		BaseState:       base,
+		OtherState:      other,
+		Diff:            Diff(base, other),
+	}, nil
+}
+
+// finalState returns a workflow's latest state from its exported archive,
+// replaying steps journaled after its snapshot
+func (c *Client) finalState(ctx context.Context, workflowID string) (*WorkflowState, error) {
+	archive, err := c.ExportWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return ReplayDeltas(nil, workflowID, archive.Snapshot, archive.Events)
+}
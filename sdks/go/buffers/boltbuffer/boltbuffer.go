@@ -0,0 +1,113 @@
+// Package boltbuffer keeps a Contd offline buffer in a bbolt database.
+// Records are stored under their big-endian sequence number, so reading
+// the bucket in key order yields them in the order they were written.
+package boltbuffer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketName = []byte("contd_buffer")
+
+// Buffer is a contd.LocalBuffer backed by bbolt
+type Buffer struct {
+	db *bolt.DB
+}
+
+var _ contd.LocalBuffer = (*Buffer)(nil)
+
+// Open opens or creates the buffer database at path
+func Open(path string) (*Buffer, error) {
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open buffer: %w", err)
+	}
+	b, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// New uses an open database, creating the buffer's bucket if needed
+func New(db *bolt.DB) (*Buffer, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buffer bucket: %w", err)
+	}
+	return &Buffer{db: db}, nil
+}
+
+// Append stores rec under the bucket's next sequence number
+func (b *Buffer) Append(rec contd.BufferedRecord) (uint64, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		rec.Seq = seq
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key(seq), data)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rec.Seq, nil
+}
+
+// Pending returns up to limit stored records, oldest first
+func (b *Buffer) Pending(limit int) ([]contd.BufferedRecord, error) {
+	var records []contd.BufferedRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var rec contd.BufferedRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return fmt.Errorf("failed to decode record %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			records = append(records, rec)
+			if limit > 0 && len(records) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// Ack deletes every record up to seq
+func (b *Buffer) Ack(seq uint64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= seq; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the database
+func (b *Buffer) Close() error {
+	return b.db.Close()
+}
+
+func key(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,15 @@
+module github.com/bhavdeep98/contd.ai/sdks/go/buffers/boltbuffer
+
+go 1.23
+
+require (
+	github.com/bhavdeep98/contd.ai/sdks/go v0.0.0
+	go.etcd.io/bbolt v1.4.3
+)
+
+require (
+	github.com/google/uuid v1.5.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
+
+replace github.com/bhavdeep98/contd.ai/sdks/go => ../..
@@ -0,0 +1,140 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// DefaultBulkConcurrency is how many requests bulk operations send at once
+const DefaultBulkConcurrency = 10
+
+// BulkInput selects the workflows a bulk operation acts on
+type BulkInput struct {
+	// WorkflowIDs lists the workflows explicitly
+	WorkflowIDs []string
+	// Filter selects every matching workflow when WorkflowIDs is empty
+	Filter *ListWorkflowsInput
+	// Concurrency bounds the requests in flight (defaults to DefaultBulkConcurrency)
+	Concurrency int
+}
+
+// BulkItemResult is the outcome of a bulk operation on one workflow
+type BulkItemResult struct {
+	WorkflowID string `json:"workflow_id"`
+	Status     string `json:"status,omitempty"`
+	Err        error  `json:"-"`
+}
+
+// BulkResult reports the outcome for every selected workflow, in selection order
+type BulkResult struct {
+	Items     []BulkItemResult `json:"items"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
+
+// Err returns an error listing the failed workflows, or nil if all succeeded
+func (r *BulkResult) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	failures := make(map[string]interface{}, r.Failed)
+	for _, item := range r.Items {
+		if item.Err != nil {
+			failures[item.WorkflowID] = item.Err.Error()
+		}
+	}
+	return NewContdError(fmt.Sprintf("%d of %d workflows failed", r.Failed, len(r.Items)), "", failures)
+}
+
+// Retry restarts a failed workflow from its last checkpoint
+func (c *Client) Retry(ctx context.Context, workflowID string) (string, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return "", err
+	}
+
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/retry", workflowID), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Status, nil
+}
+
+// BatchCancel cancels every selected workflow
+func (c *Client) BatchCancel(ctx context.Context, input BulkInput) (*BulkResult, error) {
+	return c.bulk(ctx, input, func(ctx context.Context, workflowID string) (string, error) {
+		if err := c.Cancel(ctx, workflowID); err != nil {
+			return "", err
+		}
+		return string(WorkflowStatusCancelled), nil
+	})
+}
+
+// BatchResume resumes every selected workflow
+func (c *Client) BatchResume(ctx context.Context, input BulkInput) (*BulkResult, error) {
+	return c.bulk(ctx, input, c.Resume)
+}
+
+// BatchRetry retries every selected workflow
+func (c *Client) BatchRetry(ctx context.Context, input BulkInput) (*BulkResult, error) {
+	return c.bulk(ctx, input, c.Retry)
+}
+
+// bulk applies op to every selected workflow with bounded concurrency.
+// It only fails as a whole if the workflows cannot be selected.
+func (c *Client) bulk(ctx context.Context, input BulkInput, op func(ctx context.Context, workflowID string) (string, error)) (*BulkResult, error) {
+	ids := input.WorkflowIDs
+	if len(ids) == 0 && input.Filter != nil {
+		workflows, err := c.ListWorkflowsIterator(ctx, *input.Filter).All()
+		if err != nil {
+			return nil, err
+		}
+		for _, wf := range workflows {
+			ids = append(ids, wf.WorkflowID)
+		}
+	}
+
+	concurrency := input.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBulkConcurrency
+	}
+
+	result := &BulkResult{Items: make([]BulkItemResult, len(ids))}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		result.Items[i].WorkflowID = id
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			result.Items[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(item *BulkItemResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			item.Status, item.Err = op(ctx, item.WorkflowID)
+		}(&result.Items[i])
+	}
+	wg.Wait()
+
+	for _, item := range result.Items {
+		if item.Err != nil {
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+// idempotencyKeyHeader carries a start request's RequestID
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// BusinessKeyIndex is implemented by engines that can map business keys to
+// workflows, so WorkflowConfig.BusinessKey starts at most one workflow
+type BusinessKeyIndex interface {
+	// ClaimBusinessKey maps an org's business key to workflowID unless it is
+	// already mapped, and returns the workflow the key maps to
+	ClaimBusinessKey(orgID, key, workflowID string) (string, error)
+}
+
+// claimBusinessKey returns the workflow for a business key, reporting
+// whether it is a new one
+func claimBusinessKey(engine Engine, orgID, key string) (string, bool, error) {
+	index, ok := engineAs[BusinessKeyIndex](engine)
+	if !ok {
+		return "", false, NewConfigurationError("engine does not support business keys", "business_key")
+	}
+	candidate := newWorkflowID()
+	workflowID, err := index.ClaimBusinessKey(orgID, key, candidate)
+	if err != nil {
+		return "", false, err
+	}
+	return workflowID, workflowID == candidate, nil
+}
+
+// StartWorkflowIfNotExists starts a workflow unless one already exists for
+// businessKey, returning the workflow's ID and whether it was created
+func (c *Client) StartWorkflowIfNotExists(ctx context.Context, businessKey string, input StartWorkflowInput) (string, bool, error) {
+	if businessKey == "" {
+		return "", false, NewConfigurationError("business key is required", "business_key")
+	}
+	config := WorkflowConfig{}
+	if input.Config != nil {
+		config = *input.Config
+	}
+	config.BusinessKey = businessKey
+	input.Config = &config
+
+	result, err := c.startWorkflow(ctx, input)
+	if err != nil {
+		return "", false, err
+	}
+	created := result.Created == nil || *result.Created
+	return result.WorkflowID, created, nil
+}
+
+// retryableRequest reports whether a failed request may be safely resent:
+// it never reached the server, or the server failed transiently
+func retryableRequest(err error) bool {
+	var transport *url.Error
+	return errors.As(err, &transport) || IsRetryable(err)
+}
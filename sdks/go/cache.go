@@ -0,0 +1,141 @@
+package contd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCache keeps GET responses for ClientConfig.CacheTTL. Expired
+// entries with an ETag are revalidated with If-None-Match rather than
+// fetched again.
+type responseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+type cachedResponse struct {
+	body      []byte
+	header    http.Header
+	etag      string
+	fetchedAt time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &responseCache{ttl: ttl, entries: make(map[string]*cachedResponse)}
+}
+
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return entry, time.Since(entry.fetchedAt) < c.ttl
+}
+
+func (c *responseCache) put(key string, entry *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+}
+
+// invalidate drops what a mutating request to path may have changed: the
+// workflow's own responses and every listing, or everything for requests
+// outside a single workflow
+func (c *responseCache) invalidate(orgID, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := orgID + " "
+	workflowPath := ""
+	if id := workflowIDFromPath(path); id != "" {
+		workflowPath = "/v1/workflows/" + id
+	}
+	for key := range c.entries {
+		cached, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if workflowPath == "" || cached == workflowPath || strings.HasPrefix(cached, workflowPath+"/") ||
+			strings.HasPrefix(cached, workflowPath+"?") || !strings.HasPrefix(cached, "/v1/workflows/") {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// clear drops every entry
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*cachedResponse)
+}
+
+func (e *cachedResponse) response() *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     e.header.Clone(),
+		Body:       io.NopCloser(bytes.NewReader(e.body)),
+	}
+}
+
+// cachedGet is doRequest for GETs whose responses may be served from the
+// client's cache
+func (c *Client) cachedGet(ctx context.Context, path string) (*http.Response, error) {
+	if c.cache == nil {
+		return c.doRequest(ctx, "GET", path, nil)
+	}
+	key := c.orgID + " " + path
+	entry, fresh := c.cache.get(key)
+	if fresh {
+		return entry.response(), nil
+	}
+
+	var header http.Header
+	if entry != nil && entry.etag != "" {
+		header = http.Header{"If-None-Match": {entry.etag}}
+	}
+	resp, err := c.doRequestWithHeader(ctx, "GET", path, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		revalidated := *entry
+		revalidated.fetchedAt = time.Now()
+		c.cache.put(key, &revalidated)
+		return revalidated.response(), nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	fetched := &cachedResponse{
+		body:      body,
+		header:    resp.Header.Clone(),
+		etag:      resp.Header.Get("ETag"),
+		fetchedAt: time.Now(),
+	}
+	if resp.StatusCode == http.StatusOK {
+		c.cache.put(key, fetched)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// InvalidateCache drops every cached response
+func (c *Client) InvalidateCache() {
+	if c.cache != nil {
+		c.cache.clear()
+	}
+}
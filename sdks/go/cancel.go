@@ -0,0 +1,179 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stop requests are delivered as signals under these reserved names
+const (
+	cancelSignal    = "_cancel"
+	terminateSignal = "_terminate"
+)
+
+// cancelPollInterval is how often a running workflow checks for a stop
+// request while a step is in flight
+const cancelPollInterval = time.Second
+
+// CancelLocal asks a workflow of a local engine to cancel. The workflow's
+// context is cancelled, so the running step observes it and no further
+// step starts; its compensations then run and it ends cancelled.
+func CancelLocal(engine Engine, workflowID, reason string) error {
+	return SignalLocal(engine, workflowID, cancelSignal, reason)
+}
+
+// TerminateLocal stops a workflow of a local engine like CancelLocal but
+// without running compensations; it ends terminated
+func TerminateLocal(engine Engine, workflowID, reason string) error {
+	return SignalLocal(engine, workflowID, terminateSignal, reason)
+}
+
+// compensation undoes a completed piece of work on cancellation
+type compensation struct {
+	name  string
+	fn    StepFunc
+	input interface{}
+}
+
+// Compensate registers fn to undo work done so far if the workflow is
+// cancelled. Compensations run in reverse registration order, each as a
+// step named "compensate:<name>", so cleanup interrupted by a crash resumes
+// without repeating finished compensations. Register right after the step
+// whose effect fn undoes.
+func Compensate(ctx context.Context, name string, fn StepFunc, input interface{}) error {
+	ec, err := Current(ctx)
+	if err != nil {
+		return err
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.compensations = append(ec.compensations, compensation{name: name, fn: fn, input: input})
+	return nil
+}
+
+// stopRequest returns the pending terminate or cancel request for a
+// workflow, or nil
+func stopRequest(engine Engine, workflowID string) *WorkflowCancelled {
+	store, ok := engineAs[SignalStore](engine)
+	if !ok {
+		return nil
+	}
+	for _, name := range []string{terminateSignal, cancelSignal} {
+		signal, err := store.SignalAt(workflowID, name, 0)
+		if err != nil || signal == nil {
+			continue
+		}
+		reason, _ := signal.Payload.(string)
+		return NewWorkflowCancelled(workflowID, reason, name == terminateSignal)
+	}
+	return nil
+}
+
+// checkStop cancels the workflow's context if it was asked to stop
+func (ec *ExecutionContext) checkStop() {
+	ec.mu.RLock()
+	cancel, engine := ec.cancelRun, ec.engine
+	ec.mu.RUnlock()
+	if cancel == nil {
+		return
+	}
+	if stop := stopRequest(engine, ec.WorkflowID); stop != nil {
+		cancel(stop)
+	}
+}
+
+// watchStop checks for stop requests until the returned func is called
+func (ec *ExecutionContext) watchStop(engine Engine) func() {
+	if _, ok := engineAs[SignalStore](engine); !ok {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ec.checkStop()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// stopped returns the stop request that cancelled ctx, or nil
+func stopped(ctx context.Context) *WorkflowCancelled {
+	var stop *WorkflowCancelled
+	if errors.As(context.Cause(ctx), &stop) {
+		return stop
+	}
+	return nil
+}
+
+// finishStop runs a cancelled workflow's compensations and records how it
+// ended. Cleanup runs under ctx, the caller's context, so a caller giving
+// up leaves the workflow open to resume its cleanup.
+func (r *WorkflowRunner) finishStop(ctx context.Context, ec *ExecutionContext, stop *WorkflowCancelled) error {
+	ec.mu.Lock()
+	compensations := ec.compensations
+	ec.mu.Unlock()
+
+	var failures []error
+	if !stop.Terminated {
+		cleanupCtx := WithContext(ctx, ec)
+		for i := len(compensations) - 1; i >= 0; i-- {
+			c := compensations[i]
+			if _, err := NewStepRunner(DefaultStepConfig()).Run(cleanupCtx, "compensate:"+c.name, c.fn, c.input); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				failures = append(failures, err)
+			}
+		}
+	}
+
+	event, status := "workflow_cancelled", WorkflowStatusCancelled
+	if stop.Terminated {
+		event, status = "workflow_terminated", WorkflowStatusTerminated
+	}
+	if len(failures) > 0 {
+		stop.Cause = errors.Join(failures...)
+		status = WorkflowStatusFailed
+	}
+	fields := map[string]interface{}{"reason": stop.Reason}
+	if !stop.Terminated {
+		fields["compensations"] = len(compensations)
+		fields["compensation_failures"] = len(failures)
+	}
+	appendEvent(r.engine, ec, event, fields)
+	recordStatus(r.engine, ec.WorkflowID, status)
+	notifyLifecycle(r.engine, ec, WebhookWorkflowCancelled, map[string]interface{}{
+		"reason":     stop.Reason,
+		"terminated": stop.Terminated,
+		"status":     string(status),
+	})
+	fmt.Printf("Workflow %s %s: %s\n", ec.WorkflowID, status, stop.Reason)
+	return stop
+}
+
+// Terminate stops a workflow without running its compensations
+func (c *Client) Terminate(ctx context.Context, workflowID, reason string) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{"reason": reason})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/terminate", workflowID), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
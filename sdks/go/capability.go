@@ -0,0 +1,162 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// missingCapabilities returns the required capabilities not in have
+func missingCapabilities(required, have []string) []string {
+	var missing []string
+	for _, need := range required {
+		found := false
+		for _, c := range have {
+			if c == need {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, need)
+		}
+	}
+	return missing
+}
+
+// unionCapabilities returns a followed by the capabilities of b not in a
+func unionCapabilities(a, b []string) []string {
+	union := append([]string(nil), a...)
+	return append(union, missingCapabilities(b, a)...)
+}
+
+// SetCapabilities declares what this worker offers, e.g. "gpu",
+// "large-memory" or "region:eu-west-1". Workflows and steps whose Requires
+// lists anything else fail with NoCapableWorker.
+func (r *WorkflowRunner) SetCapabilities(capabilities ...string) {
+	r.capabilities = capabilities
+}
+
+// Dispatcher routes workflows across worker pools by task queue and
+// capability. A workflow goes to the least loaded pool serving its
+// TaskQueue and offering everything its Requires lists. When a step needs
+// a capability the pool lacks, the workflow is checkpointed and resumed on
+// a pool that has it.
+type Dispatcher struct {
+	pools []*WorkerPool
+
+	mu      sync.RWMutex
+	rollout *Rollout
+}
+
+// NewDispatcher creates a dispatcher over pools
+func NewDispatcher(pools ...*WorkerPool) *Dispatcher {
+	return &Dispatcher{pools: pools}
+}
+
+// pick returns the least loaded pool serving queue and offering required.
+// If none does, it returns the capabilities missing from the closest pool.
+func (d *Dispatcher) pick(queue string, required []string) (*WorkerPool, []string) {
+	var best *WorkerPool
+	bestLoad := 0
+	missing := required
+	for _, pool := range d.pools {
+		if !subscribed(pool.config.TaskQueues, queue) {
+			continue
+		}
+		lacks := missingCapabilities(required, pool.config.Capabilities)
+		if len(lacks) > 0 {
+			if len(lacks) < len(missing) {
+				missing = lacks
+			}
+			continue
+		}
+		if load := pool.load(); best == nil || load < bestLoad {
+			best, bestLoad = pool, load
+		}
+	}
+	if best == nil {
+		return nil, missing
+	}
+	return best, nil
+}
+
+// serves reports whether any pool serves queue
+func (d *Dispatcher) serves(queue string) bool {
+	for _, pool := range d.pools {
+		if subscribed(pool.config.TaskQueues, queue) {
+			return true
+		}
+	}
+	return false
+}
+
+// Submit queues a workflow on a capable pool serving its task queue,
+// failing with a ConfigurationError if no pool serves the queue and with
+// NoCapableWorker if none of those is capable. A workflow without a
+// WorkflowID is given one so it can move between pools. ctx also bounds how
+// long a move waits for queue space.
+func (d *Dispatcher) Submit(ctx context.Context, job WorkflowJob) (*JobHandle, error) {
+	if job.Config.WorkflowID == "" {
+		job.Config.WorkflowID = newWorkflowID()
+	}
+	d.mu.RLock()
+	rollout := d.rollout
+	d.mu.RUnlock()
+	job.Config = rollout.route(job.WorkflowName, job.Config.WorkflowID, job.Config)
+	queue := taskQueue(job.Config)
+	if !d.serves(queue) {
+		return nil, notSubscribed(queue)
+	}
+	pool, missing := d.pick(queue, job.Config.Requires)
+	if pool == nil {
+		return nil, NewNoCapableWorker(job.Config.WorkflowID, "", job.Config.Requires, missing)
+	}
+	inner, err := pool.Submit(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := &JobHandle{WorkflowName: job.WorkflowName, done: make(chan struct{})}
+	go func() {
+		for {
+			<-inner.Done()
+			var needs *NoCapableWorker
+			if !errors.As(inner.err, &needs) || needs.StepName == "" {
+				handle.finish(inner.result, inner.err)
+				return
+			}
+			required := unionCapabilities(job.Config.Requires, needs.Required)
+			next, missing := d.pick(queue, required)
+			if next == nil {
+				handle.finish(nil, NewNoCapableWorker(job.Config.WorkflowID, needs.StepName, required, missing))
+				return
+			}
+			if inner, err = next.Submit(ctx, job); err != nil {
+				handle.finish(nil, err)
+				return
+			}
+		}
+	}()
+	return handle, nil
+}
+
+// Shutdown shuts down every pool, returning the first error
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	errs := make([]error, len(d.pools))
+	var wg sync.WaitGroup
+	for i, pool := range d.pools {
+		wg.Add(1)
+		go func(i int, pool *WorkerPool) {
+			defer wg.Done()
+			errs[i] = pool.Shutdown(ctx)
+		}(i, pool)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package contd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a circuit
+type CircuitState string
+
+const (
+	CircuitStateClosed   CircuitState = "closed"
+	CircuitStateOpen     CircuitState = "open"
+	CircuitStateHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerConfig configures when circuits open and recover
+type CircuitBreakerConfig struct {
+	// Window is how many recent outcomes are considered
+	Window int
+	// MinRequests is the minimum number of outcomes before the circuit can open
+	MinRequests int
+	// FailureRate opens the circuit when failures/outcomes reaches it
+	FailureRate float64
+	// Cooldown is how long the circuit stays open before a half-open trial
+	Cooldown time.Duration
+}
+
+// DefaultCircuitBreakerConfig returns a sensible default breaker config
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Window:      10,
+		MinRequests: 5,
+		FailureRate: 0.5,
+		Cooldown:    30 * time.Second,
+	}
+}
+
+// CircuitSnapshot is the persisted state of one circuit
+type CircuitSnapshot struct {
+	Name     string       `json:"name"`
+	State    CircuitState `json:"state"`
+	Outcomes []bool       `json:"outcomes"`
+	OpenedAt time.Time    `json:"opened_at,omitempty"`
+}
+
+// CircuitStore persists circuit state so it survives worker restarts.
+// Circuits are saved when their state changes, not on every outcome.
+type CircuitStore interface {
+	LoadCircuits() ([]CircuitSnapshot, error)
+	SaveCircuit(snapshot CircuitSnapshot) error
+}
+
+// CircuitBreaker tracks failure rates per step name and short-circuits
+// steps whose circuit is open. One breaker may be shared by many steps.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	config   CircuitBreakerConfig
+	store    CircuitStore
+	circuits map[string]*CircuitSnapshot
+	trials   map[string]bool
+}
+
+// NewCircuitBreaker creates a breaker, loading persisted circuits from store
+// when one is given
+func NewCircuitBreaker(config CircuitBreakerConfig, store CircuitStore) (*CircuitBreaker, error) {
+	defaults := DefaultCircuitBreakerConfig()
+	if config.Window <= 0 {
+		config.Window = defaults.Window
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = defaults.MinRequests
+	}
+	if config.FailureRate <= 0 {
+		config.FailureRate = defaults.FailureRate
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = defaults.Cooldown
+	}
+
+	cb := &CircuitBreaker{
+		config:   config,
+		store:    store,
+		circuits: make(map[string]*CircuitSnapshot),
+		trials:   make(map[string]bool),
+	}
+	if store != nil {
+		snapshots, err := store.LoadCircuits()
+		if err != nil {
+			return nil, err
+		}
+		for i := range snapshots {
+			snapshot := snapshots[i]
+			cb.circuits[snapshot.Name] = &snapshot
+		}
+	}
+	return cb, nil
+}
+
+// State returns the current state of a step's circuit
+func (cb *CircuitBreaker) State(name string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.circuit(name).State
+}
+
+// Allow reports whether a step may execute. It returns a *CircuitOpen
+// while the circuit is open, and admits a single trial once the cooldown
+// has elapsed.
+func (cb *CircuitBreaker) Allow(workflowID, stepID, name string) error {
+	_, err := cb.allow(workflowID, stepID, name)
+	return err
+}
+
+// allow is Allow, also reporting whether the call was admitted as the
+// half-open trial
+func (cb *CircuitBreaker) allow(workflowID, stepID, name string) (bool, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuit(name)
+	switch c.State {
+	case CircuitStateOpen:
+		retryAt := c.OpenedAt.Add(cb.config.Cooldown)
+		if time.Now().Before(retryAt) {
+			return false, NewCircuitOpen(workflowID, stepID, name, retryAt)
+		}
+		c.State = CircuitStateHalfOpen
+		cb.trials[name] = true
+		cb.persist(c)
+		return true, nil
+	case CircuitStateHalfOpen:
+		if cb.trials[name] {
+			return false, NewCircuitOpen(workflowID, stepID, name, time.Now().Add(cb.config.Cooldown))
+		}
+		cb.trials[name] = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// release frees a half-open trial admitted by allow whose step stopped
+// before its outcome was recorded, so the next call may try instead
+func (cb *CircuitBreaker) release(name string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.trials, name)
+}
+
+// Record records the outcome of a step execution
+func (cb *CircuitBreaker) Record(name string, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuit(name)
+	if c.State == CircuitStateHalfOpen {
+		delete(cb.trials, name)
+		if success {
+			c.State = CircuitStateClosed
+			c.Outcomes = nil
+			c.OpenedAt = time.Time{}
+		} else {
+			c.State = CircuitStateOpen
+			c.OpenedAt = time.Now()
+		}
+		cb.persist(c)
+		return
+	}
+
+	c.Outcomes = append(c.Outcomes, success)
+	if len(c.Outcomes) > cb.config.Window {
+		c.Outcomes = c.Outcomes[len(c.Outcomes)-cb.config.Window:]
+	}
+	if c.State == CircuitStateClosed && len(c.Outcomes) >= cb.config.MinRequests {
+		failures := 0
+		for _, ok := range c.Outcomes {
+			if !ok {
+				failures++
+			}
+		}
+		if float64(failures)/float64(len(c.Outcomes)) >= cb.config.FailureRate {
+			c.State = CircuitStateOpen
+			c.OpenedAt = time.Now()
+			fmt.Printf("Circuit for step %s opened (%d/%d failures)\n", name, failures, len(c.Outcomes))
+			cb.persist(c)
+		}
+	}
+}
+
+// Reset closes a step's circuit and clears its history
+func (cb *CircuitBreaker) Reset(name string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := &CircuitSnapshot{Name: name, State: CircuitStateClosed}
+	cb.circuits[name] = c
+	delete(cb.trials, name)
+	cb.persist(c)
+}
+
+func (cb *CircuitBreaker) circuit(name string) *CircuitSnapshot {
+	c, ok := cb.circuits[name]
+	if !ok {
+		c = &CircuitSnapshot{Name: name, State: CircuitStateClosed}
+		cb.circuits[name] = c
+	}
+	return c
+}
+
+func (cb *CircuitBreaker) persist(c *CircuitSnapshot) {
+	if cb.store == nil {
+		return
+	}
+	snapshot := *c
+	snapshot.Outcomes = append([]bool(nil), c.Outcomes...)
+	if err := cb.store.SaveCircuit(snapshot); err != nil {
+		fmt.Printf("Failed to persist circuit %s: %v\n", c.Name, err)
+	}
+}
+
+// FileCircuitStore persists circuits as JSON in a local file
+type FileCircuitStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileCircuitStore creates a store backed by the file at path
+func NewFileCircuitStore(path string) *FileCircuitStore {
+	return &FileCircuitStore{path: path}
+}
+
+// LoadCircuits reads all persisted circuits
+func (s *FileCircuitStore) LoadCircuits() ([]CircuitSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	circuits, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]CircuitSnapshot, 0, len(circuits))
+	for _, c := range circuits {
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// SaveCircuit writes one circuit
+func (s *FileCircuitStore) SaveCircuit(snapshot CircuitSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	circuits, err := s.read()
+	if err != nil {
+		return err
+	}
+	circuits[snapshot.Name] = snapshot
+
+	data, err := json.Marshal(circuits)
+	if err != nil {
+		return fmt.Errorf("failed to marshal circuits: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FileCircuitStore) read() (map[string]CircuitSnapshot, error) {
+	circuits := make(map[string]CircuitSnapshot)
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return circuits, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &circuits); err != nil {
+		return nil, fmt.Errorf("failed to decode circuits: %w", err)
+	}
+	return circuits, nil
+}
@@ -9,25 +9,95 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // ClientConfig configures the Contd client
 type ClientConfig struct {
-	APIKey  string
+	APIKey string
+	// Auth authenticates requests in place of APIKey, e.g. with OAuth2,
+	// SigV4 or a client certificate
+	Auth    AuthProvider
 	BaseURL string
 	Timeout time.Duration
 	Retries int
+	// Registry supplies input schemas for StartWorkflow (defaults to GlobalRegistry)
+	Registry *Registry
+	// OrgID scopes every request to one org
+	OrgID string
+	// OrgAPIKeys maps org IDs to the API keys used by ForOrg
+	OrgAPIKeys map[string]string
+	// OrgQuotas limits the request rate of each org
+	OrgQuotas map[string]OrgQuota
+	// RateLimit limits the request rate of each API key the client uses,
+	// including the OrgAPIKeys of clients derived with ForOrg
+	RateLimit *ClientRateLimit
+	// Codec decodes typed results (defaults to DefaultCodec)
+	Codec Codec
+	// HTTPClient replaces the default HTTP client; Timeout is then ignored
+	HTTPClient *http.Client
+	// Transport replaces the HTTP client's transport, e.g. for proxies or mTLS
+	Transport http.RoundTripper
+	// Connections tunes connection pooling, keep-alive and HTTP/2 of the
+	// default transport, which is sized for high-throughput workers
+	Connections ConnectionConfig
+	// RequestHooks run in order on every request before it is sent
+	RequestHooks []RequestHook
+	// ResponseHooks run in order after every request completes or fails
+	ResponseHooks []ResponseHook
+	// Redactor masks request bodies before they are sent
+	Redactor Redactor
+	// Rollout splits starts without a TaskQueue across workflow versions
+	Rollout *Rollout
+	// CacheTTL caches GetStatus and ListWorkflows responses for read-heavy
+	// callers such as dashboards; expired entries are revalidated with their
+	// ETag. Mutating calls invalidate what they affect. Zero disables it.
+	CacheTTL time.Duration
+	// Consistency is the default consistency of GetStatus and ListWorkflows
+	// (defaults to ConsistencyEventual)
+	Consistency Consistency
+	// ReadYourWritesWindow is how long ConsistencyReadYourWrites reads a
+	// written workflow strongly (defaults to DefaultReadYourWritesWindow)
+	ReadYourWritesWindow time.Duration
 }
 
+// RequestHook inspects or modifies a request before it is sent, e.g. to
+// sign it or add headers. Returning an error aborts the request.
+type RequestHook func(req *http.Request) error
+
+// ResponseHook observes a completed request. resp is nil when err is set.
+// Hooks must not read or close resp.Body.
+type ResponseHook func(req *http.Request, resp *http.Response, err error)
+
 // Client is the HTTP client for remote workflow execution
 type Client struct {
-	apiKey     string
+	auth       AuthProvider
 	baseURL    string
 	httpClient *http.Client
 	retries    int
+	registry   *Registry
+	orgID      string
+	orgKeys    map[string]string
+	quotas     map[string]*TokenBucket
+	keyLimits  *keyLimiter
+	codec      Codec
+
+	requestHooks  []RequestHook
+	responseHooks []ResponseHook
+	redactor      Redactor
+	rollout       *Rollout
+	cache         *responseCache
+	consistency   Consistency
+	writes        *recentWrites
+	// setupErr is why the config couldn't be honored; every request fails
+	// with it
+	setupErr error
 }
 
-// NewClient creates a new Contd client
+// NewClient creates a new Contd client. When the config can't be honored,
+// such as client certificate auth over a custom transport, every request
+// the client makes fails with the reason.
 func NewClient(config ClientConfig) *Client {
 	baseURL := config.BaseURL
 	if baseURL == "" {
@@ -44,14 +114,64 @@ func NewClient(config ClientConfig) *Client {
 		retries = 3
 	}
 
-	return &Client{
-		apiKey:  config.APIKey,
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
-		retries: retries,
+	registry := config.Registry
+	if registry == nil {
+		registry = GlobalRegistry
+	}
+
+	codec := config.Codec
+	if codec == nil {
+		codec = DefaultCodec
+	}
+
+	quotas := make(map[string]*TokenBucket, len(config.OrgQuotas))
+	for orgID, quota := range config.OrgQuotas {
+		quotas[orgID] = NewTokenBucket(quota.RequestsPerSecond, quota.Burst)
+	}
+
+	httpClient := &http.Client{Timeout: timeout}
+	if config.HTTPClient != nil {
+		copied := *config.HTTPClient
+		httpClient = &copied
 	}
+	if config.Transport != nil {
+		httpClient.Transport = config.Transport
+	} else if httpClient.Transport == nil {
+		httpClient.Transport = newTransport(config.Connections)
+	}
+
+	auth := config.Auth
+	if auth == nil {
+		auth = APIKeyAuth(config.APIKey)
+	}
+	var setupErr error
+	if provider, ok := auth.(TLSAuthProvider); ok {
+		httpClient.Transport, setupErr = withClientTLS(httpClient.Transport, provider)
+	}
+
+	c := &Client{
+		auth:          auth,
+		baseURL:       baseURL,
+		httpClient:    httpClient,
+		retries:       retries,
+		registry:      registry,
+		orgKeys:       config.OrgAPIKeys,
+		quotas:        quotas,
+		keyLimits:     newKeyLimiter(config.RateLimit),
+		codec:         codec,
+		requestHooks:  config.RequestHooks,
+		redactor:      config.Redactor,
+		rollout:       config.Rollout,
+		responseHooks: config.ResponseHooks,
+		cache:         newResponseCache(config.CacheTTL),
+		consistency:   config.Consistency,
+		writes:        newRecentWrites(config.ReadYourWritesWindow),
+		setupErr:      setupErr,
+	}
+	if config.OrgID != "" {
+		return c.ForOrg(config.OrgID)
+	}
+	return c
 }
 
 // StartWorkflowInput contains parameters for starting a workflow
@@ -59,49 +179,126 @@ type StartWorkflowInput struct {
 	WorkflowName string                 `json:"workflow_name"`
 	Input        map[string]interface{} `json:"input"`
 	Config       *WorkflowConfig        `json:"config,omitempty"`
+	// RequestID deduplicates the request, so a retried start never creates
+	// a second workflow. It is sent as the Idempotency-Key header and is
+	// generated when empty.
+	RequestID string `json:"request_id,omitempty"`
+	// StartDelay or StartAt enqueue the workflow now but start it later.
+	// Cancel stops it from starting until then.
+	StartDelay time.Duration `json:"start_delay,omitempty"`
+	StartAt    *time.Time    `json:"start_at,omitempty"`
+	// TaskQueue routes the workflow to workers subscribed to the queue,
+	// overriding Config.TaskQueue
+	TaskQueue string `json:"task_queue,omitempty"`
+	// Memo annotates the workflow without indexing, overriding Config.Memo
+	Memo map[string]interface{} `json:"memo,omitempty"`
 }
 
-// StartWorkflow starts a new workflow and returns the workflow ID
+// StartWorkflow starts a new workflow and returns the workflow ID. Network
+// failures and transient server errors are retried with the same RequestID.
 func (c *Client) StartWorkflow(ctx context.Context, input StartWorkflowInput) (string, error) {
-	body, err := json.Marshal(input)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal input: %w", err)
-	}
-
-	resp, err := c.doRequest(ctx, "POST", "/v1/workflows", body)
+	result, err := c.startWorkflow(ctx, input)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		WorkflowID string `json:"workflow_id"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
 	return result.WorkflowID, nil
 }
 
-// GetStatus retrieves the status of a workflow
-func (c *Client) GetStatus(ctx context.Context, workflowID string) (*WorkflowStatusResponse, error) {
-	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/workflows/%s", workflowID), nil)
-	if err != nil {
+// startWorkflowResult is the server's reply to a start request
+type startWorkflowResult struct {
+	WorkflowID string `json:"workflow_id"`
+	// Created is false when an existing workflow was returned
+	Created *bool `json:"created,omitempty"`
+}
+
+func (c *Client) startWorkflow(ctx context.Context, input StartWorkflowInput) (*startWorkflowResult, error) {
+	if err := c.registry.ValidateInput(input.WorkflowName, input.Input); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	start := StartOptions{Delay: input.StartDelay}
+	if input.StartAt != nil {
+		start.At = *input.StartAt
+	}
+	if _, err := start.startTime(time.Now()); err != nil {
+		return nil, err
+	}
+	if input.Config == nil {
+		input.Config = c.registry.defaultConfig(input.WorkflowName)
+	}
+	if c.orgID != "" {
+		config := WorkflowConfig{}
+		if input.Config != nil {
+			config = *input.Config
+		}
+		if config.OrgID != "" && config.OrgID != c.orgID {
+			return nil, NewOrgMismatch(config.WorkflowID, c.orgID, config.OrgID)
+		}
+		config.OrgID = c.orgID
+		input.Config = &config
+	}
+	if input.RequestID == "" {
+		input.RequestID = uuid.New().String()
+	}
+	if input.TaskQueue == "" && c.rollout != nil {
+		config := WorkflowConfig{}
+		if input.Config != nil {
+			config = *input.Config
+		}
+		if routed := c.rollout.route(input.WorkflowName, input.RequestID, config); routed.TaskQueue != "" {
+			input.Config = &routed
+		}
+	}
+	if input.TaskQueue == "" && input.Config != nil {
+		input.TaskQueue = input.Config.TaskQueue
+	}
+	if input.Memo == nil && input.Config != nil {
+		input.Memo = input.Config.Memo
+	}
 
-	var result WorkflowStatusResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	body, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+	header := http.Header{idempotencyKeyHeader: {input.RequestID}}
+
+	policy := DefaultRetryPolicy()
+	for attempt := 1; ; attempt++ {
+		resp, err := c.doRequestWithHeader(ctx, "POST", "/v1/workflows", body, header)
+		if err != nil {
+			if attempt > c.retries || !retryableRequest(err) {
+				return nil, err
+			}
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(retryDelay(err, policy.Backoff(attempt))):
+			}
+			continue
+		}
+
+		var result startWorkflowResult
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		c.writes.record(result.WorkflowID)
+		return &result, nil
 	}
+}
 
-	return &result, nil
+// GetStatus retrieves the status of a workflow at the client's default
+// consistency
+func (c *Client) GetStatus(ctx context.Context, workflowID string) (*WorkflowStatusResponse, error) {
+	return c.GetStatusWithConsistency(ctx, workflowID, ConsistencyDefault)
 }
 
 // Resume resumes an interrupted workflow
 func (c *Client) Resume(ctx context.Context, workflowID string) (string, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return "", err
+	}
+
 	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/resume", workflowID), nil)
 	if err != nil {
 		return "", err
@@ -120,6 +317,9 @@ func (c *Client) Resume(ctx context.Context, workflowID string) (string, error)
 
 // Cancel cancels a running workflow
 func (c *Client) Cancel(ctx context.Context, workflowID string) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
 	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/cancel", workflowID), nil)
 	if err != nil {
 		return err
@@ -130,6 +330,9 @@ func (c *Client) Cancel(ctx context.Context, workflowID string) error {
 
 // GetSavepoints retrieves all savepoints for a workflow
 func (c *Client) GetSavepoints(ctx context.Context, workflowID string) ([]SavepointInfo, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
 	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/workflows/%s/savepoints", workflowID), nil)
 	if err != nil {
 		return nil, err
@@ -148,6 +351,10 @@ func (c *Client) GetSavepoints(ctx context.Context, workflowID string) ([]Savepo
 
 // TimeTravel restores a workflow to a specific savepoint
 func (c *Client) TimeTravel(ctx context.Context, workflowID, savepointID string) (string, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return "", err
+	}
+
 	body, err := json.Marshal(map[string]string{"savepoint_id": savepointID})
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal input: %w", err)
@@ -169,6 +376,55 @@ func (c *Client) TimeTravel(ctx context.Context, workflowID, savepointID string)
 	return result.NewWorkflowID, nil
 }
 
+// Annotate attaches an operator note to a workflow's journal
+func (c *Client) Annotate(ctx context.Context, workflowID string, annotation Annotation) (*Annotation, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+	if annotation.Text == "" {
+		return nil, NewConfigurationError("annotation text is required", "text")
+	}
+
+	body, err := json.Marshal(annotation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/annotations", workflowID), body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result Annotation
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GetAnnotations retrieves all operator notes for a workflow
+func (c *Client) GetAnnotations(ctx context.Context, workflowID string) ([]Annotation, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/workflows/%s/annotations", workflowID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Annotations []Annotation `json:"annotations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Annotations, nil
+}
+
 // Health performs a health check
 func (c *Client) Health(ctx context.Context) (*HealthCheck, error) {
 	resp, err := c.doRequest(ctx, "GET", "/health", nil)
@@ -189,14 +445,26 @@ func (c *Client) Health(ctx context.Context) (*HealthCheck, error) {
 type ListWorkflowsInput struct {
 	Status string
 	Tags   map[string]string
-	Limit  int
-	Offset int
+	// TagMode combines Tags with AND (default) or OR
+	TagMode TagMatchMode
+	Limit   int
+	Offset  int
+	// Cursor continues from a previous page's NextCursor; Offset is ignored
+	Cursor string
+	// Query filters on search attributes, e.g. `cost > 10 && model = "gpt-4"`.
+	// SearchCondition builds queries with correctly quoted values.
+	Query string
+	// Consistency overrides the client's default consistency
+	Consistency Consistency
 }
 
 // ListWorkflowsOutput contains the result of listing workflows
 type ListWorkflowsOutput struct {
 	Workflows []WorkflowStatusResponse `json:"workflows"`
 	Total     int                      `json:"total"`
+	// NextCursor fetches the following page; empty on the last page or
+	// when the server paginates by offset
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // ListWorkflows lists workflows with optional filters
@@ -208,19 +476,27 @@ func (c *Client) ListWorkflows(ctx context.Context, input ListWorkflowsInput) (*
 	if input.Limit > 0 {
 		params.Set("limit", fmt.Sprintf("%d", input.Limit))
 	}
-	if input.Offset > 0 {
+	if input.Cursor != "" {
+		params.Set("cursor", input.Cursor)
+	} else if input.Offset > 0 {
 		params.Set("offset", fmt.Sprintf("%d", input.Offset))
 	}
 	for k, v := range input.Tags {
 		params.Set(fmt.Sprintf("tag.%s", k), v)
 	}
+	if input.TagMode != "" && len(input.Tags) > 0 {
+		params.Set("tag_mode", string(input.TagMode))
+	}
+	if input.Query != "" {
+		params.Set("query", input.Query)
+	}
 
 	path := "/v1/workflows"
 	if len(params) > 0 {
 		path += "?" + params.Encode()
 	}
 
-	resp, err := c.doRequest(ctx, "GET", path, nil)
+	resp, err := c.readGet(ctx, path, c.resolveConsistency(input.Consistency, ""))
 	if err != nil {
 		return nil, err
 	}
@@ -235,6 +511,48 @@ func (c *Client) ListWorkflows(ctx context.Context, input ListWorkflowsInput) (*
 }
 
 func (c *Client) doRequest(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	return c.doRequestWithHeader(ctx, method, path, body, nil)
+}
+
+// doRequestWithHeader is doRequest with extra request headers
+func (c *Client) doRequestWithHeader(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	body = redactBody(c.redactor, body)
+	resp, err := c.send(ctx, method, path, body, header)
+	if method != "GET" {
+		c.writes.record(workflowIDFromPath(path))
+		if c.cache != nil {
+			c.cache.invalidate(c.orgID, path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		// Stale credentials are refreshed and the request retried once
+		if refresher, ok := c.auth.(AuthRefresher); ok {
+			resp.Body.Close()
+			refresher.Invalidate()
+			resp, err = c.send(ctx, method, path, body, header)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, c.handleError(resp)
+	}
+
+	return resp, nil
+}
+
+// send makes a single authenticated request
+func (c *Client) send(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	if c.setupErr != nil {
+		return nil, c.setupErr
+	}
 	var bodyReader io.Reader
 	if body != nil {
 		bodyReader = bytes.NewReader(body)
@@ -245,30 +563,48 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body []byte
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.orgID != "" {
+		req.Header.Set(orgHeader, c.orgID)
+	}
+	if err := c.throttle(ctx); err != nil {
+		return nil, err
+	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if err := c.auth.Authenticate(req); err != nil {
+		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
-	if resp.StatusCode >= 400 {
-		defer resp.Body.Close()
-		return nil, c.handleError(resp)
+	for _, hook := range c.requestHooks {
+		if err := hook(req); err != nil {
+			return nil, fmt.Errorf("request hook failed: %w", err)
+		}
 	}
 
+	resp, err := c.httpClient.Do(req)
+	for _, hook := range c.responseHooks {
+		hook(req, resp, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
 	return resp, nil
 }
 
 func (c *Client) handleError(resp *http.Response) error {
 	body, _ := io.ReadAll(resp.Body)
 
-	var errResp struct {
-		Message    string `json:"message"`
-		WorkflowID string `json:"workflow_id"`
-	}
+	var errResp WireError
 	json.Unmarshal(body, &errResp)
+	if errResp.Code == CodeRateLimited || (errResp.Code == "" && resp.StatusCode == http.StatusTooManyRequests) {
+		return rateLimitedFromResponse(resp, &errResp)
+	}
+	if errResp.Code != "" {
+		return DecodeError(&errResp)
+	}
 
 	message := errResp.Message
 	if message == "" {
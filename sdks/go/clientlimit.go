@@ -0,0 +1,121 @@
+package contd
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rate-limit response headers the server sends with throttled requests
+const (
+	retryAfterHeader         = "Retry-After"
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// ClientRateLimit throttles a client's requests before they are sent, so a
+// busy worker stays under the server's limits instead of being rejected
+type ClientRateLimit struct {
+	// RequestsPerSecond of zero or less disables the limit
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// keyLimiter holds a token bucket per API key, shared by a client and the
+// clients ForOrg derives from it
+type keyLimiter struct {
+	limit   ClientRateLimit
+	mu      sync.Mutex
+	buckets map[string]*TokenBucket
+}
+
+func newKeyLimiter(limit *ClientRateLimit) *keyLimiter {
+	if limit == nil || limit.RequestsPerSecond <= 0 {
+		return nil
+	}
+	return &keyLimiter{limit: *limit, buckets: make(map[string]*TokenBucket)}
+}
+
+// wait blocks until the request budget of key allows another request
+func (l *keyLimiter) wait(ctx context.Context, key string) error {
+	l.mu.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewTokenBucket(l.limit.RequestsPerSecond, l.limit.Burst)
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+	_, err := bucket.Wait(ctx)
+	return err
+}
+
+// throttle waits for the client's org quota and API key rate limit
+func (c *Client) throttle(ctx context.Context) error {
+	if c.orgID != "" {
+		if quota, ok := c.quotas[c.orgID]; ok {
+			if _, err := quota.Wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	if c.keyLimits != nil {
+		// Clients authenticating otherwise than with an API key share one budget
+		key, _ := c.auth.(APIKeyAuth)
+		if err := c.keyLimits.wait(ctx, string(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rateLimitedFromResponse builds the RateLimited error of a throttled
+// response from its rate-limit headers, falling back to the retry delay in
+// the error body
+func rateLimitedFromResponse(resp *http.Response, w *WireError) *RateLimited {
+	now := time.Now()
+	err := NewRateLimited(w.Message, w.WorkflowID, parseRetryAfter(resp.Header.Get(retryAfterHeader), now))
+	if err.RetryAfter == 0 {
+		err.RetryAfter = time.Duration(getFloat(w.Details, "retry_after_ms")) * time.Millisecond
+	}
+	err.Limit = headerInt(resp.Header, rateLimitLimitHeader)
+	err.Remaining = headerInt(resp.Header, rateLimitRemainingHeader)
+	if reset := headerInt(resp.Header, rateLimitResetHeader); reset > 0 {
+		// Small values are seconds from now, large ones a Unix time
+		if reset < 1e9 {
+			err.Reset = now.Add(time.Duration(reset) * time.Second)
+		} else {
+			err.Reset = time.Unix(int64(reset), 0)
+		}
+		if err.RetryAfter == 0 {
+			err.RetryAfter = time.Until(err.Reset)
+		}
+	}
+	if err.RetryAfter < 0 {
+		err.RetryAfter = 0
+	}
+	err.Details["retry_after_ms"] = err.RetryAfter.Milliseconds()
+	return err
+}
+
+// parseRetryAfter parses a Retry-After header, given in seconds or as an
+// HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+func headerInt(header http.Header, name string) int {
+	n, _ := strconv.Atoi(header.Get(name))
+	return n
+}
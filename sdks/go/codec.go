@@ -0,0 +1,62 @@
+package contd
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Codec serializes workflow and step payloads
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes payloads as JSON
+type JSONCodec struct{}
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// DefaultCodec is used when no codec is configured
+var DefaultCodec Codec = JSONCodec{}
+
+// convert re-encodes a generic value into the typed value out
+func convert(codec Codec, value interface{}, out interface{}) error {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value: %w", err)
+	}
+	if err := codec.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode value: %w", err)
+	}
+	return nil
+}
+
+// Decode decodes the workflow's result into v
+func (r *WorkflowResult) Decode(v interface{}) error {
+	return convert(r.codec, r.Result, v)
+}
+
+// Get decodes one field of the workflow's result into v
+func (r *WorkflowResult) Get(key string, v interface{}) error {
+	value, ok := r.Result[key]
+	if !ok {
+		return fmt.Errorf("result has no field %q", key)
+	}
+	return convert(r.codec, value, v)
+}
+
+// Decode decodes the step's result into v
+func (r *StepResult) Decode(v interface{}) error {
+	return convert(r.codec, r.Result, v)
+}
@@ -0,0 +1,179 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// CompactableEvents are the step events compaction folds into a snapshot
+// once their step has completed. Savepoints and workflow-level events are
+// always kept.
+var CompactableEvents = []string{
+	"step_intention",
+	"step_completed",
+	"step_failed",
+	"step_throttled",
+	"step_concurrency_waited",
+	"step_short_circuited",
+}
+
+// CompactionResult describes a workflow's compaction
+type CompactionResult struct {
+	// EventsDeleted counts the journal events folded into the snapshot
+	EventsDeleted int `json:"events_deleted"`
+	// StepNumber is the last step the snapshot includes
+	StepNumber int `json:"step_number"`
+}
+
+// Compactor is implemented by engines that can fold a workflow's completed
+// steps into its snapshot and drop their journal events
+type Compactor interface {
+	// Compact compacts the workflow; it is safe while the workflow runs
+	Compact(workflowID string) (CompactionResult, error)
+}
+
+// CompactEvents folds the completed steps journaled in events over base
+// and returns the resulting state with the events that remain once those
+// steps' events are dropped. A base failing its checksum is rejected.
+// Engines implementing Compactor can use it over their journal. Offloaded
+// deltas are loaded from engine's artifact store.
+func CompactEvents(engine Engine, workflowID string, base *WorkflowState, events []map[string]interface{}) (*WorkflowState, []map[string]interface{}, error) {
+	state, dropped, err := compactEvents(engine, workflowID, base, events)
+	if err != nil {
+		return nil, nil, err
+	}
+	kept := make([]map[string]interface{}, 0, len(events)-len(dropped))
+	for i, event := range events {
+		if !dropped[i] {
+			kept = append(kept, event)
+		}
+	}
+	return state, kept, nil
+}
+
+// compactEvents is CompactEvents returning the indexes of the dropped
+// events instead of the kept ones
+func compactEvents(engine Engine, workflowID string, base *WorkflowState, events []map[string]interface{}) (*WorkflowState, map[int]bool, error) {
+	// Steps compacted earlier live only in the snapshot, so a corrupt one
+	// cannot be rebuilt from the journal
+	if base != nil {
+		if err := verifyChecksum(base, "snapshot"); err != nil {
+			return nil, nil, err
+		}
+	}
+	state, err := ReplayDeltas(engine, workflowID, base, events)
+	if err != nil {
+		return nil, nil, err
+	}
+	completed := make(map[string]bool)
+	for _, event := range events {
+		if getString(event, "workflow_id") == workflowID && getString(event, "event_type") == "step_completed" {
+			completed[getString(event, "step_id")] = true
+		}
+	}
+	compactable := make(map[string]bool, len(CompactableEvents))
+	for _, eventType := range CompactableEvents {
+		compactable[eventType] = true
+	}
+	dropped := make(map[int]bool)
+	for i, event := range events {
+		if getString(event, "workflow_id") == workflowID && compactable[getString(event, "event_type")] && completed[getString(event, "step_id")] {
+			dropped[i] = true
+		}
+	}
+	return state, dropped, nil
+}
+
+// droppedEventIDs returns the IDs of the dropped events, which engines
+// remove from their journal so events appended meanwhile are kept
+func droppedEventIDs(events []map[string]interface{}, dropped map[int]bool) map[string]bool {
+	ids := make(map[string]bool, len(dropped))
+	for i := range dropped {
+		if id := getString(events[i], "event_id"); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// CompactLocal compacts a workflow on a local engine, keeping its restores
+// from replaying steps that completed long ago
+func CompactLocal(engine Engine, workflowID string) (*CompactionResult, error) {
+	compactor, ok := engineAs[Compactor](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support compaction", "compaction")
+	}
+	result, err := compactor.Compact(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CompactArchive compacts an exported workflow offline: its completed
+// steps are folded into the archive's snapshot and their events dropped.
+// Savepoints, completed step records and artifacts are kept.
+func CompactArchive(archive *WorkflowArchive) (*CompactionResult, error) {
+	engine := &archiveEngine{artifacts: archiveArtifacts(archive.Artifacts)}
+	state, kept, err := CompactEvents(engine, archive.WorkflowID, archive.Snapshot, archive.Events)
+	if err != nil {
+		return nil, err
+	}
+	result := &CompactionResult{
+		EventsDeleted: len(archive.Events) - len(kept),
+		StepNumber:    state.StepNumber,
+	}
+	if archive.Snapshot == nil || archive.Snapshot.StepNumber < state.StepNumber {
+		archive.Snapshot = state
+	}
+	archive.Events = kept
+	return result, nil
+}
+
+// archiveEngine serves an archive's artifacts to ReplayDeltas; nothing
+// else of it is used
+type archiveEngine struct {
+	Engine
+	artifacts archiveArtifacts
+}
+
+func (e *archiveEngine) Artifacts() ArtifactStore {
+	return e.artifacts
+}
+
+type archiveArtifacts map[string][]byte
+
+func (a archiveArtifacts) Put(key string, data []byte) error {
+	a[key] = data
+	return nil
+}
+
+func (a archiveArtifacts) Get(key string) ([]byte, error) {
+	data, ok := a[key]
+	if !ok {
+		return nil, NewPersistenceError(fmt.Sprintf("artifact %s is not in the archive", key), "", nil)
+	}
+	return data, nil
+}
+
+// CompactWorkflow asks the server to compact a workflow's journal into its
+// snapshot, e.g. from a maintenance job
+func (c *Client) CompactWorkflow(ctx context.Context, workflowID string) (*CompactionResult, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/compact", workflowID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result CompactionResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
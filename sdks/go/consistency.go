@@ -0,0 +1,166 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// consistencyHeader asks the server for a read's consistency level
+const consistencyHeader = "X-Contd-Consistency"
+
+// DefaultReadYourWritesWindow is how long after a write the client keeps
+// reading the workflow strongly under ConsistencyReadYourWrites
+const DefaultReadYourWritesWindow = 10 * time.Second
+
+// Consistency is how fresh a read must be. Eventual reads may be served by
+// a replica that has not yet seen recent writes, so a workflow just started
+// can briefly read as not found.
+type Consistency string
+
+const (
+	// ConsistencyDefault uses the client's configured consistency
+	ConsistencyDefault Consistency = ""
+	// ConsistencyEventual reads from any replica and may use the cache
+	ConsistencyEventual Consistency = "eventual"
+	// ConsistencyStrong reads the latest committed state, bypassing the cache
+	ConsistencyStrong Consistency = "strong"
+	// ConsistencyReadYourWrites reads strongly whatever this client started
+	// or changed within ClientConfig.ReadYourWritesWindow, and eventually
+	// otherwise
+	ConsistencyReadYourWrites Consistency = "read_your_writes"
+)
+
+// recentWrites remembers which workflows a client wrote and when, shared
+// by the clients ForOrg derives
+type recentWrites struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	workflows map[string]time.Time
+	last      time.Time
+}
+
+func newRecentWrites(window time.Duration) *recentWrites {
+	if window <= 0 {
+		window = DefaultReadYourWritesWindow
+	}
+	return &recentWrites{window: window, workflows: make(map[string]time.Time)}
+}
+
+// record notes a write to workflowID, or to no single workflow when empty
+func (w *recentWrites) record(workflowID string) {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = now
+	if workflowID != "" {
+		w.workflows[workflowID] = now
+	}
+	for id, at := range w.workflows {
+		if now.Sub(at) >= w.window {
+			delete(w.workflows, id)
+		}
+	}
+}
+
+// wrote reports whether workflowID, or any workflow when empty, was
+// written within the window
+func (w *recentWrites) wrote(workflowID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	at := w.last
+	if workflowID != "" {
+		at = w.workflows[workflowID]
+	}
+	return !at.IsZero() && time.Since(at) < w.window
+}
+
+// workflowIDFromPath returns the workflow a /v1/workflows/{id} path
+// addresses, or "" for other paths
+func workflowIDFromPath(path string) string {
+	rest, ok := strings.CutPrefix(path, "/v1/workflows/")
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	id, _, _ = strings.Cut(id, "?")
+	return id
+}
+
+// resolveConsistency turns a read's requested consistency into eventual or
+// strong for a read of workflowID ("" for listings)
+func (c *Client) resolveConsistency(consistency Consistency, workflowID string) Consistency {
+	if consistency == ConsistencyDefault {
+		consistency = c.consistency
+	}
+	switch consistency {
+	case ConsistencyStrong:
+		return ConsistencyStrong
+	case ConsistencyReadYourWrites:
+		if c.writes.wrote(workflowID) {
+			return ConsistencyStrong
+		}
+	}
+	return ConsistencyEventual
+}
+
+// readGet performs a GET at the resolved consistency. Strong reads skip
+// the response cache, which may hold what a replica served earlier.
+func (c *Client) readGet(ctx context.Context, path string, consistency Consistency) (*http.Response, error) {
+	if consistency == ConsistencyStrong {
+		return c.doRequestWithHeader(ctx, "GET", path, nil, http.Header{consistencyHeader: {string(ConsistencyStrong)}})
+	}
+	return c.cachedGet(ctx, path)
+}
+
+// GetStatusWithConsistency retrieves the status of a workflow at the given
+// consistency
+func (c *Client) GetStatusWithConsistency(ctx context.Context, workflowID string, consistency Consistency) (*WorkflowStatusResponse, error) {
+	path := fmt.Sprintf("/v1/workflows/%s", workflowID)
+	resp, err := c.readGet(ctx, path, c.resolveConsistency(consistency, workflowID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result WorkflowStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if c.orgID != "" && !sameOrg(c.orgID, result.OrgID) {
+		return nil, NewOrgMismatch(workflowID, c.orgID, result.OrgID)
+	}
+
+	return &result, nil
+}
+
+// WaitForVisibility polls eventual reads of a workflow until replicas serve
+// it, so callers that read eventually, such as UIs listing workflows, don't
+// see a workflow they just started as missing. It returns the first status
+// read, or ctx's error if the workflow is still not visible when ctx ends.
+func (c *Client) WaitForVisibility(ctx context.Context, workflowID string) (*WorkflowStatusResponse, error) {
+	delay := 50 * time.Millisecond
+	for {
+		status, err := c.GetStatusWithConsistency(ctx, workflowID, ConsistencyEventual)
+		if err == nil {
+			return status, nil
+		}
+		if !errors.Is(err, ErrWorkflowNotFound) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > time.Second {
+			delay = time.Second
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package contdbench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+	"github.com/google/uuid"
+)
+
+// BenchmarkSteps runs b.N workflows of config.Steps steps each, reporting
+// steps/s and the mean journal append latency
+func BenchmarkSteps(b *testing.B, newEngine EngineFactory, config Config) {
+	config = config.withDefaults()
+	config.Workflows = b.N
+	b.ReportAllocs()
+	b.ResetTimer()
+	result, err := Run(context.Background(), newEngine, config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if result.Failed > 0 {
+		b.Fatalf("%d workflows failed", result.Failed)
+	}
+	b.ReportMetric(result.StepsPerSecond, "steps/s")
+	b.ReportMetric(float64(result.JournalLatency.Mean.Nanoseconds()), "ns/append")
+}
+
+// BenchmarkNoopSteps runs b.N steps that do nothing in one workflow,
+// measuring the SDK's and engine's bookkeeping per step
+func BenchmarkNoopSteps(b *testing.B, newEngine EngineFactory) {
+	engine, err := newEngine()
+	if err != nil {
+		b.Fatal(err)
+	}
+	runner := contd.NewWorkflowRunner(engine, contd.WorkflowConfig{})
+	steps := contd.NewStepRunner(contd.StepConfig{})
+	noop := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	b.ReportAllocs()
+	if _, err := runner.Run(context.Background(), "contdbench-noop", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := steps.Run(ctx, "noop", noop, nil); err != nil {
+				return nil, err
+			}
+		}
+		b.StopTimer()
+		return nil, nil
+	}, nil); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkJournalAppend appends b.N step_completed events carrying
+// payloadBytes of state to a fresh engine's journal
+func BenchmarkJournalAppend(b *testing.B, newEngine EngineFactory, payloadBytes int) {
+	engine, err := newEngine()
+	if err != nil {
+		b.Fatal(err)
+	}
+	journal := engine.Journal()
+	workflowID := uuid.New().String()
+	payload := strings.Repeat("x", payloadBytes)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := journal.Append(map[string]interface{}{
+			"event_id":    uuid.New().String(),
+			"workflow_id": workflowID,
+			"event_type":  "step_completed",
+			"step_id":     fmt.Sprintf("step_%d", i),
+			"step_number": i + 1,
+			"timestamp":   time.Now().UTC().Format(time.RFC3339),
+			"state_delta": map[string]interface{}{"payload": payload},
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRestore runs one workflow of config.Steps steps, then restores
+// its state b.N times
+func BenchmarkRestore(b *testing.B, newEngine EngineFactory, config Config) {
+	config = config.withDefaults()
+	engine, err := newEngine()
+	if err != nil {
+		b.Fatal(err)
+	}
+	workflowID, _, err := runWorkflow(context.Background(), engine, config.Steps, strings.Repeat("x", config.PayloadBytes))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := timeRestore(engine, workflowID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExtractState commits b.N step results into a state of
+// config.Steps variables, each a nested map holding config.PayloadBytes,
+// measuring the cost of keeping committed state immutable
+func BenchmarkExtractState(b *testing.B, config Config) {
+	config = config.withDefaults()
+	payload := strings.Repeat("x", config.PayloadBytes)
+	ec := contd.NewExecutionContext("", "", "contdbench-state", nil)
+	state, err := ec.GetState()
+	if err != nil {
+		b.Fatal(err)
+	}
+	variables := make(map[string]interface{}, config.Steps)
+	for i := 0; i < config.Steps; i++ {
+		variables[fmt.Sprintf("var_%d", i)] = map[string]interface{}{
+			"payload": payload,
+			"items":   []interface{}{i, payload},
+		}
+	}
+	seeded := *state
+	seeded.Variables = variables
+	ec.SetState(&seeded)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ec.ExtractState(map[string]interface{}{
+			"result": map[string]interface{}{"payload": payload, "step": i},
+		})
+	}
+}
+
+// Engines are the factories of the SDK's local engines, by name
+var Engines = map[string]EngineFactory{
+	"memory": func() (contd.Engine, error) { return contd.NewInMemoryEngine(), nil },
+	"mock":   func() (contd.Engine, error) { return contd.NewMockEngine(), nil },
+}
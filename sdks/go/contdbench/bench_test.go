@@ -0,0 +1,57 @@
+package contdbench_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/contdbench"
+)
+
+// engines are the names in contdbench.Engines each benchmark runs against,
+// in a stable order
+var engines = []string{"memory", "mock"}
+
+func BenchmarkSteps(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine, func(b *testing.B) {
+			contdbench.BenchmarkSteps(b, contdbench.Engines[engine], contdbench.Config{Steps: 10, PayloadBytes: 256})
+		})
+	}
+}
+
+func BenchmarkNoopSteps(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine, func(b *testing.B) {
+			contdbench.BenchmarkNoopSteps(b, contdbench.Engines[engine])
+		})
+	}
+}
+
+func BenchmarkJournalAppend(b *testing.B) {
+	for _, engine := range engines {
+		for _, size := range []int{256, 16 << 10} {
+			b.Run(engine+"/"+sizeName(size), func(b *testing.B) {
+				contdbench.BenchmarkJournalAppend(b, contdbench.Engines[engine], size)
+			})
+		}
+	}
+}
+
+func BenchmarkRestore(b *testing.B) {
+	for _, engine := range engines {
+		b.Run(engine, func(b *testing.B) {
+			contdbench.BenchmarkRestore(b, contdbench.Engines[engine], contdbench.Config{Steps: 50, PayloadBytes: 256})
+		})
+	}
+}
+
+func BenchmarkExtractState(b *testing.B) {
+	contdbench.BenchmarkExtractState(b, contdbench.Config{Steps: 50, PayloadBytes: 256})
+}
+
+func sizeName(bytes int) string {
+	if bytes >= 1<<10 {
+		return strconv.Itoa(bytes>>10) + "KiB"
+	}
+	return strconv.Itoa(bytes) + "B"
+}
@@ -0,0 +1,65 @@
+// Command contdbench load-tests a local Contd engine and prints its
+// throughput, journal latency and restore time.
+//
+//	go run github.com/bhavdeep98/contd.ai/sdks/go/contdbench/cmd/contdbench -workflows 1000 -steps 20
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/contdbench"
+)
+
+func main() {
+	var config contdbench.Config
+	flag.IntVar(&config.Workflows, "workflows", 100, "workflows to run")
+	flag.IntVar(&config.Steps, "steps", 10, "checkpointed steps per workflow")
+	flag.IntVar(&config.PayloadBytes, "payload", 256, "bytes each step writes to state")
+	flag.IntVar(&config.Concurrency, "concurrency", 0, "workflows run at once (defaults to GOMAXPROCS)")
+	engineName := flag.String("engine", "memory", "engine to benchmark")
+	benchmarks := flag.Bool("bench", false, "also run the no-op step, state extraction, journal append and restore benchmarks")
+	flag.Parse()
+
+	newEngine, ok := contdbench.Engines[*engineName]
+	if !ok {
+		names := make([]string, 0, len(contdbench.Engines))
+		for name := range contdbench.Engines {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "unknown engine %q (have %v)\n", *engineName, names)
+		os.Exit(2)
+	}
+
+	result, err := contdbench.Run(context.Background(), newEngine, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(result)
+
+	if !*benchmarks {
+		return
+	}
+	noop := testing.Benchmark(func(b *testing.B) {
+		contdbench.BenchmarkNoopSteps(b, newEngine)
+	})
+	fmt.Printf("no-op step: %v %v\n", noop, noop.MemString())
+	extract := testing.Benchmark(func(b *testing.B) {
+		contdbench.BenchmarkExtractState(b, config)
+	})
+	fmt.Printf("extract state: %v %v\n", extract, extract.MemString())
+	appends := testing.Benchmark(func(b *testing.B) {
+		contdbench.BenchmarkJournalAppend(b, newEngine, config.PayloadBytes)
+	})
+	fmt.Printf("journal append: %v %v\n", appends, appends.MemString())
+	restore := testing.Benchmark(func(b *testing.B) {
+		contdbench.BenchmarkRestore(b, newEngine, config)
+	})
+	fmt.Printf("restore: %v %v\n", restore, restore.MemString())
+}
@@ -0,0 +1,272 @@
+// Package contdbench measures workflow throughput, journal latency and
+// restore time against any contd.Engine, so performance regressions in the
+// SDK or an engine show up as numbers.
+//
+// Run drives a configurable load and reports what it measured. The
+// Benchmark functions take a *testing.B and are meant to be called from an
+// engine's own benchmarks:
+//
+//	func BenchmarkSteps(b *testing.B) {
+//	    contdbench.BenchmarkSteps(b, newEngine, contdbench.Config{})
+//	}
+package contdbench
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+// EngineFactory creates the engine a measurement runs against. Each run
+// gets a fresh engine so earlier runs don't skew it.
+type EngineFactory func() (contd.Engine, error)
+
+// Config shapes the load
+type Config struct {
+	// Workflows is how many workflows run (defaults to 100)
+	Workflows int
+	// Steps is how many checkpointed steps each workflow runs (defaults to 10)
+	Steps int
+	// PayloadBytes is the size of the value each step writes to state
+	// (defaults to 256)
+	PayloadBytes int
+	// Concurrency is how many workflows run at once (defaults to
+	// GOMAXPROCS)
+	Concurrency int
+}
+
+func (c Config) withDefaults() Config {
+	if c.Workflows <= 0 {
+		c.Workflows = 100
+	}
+	if c.Steps <= 0 {
+		c.Steps = 10
+	}
+	if c.PayloadBytes <= 0 {
+		c.PayloadBytes = 256
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	return c
+}
+
+// Latency summarizes a set of timings
+type Latency struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func (l Latency) String() string {
+	return fmt.Sprintf("n=%d mean=%v p50=%v p95=%v p99=%v max=%v", l.Count, l.Mean, l.P50, l.P95, l.P99, l.Max)
+}
+
+// summarize computes the latency of timings, sorting them
+func summarize(timings []time.Duration) Latency {
+	if len(timings) == 0 {
+		return Latency{}
+	}
+	sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+	var total time.Duration
+	for _, t := range timings {
+		total += t
+	}
+	at := func(q float64) time.Duration {
+		return timings[int(q*float64(len(timings)-1))]
+	}
+	return Latency{
+		Count: len(timings),
+		Mean:  total / time.Duration(len(timings)),
+		P50:   at(0.50),
+		P95:   at(0.95),
+		P99:   at(0.99),
+		Max:   timings[len(timings)-1],
+	}
+}
+
+// Result is what a Run measured
+type Result struct {
+	Config   Config
+	Duration time.Duration
+	// Steps counts the steps that completed
+	Steps int
+	// Failed counts the workflows that failed
+	Failed         int
+	StepsPerSecond float64
+	// JournalLatency times every journal append
+	JournalLatency Latency
+	// RestoreTime times restoring each completed workflow's state
+	RestoreTime Latency
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%d workflows x %d steps (%d bytes, concurrency %d) in %v: %.0f steps/s, %d failed\njournal: %v\nrestore: %v",
+		r.Config.Workflows, r.Config.Steps, r.Config.PayloadBytes, r.Config.Concurrency, r.Duration,
+		r.StepsPerSecond, r.Failed, r.JournalLatency, r.RestoreTime)
+}
+
+// Run runs config.Workflows workflows against a fresh engine, then restores
+// each one, and reports throughput and latencies
+func Run(ctx context.Context, newEngine EngineFactory, config Config) (*Result, error) {
+	config = config.withDefaults()
+	inner, err := newEngine()
+	if err != nil {
+		return nil, err
+	}
+	engine := newTimedEngine(inner)
+	payload := strings.Repeat("x", config.PayloadBytes)
+
+	var mu sync.Mutex
+	var ids []string
+	steps, failed := 0, 0
+	work := make(chan struct{})
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range work {
+				id, n, err := runWorkflow(ctx, engine, config.Steps, payload)
+				mu.Lock()
+				steps += n
+				if err != nil {
+					failed++
+				} else {
+					ids = append(ids, id)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < config.Workflows && ctx.Err() == nil; i++ {
+		work <- struct{}{}
+	}
+	close(work)
+	wg.Wait()
+	duration := time.Since(start)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	restores := make([]time.Duration, 0, len(ids))
+	for _, id := range ids {
+		took, err := timeRestore(inner, id)
+		if err != nil {
+			return nil, err
+		}
+		restores = append(restores, took)
+	}
+
+	return &Result{
+		Config:         config,
+		Duration:       duration,
+		Steps:          steps,
+		Failed:         failed,
+		StepsPerSecond: float64(steps) / duration.Seconds(),
+		JournalLatency: summarize(engine.appends()),
+		RestoreTime:    summarize(restores),
+	}, nil
+}
+
+// runWorkflow runs one workflow of n steps, returning its ID and how many
+// steps completed
+func runWorkflow(ctx context.Context, engine contd.Engine, n int, payload string) (string, int, error) {
+	var workflowID string
+	completed := 0
+	runner := contd.NewWorkflowRunner(engine, contd.WorkflowConfig{})
+	_, err := runner.Run(ctx, "contdbench", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		info, err := contd.GetInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		workflowID = info.WorkflowID
+		steps := contd.NewStepRunner(contd.StepConfig{Checkpoint: true})
+		for i := 0; i < n; i++ {
+			step := i
+			if _, err := steps.Run(ctx, "step", func(context.Context, interface{}) (interface{}, error) {
+				return map[string]interface{}{"payload": payload, "step": step}, nil
+			}, nil); err != nil {
+				return nil, err
+			}
+			completed++
+		}
+		return nil, nil
+	}, nil)
+	return workflowID, completed, err
+}
+
+// timeRestore times restoring a workflow's state the way a resuming runner
+// does: from its snapshot, or by rebuilding it from the journal
+func timeRestore(engine contd.Engine, workflowID string) (time.Duration, error) {
+	start := time.Now()
+	state, err := engine.Restore(workflowID)
+	if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		rebuilder, ok := engine.(contd.StateRebuilder)
+		if !ok {
+			return 0, fmt.Errorf("workflow %s has no snapshot and the engine cannot rebuild it", workflowID)
+		}
+		if _, err := rebuilder.RebuildState(workflowID); err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(start), nil
+}
+
+// timedEngine times the journal appends of the engine it wraps
+type timedEngine struct {
+	contd.Engine
+
+	mu      sync.Mutex
+	timings []time.Duration
+}
+
+func newTimedEngine(engine contd.Engine) *timedEngine {
+	return &timedEngine{Engine: engine}
+}
+
+// Unwrap returns the wrapped engine, so its capabilities stay visible
+func (e *timedEngine) Unwrap() contd.Engine {
+	return e.Engine
+}
+
+// Journal returns the wrapped journal, timing each append
+func (e *timedEngine) Journal() contd.Journal {
+	return &timedJournal{Journal: e.Engine.Journal(), engine: e}
+}
+
+func (e *timedEngine) appends() []time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	timings := make([]time.Duration, len(e.timings))
+	copy(timings, e.timings)
+	return timings
+}
+
+type timedJournal struct {
+	contd.Journal
+	engine *timedEngine
+}
+
+func (j *timedJournal) Append(event interface{}) error {
+	start := time.Now()
+	err := j.Journal.Append(event)
+	took := time.Since(start)
+	j.engine.mu.Lock()
+	j.engine.timings = append(j.engine.timings, took)
+	j.engine.mu.Unlock()
+	return err
+}
@@ -0,0 +1,283 @@
+// Package contdtest provides an in-memory Contd API server and a client
+// wired to it, for unit testing code that uses contd.Client
+package contdtest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Header http.Header
+	Body   []byte
+}
+
+// Decode decodes the request body into v
+func (r Request) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// HandlerFunc computes a response for a request
+type HandlerFunc func(req Request) (status int, body interface{})
+
+// Route is a programmed response for requests matching a method and path.
+// Path segments written as {name} or * match any value.
+type Route struct {
+	method   string
+	segments []string
+	handler  HandlerFunc
+	delay    time.Duration
+	drop     bool
+	times    int
+	used     int
+}
+
+// Respond replies with status and body encoded as JSON
+func (r *Route) Respond(status int, body interface{}) *Route {
+	r.handler = func(Request) (int, interface{}) { return status, body }
+	return r
+}
+
+// RespondError replies with err in the wire error format, using the HTTP
+// status the API uses for its error code
+func (r *Route) RespondError(err error) *Route {
+	wire := contd.EncodeError(err)
+	status := StatusForError(err)
+	r.handler = func(Request) (int, interface{}) { return status, wire }
+	return r
+}
+
+// Handle computes each response with fn
+func (r *Route) Handle(fn HandlerFunc) *Route {
+	r.handler = fn
+	return r
+}
+
+// Delay waits d before responding
+func (r *Route) Delay(d time.Duration) *Route {
+	r.delay = d
+	return r
+}
+
+// Drop closes the connection without responding, simulating a network failure
+func (r *Route) Drop() *Route {
+	r.drop = true
+	return r
+}
+
+// Times limits the route to the next n matching requests, after which later
+// routes are tried
+func (r *Route) Times(n int) *Route {
+	r.times = n
+	return r
+}
+
+// matches reports whether the route applies to method and path
+func (r *Route) matches(method string, segments []string) bool {
+	if r.method != method || len(r.segments) != len(segments) {
+		return false
+	}
+	if r.times > 0 && r.used >= r.times {
+		return false
+	}
+	for i, s := range r.segments {
+		if s == "*" || (strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")) {
+			continue
+		}
+		if s != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Server is an in-memory Contd API with programmable responses
+type Server struct {
+	mu       sync.Mutex
+	routes   []*Route
+	requests []Request
+	http     *httptest.Server
+}
+
+// NewServer starts a server. Requests that match no route get a 501 error.
+func NewServer() *Server {
+	s := &Server{}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// URL returns the server's base URL
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.http.Close()
+}
+
+// NewClient creates a client for the server. BaseURL is overridden.
+func (s *Server) NewClient(config contd.ClientConfig) *contd.Client {
+	config.BaseURL = s.http.URL
+	return contd.NewClient(config)
+}
+
+// On programs a response for requests matching method and path, e.g.
+// On("GET", "/v1/workflows/{id}")
+func (s *Server) On(method, path string) *Route {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	route := &Route{
+		method:   method,
+		segments: splitPath(path),
+		handler: func(Request) (int, interface{}) {
+			return http.StatusOK, map[string]interface{}{}
+		},
+	}
+	s.routes = append(s.routes, route)
+	return route
+}
+
+// Requests returns every request received, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Request, len(s.requests))
+	copy(result, s.requests)
+	return result
+}
+
+// RequestCount returns how many requests matched method and path
+func (s *Server) RequestCount(method, path string) int {
+	pattern := &Route{method: method, segments: splitPath(path)}
+	count := 0
+	for _, req := range s.Requests() {
+		if pattern.matches(req.Method, splitPath(req.Path)) {
+			count++
+		}
+	}
+	return count
+}
+
+// Reset removes all routes and recorded requests
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = nil
+	s.requests = nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	var route *Route
+	segments := splitPath(req.Path)
+	for _, candidate := range s.routes {
+		if candidate.matches(req.Method, segments) {
+			route = candidate
+			route.used++
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if route == nil {
+		writeJSON(w, http.StatusNotImplemented, contd.WireError{
+			Code:    contd.CodeUnknown,
+			Message: "no response programmed for " + req.Method + " " + req.Path,
+		})
+		return
+	}
+
+	if route.delay > 0 {
+		select {
+		case <-time.After(route.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if route.drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+
+	status, respBody := route.handler(req)
+	writeJSON(w, status, respBody)
+}
+
+// StatusForError returns the HTTP status the API uses for an error
+func StatusForError(err error) int {
+	switch {
+	case errors.Is(err, contd.ErrWorkflowNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, contd.ErrWorkflowLocked), errors.Is(err, contd.ErrWorkflowAlreadyCompleted):
+		return http.StatusConflict
+	case errors.Is(err, contd.ErrOrgMismatch):
+		return http.StatusForbidden
+	case errors.Is(err, contd.ErrValidation), errors.Is(err, contd.ErrConfiguration):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// MockClient is a contd.Client backed by an in-memory Server
+type MockClient struct {
+	*contd.Client
+	Server *Server
+}
+
+// NewMockClient starts a server and returns a client connected to it
+func NewMockClient() *MockClient {
+	server := NewServer()
+	return &MockClient{
+		Client: server.NewClient(contd.ClientConfig{APIKey: "test"}),
+		Server: server,
+	}
+}
+
+// On programs a response on the underlying server
+func (m *MockClient) On(method, path string) *Route {
+	return m.Server.On(method, path)
+}
+
+// Close shuts the underlying server down
+func (m *MockClient) Close() {
+	m.Server.Close()
+}
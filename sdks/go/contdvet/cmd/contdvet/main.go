@@ -0,0 +1,14 @@
+// Command contdvet reports nondeterministic code in Contd workflows.
+//
+//	go install github.com/bhavdeep98/contd.ai/sdks/go/contdvet/cmd/contdvet
+//	go vet -vettool=$(which contdvet) ./...
+package main
+
+import (
+	"github.com/bhavdeep98/contd.ai/sdks/go/contdvet"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(contdvet.Analyzer)
+}
@@ -0,0 +1,190 @@
+// Package contdvet provides a go/analysis checker that reports
+// nondeterministic code in Contd workflow functions. Workflow code outside
+// steps is replayed on resume, so it must make the same decisions every time.
+package contdvet
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const contdPath = "github.com/bhavdeep98/contd.ai/sdks/go"
+
+// workflowDirective marks a function as workflow code
+const workflowDirective = "//contd:workflow"
+
+// Analyzer reports time, randomness, goroutines, selects and map iteration
+// in workflow code outside steps
+var Analyzer = &analysis.Analyzer{
+	Name:     "contdvet",
+	Doc:      "report nondeterministic code in Contd workflow functions",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// nondeterministicFuncs lists functions whose results differ between runs
+var nondeterministicFuncs = map[string]map[string]bool{
+	"time": {"Now": true, "Since": true, "Until": true},
+}
+
+// nondeterministicPackages lists packages whose every function is random
+var nondeterministicPackages = map[string]bool{
+	"math/rand":    true,
+	"math/rand/v2": true,
+	"crypto/rand":  true,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	decls := make(map[types.Object]*ast.FuncDecl)
+	var workflows []ast.Node
+	insp.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
+		decl := n.(*ast.FuncDecl)
+		if obj := pass.TypesInfo.Defs[decl.Name]; obj != nil {
+			decls[obj] = decl
+		}
+		if hasDirective(decl.Doc) && decl.Body != nil {
+			workflows = append(workflows, decl.Body)
+		}
+	})
+
+	// Functions passed where a WorkflowFunc is expected are workflow code
+	insp.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		sig, ok := pass.TypesInfo.TypeOf(call.Fun).(*types.Signature)
+		if !ok {
+			return
+		}
+		for i, arg := range call.Args {
+			if !isContdType(paramType(sig, i), "WorkflowFunc") {
+				continue
+			}
+			switch fn := ast.Unparen(arg).(type) {
+			case *ast.FuncLit:
+				workflows = append(workflows, fn.Body)
+			case *ast.Ident:
+				if decl, ok := decls[pass.TypesInfo.Uses[fn]]; ok && decl.Body != nil {
+					workflows = append(workflows, decl.Body)
+				}
+			}
+		}
+	})
+
+	seen := make(map[ast.Node]bool)
+	for _, body := range workflows {
+		if !seen[body] {
+			seen[body] = true
+			checkWorkflow(pass, body)
+		}
+	}
+	return nil, nil
+}
+
+// stepFuncTypes are the contd function types run as journaled steps, or
+// checked as workflows of their own
+var stepFuncTypes = []string{"StepFunc", "BatchItemFunc", "WorkflowFunc"}
+
+// checkWorkflow reports nondeterminism in a workflow body, skipping
+// functions handed to the contd package to run as steps. Functions handed
+// to helpers such as Loop, If and StepGroup run as workflow code and are
+// checked.
+func checkWorkflow(pass *analysis.Pass, body ast.Node) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if fn := calledFunc(pass, n); fn != nil && fn.Pkg() != nil {
+				pkg := fn.Pkg().Path()
+				if nondeterministicPackages[pkg] || nondeterministicFuncs[pkg][fn.Name()] {
+					pass.Reportf(n.Pos(), "workflow code calls %s.%s; results differ on replay, call it inside a step", fn.Pkg().Name(), fn.Name())
+				}
+				if pkg == contdPath {
+					sig, _ := pass.TypesInfo.TypeOf(n.Fun).(*types.Signature)
+					checkWorkflow(pass, n.Fun)
+					for i, arg := range n.Args {
+						if _, ok := ast.Unparen(arg).(*ast.FuncLit); ok && sig != nil && isStepFunc(paramType(sig, i)) {
+							continue
+						}
+						checkWorkflow(pass, arg)
+					}
+					return false
+				}
+			}
+		case *ast.GoStmt:
+			pass.Reportf(n.Pos(), "workflow code starts a goroutine; its scheduling differs on replay, use steps or a DAG")
+		case *ast.SelectStmt:
+			pass.Reportf(n.Pos(), "workflow code uses select; the chosen case can differ on replay")
+		case *ast.RangeStmt:
+			if _, ok := pass.TypesInfo.TypeOf(n.X).Underlying().(*types.Map); ok {
+				pass.Reportf(n.Pos(), "workflow code ranges over a map; iteration order differs on replay, sort the keys first")
+			}
+		}
+		return true
+	})
+}
+
+// calledFunc returns the function or method a call invokes, if static
+func calledFunc(pass *analysis.Pass, call *ast.CallExpr) *types.Func {
+	var ident *ast.Ident
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := pass.TypesInfo.Uses[ident].(*types.Func)
+	return fn
+}
+
+// paramType returns the type of a call's ith argument
+func paramType(sig *types.Signature, i int) types.Type {
+	params := sig.Params()
+	if sig.Variadic() && i >= params.Len()-1 {
+		if slice, ok := params.At(params.Len() - 1).Type().(*types.Slice); ok {
+			return slice.Elem()
+		}
+	}
+	if i < params.Len() {
+		return params.At(i).Type()
+	}
+	return nil
+}
+
+// isStepFunc reports whether t is one of stepFuncTypes
+func isStepFunc(t types.Type) bool {
+	for _, name := range stepFuncTypes {
+		if isContdType(t, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isContdType reports whether t is the named contd type name
+func isContdType(t types.Type, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Name() == name && obj.Pkg() != nil && obj.Pkg().Path() == contdPath
+}
+
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, workflowDirective) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+package contdvet_test
+
+import (
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/contdvet"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), contdvet.Analyzer, "workflows")
+}
@@ -0,0 +1,30 @@
+// Package contd stubs the parts of the SDK the analyzer looks at
+package contd
+
+import "context"
+
+type WorkflowFunc func(ctx context.Context, input interface{}) (interface{}, error)
+
+type StepFunc func(ctx context.Context, input interface{}) (interface{}, error)
+
+type Engine interface{}
+
+func Execute(ctx context.Context, engine Engine, name string, fn WorkflowFunc, input interface{}) (interface{}, error) {
+	return fn(ctx, input)
+}
+
+func Step(ctx context.Context, name string, fn StepFunc) (interface{}, error) {
+	return fn(ctx, nil)
+}
+
+func Loop(ctx context.Context, name string, cond func(ctx context.Context, i int) (bool, error), body func(ctx context.Context, i int) error) error {
+	return nil
+}
+
+func If(ctx context.Context, name string, cond func(ctx context.Context) (bool, error), then, otherwise func(ctx context.Context) error) error {
+	return nil
+}
+
+func StepGroup(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,54 @@
+package workflows
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+func run(ctx context.Context, engine contd.Engine) {
+	contd.Execute(ctx, engine, "order", order, nil)
+}
+
+func order(ctx context.Context, _ interface{}) (interface{}, error) {
+	_ = time.Now() // want `workflow code calls time.Now`
+	go func() {}() // want `workflow code starts a goroutine`
+
+	// Step functions are journaled, so they may do as they like
+	contd.Step(ctx, "charge", func(context.Context, interface{}) (interface{}, error) {
+		return rand.Int(), nil
+	})
+
+	contd.Loop(ctx, "poll",
+		func(ctx context.Context, i int) (bool, error) {
+			return time.Since(time.Time{}) > 0, nil // want `workflow code calls time.Since`
+		},
+		func(ctx context.Context, i int) error {
+			for range map[string]int{} { // want `workflow code ranges over a map`
+			}
+			return nil
+		})
+
+	contd.If(ctx, "lucky",
+		func(ctx context.Context) (bool, error) {
+			return rand.Intn(2) == 0, nil // want `workflow code calls rand.Intn`
+		},
+		func(ctx context.Context) error {
+			go func() {}() // want `workflow code starts a goroutine`
+			return nil
+		},
+		func(ctx context.Context) error {
+			select {} // want `workflow code uses select`
+		})
+
+	contd.StepGroup(ctx, "checkout", func(ctx context.Context) error {
+		_ = time.Now() // want `workflow code calls time.Now`
+		_, err := contd.Step(ctx, "reserve", func(context.Context, interface{}) (interface{}, error) {
+			return time.Now(), nil
+		})
+		return err
+	})
+	return nil, nil
+}
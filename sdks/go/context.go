@@ -7,7 +7,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -30,10 +32,49 @@ type ExecutionContext struct {
 	stepCounter int
 	engine      Engine
 	lease       *Lease
+	tracker     *resourceTracker
+	rateLimits  *RateLimits
+	tagSyncer   TagSyncer
+	pendingTags map[string]string
+	trace       []stepCall
+	replaying   bool
+	snapshots   snapshotTracker
+	maxPayload  int
+	changes     map[string]varChange
+	budget      *Budget
+
+	searchAttrSyncer   SearchAttributeSyncer
+	pendingSearchAttrs map[string]SearchAttribute
+
+	sticky    *StickyCache
+	lostLease int32
+
+	capabilities []string
+	handedOff    map[string]struct{}
+	steps        *StepRegistry
+	resumed      *WorkflowState
+	lastStepID   string
+	scopes       map[string]struct{}
+	stepIDs      StepIDStrategy
+	siteCounts   map[string]int
+	stepSites    map[string]string
+	completedIDs map[string]struct{}
+	progress     *Progress
+	drain        <-chan struct{}
+	semaphores   *Semaphores
+	inputs       *InputRecording
+	run          runInfo
+	history      historyGuard
+	header       atomic.Pointer[eventHeader]
+
+	cancelRun     context.CancelCauseFunc
+	compensations []compensation
+	activities    map[string]*PendingActivity
 
 	heartbeatStop chan struct{}
 	heartbeatWg   sync.WaitGroup
 	mu            sync.RWMutex
+	commitMu      sync.Mutex
 }
 
 // Engine interface for workflow execution
@@ -46,6 +87,45 @@ type Engine interface {
 	Idempotency() IdempotencyManager
 }
 
+// engineWrapper is implemented by engines that decorate another engine
+type engineWrapper interface {
+	Unwrap() Engine
+}
+
+// capabilityScoper is implemented by wrappers that vet the capabilities of
+// the engines they wrap, as OrgEngine checks workflows' orgs. It is passed a
+// pointer to the capability, may replace it, and returns false to hide it.
+type capabilityScoper interface {
+	scopeCapability(capability interface{}) bool
+}
+
+// engineAs finds the first engine in a chain of wrappers implementing T,
+// as scoped by the wrappers above it
+func engineAs[T any](engine Engine) (T, bool) {
+	var scopers []capabilityScoper
+	for engine != nil {
+		if capability, ok := engine.(T); ok {
+			for i := len(scopers) - 1; i >= 0; i-- {
+				if !scopers[i].scopeCapability(&capability) {
+					var zero T
+					return zero, false
+				}
+			}
+			return capability, true
+		}
+		if scoper, ok := engine.(capabilityScoper); ok {
+			scopers = append(scopers, scoper)
+		}
+		wrapper, ok := engine.(engineWrapper)
+		if !ok {
+			break
+		}
+		engine = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
 // LeaseManager interface for lease operations
 type LeaseManager interface {
 	Acquire(workflowID, ownerID string) (*Lease, error)
@@ -84,8 +164,19 @@ func WithContext(ctx context.Context, ec *ExecutionContext) context.Context {
 func NewExecutionContext(workflowID, orgID, workflowName string, tags map[string]string) *ExecutionContext {
 	isNewWorkflow := workflowID == ""
 	if workflowID == "" {
-		workflowID = "wf-" + uuid.New().String()
+		workflowID = newWorkflowID()
 	}
+	return newExecutionContext(workflowID, orgID, workflowName, tags, isNewWorkflow)
+}
+
+// newWorkflowID generates the ID of a new workflow
+func newWorkflowID() string {
+	return "wf-" + uuid.New().String()
+}
+
+// newExecutionContext creates an execution context for workflowID, with
+// fresh state when isNewWorkflow is set
+func newExecutionContext(workflowID, orgID, workflowName string, tags map[string]string, isNewWorkflow bool) *ExecutionContext {
 	if orgID == "" {
 		orgID = "default"
 	}
@@ -130,7 +221,8 @@ func (ec *ExecutionContext) IsResuming() bool {
 	return ec.state == nil
 }
 
-// GetState returns the current workflow state
+// GetState returns the current workflow state. It is shared with the
+// workflow and must not be modified; ExtractState and Get return copies.
 func (ec *ExecutionContext) GetState() (*WorkflowState, error) {
 	ec.mu.RLock()
 	defer ec.mu.RUnlock()
@@ -140,12 +232,12 @@ func (ec *ExecutionContext) GetState() (*WorkflowState, error) {
 	return ec.state, nil
 }
 
-// SetState sets the workflow state
+// SetState sets the workflow state. The step counter is left untouched: it
+// tracks the replay position of the workflow code, not the restored state.
 func (ec *ExecutionContext) SetState(state *WorkflowState) {
 	ec.mu.Lock()
 	defer ec.mu.Unlock()
 	ec.state = state
-	ec.stepCounter = state.StepNumber
 }
 
 // IncrementStep increments the step counter
@@ -155,34 +247,79 @@ func (ec *ExecutionContext) IncrementStep() {
 	ec.stepCounter++
 }
 
+// stepCompleted advances the step counter past a completed step
+func (ec *ExecutionContext) stepCompleted(stepID string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.stepCounter++
+	ec.lastStepID = stepID
+}
+
+// currentStep returns the replay position of the next step
+func (ec *ExecutionContext) currentStep() int {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.stepCounter
+}
+
 // GenerateStepID generates a deterministic step ID
 func (ec *ExecutionContext) GenerateStepID(stepName string) string {
 	ec.mu.RLock()
 	defer ec.mu.RUnlock()
-	return fmt.Sprintf("%s_%d", stepName, ec.stepCounter)
+	return stepName + "_" + strconv.Itoa(ec.stepCounter)
 }
 
-// ExtractState extracts new state from a step result
+// ExtractState returns the state a step result would commit, with the
+// variables recorded with Set and Delete applied. A returned map is merged
+// into the variables first, so explicit changes take precedence. It commits
+// nothing: the recorded changes stay pending for the step's commit. The
+// state is a deep copy, safe to modify and to use from other goroutines.
 func (ec *ExecutionContext) ExtractState(result interface{}) *WorkflowState {
+	if state, ok := result.(*WorkflowState); ok {
+		return state
+	}
+	ec.mu.RLock()
+	state, _ := ec.buildState(result)
+	ec.mu.RUnlock()
+	state = deepCopyState(state)
+	state.Checksum = computeChecksum(state)
+	return state
+}
+
+// extractState extracts new state and the variables changed with Set or
+// Delete, consuming the changes. State it builds is left unsigned for the
+// caller to sign once stamped.
+func (ec *ExecutionContext) extractState(result interface{}) (*WorkflowState, map[string]struct{}) {
 	ec.mu.Lock()
 	defer ec.mu.Unlock()
 
 	// If result is already a WorkflowState, use it
 	if state, ok := result.(*WorkflowState); ok {
-		return state
+		ec.changes = nil
+		return state, nil
 	}
 
+	state, dirty := ec.buildState(result)
+	ec.changes = nil
+	return state, dirty
+}
+
+// buildState builds the state a result commits with the pending changes
+// applied. Callers must hold ec.mu.
+func (ec *ExecutionContext) buildState(result interface{}) (*WorkflowState, map[string]struct{}) {
 	currentVars := make(map[string]interface{})
 	for k, v := range ec.state.Variables {
 		currentVars[k] = v
 	}
 
-	// If result is a map, merge it
+	// If result is a map, merge it. Merged values are copied so the caller
+	// keeps the result it returned without aliasing committed state.
 	if m, ok := result.(map[string]interface{}); ok {
 		for k, v := range m {
-			currentVars[k] = v
+			currentVars[k] = deepCopyValue(v)
 		}
 	}
+	dirty := ec.applyChanges(currentVars)
 
 	newState := &WorkflowState{
 		WorkflowID: ec.state.WorkflowID,
@@ -193,9 +330,8 @@ func (ec *ExecutionContext) ExtractState(result interface{}) *WorkflowState {
 		Checksum:   "",
 		OrgID:      ec.OrgID,
 	}
-	newState.Checksum = computeChecksum(newState)
 
-	return newState
+	return newState, dirty
 }
 
 // SetEngine sets the execution engine
@@ -226,27 +362,45 @@ func (ec *ExecutionContext) GetLease() *Lease {
 	return ec.lease
 }
 
+// fencingToken returns the token of the held lease, or 0 without one
+func (ec *ExecutionContext) fencingToken() int64 {
+	if lease := ec.GetLease(); lease != nil {
+		return lease.FencingToken
+	}
+	return 0
+}
+
 // StartHeartbeat starts the background heartbeat goroutine
 func (ec *ExecutionContext) StartHeartbeat(lease *Lease, engine Engine) {
 	ec.mu.Lock()
 	ec.lease = lease
 	ec.engine = engine
-	ec.heartbeatStop = make(chan struct{})
+	stop := make(chan struct{})
+	ec.heartbeatStop = stop
 	ec.heartbeatWg.Add(1) // Add before releasing lock to prevent race with StopHeartbeat
+	tracker := ec.tracker
 	ec.mu.Unlock()
 
+	tracker.add(trackedHeartbeats, 1)
 	go func() {
 		defer ec.heartbeatWg.Done()
+		defer tracker.add(trackedHeartbeats, -1)
 		ticker := time.NewTicker(engine.LeaseManager().HeartbeatInterval())
 		defer ticker.Stop()
 
 		for {
 			select {
-			case <-ec.heartbeatStop:
+			case <-stop:
 				return
 			case <-ticker.C:
 				if err := engine.LeaseManager().Heartbeat(lease); err != nil {
 					fmt.Printf("Heartbeat failed for %s: %v\n", ec.WorkflowID, err)
+					atomic.StoreInt32(&ec.lostLease, 1)
+					ec.sticky.Invalidate(ec.WorkflowID)
+					notifyLifecycle(engine, ec, WebhookLeaseLost, map[string]interface{}{
+						"owner_id": lease.OwnerID,
+						"error":    err.Error(),
+					})
 					return
 				}
 			}
@@ -254,6 +408,11 @@ func (ec *ExecutionContext) StartHeartbeat(lease *Lease, engine Engine) {
 	}()
 }
 
+// leaseLost reports whether a heartbeat failed to renew the lease
+func (ec *ExecutionContext) leaseLost() bool {
+	return atomic.LoadInt32(&ec.lostLease) == 1
+}
+
 // StopHeartbeat stops the background heartbeat goroutine
 func (ec *ExecutionContext) StopHeartbeat() {
 	ec.mu.Lock()
@@ -265,7 +424,8 @@ func (ec *ExecutionContext) StopHeartbeat() {
 	ec.heartbeatWg.Wait()
 }
 
-// CreateSavepoint creates a rich savepoint with epistemic metadata
+// CreateSavepoint creates a rich savepoint with epistemic metadata. Nil
+// metadata captures what was recorded with the SavepointRecorder methods.
 func (ec *ExecutionContext) CreateSavepoint(metadata *SavepointMetadata) (string, error) {
 	savepointID := uuid.New().String()
 
@@ -274,6 +434,11 @@ func (ec *ExecutionContext) CreateSavepoint(metadata *SavepointMetadata) (string
 	engine := ec.engine
 	ec.mu.RUnlock()
 
+	// Without explicit metadata, use what the workflow recorded, falling
+	// back to the _savepoint_metadata variable convention
+	if metadata == nil {
+		metadata = ec.RecordedMetadata()
+	}
 	if metadata == nil {
 		if m, ok := state.Variables["_savepoint_metadata"].(map[string]interface{}); ok {
 			metadata = &SavepointMetadata{
@@ -287,11 +452,27 @@ func (ec *ExecutionContext) CreateSavepoint(metadata *SavepointMetadata) (string
 		}
 	}
 
+	snapshotRef := ""
+	if store, ok := engineAs[SavepointStore](engine); ok {
+		info := SavepointInfo{
+			SavepointID: savepointID,
+			WorkflowID:  ec.WorkflowID,
+			StepNumber:  state.StepNumber,
+			CreatedAt:   time.Now().UTC(),
+			Metadata:    *metadata,
+		}
+		if err := store.SaveSavepoint(info, state); err != nil {
+			return "", err
+		}
+		snapshotRef = savepointID
+	}
+
 	if engine != nil {
 		event := map[string]interface{}{
 			"event_id":            uuid.New().String(),
 			"workflow_id":         ec.WorkflowID,
 			"org_id":              ec.OrgID,
+			"fencing_token":       ec.fencingToken(),
 			"timestamp":           time.Now().UTC().Format(time.RFC3339),
 			"event_type":          "savepoint_created",
 			"savepoint_id":        savepointID,
@@ -301,18 +482,95 @@ func (ec *ExecutionContext) CreateSavepoint(metadata *SavepointMetadata) (string
 			"open_questions":      metadata.Questions,
 			"decision_log":        metadata.Decisions,
 			"next_step":           metadata.NextStep,
-			"snapshot_ref":        "",
+			"snapshot_ref":        snapshotRef,
 		}
 		if err := engine.Journal().Append(event); err != nil {
 			return "", err
 		}
 	}
 
+	notifyLifecycle(engine, ec, WebhookSavepointCreated, map[string]interface{}{
+		"savepoint_id": savepointID,
+		"step_number":  state.StepNumber,
+	})
 	fmt.Printf("Created savepoint %s at step %d\n", savepointID, state.StepNumber)
 	return savepointID, nil
 }
 
-// UpdateTags updates workflow tags
+// Annotate journals an operator note alongside the workflow's events
+func (ec *ExecutionContext) Annotate(annotation Annotation) error {
+	ec.mu.RLock()
+	engine := ec.engine
+	stepNumber := ec.stepCounter
+	ec.mu.RUnlock()
+
+	if annotation.AnnotationID == "" {
+		annotation.AnnotationID = uuid.New().String()
+	}
+	if annotation.CreatedAt.IsZero() {
+		annotation.CreatedAt = time.Now().UTC()
+	}
+
+	if engine == nil {
+		return fmt.Errorf("no execution engine in context")
+	}
+	return engine.Journal().Append(map[string]interface{}{
+		"event_id":      uuid.New().String(),
+		"workflow_id":   ec.WorkflowID,
+		"org_id":        ec.OrgID,
+		"fencing_token": ec.fencingToken(),
+		"timestamp":     annotation.CreatedAt.Format(time.RFC3339),
+		"event_type":    "annotation_added",
+		"annotation_id": annotation.AnnotationID,
+		"step_number":   stepNumber,
+		"author":        annotation.Author,
+		"text":          annotation.Text,
+		"labels":        annotation.Labels,
+	})
+}
+
+// Suspend parks the workflow, e.g. while it waits hours for a webhook or a
+// human: return the error it gives from the workflow function, not from a
+// step, and the runner checkpoints the workflow, journals the suspension,
+// marks it suspended and releases its lease, so the process can exit.
+// Running the workflow ID again resumes it, whether through Client.Resume,
+// SignalWithStart or a WorkflowRunner.
+//
+// The resumed run replays up to the suspension, where Suspend returns nil,
+// so check for what the workflow waits on in a loop:
+//
+//	for {
+//		approval, ok, err := contd.ReceiveSignal[string](ctx, "approved")
+//		if err != nil {
+//			return nil, err
+//		}
+//		if ok {
+//			return approval, nil
+//		}
+//		if err := ec.Suspend("awaiting approval"); err != nil {
+//			return nil, err
+//		}
+//	}
+func (ec *ExecutionContext) Suspend(reason string) error {
+	ec.mu.RLock()
+	resumedHere := ec.resumed != nil && ec.stepCounter <= ec.resumed.StepNumber
+	ec.mu.RUnlock()
+	if resumedHere {
+		return nil
+	}
+	return NewWorkflowSuspended(ec.WorkflowID, reason)
+}
+
+// catchingUp reports whether a resumed run is still replaying steps the
+// workflow had completed before it stopped
+func (ec *ExecutionContext) catchingUp() bool {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.replaying || (ec.resumed != nil && ec.stepCounter < ec.resumed.StepNumber)
+}
+
+// UpdateTags updates workflow tags. Changes are pushed to the server at the
+// next checkpoint when the runner has a TagSyncer.
 func (ec *ExecutionContext) UpdateTags(newTags map[string]string) {
 	ec.mu.Lock()
 	defer ec.mu.Unlock()
@@ -320,30 +578,53 @@ func (ec *ExecutionContext) UpdateTags(newTags map[string]string) {
 	if ec.Tags == nil {
 		ec.Tags = make(map[string]string)
 	}
+	if ec.pendingTags == nil {
+		ec.pendingTags = make(map[string]string)
+	}
 	for k, v := range newTags {
 		ec.Tags[k] = v
+		ec.pendingTags[k] = v
 	}
 
+	// Committed state is shared with the engine, so the tags go into a
+	// new state rather than the current one
 	if ec.state != nil {
-		metadata := ec.state.Metadata
-		if metadata == nil {
-			metadata = make(map[string]interface{})
-		}
-		tags, _ := metadata["tags"].(map[string]string)
-		if tags == nil {
-			tags = make(map[string]string)
+		updated := copyState(ec.state)
+		stored, _ := ec.state.Metadata["tags"].(map[string]string)
+		tags := make(map[string]string, len(stored)+len(newTags))
+		for k, v := range stored {
+			tags[k] = v
 		}
 		for k, v := range newTags {
 			tags[k] = v
 		}
-		metadata["tags"] = tags
-		ec.state.Metadata = metadata
+		updated.Metadata["tags"] = tags
+		updated.Checksum = ""
+		updated.Checksum = computeChecksum(updated)
+		ec.state = updated
 	}
 }
 
+// appendEvent journals an event stamped with the context's workflow and org
+func appendEvent(engine Engine, ec *ExecutionContext, eventType string, fields map[string]interface{}) error {
+	event := ec.newEvent(eventType, len(fields))
+	for k, v := range fields {
+		event[k] = v
+	}
+	return engine.Journal().Append(event)
+}
+
 func computeChecksum(state *WorkflowState) string {
-	data, _ := json.Marshal(state)
-	hash := sha256.Sum256(data)
+	var hash [sha256.Size]byte
+	buf := jsonBuffers.Get().(*[]byte)
+	if data, ok := appendState((*buf)[:0], state); ok {
+		hash = sha256.Sum256(data)
+		*buf = data
+	} else {
+		data, _ := json.Marshal(state)
+		hash = sha256.Sum256(data)
+	}
+	releaseJSON(buf)
 	return hex.EncodeToString(hash[:])
 }
 
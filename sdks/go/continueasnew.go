@@ -0,0 +1,61 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+)
+
+// ContinuedFromTag records on a continued workflow the workflow it continues
+const ContinuedFromTag = "contd.continued_from"
+
+// ContinueAsNewWith returns the error that ends the running workflow so the
+// runner continues it as a fresh workflow started with input. Long-running
+// workflows return it once GetInfo suggests their history is large, passing
+// whatever the fresh workflow needs to pick up where this one left off.
+func ContinueAsNewWith(ctx context.Context, input interface{}) error {
+	ec, err := Current(ctx)
+	if err != nil {
+		return err
+	}
+	return NewContinueAsNew(ec.WorkflowID, input, "requested")
+}
+
+// finishContinueAsNew completes a workflow that continues as new, naming
+// the workflow that continues it
+func (r *WorkflowRunner) finishContinueAsNew(ec *ExecutionContext, next *ContinueAsNew) error {
+	if state, _ := ec.GetState(); state != nil {
+		if err := r.engine.MaybeSnapshot(state); err != nil {
+			return err
+		}
+	}
+	next.WorkflowID = ec.WorkflowID
+	next.NextWorkflowID = newWorkflowID()
+	next.Details["next_workflow_id"] = next.NextWorkflowID
+	if err := appendEvent(r.engine, ec, "workflow_continued_as_new", map[string]interface{}{
+		"next_workflow_id": next.NextWorkflowID,
+		"reason":           next.Reason,
+	}); err != nil {
+		return err
+	}
+	if err := r.engine.CompleteWorkflow(ec.WorkflowID); err != nil {
+		return err
+	}
+	recordStatus(r.engine, ec.WorkflowID, WorkflowStatusCompleted)
+	r.sticky.retain(ec, nil)
+	fmt.Printf("Workflow %s continued as new as %s (%s)\n", ec.WorkflowID, next.NextWorkflowID, next.Reason)
+	return next
+}
+
+// continuedConfig is the config of the workflow continuing previous under
+// next.NextWorkflowID
+func continuedConfig(previous WorkflowConfig, next *ContinueAsNew) WorkflowConfig {
+	config := previous
+	config.WorkflowID = next.NextWorkflowID
+	config.BusinessKey, config.IDReusePolicy, config.ResumeFromSavepoint = "", "", ""
+	config.Tags = make(map[string]string, len(previous.Tags)+1)
+	for k, v := range previous.Tags {
+		config.Tags[k] = v
+	}
+	config.Tags[ContinuedFromTag] = next.WorkflowID
+	return config
+}
@@ -0,0 +1,217 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// StepUsage is the model usage a step reports, typically one LLM call
+type StepUsage struct {
+	Model        string  `json:"model,omitempty"`
+	InputTokens  int64   `json:"input_tokens,omitempty"`
+	OutputTokens int64   `json:"output_tokens,omitempty"`
+	CostUSD      float64 `json:"cost_usd,omitempty"`
+}
+
+// ModelUsage aggregates the usage of one model
+type ModelUsage struct {
+	Calls        int     `json:"calls"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// WorkflowUsage aggregates the usage of a step or a whole workflow
+type WorkflowUsage struct {
+	InputTokens  int64                 `json:"input_tokens"`
+	OutputTokens int64                 `json:"output_tokens"`
+	CostUSD      float64               `json:"cost_usd"`
+	ByModel      map[string]ModelUsage `json:"by_model,omitempty"`
+}
+
+// TotalTokens returns the input and output tokens combined
+func (u WorkflowUsage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// add accumulates a single usage report
+func (u *WorkflowUsage) add(s StepUsage) {
+	u.InputTokens += s.InputTokens
+	u.OutputTokens += s.OutputTokens
+	u.CostUSD += s.CostUSD
+	if s.Model == "" {
+		return
+	}
+	if u.ByModel == nil {
+		u.ByModel = make(map[string]ModelUsage)
+	}
+	m := u.ByModel[s.Model]
+	m.Calls++
+	m.InputTokens += s.InputTokens
+	m.OutputTokens += s.OutputTokens
+	m.CostUSD += s.CostUSD
+	u.ByModel[s.Model] = m
+}
+
+// merge accumulates another aggregate
+func (u *WorkflowUsage) merge(o WorkflowUsage) {
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CostUSD += o.CostUSD
+	for model, mu := range o.ByModel {
+		if u.ByModel == nil {
+			u.ByModel = make(map[string]ModelUsage)
+		}
+		m := u.ByModel[model]
+		m.Calls += mu.Calls
+		m.InputTokens += mu.InputTokens
+		m.OutputTokens += mu.OutputTokens
+		m.CostUSD += mu.CostUSD
+		u.ByModel[model] = m
+	}
+}
+
+// Budget caps a workflow's spend. Once exceeded, the workflow is suspended
+// before its next step; resume it with a raised budget. Zero fields are
+// unlimited.
+type Budget struct {
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
+	MaxTokens  int64   `json:"max_tokens,omitempty"`
+}
+
+// check returns BudgetExceeded if usage is over either limit
+func (b *Budget) check(workflowID string, usage WorkflowUsage) error {
+	if b == nil {
+		return nil
+	}
+	if b.MaxCostUSD > 0 && usage.CostUSD > b.MaxCostUSD {
+		return NewBudgetExceeded(workflowID, "cost_usd", usage.CostUSD, b.MaxCostUSD)
+	}
+	if b.MaxTokens > 0 && usage.TotalTokens() > b.MaxTokens {
+		return NewBudgetExceeded(workflowID, "tokens", float64(usage.TotalTokens()), float64(b.MaxTokens))
+	}
+	return nil
+}
+
+// StepMetrics collects the usage reported by a running step. Usage is
+// journaled with the step and counted against the workflow's budget, even
+// when the step fails.
+type StepMetrics struct {
+	mu       sync.Mutex
+	usage    WorkflowUsage
+	recorded bool
+}
+
+const stepMetricsKey contextKey = "contd_step_metrics"
+
+// Metrics returns the usage recorder of the step running in ctx. Outside a
+// step it returns nil, on which Record is a no-op.
+func Metrics(ctx context.Context) *StepMetrics {
+	m, _ := ctx.Value(stepMetricsKey).(*StepMetrics)
+	return m
+}
+
+// Record reports usage for the step
+func (m *StepMetrics) Record(usage StepUsage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.add(usage)
+	m.recorded = true
+}
+
+// total returns the step's aggregate usage, or nil if none was recorded
+func (m *StepMetrics) total() *WorkflowUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.recorded {
+		return nil
+	}
+	usage := m.usage
+	return &usage
+}
+
+// Usage returns the workflow's accumulated usage
+func (ec *ExecutionContext) Usage() WorkflowUsage {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.usageLocked()
+}
+
+// usageLocked reads the usage kept in state metadata. Must be called with
+// ec.mu held.
+func (ec *ExecutionContext) usageLocked() WorkflowUsage {
+	var usage WorkflowUsage
+	if ec.state == nil {
+		return usage
+	}
+	switch v := ec.state.Metadata["usage"].(type) {
+	case WorkflowUsage:
+		usage = v
+	case nil:
+	default:
+		// Usage restored from a snapshot is decoded generically
+		convert(nil, v, &usage)
+	}
+	return usage
+}
+
+// addUsage adds a step's usage to the workflow's total in state metadata
+func (ec *ExecutionContext) addUsage(step WorkflowUsage) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.state == nil {
+		return
+	}
+	usage := ec.usageLocked()
+	// Copy the per-model map so earlier snapshots sharing it are unaffected
+	merged := WorkflowUsage{InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens, CostUSD: usage.CostUSD}
+	merged.merge(WorkflowUsage{ByModel: usage.ByModel})
+	merged.merge(step)
+	if ec.state.Metadata == nil {
+		ec.state.Metadata = make(map[string]interface{})
+	}
+	ec.state.Metadata["usage"] = merged
+}
+
+// checkBudget returns BudgetExceeded once the workflow is over budget
+func (ec *ExecutionContext) checkBudget() error {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.budget.check(ec.WorkflowID, ec.usageLocked())
+}
+
+// BudgetStatus reports a workflow's spend against its budget
+type BudgetStatus struct {
+	WorkflowID string        `json:"workflow_id"`
+	Budget     *Budget       `json:"budget,omitempty"`
+	Usage      WorkflowUsage `json:"usage"`
+	// RemainingCostUSD and RemainingTokens are nil when unlimited
+	RemainingCostUSD *float64 `json:"remaining_cost_usd,omitempty"`
+	RemainingTokens  *int64   `json:"remaining_tokens,omitempty"`
+	Exceeded         bool     `json:"exceeded"`
+}
+
+// GetBudget returns a workflow's usage and remaining budget
+func (c *Client) GetBudget(ctx context.Context, workflowID string) (*BudgetStatus, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/workflows/%s/budget", workflowID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result BudgetStatus
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,311 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// dagPrefix prefixes the workflow variables holding DAG node results
+const dagPrefix = "_dag."
+
+// DAG is a declarative workflow definition whose steps run once their
+// dependencies complete. Independent branches execute in parallel.
+type DAG struct {
+	nodes       []*dagNode
+	index       map[string]*dagNode
+	last        *dagNode
+	maxParallel int
+	merge       MergeStrategy
+	mergeFn     MergeFunc
+	err         error
+}
+
+type dagNode struct {
+	name   string
+	fn     StepFunc
+	deps   []string
+	config StepConfig
+}
+
+// dagResult reports the outcome of a single node execution
+type dagResult struct {
+	name   string
+	result interface{}
+	err    error
+}
+
+// NewDAG creates an empty DAG
+func NewDAG() *DAG {
+	return &DAG{
+		index: make(map[string]*dagNode),
+	}
+}
+
+// Step adds a node to the DAG. Subsequent After/With* calls apply to it.
+// The node receives a map of its dependencies' results as input, or the
+// DAG's input if it has no dependencies.
+func (d *DAG) Step(name string, fn StepFunc) *DAG {
+	if _, exists := d.index[name]; exists {
+		d.setErr(NewConfigurationError(fmt.Sprintf("duplicate DAG step %q", name), "dag.step"))
+		return d
+	}
+	node := &dagNode{name: name, fn: fn, config: DefaultStepConfig()}
+	d.nodes = append(d.nodes, node)
+	d.index[name] = node
+	d.last = node
+	return d
+}
+
+// After declares dependencies of the most recently added step
+func (d *DAG) After(deps ...string) *DAG {
+	if d.last == nil {
+		d.setErr(NewConfigurationError("After called before Step", "dag.after"))
+		return d
+	}
+	d.last.deps = append(d.last.deps, deps...)
+	return d
+}
+
+// WithConfig sets the step config of the most recently added step
+func (d *DAG) WithConfig(config StepConfig) *DAG {
+	if d.last == nil {
+		d.setErr(NewConfigurationError("WithConfig called before Step", "dag.config"))
+		return d
+	}
+	d.last.config = config
+	return d
+}
+
+// WithRetry sets the retry policy of the most recently added step
+func (d *DAG) WithRetry(policy RetryPolicy) *DAG {
+	if d.last == nil {
+		d.setErr(NewConfigurationError("WithRetry called before Step", "dag.retry"))
+		return d
+	}
+	d.last.config.Retry = &policy
+	return d
+}
+
+// WithTimeout sets the timeout of the most recently added step
+func (d *DAG) WithTimeout(timeout time.Duration) *DAG {
+	if d.last == nil {
+		d.setErr(NewConfigurationError("WithTimeout called before Step", "dag.timeout"))
+		return d
+	}
+	d.last.config.Timeout = timeout
+	return d
+}
+
+// MaxParallel bounds how many nodes run at once (0 means unbounded)
+func (d *DAG) MaxParallel(n int) *DAG {
+	d.maxParallel = n
+	return d
+}
+
+// MergeVariables sets how conflicting variable writes of parallel nodes are
+// resolved (the default is MergeLastWriteWins). Nodes write in their own
+// namespace with SetVar; a map result counts as writes to its keys.
+func (d *DAG) MergeVariables(strategy MergeStrategy, merge MergeFunc) *DAG {
+	if strategy == MergeCustom && merge == nil {
+		d.setErr(NewConfigurationError("MergeCustom requires a MergeFunc", "dag.merge"))
+		return d
+	}
+	d.merge, d.mergeFn = strategy, merge
+	return d
+}
+
+func (d *DAG) setErr(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// Validate checks for unknown dependencies and cycles, returning the nodes
+// in a deterministic topological order
+func (d *DAG) Validate() ([]string, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	indegree := make(map[string]int, len(d.nodes))
+	dependents := make(map[string][]string, len(d.nodes))
+	for _, node := range d.nodes {
+		indegree[node.name] = len(node.deps)
+		for _, dep := range node.deps {
+			if _, ok := d.index[dep]; !ok {
+				return nil, NewConfigurationError(fmt.Sprintf("DAG step %q depends on unknown step %q", node.name, dep), "dag.after")
+			}
+			dependents[dep] = append(dependents[dep], node.name)
+		}
+	}
+
+	var ready []string
+	for _, node := range d.nodes {
+		if indegree[node.name] == 0 {
+			ready = append(ready, node.name)
+		}
+	}
+
+	order := make([]string, 0, len(d.nodes))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+		for _, next := range dependents[name] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	if len(order) != len(d.nodes) {
+		return nil, NewConfigurationError("DAG contains a dependency cycle", "dag.after")
+	}
+	return order, nil
+}
+
+// Run executes the DAG inside the current workflow and returns each node's
+// result keyed by step name. Each node is journaled as its own step, so
+// completed nodes are served from cache when the workflow resumes.
+func (d *DAG) Run(ctx context.Context) (map[string]interface{}, error) {
+	return d.RunWithInput(ctx, nil)
+}
+
+// RunWithInput runs the DAG like Run, passing input to the nodes without
+// dependencies
+func (d *DAG) RunWithInput(ctx context.Context, input interface{}) (map[string]interface{}, error) {
+	order, err := d.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ec, err := Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	engine := ec.GetEngine()
+	if engine == nil {
+		return nil, fmt.Errorf("no execution engine in context")
+	}
+
+	if err := appendEvent(engine, ec, "dag_started", map[string]interface{}{"nodes": order}); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	remaining := make(map[string]int, len(d.nodes))
+	for _, node := range d.nodes {
+		remaining[node.name] = len(node.deps)
+	}
+
+	results := make(map[string]interface{}, len(d.nodes))
+	group := NewBranchGroup("dag", d.merge, d.mergeFn)
+	done := make(chan dagResult)
+	running := 0
+	var firstErr error
+
+	launch := func(node *dagNode) {
+		var nodeInput interface{} = input
+		if len(node.deps) > 0 || input == nil {
+			deps := make(map[string]interface{}, len(node.deps))
+			for _, dep := range node.deps {
+				deps[dep] = results[dep]
+			}
+			nodeInput = deps
+		}
+		running++
+		go func() {
+			runner := NewStepRunner(node.config)
+			result, err := runner.run(group.Branch(ctx, node.name), node.name, "dag."+node.name, node.storingFn(), nodeInput)
+			// A node served from cache returns the state it committed
+			if state, ok := result.(*WorkflowState); ok {
+				result = state.Variables[dagPrefix+node.name]
+			}
+			done <- dagResult{name: node.name, result: result, err: err}
+		}()
+	}
+
+	// pending holds ready nodes in topological order
+	var pending []*dagNode
+	for _, name := range order {
+		if remaining[name] == 0 {
+			pending = append(pending, d.index[name])
+		}
+	}
+
+	for len(pending) > 0 || running > 0 {
+		for firstErr == nil && len(pending) > 0 && (d.maxParallel <= 0 || running < d.maxParallel) {
+			launch(pending[0])
+			pending = pending[1:]
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-done
+		running--
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+				cancel()
+			}
+			continue
+		}
+		results[res.name] = res.result
+
+		for _, name := range order {
+			node := d.index[name]
+			for _, dep := range node.deps {
+				if dep == res.name {
+					remaining[name]--
+					if remaining[name] == 0 {
+						pending = append(pending, node)
+					}
+				}
+			}
+		}
+	}
+
+	if firstErr != nil {
+		appendEvent(engine, ec, "dag_failed", map[string]interface{}{"error": firstErr.Error()})
+		return nil, firstErr
+	}
+
+	if err := appendEvent(engine, ec, "dag_completed", map[string]interface{}{"nodes": order}); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// storingFn runs the node's function and keeps its result in state, so a
+// resumed workflow can hand it to the node's dependents
+func (n *dagNode) storingFn() StepFunc {
+	return func(ctx context.Context, input interface{}) (interface{}, error) {
+		result, err := n.fn(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if err := SetVar(ctx, dagPrefix+n.name, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// Workflow adapts the DAG into a WorkflowFunc for use with WorkflowRunner.
+// The workflow's input is passed to the nodes without dependencies.
+func (d *DAG) Workflow() WorkflowFunc {
+	return func(ctx context.Context, input interface{}) (interface{}, error) {
+		results, err := d.RunWithInput(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+}
@@ -0,0 +1,179 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeadLetter records a step that permanently failed
+type DeadLetter struct {
+	WorkflowID string         `json:"workflow_id"`
+	OrgID      string         `json:"org_id"`
+	StepID     string         `json:"step_id"`
+	StepName   string         `json:"step_name"`
+	Attempts   int            `json:"attempts"`
+	Input      interface{}    `json:"input,omitempty"`
+	ErrorChain []string       `json:"error_chain"`
+	State      *WorkflowState `json:"state,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	RedrivenAt *time.Time     `json:"redriven_at,omitempty"`
+}
+
+// DeadLetterQueue stores permanently failed steps. MarkRedriven also
+// resets the step's attempt count, so a redriven step gets its retry
+// policy's full budget again.
+type DeadLetterQueue interface {
+	Put(letter DeadLetter) error
+	List(workflowID string) ([]DeadLetter, error)
+	MarkRedriven(workflowID, stepID string, at time.Time) (*DeadLetter, error)
+}
+
+// DeadLetterProvider is implemented by engines with a dead-letter queue
+type DeadLetterProvider interface {
+	DeadLetters() DeadLetterQueue
+}
+
+// errorChain flattens an error and everything it wraps into messages,
+// skipping embedded bases that repeat their wrapper's message
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		if msg := err.Error(); len(chain) == 0 || chain[len(chain)-1] != msg {
+			chain = append(chain, msg)
+		}
+		err = errors.Unwrap(err)
+	}
+	return chain
+}
+
+// deadLetter records a permanently failed step if the engine supports it.
+// A step fails permanently when it runs out of attempts or fails with an
+// error marked NonRetryable; an ApplicationFailure is a workflow outcome,
+// not a failed step, and is never dead-lettered.
+func deadLetter(engine Engine, ec *ExecutionContext, stepID, stepName string, attempts int, input interface{}, err error) {
+	provider, ok := engineAs[DeadLetterProvider](engine)
+	if !ok {
+		return
+	}
+
+	state, _ := ec.GetState()
+	letter := DeadLetter{
+		WorkflowID: ec.WorkflowID,
+		OrgID:      ec.OrgID,
+		StepID:     stepID,
+		StepName:   stepName,
+		Attempts:   attempts,
+		Input:      input,
+		ErrorChain: errorChain(err),
+		State:      copyState(state),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if putErr := provider.DeadLetters().Put(letter); putErr != nil {
+		fmt.Printf("Failed to dead-letter step %s: %v\n", stepID, putErr)
+		return
+	}
+	appendEvent(engine, ec, "step_dead_lettered", map[string]interface{}{
+		"step_id":     stepID,
+		"step_name":   stepName,
+		"attempts":    attempts,
+		"error_chain": letter.ErrorChain,
+	})
+}
+
+// Redrive marks a dead-lettered step for retry on a local engine. The step
+// was never marked completed, so running the workflow again with its
+// WorkflowID re-executes it, starting over at attempt 1.
+func Redrive(engine Engine, workflowID, stepID string) (*DeadLetter, error) {
+	provider, ok := engineAs[DeadLetterProvider](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support dead letters", "dead_letters")
+	}
+	letter, err := provider.DeadLetters().MarkRedriven(workflowID, stepID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := engine.Journal().Append(map[string]interface{}{
+		"event_id":    uuid.New().String(),
+		"workflow_id": workflowID,
+		"org_id":      letter.OrgID,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"event_type":  "step_redriven",
+		"step_id":     stepID,
+	}); err != nil {
+		return nil, err
+	}
+	return letter, nil
+}
+
+// ListDeadLettersInput contains parameters for listing dead letters
+type ListDeadLettersInput struct {
+	WorkflowID string
+	Limit      int
+	Offset     int
+}
+
+// ListDeadLettersOutput contains the result of listing dead letters
+type ListDeadLettersOutput struct {
+	DeadLetters []DeadLetter `json:"dead_letters"`
+	Total       int          `json:"total"`
+}
+
+// ListDeadLetters lists permanently failed steps
+func (c *Client) ListDeadLetters(ctx context.Context, input ListDeadLettersInput) (*ListDeadLettersOutput, error) {
+	params := url.Values{}
+	if input.WorkflowID != "" {
+		params.Set("workflow_id", input.WorkflowID)
+	}
+	if input.Limit > 0 {
+		params.Set("limit", fmt.Sprintf("%d", input.Limit))
+	}
+	if input.Offset > 0 {
+		params.Set("offset", fmt.Sprintf("%d", input.Offset))
+	}
+
+	path := "/v1/dead-letters"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, err := c.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ListDeadLettersOutput
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Redrive retries a dead-lettered step and resumes its workflow
+func (c *Client) Redrive(ctx context.Context, workflowID, stepID string) (string, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return "", err
+	}
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/steps/%s/redrive", workflowID, url.PathEscape(stepID)), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Status, nil
+}
@@ -0,0 +1,175 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// elapsedMetadataKey is the state metadata key holding accumulated run time
+const elapsedMetadataKey = "elapsed_ms"
+
+// errDeadlineExceeded is the cancellation cause when MaxDuration is reached
+var errDeadlineExceeded = errors.New("workflow max duration exceeded")
+
+// DeadlineExtender is consulted when a workflow reaches MaxDuration. A
+// positive extension keeps the workflow running for that much longer.
+type DeadlineExtender func(ctx context.Context, workflowID string, elapsed time.Duration) (time.Duration, error)
+
+// workflowDeadline enforces MaxDuration across resumes
+type workflowDeadline struct {
+	mu        sync.Mutex
+	prior     time.Duration
+	started   time.Time
+	limit     time.Duration
+	timer     *time.Timer
+	cancel    context.CancelCauseFunc
+	extend    DeadlineExtender
+	ctx       context.Context
+	workflow  string
+	exhausted bool
+}
+
+// priorElapsed reads the run time accumulated by previous executions
+func priorElapsed(state *WorkflowState) time.Duration {
+	if state == nil || state.Metadata == nil {
+		return 0
+	}
+	switch v := state.Metadata[elapsedMetadataKey].(type) {
+	case int64:
+		return time.Duration(v) * time.Millisecond
+	case int:
+		return time.Duration(v) * time.Millisecond
+	case float64:
+		return time.Duration(v) * time.Millisecond
+	case json.Number:
+		ms, _ := v.Int64()
+		return time.Duration(ms) * time.Millisecond
+	}
+	return 0
+}
+
+// startDeadline derives a context that is cancelled once the workflow's
+// total run time reaches limit, unless extended
+func startDeadline(ctx context.Context, workflowID string, prior, limit time.Duration, extend DeadlineExtender) (context.Context, *workflowDeadline) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	d := &workflowDeadline{
+		prior:    prior,
+		started:  time.Now(),
+		limit:    limit,
+		cancel:   cancel,
+		extend:   extend,
+		ctx:      ctx,
+		workflow: workflowID,
+	}
+	remaining := limit - prior
+	if remaining < 0 {
+		remaining = 0
+	}
+	d.mu.Lock()
+	d.timer = time.AfterFunc(remaining, d.fire)
+	d.mu.Unlock()
+	return ctx, d
+}
+
+func (d *workflowDeadline) fire() {
+	elapsed := d.Elapsed()
+	if d.extend != nil {
+		extension, err := d.extend(d.ctx, d.workflow, elapsed)
+		if err == nil && extension > 0 {
+			d.mu.Lock()
+			d.limit += extension
+			d.timer.Reset(extension)
+			d.mu.Unlock()
+			fmt.Printf("Extended deadline for workflow %s by %v\n", d.workflow, extension)
+			return
+		}
+	}
+	d.mu.Lock()
+	d.exhausted = true
+	d.mu.Unlock()
+	d.cancel(errDeadlineExceeded)
+}
+
+// Elapsed returns the total run time including previous executions
+func (d *workflowDeadline) Elapsed() time.Duration {
+	return d.prior + time.Since(d.started)
+}
+
+// Limit returns the current limit including extensions
+func (d *workflowDeadline) Limit() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.limit
+}
+
+// Exceeded reports whether the deadline fired
+func (d *workflowDeadline) Exceeded() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.exhausted
+}
+
+// Stop releases the deadline's timer and context
+func (d *workflowDeadline) Stop() {
+	d.mu.Lock()
+	d.timer.Stop()
+	d.mu.Unlock()
+	d.cancel(nil)
+}
+
+// persistElapsed records the accumulated run time in state metadata and
+// checkpoints it so the next execution continues the clock
+func persistElapsed(engine Engine, ec *ExecutionContext, elapsed time.Duration) error {
+	state, err := ec.GetState()
+	if err != nil {
+		return nil
+	}
+	updated := copyState(state)
+	updated.Metadata[elapsedMetadataKey] = elapsed.Milliseconds()
+	updated.StateVersion++
+	updated.Checksum = ""
+	updated.Checksum = computeChecksum(updated)
+	ec.SetState(updated)
+	return engine.MaybeSnapshot(updated)
+}
+
+// ExtendDeadline extends a workflow's MaxDuration on the server
+func (c *Client) ExtendDeadline(ctx context.Context, workflowID string, extension time.Duration) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]int64{"extension_ms": extension.Milliseconds()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/extend", workflowID), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DeadlineExtender returns an extender that extends each deadline by
+// extension through the API, at most maxExtensions times
+func (c *Client) DeadlineExtender(extension time.Duration, maxExtensions int) DeadlineExtender {
+	var mu sync.Mutex
+	used := 0
+	return func(ctx context.Context, workflowID string, elapsed time.Duration) (time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if used >= maxExtensions {
+			return 0, nil
+		}
+		if err := c.ExtendDeadline(ctx, workflowID, extension); err != nil {
+			return 0, err
+		}
+		used++
+		return extension, nil
+	}
+}
@@ -0,0 +1,189 @@
+// Package definitions runs workflows declared in YAML or JSON. Each step
+// of a definition invokes a step registered in a contd.StepRegistry, so
+// the Go code supplies the building blocks and the definition wires them
+// together:
+//
+//	name: onboard
+//	steps:
+//	  - id: fetch
+//	    step: fetch_account
+//	    input: {account_id: "${input.account_id}"}
+//	  - id: notify
+//	    step: send_email
+//	    after: [fetch]
+//	    if: steps.fetch.active && steps.fetch.plan != "free"
+//	    for_each: steps.fetch.contacts
+//	    input: {to: "${item.email}", name: "${steps.fetch.name}"}
+//	    retry: {max_attempts: 5}
+//	    timeout: 30s
+//
+// Expressions reference the workflow input as input, earlier results as
+// steps.<id>, and the current element and its position as item and index
+// inside a for_each loop.
+package definitions
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+	"gopkg.in/yaml.v3"
+)
+
+// Definition is a declarative workflow
+type Definition struct {
+	Name        string     `json:"name" yaml:"name"`
+	Description string     `json:"description,omitempty" yaml:"description,omitempty"`
+	Steps       []StepSpec `json:"steps" yaml:"steps"`
+}
+
+// StepSpec is one step of a definition
+type StepSpec struct {
+	// ID names the step within the definition and in the journal
+	ID string `json:"id" yaml:"id"`
+	// Step is the registered step to invoke (defaults to ID)
+	Step string `json:"step,omitempty" yaml:"step,omitempty"`
+	// After lists steps that must finish first
+	After []string `json:"after,omitempty" yaml:"after,omitempty"`
+	// Input is passed to the step after its ${...} expressions are
+	// resolved (defaults to the workflow input)
+	Input interface{} `json:"input,omitempty" yaml:"input,omitempty"`
+	// If skips the step unless the expression is true; a skipped step's
+	// result is null
+	If string `json:"if,omitempty" yaml:"if,omitempty"`
+	// ForEach runs the step once per element of the list the expression
+	// yields; the step's result is the list of results
+	ForEach string     `json:"for_each,omitempty" yaml:"for_each,omitempty"`
+	Retry   *RetrySpec `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// Timeout bounds each invocation, e.g. "30s"
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// RetrySpec overrides the retry policy of the registered step. Unset
+// fields keep contd.DefaultRetryPolicy's values.
+type RetrySpec struct {
+	MaxAttempts int     `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	BackoffBase float64 `json:"backoff_base,omitempty" yaml:"backoff_base,omitempty"`
+	BackoffMax  float64 `json:"backoff_max,omitempty" yaml:"backoff_max,omitempty"`
+}
+
+// Parse decodes a definition from YAML or JSON
+func Parse(data []byte) (*Definition, error) {
+	var d Definition
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow definition: %w", err)
+	}
+	return &d, nil
+}
+
+// Load reads a definition from a YAML or JSON file
+func Load(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// stepName returns the registered step a spec invokes
+func (s *StepSpec) stepName() string {
+	if s.Step != "" {
+		return s.Step
+	}
+	return s.ID
+}
+
+// config returns the step config to invoke the spec with, starting from
+// the registered step's
+func (s *StepSpec) config(base contd.StepConfig) (contd.StepConfig, error) {
+	if s.Retry != nil {
+		policy := contd.DefaultRetryPolicy()
+		if base.Retry != nil {
+			policy = *base.Retry
+		}
+		if s.Retry.MaxAttempts > 0 {
+			policy.MaxAttempts = s.Retry.MaxAttempts
+		}
+		if s.Retry.BackoffBase > 0 {
+			policy.BackoffBase = s.Retry.BackoffBase
+		}
+		if s.Retry.BackoffMax > 0 {
+			policy.BackoffMax = s.Retry.BackoffMax
+		}
+		base.Retry = &policy
+	}
+	if s.Timeout != "" {
+		timeout, err := time.ParseDuration(s.Timeout)
+		if err != nil || timeout <= 0 {
+			return base, contd.NewConfigurationError(fmt.Sprintf("step %q has invalid timeout %q", s.ID, s.Timeout), "definition.timeout")
+		}
+		base.Timeout = timeout
+	}
+	return base, nil
+}
+
+// Validate checks that step IDs are unique, dependencies exist and form no
+// cycle, every step is registered in steps and every expression parses.
+// It returns the step IDs in the order they run.
+func (d *Definition) Validate(steps *contd.StepRegistry) ([]string, error) {
+	if d.Name == "" {
+		return nil, contd.NewConfigurationError("workflow definition needs a name", "definition.name")
+	}
+	index := make(map[string]*StepSpec, len(d.Steps))
+	for i := range d.Steps {
+		spec := &d.Steps[i]
+		if spec.ID == "" {
+			return nil, contd.NewConfigurationError(fmt.Sprintf("step %d of %q has no id", i, d.Name), "definition.steps")
+		}
+		if _, dup := index[spec.ID]; dup {
+			return nil, contd.NewConfigurationError(fmt.Sprintf("duplicate step %q", spec.ID), "definition.steps")
+		}
+		index[spec.ID] = spec
+		if !steps.Has(spec.stepName()) {
+			return nil, contd.NewConfigurationError(fmt.Sprintf("step %q invokes unregistered step %q", spec.ID, spec.stepName()), "definition.step")
+		}
+		for _, src := range []string{spec.If, spec.ForEach} {
+			if src == "" {
+				continue
+			}
+			if _, err := parseExpr(src); err != nil {
+				return nil, contd.NewConfigurationError(fmt.Sprintf("step %q: %v", spec.ID, err), "definition.expression")
+			}
+		}
+		if err := checkTemplate(spec.Input); err != nil {
+			return nil, contd.NewConfigurationError(fmt.Sprintf("step %q: %v", spec.ID, err), "definition.input")
+		}
+		if _, err := spec.config(contd.DefaultStepConfig()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Run steps in declaration order as their dependencies allow
+	done := make(map[string]bool, len(d.Steps))
+	order := make([]string, 0, len(d.Steps))
+	for len(order) < len(d.Steps) {
+		progressed := false
+		for _, spec := range d.Steps {
+			if done[spec.ID] {
+				continue
+			}
+			ready := true
+			for _, dep := range spec.After {
+				if _, ok := index[dep]; !ok {
+					return nil, contd.NewConfigurationError(fmt.Sprintf("step %q depends on unknown step %q", spec.ID, dep), "definition.after")
+				}
+				ready = ready && done[dep]
+			}
+			if ready {
+				done[spec.ID] = true
+				order = append(order, spec.ID)
+				progressed = true
+			}
+		}
+		if !progressed {
+			return nil, contd.NewConfigurationError("workflow definition contains a dependency cycle", "definition.after")
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,401 @@
+package definitions
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// scope holds the values expressions can reference: input, steps.<id>,
+// and item and index inside a for_each loop
+type scope map[string]interface{}
+
+// expr is a parsed expression
+type expr interface {
+	eval(s scope) (interface{}, error)
+}
+
+type literal struct{ value interface{} }
+
+type reference struct{ path []string }
+
+type unary struct {
+	op      string
+	operand expr
+}
+
+type binary struct {
+	op          string
+	left, right expr
+}
+
+func (e literal) eval(scope) (interface{}, error) { return e.value, nil }
+
+func (e reference) eval(s scope) (interface{}, error) {
+	var value interface{} = map[string]interface{}(s)
+	for _, segment := range e.path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[segment]
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, nil
+			}
+			value = v[i]
+		default:
+			return nil, nil
+		}
+	}
+	return value, nil
+}
+
+func (e unary) eval(s scope) (interface{}, error) {
+	v, err := e.operand.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+func (e binary) eval(s scope) (interface{}, error) {
+	left, err := e.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := e.right.eval(s)
+		return truthy(right), err
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := e.right.eval(s)
+		return truthy(right), err
+	}
+	right, err := e.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+	if l, ok := number(left); ok {
+		if r, ok := number(right); ok {
+			return compare(e.op, l, r), nil
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return compare(e.op, strings.Compare(l, r), 0), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot compare %v %s %v", left, e.op, right)
+}
+
+func compare[T int | float64](op string, l, r T) bool {
+	switch op {
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	case "<":
+		return l < r
+	default:
+		return l <= r
+	}
+}
+
+// truthy reports whether a value counts as true in a condition
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case string:
+		return x != ""
+	case []interface{}:
+		return len(x) > 0
+	case map[string]interface{}:
+		return len(x) > 0
+	}
+	if n, ok := number(v); ok {
+		return n != 0
+	}
+	return true
+}
+
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			return x == y
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case uint64:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+// parseExpr parses a condition or value expression, e.g.
+// `steps.fetch.total > 100 && input.priority == "high"`
+func parseExpr(src string) (expr, error) {
+	p := &parser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression %q", p.tokens[p.pos], src)
+	}
+	return e, nil
+}
+
+type parser struct {
+	src    string
+	tokens []string
+	pos    int
+}
+
+var operators = []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")"}
+
+func (p *parser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return fmt.Errorf("unterminated string in expression %q", p.src)
+			}
+			p.tokens = append(p.tokens, s[i:i+end+2])
+			i += end + 2
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-' || c == '.':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || strings.ContainsRune("_-.[]", rune(s[j]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, s[i:j])
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, op)
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected %q in expression %q", s[i], p.src)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right expr
+		if right, err = p.parseAnd(); err == nil {
+			left = binary{op: "||", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseComparison()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right expr
+		if right, err = p.parseComparison(); err == nil {
+			left = binary{op: "&&", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", ">", ">=", "<", "<=":
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return binary{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.peek() == "!" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op: "!", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	tok := p.peek()
+	if tok == "" {
+		return nil, fmt.Errorf("unexpected end of expression %q", p.src)
+	}
+	p.pos++
+	switch {
+	case tok == "(":
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ) in expression %q", p.src)
+		}
+		p.pos++
+		return e, nil
+	case tok[0] == '"' || tok[0] == '\'':
+		return literal{tok[1 : len(tok)-1]}, nil
+	case tok == "true" || tok == "false":
+		return literal{tok == "true"}, nil
+	case tok == "null":
+		return literal{nil}, nil
+	}
+	if n, err := strconv.ParseFloat(tok, 64); err == nil {
+		return literal{n}, nil
+	}
+	if !unicode.IsLetter(rune(tok[0])) && tok[0] != '_' {
+		return nil, fmt.Errorf("unexpected %q in expression %q", tok, p.src)
+	}
+	path := strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(tok), ".")
+	return reference{path: path}, nil
+}
+
+// templatePattern matches ${...} references in a string value
+var templatePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// checkTemplate parses every ${...} expression in a value
+func checkTemplate(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		for _, m := range templatePattern.FindAllStringSubmatch(v, -1) {
+			if _, err := parseExpr(m[1]); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if err := checkTemplate(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := checkTemplate(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderValue resolves the ${...} expressions in a value. A string that is
+// a single ${...} becomes the referenced value itself; other strings are
+// interpolated.
+func renderValue(value interface{}, s scope) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if m := templatePattern.FindStringSubmatchIndex(v); m != nil && m[0] == 0 && m[1] == len(v) {
+			e, err := parseExpr(v[m[2]:m[3]])
+			if err != nil {
+				return nil, err
+			}
+			return e.eval(s)
+		}
+		var renderErr error
+		out := templatePattern.ReplaceAllStringFunc(v, func(match string) string {
+			e, err := parseExpr(match[2 : len(match)-1])
+			if err != nil {
+				renderErr = err
+				return match
+			}
+			result, err := e.eval(s)
+			if err != nil {
+				renderErr = err
+				return match
+			}
+			if result == nil {
+				return ""
+			}
+			return fmt.Sprint(result)
+		})
+		return out, renderErr
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			rendered, err := renderValue(item, s)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderValue(item, s)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	}
+	return value, nil
+}
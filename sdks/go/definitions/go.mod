@@ -0,0 +1,12 @@
+module github.com/bhavdeep98/contd.ai/sdks/go/definitions
+
+go 1.23
+
+require (
+	github.com/bhavdeep98/contd.ai/sdks/go v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/google/uuid v1.5.0 // indirect
+
+replace github.com/bhavdeep98/contd.ai/sdks/go => ..
@@ -0,0 +1,134 @@
+package definitions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+// Workflow validates the definition and returns a WorkflowFunc running it
+// with the steps registered in steps. Steps run one at a time in
+// dependency order, each journaled under its ID, and the workflow's result
+// maps step IDs to results.
+func (d *Definition) Workflow(steps *contd.StepRegistry) (contd.WorkflowFunc, error) {
+	order, err := d.Validate(steps)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]*StepSpec, len(d.Steps))
+	for i := range d.Steps {
+		index[d.Steps[i].ID] = &d.Steps[i]
+	}
+
+	return func(ctx context.Context, input interface{}) (interface{}, error) {
+		workflowInput, err := generic(input)
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[string]interface{}, len(order))
+		s := scope{"input": workflowInput, "steps": results}
+		for _, id := range order {
+			result, err := runStep(ctx, steps, index[id], s)
+			if err != nil {
+				return nil, err
+			}
+			results[id] = result
+		}
+		return results, nil
+	}, nil
+}
+
+// Register registers the definition under its name in workflows
+func (d *Definition) Register(workflows *contd.Registry, steps *contd.StepRegistry) error {
+	fn, err := d.Workflow(steps)
+	if err != nil {
+		return err
+	}
+	workflows.Register(d.Name, fn, contd.WorkflowOptions{Description: d.Description})
+	return nil
+}
+
+func runStep(ctx context.Context, steps *contd.StepRegistry, spec *StepSpec, s scope) (interface{}, error) {
+	if spec.If != "" {
+		ok, err := evalExpr(spec.If, s)
+		if err != nil {
+			return nil, fmt.Errorf("step %q: %w", spec.ID, err)
+		}
+		if !truthy(ok) {
+			return nil, nil
+		}
+	}
+
+	fn, base, _ := steps.Get(spec.stepName())
+	config, err := spec.config(base)
+	if err != nil {
+		return nil, err
+	}
+	runner := contd.NewStepRunner(config)
+	invoke := func(s scope) (interface{}, error) {
+		input := s["input"]
+		if spec.Input != nil {
+			rendered, err := renderValue(spec.Input, s)
+			if err != nil {
+				return nil, fmt.Errorf("step %q: %w", spec.ID, err)
+			}
+			input = rendered
+		}
+		result, err := runner.Run(ctx, spec.ID, fn, input)
+		if err != nil {
+			return nil, err
+		}
+		// Fresh results are compared like the JSON a replay restores
+		return generic(result)
+	}
+
+	if spec.ForEach == "" {
+		return invoke(s)
+	}
+	items, err := evalExpr(spec.ForEach, s)
+	if err != nil {
+		return nil, fmt.Errorf("step %q: %w", spec.ID, err)
+	}
+	list, ok := items.([]interface{})
+	if !ok && items != nil {
+		return nil, fmt.Errorf("step %q: for_each must yield a list, got %T", spec.ID, items)
+	}
+	results := make([]interface{}, 0, len(list))
+	for i, item := range list {
+		iteration := make(scope, len(s)+2)
+		for k, v := range s {
+			iteration[k] = v
+		}
+		iteration["item"] = item
+		iteration["index"] = float64(i)
+		result, err := invoke(iteration)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func evalExpr(src string, s scope) (interface{}, error) {
+	e, err := parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	return e.eval(s)
+}
+
+// generic converts a value to its JSON form
+func generic(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode value: %w", err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode value: %w", err)
+	}
+	return out, nil
+}
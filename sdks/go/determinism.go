@@ -0,0 +1,108 @@
+package contd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DeterminismMode controls the determinism check. The check runs the
+// workflow body a second time in-process after every successful run, so it
+// is meant for tests and development only.
+type DeterminismMode string
+
+const (
+	// DeterminismOff disables the check
+	DeterminismOff DeterminismMode = ""
+	// DeterminismWarn prints divergences
+	DeterminismWarn DeterminismMode = "warn"
+	// DeterminismFail fails the run with a *DeterminismError on divergence
+	DeterminismFail DeterminismMode = "fail"
+)
+
+// stepCall records one step a workflow asked to run
+type stepCall struct {
+	StepID string
+	Input  string
+}
+
+func (c stepCall) String() string {
+	return fmt.Sprintf("%s(input=%s)", c.StepID, c.Input)
+}
+
+// inputDigest fingerprints a step input so replays can compare it
+func inputDigest(input interface{}) string {
+	data, err := json.Marshal(input)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%#v", input))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// recordStep adds a step call to the context's trace. Retries of the step
+// just recorded are not recorded again.
+func (ec *ExecutionContext) recordStep(stepID string, input interface{}) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if n := len(ec.trace); n > 0 && ec.trace[n-1].StepID == stepID {
+		return
+	}
+	ec.trace = append(ec.trace, stepCall{StepID: stepID, Input: inputDigest(input)})
+}
+
+// stepTrace returns the recorded step calls sorted by step ID, since steps
+// run in parallel may be recorded in any order
+func (ec *ExecutionContext) stepTrace() []stepCall {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	trace := make([]stepCall, len(ec.trace))
+	copy(trace, ec.trace)
+	sort.Slice(trace, func(i, j int) bool { return trace[i].StepID < trace[j].StepID })
+	return trace
+}
+
+// checkDeterminism replays a finished workflow against its recorded steps.
+// Steps are served from cache and any step that was not recorded fails the
+// replay instead of executing, so code outside steps that reads the clock,
+// randomness, map order or goroutine scheduling shows up as a divergence.
+// Everything else outside steps, such as logging and client calls, runs
+// again. It returns a *DeterminismError on divergence in DeterminismFail
+// mode.
+func (r *WorkflowRunner) checkDeterminism(ctx context.Context, ec *ExecutionContext, workflowName string, fn WorkflowFunc, input interface{}, initial *WorkflowState, result interface{}) error {
+	replay := NewExecutionContext(ec.WorkflowID, ec.OrgID, workflowName, ec.Tags)
+	replay.SetEngine(r.engine)
+	replay.SetLease(ec.GetLease())
+	replay.SetState(copyState(initial))
+	replay.replaying = true
+	replay.run = ec.run
+	replay.history.limits = ec.history.limits
+
+	replayResult, err := fn(WithContext(ctx, replay), input)
+
+	var divergences []string
+	if err != nil {
+		divergences = append(divergences, fmt.Sprintf("replay failed: %v", err))
+	}
+	expected, actual := ec.stepTrace(), replay.stepTrace()
+	if !reflect.DeepEqual(expected, actual) {
+		divergences = append(divergences, fmt.Sprintf("steps %v on replay, expected %v", actual, expected))
+	}
+	if err == nil && !reflect.DeepEqual(result, replayResult) {
+		divergences = append(divergences, fmt.Sprintf("result %v on replay, expected %v", replayResult, result))
+	}
+	if len(divergences) == 0 {
+		return nil
+	}
+
+	err = NewDeterminismError(ec.WorkflowID, workflowName, divergences)
+	if r.config.DeterminismCheck == DeterminismFail {
+		return err
+	}
+	fmt.Printf("WARNING: %v\n", err)
+	return nil
+}
@@ -0,0 +1,180 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeKind classifies a difference between two states
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// StateChange is one value that differs between two states. Nested maps
+// are compared key by key, so Path is dotted, e.g. "order.status".
+type StateChange struct {
+	Path string      `json:"path"`
+	Kind ChangeKind  `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// StateDiff is the difference between two workflow states
+type StateDiff struct {
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Variables []StateChange `json:"variables"`
+	Metadata  []StateChange `json:"metadata"`
+}
+
+// Empty reports whether the states are identical
+func (d *StateDiff) Empty() bool {
+	return len(d.Variables) == 0 && len(d.Metadata) == 0
+}
+
+// String renders the diff for people, one change per line:
+// "+" added, "-" removed, "~" changed
+func (d *StateDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", d.From, d.To)
+	if d.Empty() {
+		b.WriteString("(no changes)\n")
+		return b.String()
+	}
+	writeChanges(&b, "variables", d.Variables)
+	writeChanges(&b, "metadata", d.Metadata)
+	return b.String()
+}
+
+func writeChanges(b *strings.Builder, section string, changes []StateChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s:\n", section)
+	for _, c := range changes {
+		switch c.Kind {
+		case ChangeAdded:
+			fmt.Fprintf(b, "  + %s: %s\n", c.Path, formatDiffValue(c.New))
+		case ChangeRemoved:
+			fmt.Fprintf(b, "  - %s: %s\n", c.Path, formatDiffValue(c.Old))
+		case ChangeChanged:
+			fmt.Fprintf(b, "  ~ %s: %s -> %s\n", c.Path, formatDiffValue(c.Old), formatDiffValue(c.New))
+		}
+	}
+}
+
+func formatDiffValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// Diff compares the variables and metadata of two states. Values are
+// compared in their JSON form, so a struct and the map restored from it
+// are equal.
+func Diff(from, to *WorkflowState) *StateDiff {
+	d := &StateDiff{From: stateLabel(from), To: stateLabel(to)}
+	var fromVars, toVars, fromMeta, toMeta map[string]interface{}
+	if from != nil {
+		fromVars, fromMeta = from.Variables, from.Metadata
+	}
+	if to != nil {
+		toVars, toMeta = to.Variables, to.Metadata
+	}
+	d.Variables = diffMaps("", normalizeMap(fromVars), normalizeMap(toVars))
+	d.Metadata = diffMaps("", normalizeMap(fromMeta), normalizeMap(toMeta))
+	return d
+}
+
+func stateLabel(state *WorkflowState) string {
+	if state == nil {
+		return "(none)"
+	}
+	return fmt.Sprintf("%s@%d", state.WorkflowID, state.StepNumber)
+}
+
+// normalizeMap converts a map to its generic JSON form
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	var out map[string]interface{}
+	if err := convert(nil, m, &out); err != nil {
+		return m
+	}
+	return out
+}
+
+// diffMaps lists changes between two maps, descending into nested maps
+func diffMaps(prefix string, from, to map[string]interface{}) []StateChange {
+	var changes []StateChange
+	for k, v := range to {
+		path := prefix + k
+		oldV, exists := from[k]
+		if !exists {
+			changes = append(changes, StateChange{Path: path, Kind: ChangeAdded, New: v})
+			continue
+		}
+		oldMap, oldIsMap := oldV.(map[string]interface{})
+		newMap, newIsMap := v.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			changes = append(changes, diffMaps(path+".", oldMap, newMap)...)
+		} else if formatDiffValue(oldV) != formatDiffValue(v) {
+			changes = append(changes, StateChange{Path: path, Kind: ChangeChanged, Old: oldV, New: v})
+		}
+	}
+	for k, v := range from {
+		if _, exists := to[k]; !exists {
+			changes = append(changes, StateChange{Path: prefix + k, Kind: ChangeRemoved, Old: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// DiffSavepoints compares the states captured by two savepoints of a workflow
+func (c *Client) DiffSavepoints(ctx context.Context, workflowID, fromSavepointID, toSavepointID string) (*StateDiff, error) {
+	archive, err := c.ExportWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]*WorkflowState, len(archive.Savepoints))
+	for _, sp := range archive.Savepoints {
+		states[sp.Info.SavepointID] = sp.State
+	}
+	from, ok := states[fromSavepointID]
+	if !ok {
+		return nil, NewInvalidSavepoint(workflowID, fromSavepointID, "savepoint not found")
+	}
+	to, ok := states[toSavepointID]
+	if !ok {
+		return nil, NewInvalidSavepoint(workflowID, toSavepointID, "savepoint not found")
+	}
+
+	d := Diff(from, to)
+	d.From = fmt.Sprintf("%s@%s", workflowID, fromSavepointID)
+	d.To = fmt.Sprintf("%s@%s", workflowID, toSavepointID)
+	return d, nil
+}
+
+// DiffWorkflows compares the latest states of two workflow runs
+func (c *Client) DiffWorkflows(ctx context.Context, fromWorkflowID, toWorkflowID string) (*StateDiff, error) {
+	from, err := c.finalState(ctx, fromWorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := c.finalState(ctx, toWorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(from, to), nil
+}
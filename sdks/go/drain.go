@@ -0,0 +1,66 @@
+package contd
+
+import (
+	"context"
+	"time"
+)
+
+// drainReason is the suspension reason of workflows parked by Drain
+const drainReason = "worker draining"
+
+// checkDrain returns WorkflowSuspended once the workflow's worker is
+// draining, so the step in flight is the last one it runs here
+func (ec *ExecutionContext) checkDrain() error {
+	if ec.drain == nil {
+		return nil
+	}
+	select {
+	case <-ec.drain:
+		return NewWorkflowSuspended(ec.WorkflowID, drainReason)
+	default:
+		return nil
+	}
+}
+
+// Drain hands the pool's work over to other workers for a deploy. It stops
+// accepting workflows and rejects queued ones with PoolClosed. Running
+// workflows finish the step in flight, then are checkpointed, suspended and
+// release their lease, so another worker can resume them straight away.
+// Workflows still running when ctx is done, such as those waiting on a
+// signal or timer, are cancelled and suspended the same way.
+func (p *WorkerPool) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	queued := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+
+	for _, rejected := range queued {
+		<-p.slots
+		rejected.handle.finish(nil, NewPoolClosed(rejected.job.WorkflowName))
+	}
+	p.drainOnce.Do(func() { close(p.draining) })
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		p.cancel(NewPoolClosed(""))
+		return p.tracker.waitIdle(p.engine, DefaultCloseTimeout)
+	case <-ctx.Done():
+	}
+
+	p.cancel(NewWorkflowSuspended("", drainReason))
+	timer := time.NewTimer(DefaultCloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		return p.tracker.waitIdle(p.engine, DefaultCloseTimeout)
+	case <-timer.C:
+		return ctx.Err()
+	}
+}
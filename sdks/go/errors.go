@@ -1,7 +1,51 @@
 package contd
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sentinel errors for matching error kinds with errors.Is
+var (
+	ErrWorkflowLocked           = errors.New("workflow locked")
+	ErrNoActiveWorkflow         = errors.New("no active workflow")
+	ErrWorkflowNotFound         = errors.New("workflow not found")
+	ErrWorkflowAlreadyCompleted = errors.New("workflow already completed")
+	ErrWorkflowTimeout          = errors.New("workflow timeout")
+	ErrStep                     = errors.New("step error")
+	ErrStepTimeout              = errors.New("step timeout")
+	ErrTooManyAttempts          = errors.New("too many attempts")
+	ErrStepExecutionFailed      = errors.New("step execution failed")
+	ErrStepPanic                = errors.New("step panicked")
+	ErrCircuitOpen              = errors.New("circuit open")
+	ErrBatch                    = errors.New("batch failed")
+	ErrIntegrity                = errors.New("integrity error")
+	ErrChecksumMismatch         = errors.New("checksum mismatch")
+	ErrPersistence              = errors.New("persistence error")
+	ErrRecovery                 = errors.New("recovery error")
+	ErrRecoveryFailed           = errors.New("recovery failed")
+	ErrInvalidSavepoint         = errors.New("invalid savepoint")
+	ErrConfiguration            = errors.New("configuration error")
+	ErrOrgMismatch              = errors.New("org mismatch")
+	ErrStaleLease               = errors.New("stale lease")
+	ErrPoolClosed               = errors.New("worker pool closed")
+	ErrValidation               = errors.New("validation error")
+	ErrWorkflowInterrupted      = errors.New("workflow interrupted")
+	ErrBudgetExceeded           = errors.New("budget exceeded")
+	ErrWorkflowAlreadyExists    = errors.New("workflow already exists")
+	ErrNoCapableWorker          = errors.New("no capable worker")
+	ErrWorkflowCancelled        = errors.New("workflow cancelled")
+	ErrWorkflowTerminated       = errors.New("workflow terminated")
+	ErrNonDeterminism           = errors.New("non-determinism")
+	ErrWorkflowSuspended        = errors.New("workflow suspended")
+	ErrVariableConflict         = errors.New("variable conflict")
+	ErrStateConflict            = errors.New("state conflict")
+	ErrContinueAsNew            = errors.New("continue as new")
+	ErrRateLimited              = errors.New("rate limited")
+	ErrApplicationFailure       = errors.New("application failure")
 )
 
 // ContdError is the base error type for all Contd SDK errors
@@ -9,6 +53,8 @@ type ContdError struct {
 	Message    string
 	WorkflowID string
 	Details    map[string]interface{}
+	// Cause is the underlying error, if any
+	Cause error
 }
 
 func (e *ContdError) Error() string {
@@ -22,6 +68,11 @@ func (e *ContdError) Error() string {
 	return msg
 }
 
+// Unwrap returns the underlying cause
+func (e *ContdError) Unwrap() error {
+	return e.Cause
+}
+
 // NewContdError creates a new ContdError
 func NewContdError(message string, workflowID string, details map[string]interface{}) *ContdError {
 	return &ContdError{
@@ -58,6 +109,16 @@ func NewWorkflowLocked(workflowID, ownerID, expiresAt string) *WorkflowLocked {
 	}
 }
 
+// Is reports whether target is ErrWorkflowLocked
+func (e *WorkflowLocked) Is(target error) bool {
+	return target == ErrWorkflowLocked
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowLocked) Unwrap() error {
+	return &e.ContdError
+}
+
 // NoActiveWorkflow indicates no workflow context is active
 type NoActiveWorkflow struct {
 	ContdError
@@ -73,6 +134,16 @@ func NewNoActiveWorkflow(message string) *NoActiveWorkflow {
 	}
 }
 
+// Is reports whether target is ErrNoActiveWorkflow
+func (e *NoActiveWorkflow) Is(target error) bool {
+	return target == ErrNoActiveWorkflow
+}
+
+// Unwrap returns the embedded ContdError
+func (e *NoActiveWorkflow) Unwrap() error {
+	return &e.ContdError
+}
+
 // WorkflowNotFound indicates the workflow does not exist
 type WorkflowNotFound struct {
 	ContdError
@@ -88,6 +159,16 @@ func NewWorkflowNotFound(workflowID string) *WorkflowNotFound {
 	}
 }
 
+// Is reports whether target is ErrWorkflowNotFound
+func (e *WorkflowNotFound) Is(target error) bool {
+	return target == ErrWorkflowNotFound
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowNotFound) Unwrap() error {
+	return &e.ContdError
+}
+
 // WorkflowAlreadyCompleted indicates the workflow has already completed
 type WorkflowAlreadyCompleted struct {
 	ContdError
@@ -110,6 +191,49 @@ func NewWorkflowAlreadyCompleted(workflowID, completedAt string) *WorkflowAlread
 	}
 }
 
+// Is reports whether target is ErrWorkflowAlreadyCompleted
+func (e *WorkflowAlreadyCompleted) Is(target error) bool {
+	return target == ErrWorkflowAlreadyCompleted
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowAlreadyCompleted) Unwrap() error {
+	return &e.ContdError
+}
+
+// WorkflowTimeout indicates a workflow exceeded its MaxDuration
+type WorkflowTimeout struct {
+	ContdError
+	MaxDuration time.Duration
+	Elapsed     time.Duration
+}
+
+// NewWorkflowTimeout creates a new WorkflowTimeout error
+func NewWorkflowTimeout(workflowID string, maxDuration, elapsed time.Duration) *WorkflowTimeout {
+	return &WorkflowTimeout{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Workflow exceeded max duration of %v (elapsed %v)", maxDuration, elapsed.Round(time.Millisecond)),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"max_duration_ms": maxDuration.Milliseconds(),
+				"elapsed_ms":      elapsed.Milliseconds(),
+			},
+		},
+		MaxDuration: maxDuration,
+		Elapsed:     elapsed,
+	}
+}
+
+// Is reports whether target is ErrWorkflowTimeout
+func (e *WorkflowTimeout) Is(target error) bool {
+	return target == ErrWorkflowTimeout
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowTimeout) Unwrap() error {
+	return &e.ContdError
+}
+
 // StepError is the base error for step-related errors
 type StepError struct {
 	ContdError
@@ -144,6 +268,16 @@ func NewStepError(message, workflowID, stepID, stepName string, attempt int, det
 	}
 }
 
+// Is reports whether target is ErrStep
+func (e *StepError) Is(target error) bool {
+	return target == ErrStep
+}
+
+// Unwrap returns the embedded ContdError
+func (e *StepError) Unwrap() error {
+	return &e.ContdError
+}
+
 // StepTimeout indicates a step exceeded its timeout
 type StepTimeout struct {
 	StepError
@@ -156,7 +290,7 @@ func NewStepTimeout(workflowID, stepID, stepName string, timeoutSeconds, elapsed
 	return &StepTimeout{
 		StepError: StepError{
 			ContdError: ContdError{
-				Message:    fmt.Sprintf("Step timed out after %.2fs (limit: %.0fs)", elapsedSeconds, timeoutSeconds),
+				Message:    fmt.Sprintf("Step timed out after %.2fs (limit: %.2fs)", elapsedSeconds, timeoutSeconds),
 				WorkflowID: workflowID,
 				Details: map[string]interface{}{
 					"step_id":         stepID,
@@ -173,6 +307,16 @@ func NewStepTimeout(workflowID, stepID, stepName string, timeoutSeconds, elapsed
 	}
 }
 
+// Is reports whether target is ErrStepTimeout
+func (e *StepTimeout) Is(target error) bool {
+	return target == ErrStepTimeout
+}
+
+// Unwrap returns the embedded StepError
+func (e *StepTimeout) Unwrap() error {
+	return &e.StepError
+}
+
 // TooManyAttempts indicates a step exceeded maximum retry attempts
 type TooManyAttempts struct {
 	StepError
@@ -205,6 +349,16 @@ func NewTooManyAttempts(workflowID, stepID, stepName string, maxAttempts int, la
 	}
 }
 
+// Is reports whether target is ErrTooManyAttempts
+func (e *TooManyAttempts) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// Unwrap returns the embedded StepError
+func (e *TooManyAttempts) Unwrap() error {
+	return &e.StepError
+}
+
 // StepExecutionFailed indicates a step execution failed
 type StepExecutionFailed struct {
 	StepError
@@ -218,6 +372,7 @@ func NewStepExecutionFailed(workflowID, stepID, stepName string, attempt int, or
 			ContdError: ContdError{
 				Message:    fmt.Sprintf("Step execution failed: %v", originalError),
 				WorkflowID: workflowID,
+				Cause:      originalError,
 				Details: map[string]interface{}{
 					"step_id":             stepID,
 					"step_name":           stepName,
@@ -233,9 +388,149 @@ func NewStepExecutionFailed(workflowID, stepID, stepName string, attempt int, or
 	}
 }
 
-// Unwrap returns the original error
+// Is reports whether target is ErrStepExecutionFailed
+func (e *StepExecutionFailed) Is(target error) bool {
+	return target == ErrStepExecutionFailed
+}
+
+// Unwrap returns the embedded StepError, whose cause is the original error
 func (e *StepExecutionFailed) Unwrap() error {
-	return e.OriginalError
+	return &e.StepError
+}
+
+// StepPanic indicates a step panicked. It is the original error of the
+// resulting StepExecutionFailed.
+type StepPanic struct {
+	StepError
+	Value interface{}
+	Stack string
+}
+
+// NewStepPanic creates a new StepPanic error
+func NewStepPanic(workflowID, stepID, stepName string, value interface{}, stack string) *StepPanic {
+	return &StepPanic{
+		StepError: StepError{
+			ContdError: ContdError{
+				Message:    fmt.Sprintf("Step panicked: %v", value),
+				WorkflowID: workflowID,
+				Details: map[string]interface{}{
+					"step_id":   stepID,
+					"step_name": stepName,
+					"stack":     stack,
+				},
+			},
+			StepID:   stepID,
+			StepName: stepName,
+		},
+		Value: value,
+		Stack: stack,
+	}
+}
+
+// Error omits the stack trace, which is kept in Stack
+func (e *StepPanic) Error() string {
+	msg := e.Message
+	if e.WorkflowID != "" {
+		msg += fmt.Sprintf(" [workflow=%s]", e.WorkflowID)
+	}
+	return msg
+}
+
+// Is reports whether target is ErrStepPanic
+func (e *StepPanic) Is(target error) bool {
+	return target == ErrStepPanic
+}
+
+// Unwrap returns the embedded StepError
+func (e *StepPanic) Unwrap() error {
+	return &e.StepError
+}
+
+// CircuitOpen indicates a step was short-circuited because its circuit is open
+type CircuitOpen struct {
+	StepError
+	RetryAt time.Time
+}
+
+// NewCircuitOpen creates a new CircuitOpen error
+func NewCircuitOpen(workflowID, stepID, stepName string, retryAt time.Time) *CircuitOpen {
+	return &CircuitOpen{
+		StepError: StepError{
+			ContdError: ContdError{
+				Message:    fmt.Sprintf("Circuit open for step %s", stepName),
+				WorkflowID: workflowID,
+				Details: map[string]interface{}{
+					"step_id":   stepID,
+					"step_name": stepName,
+					"retry_at":  retryAt.UTC().Format(time.RFC3339),
+				},
+			},
+			StepID:   stepID,
+			StepName: stepName,
+		},
+		RetryAt: retryAt,
+	}
+}
+
+// Is reports whether target is ErrCircuitOpen
+func (e *CircuitOpen) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Unwrap returns the embedded StepError
+func (e *CircuitOpen) Unwrap() error {
+	return &e.StepError
+}
+
+// BatchError indicates some items of a batch step failed
+type BatchError struct {
+	StepError
+	Total    int
+	Failures map[int]error
+	// Results holds the outputs of the items that succeeded, by index
+	Results []interface{}
+}
+
+// NewBatchError creates a new BatchError
+func NewBatchError(workflowID, stepID, stepName string, total int, failures map[int]error, results []interface{}) *BatchError {
+	failed := make([]int, 0, len(failures))
+	for i := range failures {
+		failed = append(failed, i)
+	}
+	sort.Ints(failed)
+	return &BatchError{
+		StepError: StepError{
+			ContdError: ContdError{
+				Message:    fmt.Sprintf("%d of %d batch items failed", len(failures), total),
+				WorkflowID: workflowID,
+				Details: map[string]interface{}{
+					"step_id":      stepID,
+					"step_name":    stepName,
+					"failed_items": failed,
+				},
+			},
+			StepID:   stepID,
+			StepName: stepName,
+		},
+		Total:    total,
+		Failures: failures,
+		Results:  results,
+	}
+}
+
+// Is reports whether target is ErrBatch
+func (e *BatchError) Is(target error) bool {
+	return target == ErrBatch
+}
+
+// Unwrap returns the embedded StepError and the per-item errors
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures)+1)
+	errs = append(errs, &e.StepError)
+	for _, err := range e.Failures {
+		errs = append(errs, err)
+	}
+	return errs
 }
 
 // IntegrityError is the base error for data integrity errors
@@ -243,6 +538,16 @@ type IntegrityError struct {
 	ContdError
 }
 
+// Is reports whether target is ErrIntegrity
+func (e *IntegrityError) Is(target error) bool {
+	return target == ErrIntegrity
+}
+
+// Unwrap returns the embedded ContdError
+func (e *IntegrityError) Unwrap() error {
+	return &e.ContdError
+}
+
 // ChecksumMismatch indicates a checksum validation failed
 type ChecksumMismatch struct {
 	IntegrityError
@@ -271,6 +576,16 @@ func NewChecksumMismatch(workflowID, resourceType, expected, actual string) *Che
 	}
 }
 
+// Is reports whether target is ErrChecksumMismatch
+func (e *ChecksumMismatch) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// Unwrap returns the embedded IntegrityError
+func (e *ChecksumMismatch) Unwrap() error {
+	return &e.IntegrityError
+}
+
 // PersistenceError is the base error for persistence layer errors
 type PersistenceError struct {
 	ContdError
@@ -287,11 +602,31 @@ func NewPersistenceError(message, workflowID string, details map[string]interfac
 	}
 }
 
+// Is reports whether target is ErrPersistence
+func (e *PersistenceError) Is(target error) bool {
+	return target == ErrPersistence
+}
+
+// Unwrap returns the embedded ContdError
+func (e *PersistenceError) Unwrap() error {
+	return &e.ContdError
+}
+
 // RecoveryError is the base error for recovery-related errors
 type RecoveryError struct {
 	ContdError
 }
 
+// Is reports whether target is ErrRecovery
+func (e *RecoveryError) Is(target error) bool {
+	return target == ErrRecovery
+}
+
+// Unwrap returns the embedded ContdError
+func (e *RecoveryError) Unwrap() error {
+	return &e.ContdError
+}
+
 // RecoveryFailed indicates workflow recovery failed
 type RecoveryFailed struct {
 	RecoveryError
@@ -312,6 +647,16 @@ func NewRecoveryFailed(workflowID, reason string, recoverable bool) *RecoveryFai
 	}
 }
 
+// Is reports whether target is ErrRecoveryFailed
+func (e *RecoveryFailed) Is(target error) bool {
+	return target == ErrRecoveryFailed
+}
+
+// Unwrap returns the embedded RecoveryError
+func (e *RecoveryFailed) Unwrap() error {
+	return &e.RecoveryError
+}
+
 // InvalidSavepoint indicates a savepoint is invalid
 type InvalidSavepoint struct {
 	RecoveryError
@@ -332,6 +677,16 @@ func NewInvalidSavepoint(workflowID, savepointID, reason string) *InvalidSavepoi
 	}
 }
 
+// Is reports whether target is ErrInvalidSavepoint
+func (e *InvalidSavepoint) Is(target error) bool {
+	return target == ErrInvalidSavepoint
+}
+
+// Unwrap returns the embedded RecoveryError
+func (e *InvalidSavepoint) Unwrap() error {
+	return &e.RecoveryError
+}
+
 // ConfigurationError indicates invalid SDK configuration
 type ConfigurationError struct {
 	ContdError
@@ -353,6 +708,157 @@ func NewConfigurationError(message, configKey string) *ConfigurationError {
 	}
 }
 
+// Is reports whether target is ErrConfiguration
+func (e *ConfigurationError) Is(target error) bool {
+	return target == ErrConfiguration
+}
+
+// Unwrap returns the embedded ContdError
+func (e *ConfigurationError) Unwrap() error {
+	return &e.ContdError
+}
+
+// OrgMismatch indicates an org-scoped caller touched another org's workflow
+type OrgMismatch struct {
+	ContdError
+	OrgID         string
+	ResourceOrgID string
+}
+
+// NewOrgMismatch creates a new OrgMismatch error
+func NewOrgMismatch(workflowID, orgID, resourceOrgID string) *OrgMismatch {
+	return &OrgMismatch{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Workflow belongs to org %s, not %s", resourceOrgID, orgID),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"org_id":          orgID,
+				"resource_org_id": resourceOrgID,
+			},
+		},
+		OrgID:         orgID,
+		ResourceOrgID: resourceOrgID,
+	}
+}
+
+// Is reports whether target is ErrOrgMismatch
+func (e *OrgMismatch) Is(target error) bool {
+	return target == ErrOrgMismatch
+}
+
+// Unwrap returns the embedded ContdError
+func (e *OrgMismatch) Unwrap() error {
+	return &e.ContdError
+}
+
+// StaleLease indicates a write was fenced off because a newer lease on the
+// workflow has been issued to another owner
+type StaleLease struct {
+	ContdError
+	OwnerID      string
+	Token        int64
+	CurrentToken int64
+}
+
+// NewStaleLease creates a new StaleLease error
+func NewStaleLease(workflowID, ownerID string, token, currentToken int64) *StaleLease {
+	return &StaleLease{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Lease token %d is stale (current token: %d)", token, currentToken),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"owner_id":      ownerID,
+				"token":         token,
+				"current_token": currentToken,
+			},
+		},
+		OwnerID:      ownerID,
+		Token:        token,
+		CurrentToken: currentToken,
+	}
+}
+
+// Is reports whether target is ErrStaleLease
+func (e *StaleLease) Is(target error) bool {
+	return target == ErrStaleLease
+}
+
+// Unwrap returns the embedded ContdError
+func (e *StaleLease) Unwrap() error {
+	return &e.ContdError
+}
+
+// PoolClosed indicates a worker pool is shutting down and rejected or
+// cancelled a workflow
+type PoolClosed struct {
+	ContdError
+	WorkflowName string
+}
+
+// NewPoolClosed creates a new PoolClosed error
+func NewPoolClosed(workflowName string) *PoolClosed {
+	details := make(map[string]interface{})
+	if workflowName != "" {
+		details["workflow_name"] = workflowName
+	}
+	return &PoolClosed{
+		ContdError: ContdError{
+			Message: "Worker pool is shutting down",
+			Details: details,
+		},
+		WorkflowName: workflowName,
+	}
+}
+
+// Is reports whether target is ErrPoolClosed
+func (e *PoolClosed) Is(target error) bool {
+	return target == ErrPoolClosed
+}
+
+// Unwrap returns the embedded ContdError
+func (e *PoolClosed) Unwrap() error {
+	return &e.ContdError
+}
+
+// ValidationError indicates a workflow payload failed schema validation
+type ValidationError struct {
+	ContdError
+	WorkflowName string
+	Direction    string
+	Violations   []FieldViolation
+}
+
+// NewValidationError creates a new ValidationError
+func NewValidationError(workflowName, direction string, violations []FieldViolation) *ValidationError {
+	paths := make([]string, len(violations))
+	for i, v := range violations {
+		paths[i] = v.Path
+	}
+	return &ValidationError{
+		ContdError: ContdError{
+			Message: fmt.Sprintf("Workflow %s %s failed validation (%d violations)", workflowName, direction, len(violations)),
+			Details: map[string]interface{}{
+				"workflow_name": workflowName,
+				"direction":     direction,
+				"fields":        paths,
+			},
+		},
+		WorkflowName: workflowName,
+		Direction:    direction,
+		Violations:   violations,
+	}
+}
+
+// Is reports whether target is ErrValidation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Unwrap returns the embedded ContdError
+func (e *ValidationError) Unwrap() error {
+	return &e.ContdError
+}
+
 // WorkflowInterrupted indicates a workflow was intentionally interrupted (for testing)
 type WorkflowInterrupted struct {
 	ContdError
@@ -370,3 +876,457 @@ func NewWorkflowInterrupted(workflowID string, stepNumber int) *WorkflowInterrup
 		StepNumber: stepNumber,
 	}
 }
+
+// Is reports whether target is ErrWorkflowInterrupted
+func (e *WorkflowInterrupted) Is(target error) bool {
+	return target == ErrWorkflowInterrupted
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowInterrupted) Unwrap() error {
+	return &e.ContdError
+}
+
+// BudgetExceeded indicates a workflow spent more than its budget and was
+// suspended
+type BudgetExceeded struct {
+	ContdError
+	Limit string
+	Used  float64
+	Max   float64
+}
+
+// NewBudgetExceeded creates a new BudgetExceeded error
+func NewBudgetExceeded(workflowID, limit string, used, max float64) *BudgetExceeded {
+	return &BudgetExceeded{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Workflow budget exceeded: %s %g > %g", limit, used, max),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"limit": limit,
+				"used":  used,
+				"max":   max,
+			},
+		},
+		Limit: limit,
+		Used:  used,
+		Max:   max,
+	}
+}
+
+// Is reports whether target is ErrBudgetExceeded
+func (e *BudgetExceeded) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// Unwrap returns the embedded ContdError
+func (e *BudgetExceeded) Unwrap() error {
+	return &e.ContdError
+}
+
+// WorkflowAlreadyExists indicates a workflow ID's IDReusePolicy forbids
+// starting another run under it
+type WorkflowAlreadyExists struct {
+	ContdError
+	Status WorkflowStatus
+	Policy IDReusePolicy
+}
+
+// NewWorkflowAlreadyExists creates a new WorkflowAlreadyExists error
+func NewWorkflowAlreadyExists(workflowID string, status WorkflowStatus, policy IDReusePolicy) *WorkflowAlreadyExists {
+	return &WorkflowAlreadyExists{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Workflow already exists with status %s and policy %s forbids reusing its ID", status, policy),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"status": string(status),
+				"policy": string(policy),
+			},
+		},
+		Status: status,
+		Policy: policy,
+	}
+}
+
+// Is reports whether target is ErrWorkflowAlreadyExists
+func (e *WorkflowAlreadyExists) Is(target error) bool {
+	return target == ErrWorkflowAlreadyExists
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowAlreadyExists) Unwrap() error {
+	return &e.ContdError
+}
+
+// NoCapableWorker indicates no worker offers the capabilities a workflow or
+// step requires. StepName is empty when the workflow itself requires them.
+type NoCapableWorker struct {
+	ContdError
+	StepName string
+	Required []string
+	Missing  []string
+}
+
+// NewNoCapableWorker creates a new NoCapableWorker error
+func NewNoCapableWorker(workflowID, stepName string, required, missing []string) *NoCapableWorker {
+	message := fmt.Sprintf("No worker offers required capabilities %v", missing)
+	if stepName != "" {
+		message = fmt.Sprintf("Step %s requires capabilities %v this worker lacks", stepName, missing)
+	}
+	details := map[string]interface{}{
+		"required": required,
+		"missing":  missing,
+	}
+	if stepName != "" {
+		details["step_name"] = stepName
+	}
+	return &NoCapableWorker{
+		ContdError: ContdError{
+			Message:    message,
+			WorkflowID: workflowID,
+			Details:    details,
+		},
+		StepName: stepName,
+		Required: required,
+		Missing:  missing,
+	}
+}
+
+// Is reports whether target is ErrNoCapableWorker
+func (e *NoCapableWorker) Is(target error) bool {
+	return target == ErrNoCapableWorker
+}
+
+// Unwrap returns the embedded ContdError
+func (e *NoCapableWorker) Unwrap() error {
+	return &e.ContdError
+}
+
+// WorkflowCancelled indicates a workflow stopped because it was asked to.
+// A terminated workflow skipped its compensations.
+type WorkflowCancelled struct {
+	ContdError
+	Reason     string
+	Terminated bool
+}
+
+// NewWorkflowCancelled creates a new WorkflowCancelled error
+func NewWorkflowCancelled(workflowID, reason string, terminated bool) *WorkflowCancelled {
+	message := "Workflow cancelled"
+	if terminated {
+		message = "Workflow terminated"
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+	return &WorkflowCancelled{
+		ContdError: ContdError{
+			Message:    message,
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"reason":     reason,
+				"terminated": terminated,
+			},
+		},
+		Reason:     reason,
+		Terminated: terminated,
+	}
+}
+
+// Is reports whether target is ErrWorkflowTerminated for a terminated
+// workflow, or ErrWorkflowCancelled otherwise
+func (e *WorkflowCancelled) Is(target error) bool {
+	if e.Terminated {
+		return target == ErrWorkflowTerminated
+	}
+	return target == ErrWorkflowCancelled
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowCancelled) Unwrap() error {
+	return &e.ContdError
+}
+
+// NonDeterminism indicates a resumed workflow asked for a step other than
+// the one its original run recorded at the same step ID
+type NonDeterminism struct {
+	ContdError
+	StepID   string
+	StepName string
+	// Recorded is the name of the step the original run recorded
+	Recorded string
+}
+
+// NewNonDeterminism creates a new NonDeterminism error
+func NewNonDeterminism(workflowID, stepID, stepName, recorded, reason string) *NonDeterminism {
+	details := map[string]interface{}{
+		"step_id":   stepID,
+		"step_name": stepName,
+	}
+	message := fmt.Sprintf("Step %s (%s): %s", stepID, stepName, reason)
+	if recorded != "" {
+		details["recorded_step_name"] = recorded
+		message = fmt.Sprintf("Step %s is %s but was recorded as %s: %s", stepID, stepName, recorded, reason)
+	}
+	return &NonDeterminism{
+		ContdError: ContdError{
+			Message:    message,
+			WorkflowID: workflowID,
+			Details:    details,
+		},
+		StepID:   stepID,
+		StepName: stepName,
+		Recorded: recorded,
+	}
+}
+
+// Is reports whether target is ErrNonDeterminism
+func (e *NonDeterminism) Is(target error) bool {
+	return target == ErrNonDeterminism
+}
+
+// Unwrap returns the embedded ContdError
+func (e *NonDeterminism) Unwrap() error {
+	return &e.ContdError
+}
+
+// DeterminismError indicates the determinism check's replay of a successful
+// run diverged from it
+type DeterminismError struct {
+	ContdError
+	WorkflowName string
+	Divergences  []string
+}
+
+// NewDeterminismError creates a new DeterminismError
+func NewDeterminismError(workflowID, workflowName string, divergences []string) *DeterminismError {
+	return &DeterminismError{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Workflow %s is nondeterministic: %s", workflowName, strings.Join(divergences, "; ")),
+			WorkflowID: workflowID,
+		},
+		WorkflowName: workflowName,
+		Divergences:  divergences,
+	}
+}
+
+// Is reports whether target is ErrNonDeterminism
+func (e *DeterminismError) Is(target error) bool {
+	return target == ErrNonDeterminism
+}
+
+// Unwrap returns the embedded ContdError
+func (e *DeterminismError) Unwrap() error {
+	return &e.ContdError
+}
+
+// WorkflowSuspended indicates a workflow parked itself with
+// ExecutionContext.Suspend
+type WorkflowSuspended struct {
+	ContdError
+	Reason string
+}
+
+// NewWorkflowSuspended creates a new WorkflowSuspended error
+func NewWorkflowSuspended(workflowID, reason string) *WorkflowSuspended {
+	return &WorkflowSuspended{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Workflow suspended: %s", reason),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"reason": reason,
+			},
+		},
+		Reason: reason,
+	}
+}
+
+// Is reports whether target is ErrWorkflowSuspended
+func (e *WorkflowSuspended) Is(target error) bool {
+	return target == ErrWorkflowSuspended
+}
+
+// Unwrap returns the embedded ContdError
+func (e *WorkflowSuspended) Unwrap() error {
+	return &e.ContdError
+}
+
+// VariableConflict indicates parallel branches wrote the same variable
+// under MergeError
+type VariableConflict struct {
+	ContdError
+	Key      string
+	Branches []string
+}
+
+// NewVariableConflict creates a new VariableConflict error
+func NewVariableConflict(workflowID, key string, branches []string) *VariableConflict {
+	return &VariableConflict{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Branches %v both wrote variable %q", branches, key),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"key":      key,
+				"branches": branches,
+			},
+		},
+		Key:      key,
+		Branches: branches,
+	}
+}
+
+// Is reports whether target is ErrVariableConflict
+func (e *VariableConflict) Is(target error) bool {
+	return target == ErrVariableConflict
+}
+
+// Unwrap returns the embedded ContdError
+func (e *VariableConflict) Unwrap() error {
+	return &e.ContdError
+}
+
+// StateConflict indicates a state write was rejected because another
+// executor committed a newer state
+type StateConflict struct {
+	ContdError
+	CurrentVersion   int64
+	AttemptedVersion int64
+}
+
+// NewStateConflict creates a new StateConflict error
+func NewStateConflict(workflowID string, current, attempted int64) *StateConflict {
+	return &StateConflict{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("State version %d conflicts with stored version %d", attempted, current),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"current_version":   current,
+				"attempted_version": attempted,
+			},
+		},
+		CurrentVersion:   current,
+		AttemptedVersion: attempted,
+	}
+}
+
+// Is reports whether target is ErrStateConflict
+func (e *StateConflict) Is(target error) bool {
+	return target == ErrStateConflict
+}
+
+// Unwrap returns the embedded ContdError
+func (e *StateConflict) Unwrap() error {
+	return &e.ContdError
+}
+
+// ContinueAsNew ends a workflow so the runner continues its work in a fresh
+// workflow with a new ID and an empty history, started with Input
+type ContinueAsNew struct {
+	ContdError
+	Input interface{}
+	// Reason is why the workflow continued, e.g. "history_limit"
+	Reason string
+	// NextWorkflowID is the workflow continuing the work, set once the
+	// runner has started it
+	NextWorkflowID string
+}
+
+// NewContinueAsNew creates a new ContinueAsNew error
+func NewContinueAsNew(workflowID string, input interface{}, reason string) *ContinueAsNew {
+	return &ContinueAsNew{
+		ContdError: ContdError{
+			Message:    fmt.Sprintf("Workflow continued as new: %s", reason),
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"reason": reason,
+			},
+		},
+		Input:  input,
+		Reason: reason,
+	}
+}
+
+// Is reports whether target is ErrContinueAsNew
+func (e *ContinueAsNew) Is(target error) bool {
+	return target == ErrContinueAsNew
+}
+
+// Unwrap returns the embedded ContdError
+func (e *ContinueAsNew) Unwrap() error {
+	return &e.ContdError
+}
+
+// RateLimited indicates the server rejected a request for exceeding a rate
+// limit. Callers should wait RetryAfter before trying again.
+type RateLimited struct {
+	ContdError
+	RetryAfter time.Duration
+	// Limit, Remaining and Reset describe the limit, when the server sent them
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// NewRateLimited creates a new RateLimited error
+func NewRateLimited(message, workflowID string, retryAfter time.Duration) *RateLimited {
+	if message == "" {
+		message = "Rate limit exceeded"
+	}
+	return &RateLimited{
+		ContdError: ContdError{
+			Message:    message,
+			WorkflowID: workflowID,
+			Details: map[string]interface{}{
+				"retry_after_ms": retryAfter.Milliseconds(),
+			},
+		},
+		RetryAfter: retryAfter,
+	}
+}
+
+// Is reports whether target is ErrRateLimited
+func (e *RateLimited) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// Unwrap returns the embedded ContdError
+func (e *RateLimited) Unwrap() error {
+	return &e.ContdError
+}
+
+// ApplicationFailure is a business outcome rather than a system error, such
+// as an order rejected for fraud. A workflow returning it completes with the
+// failure as its result: it is journaled and queryable, but never retried
+// and not reported as a failed workflow.
+type ApplicationFailure struct {
+	ContdError
+	// Type categorizes the failure for callers, e.g. "fraud_rejected"
+	Type string
+}
+
+// NewApplicationFailure creates a new ApplicationFailure. The runner sets
+// its WorkflowID when the workflow completes with it.
+func NewApplicationFailure(failureType, message string, details map[string]interface{}) *ApplicationFailure {
+	fields := make(map[string]interface{}, len(details)+1)
+	for k, v := range details {
+		fields[k] = v
+	}
+	fields["failure_type"] = failureType
+	return &ApplicationFailure{
+		ContdError: ContdError{
+			Message: message,
+			Details: fields,
+		},
+		Type: failureType,
+	}
+}
+
+// Is reports whether target is ErrApplicationFailure
+func (e *ApplicationFailure) Is(target error) bool {
+	return target == ErrApplicationFailure
+}
+
+// Unwrap returns the embedded ContdError
+func (e *ApplicationFailure) Unwrap() error {
+	return &e.ContdError
+}
@@ -0,0 +1,65 @@
+// Command approval runs a workflow on the in-memory engine that suspends
+// until it receives an "approved" signal. The first run suspends; after the
+// signal is sent, running the workflow again resumes it and it completes.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+func expenseApproval(ctx context.Context, input interface{}) (interface{}, error) {
+	ec, err := contd.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	steps := contd.NewStepRunner(contd.DefaultStepConfig())
+
+	if _, err := steps.Run(ctx, "submit_expense", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		fmt.Println("submitted expense", input)
+		return map[string]interface{}{"submitted": true}, nil
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	for {
+		approver, ok, err := contd.ReceiveSignal[string](ctx, "approved")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return map[string]interface{}{"approved_by": approver}, nil
+		}
+		if err := ec.Suspend("awaiting approval"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func main() {
+	ctx := context.Background()
+	engine := contd.NewInMemoryEngine()
+	config := contd.WorkflowConfig{WorkflowID: "expense-42"}
+	input := map[string]interface{}{"amount": 120}
+
+	_, err := contd.NewWorkflowRunner(engine, config).Run(ctx, "expense-approval", expenseApproval, input)
+	var suspended *contd.WorkflowSuspended
+	if !errors.As(err, &suspended) {
+		log.Fatalf("expected the workflow to suspend, got %v", err)
+	}
+	fmt.Println("suspended:", suspended.Reason)
+
+	if err := contd.SignalLocal(engine, config.WorkflowID, "approved", "alice"); err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := contd.NewWorkflowRunner(engine, config).Run(ctx, "expense-approval", expenseApproval, input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("completed:", result)
+}
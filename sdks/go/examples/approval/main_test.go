@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/examples/internal/exampletest"
+)
+
+func TestApproval(t *testing.T) {
+	output := exampletest.Output(t, main)
+	exampletest.Contains(t, output,
+		"suspended: awaiting approval",
+		"completed: map[approved_by:alice]",
+	)
+}
@@ -0,0 +1,51 @@
+// Package exampletest runs the example programs in tests and checks what
+// they print.
+package exampletest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Output runs fn and returns everything it writes to standard output
+func Output(t testing.TB, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	copied := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		copied <- buf.Bytes()
+	}()
+	fn()
+	w.Close()
+	return string(<-copied)
+}
+
+// Contains fails t for each of lines that output has no line starting with
+func Contains(t testing.TB, output string, lines ...string) {
+	t.Helper()
+	printed := strings.Split(output, "\n")
+	for _, want := range lines {
+		found := false
+		for _, line := range printed {
+			if strings.HasPrefix(line, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("output has no line starting %q; got:\n%s", want, output)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Command quickstart runs a three-step order workflow on the in-memory
+// engine. The payment step fails on its first attempt, as if the process
+// crashed mid-workflow; running the workflow again under the same ID
+// resumes after the last completed step instead of starting over.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+var paymentAttempts int
+
+func processOrder(ctx context.Context, input interface{}) (interface{}, error) {
+	orderID := input.(map[string]interface{})["orderId"].(string)
+	steps := contd.NewStepRunner(contd.DefaultStepConfig())
+
+	if _, err := steps.Run(ctx, "reserve_inventory", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		fmt.Println("reserving inventory for", orderID)
+		return map[string]interface{}{"reserved": true}, nil
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	if _, err := steps.Run(ctx, "charge_payment", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		paymentAttempts++
+		if paymentAttempts == 1 {
+			return nil, errors.New("payment gateway unavailable")
+		}
+		fmt.Println("charging payment for", orderID)
+		return map[string]interface{}{"charge_id": "ch_" + orderID}, nil
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	if _, err := steps.Run(ctx, "ship_order", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		fmt.Println("shipping", orderID)
+		return map[string]interface{}{"shipped": true}, nil
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	ec, err := contd.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chargeID, err := contd.Get[string](ec, "charge_id")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"order": orderID, "charge_id": chargeID}, nil
+}
+
+func main() {
+	ctx := context.Background()
+	engine := contd.NewInMemoryEngine()
+	config := contd.WorkflowConfig{WorkflowID: "order-12345"}
+	input := map[string]interface{}{"orderId": "12345"}
+
+	_, err := contd.NewWorkflowRunner(engine, config).Run(ctx, "process-order", processOrder, input)
+	fmt.Println("first run failed:", err)
+
+	result, err := contd.NewWorkflowRunner(engine, config).Run(ctx, "process-order", processOrder, input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("resumed run completed:", result)
+}
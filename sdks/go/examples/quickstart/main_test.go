@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/examples/internal/exampletest"
+)
+
+func TestQuickstart(t *testing.T) {
+	output := exampletest.Output(t, main)
+	exampletest.Contains(t, output,
+		"first run failed: Step execution failed: payment gateway unavailable",
+		"charging payment for 12345",
+		"resumed run completed: map[charge_id:ch_12345 order:12345]",
+	)
+}
@@ -0,0 +1,117 @@
+// Command research runs an LLM research agent on the in-memory engine. The
+// agent plans, researches and writes a report, taking a savepoint after
+// each phase. It then time-travels back to the savepoint taken after
+// planning and writes the report again: the planning call is not repeated,
+// because its transcript is part of the restored state.
+//
+// A scripted provider stands in for a real model; swap in llm.NewOpenAI or
+// llm.NewAnthropic to run against an API.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+	"github.com/bhavdeep98/contd.ai/sdks/go/llm"
+)
+
+// scriptedProvider answers each phase with canned text and counts calls
+type scriptedProvider struct {
+	calls map[string]int
+}
+
+func (p *scriptedProvider) Complete(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	phase := req.Messages[0].Content
+	phase = phase[:strings.Index(phase, ":")]
+	p.calls[phase]++
+	answers := map[string]string{
+		"plan":     "1. Survey durable execution engines 2. Compare replay models",
+		"research": "Journaled engines replay completed steps instead of re-running them",
+		"report":   fmt.Sprintf("Report #%d: durable workflows avoid repeating finished work", p.calls[phase]),
+	}
+	return &llm.Response{
+		Model:   req.Model,
+		Content: answers[phase],
+		Usage:   llm.Usage{InputTokens: 200, OutputTokens: 50},
+	}, nil
+}
+
+func newAgent(provider llm.Provider) contd.WorkflowFunc {
+	model := llm.NewStep(llm.Config{
+		Provider: provider,
+		Pricing:  map[string]llm.Price{"demo-model": {InputPerMillion: 3, OutputPerMillion: 15}},
+	})
+	ask := func(ctx context.Context, name, prompt string) (string, error) {
+		resp, err := model.Run(ctx, name, llm.Request{
+			Model:    "demo-model",
+			Messages: []llm.Message{{Role: "user", Content: prompt}},
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Content, nil
+	}
+
+	return func(ctx context.Context, input interface{}) (interface{}, error) {
+		ec, err := contd.Current(ctx)
+		if err != nil {
+			return nil, err
+		}
+		topic := input.(string)
+
+		plan, err := ask(ctx, "plan", "plan: how to research "+topic)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ec.CreateSavepoint(&contd.SavepointMetadata{GoalSummary: "research " + topic, NextStep: "research"}); err != nil {
+			return nil, err
+		}
+
+		findings, err := ask(ctx, "research", "research: "+plan)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ec.CreateSavepoint(&contd.SavepointMetadata{GoalSummary: "research " + topic, NextStep: "report"}); err != nil {
+			return nil, err
+		}
+
+		return ask(ctx, "report", "report: "+findings)
+	}
+}
+
+func main() {
+	ctx := context.Background()
+	engine := contd.NewInMemoryEngine()
+	provider := &scriptedProvider{calls: make(map[string]int)}
+	agent := newAgent(provider)
+	config := contd.WorkflowConfig{WorkflowID: "research-1"}
+
+	report, err := contd.NewWorkflowRunner(engine, config).Run(ctx, "research-agent", agent, "durable execution")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("first report:", report)
+
+	savepoints, err := engine.ListSavepoints(config.WorkflowID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(savepoints) != 2 {
+		log.Fatalf("expected 2 savepoints, got %d", len(savepoints))
+	}
+	fmt.Printf("rewinding to savepoint %q taken before %s\n", savepoints[0].SavepointID, savepoints[0].Metadata.NextStep)
+
+	config.ResumeFromSavepoint = savepoints[0].SavepointID
+	report, err = contd.NewWorkflowRunner(engine, config).Run(ctx, "research-agent", agent, "durable execution")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("second report:", report)
+	fmt.Println("provider calls:", provider.calls)
+	if provider.calls["plan"] != 1 || provider.calls["report"] != 2 {
+		log.Fatalf("unexpected provider calls: %v", provider.calls)
+	}
+}
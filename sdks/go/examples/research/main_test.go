@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/examples/internal/exampletest"
+)
+
+func TestResearch(t *testing.T) {
+	output := exampletest.Output(t, main)
+	exampletest.Contains(t, output,
+		"first report: Report #1: durable workflows avoid repeating finished work",
+		"second report: Report #2: durable workflows avoid repeating finished work",
+		"provider calls: map[plan:1 report:2 research:2]",
+	)
+}
@@ -0,0 +1,77 @@
+// Command saga runs an order saga on the in-memory engine. Each step that
+// changes the outside world has a compensating step; when the card is
+// declined, the inventory reservation is released in a step of its own, so
+// a crash during cleanup resumes it without releasing twice.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+// inventory stands in for an external inventory service
+var inventory = map[string]int{"widget": 5}
+
+func orderSaga(ctx context.Context, input interface{}) (interface{}, error) {
+	order := input.(map[string]interface{})
+	item, card := order["item"].(string), order["card"].(string)
+	steps := contd.NewStepRunner(contd.StepConfig{Retry: &contd.RetryPolicy{MaxAttempts: 1}})
+
+	if _, err := steps.Run(ctx, "reserve_inventory", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		inventory[item]--
+		return map[string]interface{}{"reserved": item}, nil
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	_, err := steps.Run(ctx, "charge_card", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		if card == "4000-0000-0000-0002" {
+			return nil, errors.New("card declined")
+		}
+		return map[string]interface{}{"charged": card}, nil
+	}, nil)
+	if err != nil {
+		// Undo the reservation before failing the saga
+		if _, undoErr := steps.Run(ctx, "release_inventory", func(ctx context.Context, _ interface{}) (interface{}, error) {
+			inventory[item]++
+			return map[string]interface{}{"reserved": nil}, nil
+		}, nil); undoErr != nil {
+			return nil, undoErr
+		}
+		return nil, err
+	}
+
+	if _, err := steps.Run(ctx, "ship_order", func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return map[string]interface{}{"shipped": true}, nil
+	}, nil); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"item": item, "status": "shipped"}, nil
+}
+
+func main() {
+	ctx := context.Background()
+	engine := contd.NewInMemoryEngine()
+
+	result, err := contd.NewWorkflowRunner(engine, contd.WorkflowConfig{}).Run(ctx, "order-saga", orderSaga,
+		map[string]interface{}{"item": "widget", "card": "4242-4242-4242-4242"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("first order:", result, "- widgets left:", inventory["widget"])
+
+	_, err = contd.NewWorkflowRunner(engine, contd.WorkflowConfig{}).Run(ctx, "order-saga", orderSaga,
+		map[string]interface{}{"item": "widget", "card": "4000-0000-0000-0002"})
+	var stepErr *contd.StepError
+	if !errors.As(err, &stepErr) || stepErr.StepName != "charge_card" {
+		log.Fatalf("expected the charge to fail, got %v", err)
+	}
+	fmt.Println("second order failed at", stepErr.StepName, "- widgets left:", inventory["widget"])
+	if inventory["widget"] != 4 {
+		log.Fatalf("reservation was not compensated: %d widgets left", inventory["widget"])
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/examples/internal/exampletest"
+)
+
+func TestSaga(t *testing.T) {
+	output := exampletest.Output(t, main)
+	exampletest.Contains(t, output,
+		"first order: map[item:widget status:shipped] - widgets left: 4",
+		"second order failed at charge_card - widgets left: 4",
+	)
+}
@@ -0,0 +1,91 @@
+// Command scraper fans a crawl out over a list of pages with RunBatch on
+// the in-memory engine. Pages are fetched concurrently, each with its own
+// retries, so one flaky page is retried without refetching the others. The
+// pages are served from a local test server to keep the example offline.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+func newSite() (*httptest.Server, *int64) {
+	var fetches int64
+	var flaked int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		// The pricing page fails once, like an overloaded backend
+		if r.URL.Path == "/pricing" && atomic.CompareAndSwapInt32(&flaked, 0, 1) {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "<title>%s</title>", strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	return server, &fetches
+}
+
+func newCrawler(baseURL string) contd.WorkflowFunc {
+	return func(ctx context.Context, input interface{}) (interface{}, error) {
+		var pages []interface{}
+		for _, path := range input.([]string) {
+			pages = append(pages, baseURL+path)
+		}
+
+		steps := contd.NewStepRunner(contd.DefaultStepConfig())
+		titles, err := steps.RunBatch(ctx, "fetch_pages", pages, func(ctx context.Context, index int, item interface{}) (interface{}, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", item.(string), nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("GET %s: %s", item, resp.Status)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			title := strings.TrimSuffix(strings.TrimPrefix(string(body), "<title>"), "</title>")
+			return title, nil
+		}, contd.BatchOptions{
+			Concurrency: 4,
+			Retry:       &contd.RetryPolicy{MaxAttempts: 3, BackoffBase: 0.1, BackoffMax: 0.5},
+			ItemTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"titles": titles}, nil
+	}
+}
+
+func main() {
+	server, fetches := newSite()
+	defer server.Close()
+
+	paths := []string{"/home", "/docs", "/pricing", "/blog", "/about", "/careers"}
+	engine := contd.NewInMemoryEngine()
+	result, err := contd.NewWorkflowRunner(engine, contd.WorkflowConfig{}).Run(context.Background(), "scraper", newCrawler(server.URL), paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+	titles := result.(map[string]interface{})["titles"].([]interface{})
+	fmt.Println("titles:", titles)
+	fmt.Println("fetches:", atomic.LoadInt64(fetches))
+	if len(titles) != len(paths) || atomic.LoadInt64(fetches) != int64(len(paths)+1) {
+		log.Fatalf("expected %d titles from %d fetches", len(paths), len(paths)+1)
+	}
+}
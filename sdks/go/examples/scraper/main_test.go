@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bhavdeep98/contd.ai/sdks/go/examples/internal/exampletest"
+)
+
+func TestScraper(t *testing.T) {
+	output := exampletest.Output(t, main)
+	exampletest.Contains(t, output,
+		"titles: [home docs pricing blog about careers]",
+		"fetches: 7",
+	)
+}
@@ -0,0 +1,132 @@
+package contd
+
+import (
+	"context"
+	"time"
+)
+
+// WorkflowOption configures a workflow run with Execute
+type WorkflowOption func(*WorkflowConfig)
+
+// Execute runs fn as the durable workflow workflowName on engine:
+//
+//	result, err := contd.Execute(ctx, engine, "process-order", processOrder, order,
+//	    contd.WithWorkflowID("order-"+order.ID),
+//	    contd.WithTags(map[string]string{"team": "payments"}),
+//	    contd.WithMaxDuration(time.Hour))
+//
+// Running it again under the same WithWorkflowID resumes it. A
+// WorkflowRunner built with NewWorkflowRunner remains available for
+// registries, rate limits and other runner-wide settings.
+func Execute(ctx context.Context, engine Engine, workflowName string, fn WorkflowFunc, input interface{}, opts ...WorkflowOption) (interface{}, error) {
+	var config WorkflowConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return NewWorkflowRunner(engine, config).Run(ctx, workflowName, fn, input)
+}
+
+// WithWorkflowConfig starts from config; options after it override its
+// fields. Its tags, memo and requirements are copied, so later options and
+// the run never change the caller's config.
+func WithWorkflowConfig(config WorkflowConfig) WorkflowOption {
+	return func(c *WorkflowConfig) {
+		*c = config
+		if config.Tags != nil {
+			c.Tags = make(map[string]string, len(config.Tags))
+			for k, v := range config.Tags {
+				c.Tags[k] = v
+			}
+		}
+		if config.Memo != nil {
+			c.Memo = make(map[string]interface{}, len(config.Memo))
+			for k, v := range config.Memo {
+				c.Memo[k] = v
+			}
+		}
+		if config.Requires != nil {
+			c.Requires = append([]string(nil), config.Requires...)
+		}
+	}
+}
+
+// WithWorkflowID runs the workflow under id, resuming it if it exists
+func WithWorkflowID(id string) WorkflowOption {
+	return func(c *WorkflowConfig) { c.WorkflowID = id }
+}
+
+// WithTags adds tags to the workflow
+func WithTags(tags map[string]string) WorkflowOption {
+	return func(c *WorkflowConfig) {
+		if c.Tags == nil {
+			c.Tags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			c.Tags[k] = v
+		}
+	}
+}
+
+// WithMaxDuration bounds how long the workflow may run
+func WithMaxDuration(d time.Duration) WorkflowOption {
+	return func(c *WorkflowConfig) { c.MaxDuration = d }
+}
+
+// WithOrgID runs the workflow in org
+func WithOrgID(org string) WorkflowOption {
+	return func(c *WorkflowConfig) { c.OrgID = org }
+}
+
+// WithWorkflowRetry reruns the failed workflow under policy
+func WithWorkflowRetry(policy RetryPolicy) WorkflowOption {
+	return func(c *WorkflowConfig) { c.RetryPolicy = &policy }
+}
+
+// WithBusinessKey starts the workflow only if none exists for key yet,
+// resuming the existing one otherwise
+func WithBusinessKey(key string) WorkflowOption {
+	return func(c *WorkflowConfig) { c.BusinessKey = key }
+}
+
+// WithIDReusePolicy decides whether a closed workflow's ID may start a new
+// run
+func WithIDReusePolicy(policy IDReusePolicy) WorkflowOption {
+	return func(c *WorkflowConfig) { c.IDReusePolicy = policy }
+}
+
+// WithTaskQueue runs the workflow on queue's workers
+func WithTaskQueue(queue string) WorkflowOption {
+	return func(c *WorkflowConfig) { c.TaskQueue = queue }
+}
+
+// WithPriority orders the workflow among queued ones; higher starts sooner
+func WithPriority(priority int) WorkflowOption {
+	return func(c *WorkflowConfig) { c.Priority = priority }
+}
+
+// WithBudget suspends the workflow once it spends budget
+func WithBudget(budget Budget) WorkflowOption {
+	return func(c *WorkflowConfig) { c.Budget = &budget }
+}
+
+// WithSnapshotPolicy decides which checkpointing steps snapshot state
+func WithSnapshotPolicy(policy SnapshotPolicy) WorkflowOption {
+	return func(c *WorkflowConfig) { c.SnapshotPolicy = policy }
+}
+
+// WithHistoryLimits bounds the workflow's journal
+func WithHistoryLimits(limits HistoryLimits) WorkflowOption {
+	return func(c *WorkflowConfig) { c.HistoryLimits = &limits }
+}
+
+// WithDeterminismCheck runs the workflow body again after each successful
+// run to report nondeterminism. Code outside steps runs twice, so use it in
+// tests and development only.
+func WithDeterminismCheck(mode DeterminismMode) WorkflowOption {
+	return func(c *WorkflowConfig) { c.DeterminismCheck = mode }
+}
+
+// WithWorkflowMemo attaches memo fields to the workflow
+func WithWorkflowMemo(memo map[string]interface{}) WorkflowOption {
+	return func(c *WorkflowConfig) { c.Memo = memo }
+}
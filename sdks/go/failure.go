@@ -0,0 +1,54 @@
+package contd
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// recordFailure journals the error a workflow failed with
+func recordFailure(engine Engine, ec *ExecutionContext, err error) {
+	if appendErr := appendEvent(engine, ec, "workflow_failed", map[string]interface{}{
+		"error":   err.Error(),
+		"code":    errorCode(err),
+		"failure": EncodeError(err),
+	}); appendErr != nil {
+		fmt.Printf("Failed to journal failure of %s: %v\n", ec.WorkflowID, appendErr)
+	}
+}
+
+// wireErrorValue reads a failure recorded in a journal event, which is a
+// *WireError in memory and a map once the event is decoded from JSON
+func wireErrorValue(value interface{}) *WireError {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case *WireError:
+		return v
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var w WireError
+	if err := json.Unmarshal(data, &w); err != nil || w.Code == "" {
+		return nil
+	}
+	return &w
+}
+
+// Chain returns the error followed by its causes, outermost first
+func (w *WireError) Chain() []*WireError {
+	var chain []*WireError
+	for ; w != nil; w = w.Cause {
+		chain = append(chain, w)
+	}
+	return chain
+}
+
+// Root returns the innermost cause of the error
+func (w *WireError) Root() *WireError {
+	for w != nil && w.Cause != nil {
+		w = w.Cause
+	}
+	return w
+}
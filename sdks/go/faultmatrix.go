@@ -0,0 +1,229 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FaultKind is where a fault-matrix run interrupts the workflow
+type FaultKind string
+
+const (
+	// FaultStepBoundary interrupts before a step starts
+	FaultStepBoundary FaultKind = "step_boundary"
+	// FaultJournalWrite interrupts while a step's completion is journaled,
+	// after the step ran but before its result was recorded
+	FaultJournalWrite FaultKind = "journal_write"
+)
+
+// SideEffectCounter counts external side effects performed by steps, so
+// fault-matrix runs can check each one happened exactly once
+type SideEffectCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewSideEffectCounter creates an empty counter
+func NewSideEffectCounter() *SideEffectCounter {
+	return &SideEffectCounter{counts: make(map[string]int)}
+}
+
+// Inc records one occurrence of a side effect
+func (c *SideEffectCounter) Inc(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[name]++
+}
+
+// Counts returns a copy of the current counts
+func (c *SideEffectCounter) Counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make(map[string]int, len(c.counts))
+	for k, v := range c.counts {
+		result[k] = v
+	}
+	return result
+}
+
+// Reset clears all counts
+func (c *SideEffectCounter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = make(map[string]int)
+}
+
+// FaultMatrixOptions configures RunFaultMatrix
+type FaultMatrixOptions struct {
+	Input interface{}
+	// SideEffects is reset before each run and compared against the baseline
+	SideEffects *SideEffectCounter
+	// SkipJournalFaults only interrupts at step boundaries
+	SkipJournalFaults bool
+}
+
+// FaultRun is the outcome of one run of the fault matrix
+type FaultRun struct {
+	Kind FaultKind
+	// Step is the index of the executed step the fault was injected at
+	Step        int
+	Interrupted bool
+	Result      interface{}
+	FinalState  *WorkflowState
+	SideEffects map[string]int
+	Violations  []string
+}
+
+// FaultMatrixReport holds the baseline run and every faulted run
+type FaultMatrixReport struct {
+	Baseline FaultRun
+	Runs     []FaultRun
+}
+
+// Err returns an error describing every violation, or nil if each faulted
+// run matched the baseline
+func (r *FaultMatrixReport) Err() error {
+	var lines []string
+	for _, run := range r.Runs {
+		for _, v := range run.Violations {
+			lines = append(lines, fmt.Sprintf("%s@%d: %s", run.Kind, run.Step, v))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return fmt.Errorf("exactly-once violations in %d runs:\n  %s", len(r.Runs), strings.Join(lines, "\n  "))
+}
+
+// RunFaultMatrix checks that a workflow is crash-consistent. It runs the
+// workflow once without faults, then once for every step boundary and every
+// step commit, each time interrupting there and resuming. Every resumed run
+// must produce the baseline's result, final state variables and side-effect
+// counts. Each run uses a fresh MockEngine.
+func RunFaultMatrix(ctx context.Context, workflowName string, fn WorkflowFunc, opts FaultMatrixOptions) (*FaultMatrixReport, error) {
+	tc := NewTestCase()
+	resetSideEffects(opts.SideEffects)
+	result, err := tc.RunWorkflow(ctx, workflowName, fn, RunWorkflowOptions{Input: opts.Input})
+	if err != nil {
+		return nil, fmt.Errorf("baseline run failed: %w", err)
+	}
+	report := &FaultMatrixReport{
+		Baseline: FaultRun{
+			Result:      result,
+			FinalState:  tc.CurrentExecution.FinalState,
+			SideEffects: sideEffectCounts(opts.SideEffects),
+		},
+	}
+
+	steps := 0
+	for _, step := range tc.CurrentExecution.Steps {
+		if step.CompletedAt != nil && !step.WasCached {
+			steps++
+		}
+	}
+
+	kinds := []FaultKind{FaultStepBoundary}
+	if !opts.SkipJournalFaults {
+		kinds = append(kinds, FaultJournalWrite)
+	}
+	for _, kind := range kinds {
+		for step := 0; step < steps; step++ {
+			run, err := runWithFault(ctx, workflowName, fn, opts, kind, step)
+			if err != nil {
+				return nil, err
+			}
+			run.Violations = append(run.Violations, report.Baseline.diff(run)...)
+			report.Runs = append(report.Runs, *run)
+		}
+	}
+	return report, nil
+}
+
+func runWithFault(ctx context.Context, workflowName string, fn WorkflowFunc, opts FaultMatrixOptions, kind FaultKind, step int) (*FaultRun, error) {
+	tc := NewTestCase()
+	resetSideEffects(opts.SideEffects)
+	run := &FaultRun{Kind: kind, Step: step}
+
+	runOpts := RunWorkflowOptions{Input: opts.Input}
+	switch kind {
+	case FaultStepBoundary:
+		runOpts.InterruptAtStep = &step
+	case FaultJournalWrite:
+		tc.Engine.SetInterruptJournalAt(step)
+	}
+
+	result, err := tc.RunWorkflow(ctx, workflowName, fn, runOpts)
+	if err != nil {
+		run.Violations = append(run.Violations, fmt.Sprintf("faulted run failed: %v", err))
+		return run, nil
+	}
+	if tc.CurrentExecution.Status != "interrupted" {
+		run.Violations = append(run.Violations, "fault was never reached")
+		run.Result = result
+		run.FinalState = tc.CurrentExecution.FinalState
+		run.SideEffects = sideEffectCounts(opts.SideEffects)
+		return run, nil
+	}
+	run.Interrupted = true
+
+	result, err = tc.ResumeWorkflow(ctx, workflowName, fn, opts.Input)
+	if err != nil {
+		run.Violations = append(run.Violations, fmt.Sprintf("resume failed: %v", err))
+	}
+	run.Result = result
+	run.FinalState = tc.CurrentExecution.FinalState
+	run.SideEffects = sideEffectCounts(opts.SideEffects)
+	return run, nil
+}
+
+// diff lists how a faulted run differs from the baseline
+func (b FaultRun) diff(run *FaultRun) []string {
+	var violations []string
+	if !reflect.DeepEqual(b.Result, run.Result) {
+		violations = append(violations, fmt.Sprintf("result %v, expected %v", run.Result, b.Result))
+	}
+	if !reflect.DeepEqual(stateVariables(b.FinalState), stateVariables(run.FinalState)) {
+		violations = append(violations, fmt.Sprintf("final state %v, expected %v", stateVariables(run.FinalState), stateVariables(b.FinalState)))
+	}
+
+	names := make([]string, 0, len(b.SideEffects)+len(run.SideEffects))
+	for name := range b.SideEffects {
+		names = append(names, name)
+	}
+	for name := range run.SideEffects {
+		if _, ok := b.SideEffects[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if got, want := run.SideEffects[name], b.SideEffects[name]; got != want {
+			violations = append(violations, fmt.Sprintf("side effect %s happened %d times, expected %d", name, got, want))
+		}
+	}
+	return violations
+}
+
+func stateVariables(state *WorkflowState) map[string]interface{} {
+	if state == nil {
+		return nil
+	}
+	return state.Variables
+}
+
+func resetSideEffects(counter *SideEffectCounter) {
+	if counter != nil {
+		counter.Reset()
+	}
+}
+
+func sideEffectCounts(counter *SideEffectCounter) map[string]int {
+	if counter == nil {
+		return nil
+	}
+	return counter.Counts()
+}
@@ -0,0 +1,69 @@
+package contd
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestStaleFencingTokenRejected checks that once a workflow's lease passes
+// to a new owner, the old owner's journal writes and attempts are rejected
+func TestStaleFencingTokenRejected(t *testing.T) {
+	engines := map[string]Engine{
+		"memory": NewInMemoryEngine(),
+		"mock":   NewMockEngine(),
+	}
+	for name, engine := range engines {
+		t.Run(name, func(t *testing.T) {
+			stale, err := engine.LeaseManager().Acquire("fenced-1", "worker-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := engine.LeaseManager().Release(stale); err != nil {
+				t.Fatal(err)
+			}
+			current, err := engine.LeaseManager().Acquire("fenced-1", "worker-b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current.FencingToken <= stale.FencingToken {
+				t.Fatalf("new lease token %d, want more than %d", current.FencingToken, stale.FencingToken)
+			}
+
+			err = engine.Journal().Append(map[string]interface{}{
+				"event_id":      "stale-write",
+				"workflow_id":   "fenced-1",
+				"event_type":    "step_intention",
+				"step_id":       "charge_0",
+				"fencing_token": stale.FencingToken,
+			})
+			if !errors.Is(err, ErrStaleLease) {
+				t.Errorf("append with stale token: got %v, want StaleLease", err)
+			}
+			if _, err := engine.Idempotency().AllocateAttempt("fenced-1", "charge_0", stale); !errors.Is(err, ErrStaleLease) {
+				t.Errorf("attempt with stale lease: got %v, want StaleLease", err)
+			}
+			if _, err := engine.Idempotency().AllocateAttempt("fenced-1", "charge_0", current); err != nil {
+				t.Errorf("attempt with current lease: %v", err)
+			}
+		})
+	}
+}
+
+// TestResetWorkflowDropsAttemptTokens checks that resetting a workflow
+// forgets the fencing tokens of its attempts along with their counts
+func TestResetWorkflowDropsAttemptTokens(t *testing.T) {
+	engine := NewInMemoryEngine()
+	lease, err := engine.LeaseManager().Acquire("reset-1", "worker-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Idempotency().AllocateAttempt("reset-1", "charge_0", lease); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.ResetWorkflow("reset-1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(engine.attempts) != 0 || len(engine.attemptTokens) != 0 {
+		t.Errorf("after reset: %d attempts and %d attempt tokens remain", len(engine.attempts), len(engine.attemptTokens))
+	}
+}
@@ -0,0 +1,172 @@
+package contd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileBuffer is a LocalBuffer kept in an append-only file of JSON lines,
+// with the last synced sequence number in a side file. Every append is
+// fsynced. The log is truncated once everything in it has been synced.
+type FileBuffer struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	pending []BufferedRecord
+	lastSeq uint64
+	acked   uint64
+}
+
+// OpenFileBuffer opens or creates the buffer at path, keeping the synced
+// position in path+".ack"
+func OpenFileBuffer(path string) (*FileBuffer, error) {
+	b := &FileBuffer{path: path}
+	if data, err := os.ReadFile(b.ackPath()); err == nil {
+		if b.acked, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return nil, fmt.Errorf("failed to read buffer position: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	b.lastSeq = b.acked
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	// A line cut short by a crash was never acknowledged to the writer, so
+	// it is dropped along with anything after it
+	var valid int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		var rec BufferedRecord
+		if json.Unmarshal(line, &rec) != nil {
+			break
+		}
+		valid += int64(len(line))
+		if rec.Seq > b.lastSeq {
+			b.lastSeq = rec.Seq
+		}
+		if rec.Seq > b.acked {
+			b.pending = append(b.pending, rec)
+		}
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(valid, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	b.file = file
+	return b, nil
+}
+
+func (b *FileBuffer) ackPath() string {
+	return b.path + ".ack"
+}
+
+// Append writes rec to the log and fsyncs it
+func (b *FileBuffer) Append(rec BufferedRecord) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file == nil {
+		return 0, fmt.Errorf("file buffer is closed")
+	}
+	rec.Seq = b.lastSeq + 1
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := b.file.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	if err := b.file.Sync(); err != nil {
+		return 0, err
+	}
+	b.lastSeq = rec.Seq
+	b.pending = append(b.pending, rec)
+	return rec.Seq, nil
+}
+
+// Pending returns up to limit unsynced records, oldest first
+func (b *FileBuffer) Pending(limit int) ([]BufferedRecord, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.pending)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	return append([]BufferedRecord(nil), b.pending[:n]...), nil
+}
+
+// Ack records seq as synced, truncating the log once nothing is pending
+func (b *FileBuffer) Ack(seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if seq <= b.acked {
+		return nil
+	}
+	if err := writeFileSync(b.ackPath(), []byte(strconv.FormatUint(seq, 10))); err != nil {
+		return err
+	}
+	b.acked = seq
+	i := 0
+	for i < len(b.pending) && b.pending[i].Seq <= seq {
+		i++
+	}
+	b.pending = b.pending[i:]
+	if len(b.pending) == 0 && b.file != nil {
+		if err := b.file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := b.file.Seek(0, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the log file
+func (b *FileBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
+
+// writeFileSync replaces path with data atomically and durably
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
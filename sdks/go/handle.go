@@ -0,0 +1,98 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// WorkflowHandle binds follow-up calls on a workflow to a client and the
+// workflow's ID
+type WorkflowHandle struct {
+	client     *Client
+	workflowID string
+}
+
+// Run starts a workflow like StartWorkflow and returns a handle to it
+func (c *Client) Run(ctx context.Context, input StartWorkflowInput) (*WorkflowHandle, error) {
+	workflowID, err := c.StartWorkflow(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetHandle(workflowID), nil
+}
+
+// GetHandle returns a handle to an existing workflow without contacting
+// the server
+func (c *Client) GetHandle(workflowID string) *WorkflowHandle {
+	return &WorkflowHandle{client: c, workflowID: workflowID}
+}
+
+// WorkflowID returns the ID of the workflow the handle refers to
+func (h *WorkflowHandle) WorkflowID() string {
+	return h.workflowID
+}
+
+// GetResult waits for the workflow to finish and returns its result
+func (h *WorkflowHandle) GetResult(ctx context.Context, opts WaitOptions) (*WorkflowResult, error) {
+	return h.client.GetResult(ctx, h.workflowID, opts)
+}
+
+// Signal sends a signal to the workflow
+func (h *WorkflowHandle) Signal(ctx context.Context, signalName string, payload interface{}) error {
+	return h.client.Signal(ctx, h.workflowID, signalName, payload)
+}
+
+// Query asks the server to answer a named query about the workflow and
+// decodes the answer into result
+func (h *WorkflowHandle) Query(ctx context.Context, queryName string, args interface{}, result interface{}) error {
+	return h.client.Query(ctx, h.workflowID, queryName, args, result)
+}
+
+// Cancel cancels the workflow
+func (h *WorkflowHandle) Cancel(ctx context.Context) error {
+	return h.client.Cancel(ctx, h.workflowID)
+}
+
+// Describe returns the workflow's status
+func (h *WorkflowHandle) Describe(ctx context.Context) (*WorkflowStatusResponse, error) {
+	return h.client.GetStatus(ctx, h.workflowID)
+}
+
+// Savepoints returns the workflow's savepoints
+func (h *WorkflowHandle) Savepoints(ctx context.Context) ([]SavepointInfo, error) {
+	return h.client.GetSavepoints(ctx, h.workflowID)
+}
+
+// Query asks the server to answer a named query about a workflow, passing
+// args, and decodes the answer into result unless result is nil
+func (c *Client) Query(ctx context.Context, workflowID, queryName string, args interface{}, result interface{}) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{"args": args})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/query/%s", workflowID, url.PathEscape(queryName)), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if result == nil || len(answer.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(answer.Result, result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
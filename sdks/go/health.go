@@ -0,0 +1,150 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds the connection check behind /readyz
+const healthCheckTimeout = 5 * time.Second
+
+// HealthChecker is implemented by engines that can check their connection
+// to the backing store
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// WorkerHealth is the body of the pool's health endpoints
+type WorkerHealth struct {
+	Status string `json:"status"`
+	// InFlight is how many workflows are running in the pool
+	InFlight int `json:"in_flight"`
+	Queued   int `json:"queued"`
+	// LeasesLost counts running workflows whose heartbeat failed to renew
+	// their lease
+	LeasesLost int    `json:"leases_lost"`
+	Connected  bool   `json:"connected"`
+	Draining   bool   `json:"draining"`
+	Error      string `json:"error,omitempty"`
+}
+
+// leasesLost counts running workflows that lost their lease
+func (s *runningSet) leasesLost() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lost := 0
+	for _, ec := range s.ecs {
+		if ec.leaseLost() {
+			lost++
+		}
+	}
+	return lost
+}
+
+// checkConnection runs the engine's and the config's health checks
+func (p *WorkerPool) checkConnection(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if checker, ok := engineAs[HealthChecker](p.engine); ok {
+		if err := checker.CheckHealth(ctx); err != nil {
+			return err
+		}
+	}
+	if p.config.HealthCheck != nil {
+		return p.config.HealthCheck(ctx)
+	}
+	return nil
+}
+
+// Health reports the pool's in-flight work, lease health and connection
+// status. The pool is ready while it accepts work and its connection check
+// passes.
+func (p *WorkerPool) Health(ctx context.Context) WorkerHealth {
+	p.mu.Lock()
+	health := WorkerHealth{
+		InFlight: p.running,
+		Queued:   len(p.queue),
+		Draining: p.closed,
+	}
+	p.mu.Unlock()
+	health.LeasesLost = p.tracker.running.leasesLost()
+
+	health.Status = "ok"
+	if err := p.checkConnection(ctx); err != nil {
+		health.Status, health.Error = "unavailable", err.Error()
+	} else {
+		health.Connected = true
+	}
+	if health.Draining {
+		health.Status = "draining"
+	}
+	return health
+}
+
+// live reports whether the worker is making progress: it is not when every
+// in-flight workflow has lost its lease, as heartbeats are not getting through
+func (h WorkerHealth) live() bool {
+	return h.LeasesLost == 0 || h.LeasesLost < h.InFlight
+}
+
+// ready reports whether the worker should be sent new work
+func (h WorkerHealth) ready() bool {
+	return h.Connected && !h.Draining
+}
+
+// HealthHandler serves the pool's health endpoints:
+//
+//   - GET /healthz fails once every in-flight workflow has lost its lease
+//   - GET /readyz fails while the pool drains or its connection check fails
+//   - POST /drain starts Drain in the background, allowing DrainTimeout,
+//     so a preStop hook can hand work over before the pod is killed
+//
+// Each responds with a WorkerHealth body and 503 when the check fails.
+func (p *WorkerPool) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		health := p.Health(r.Context())
+		writeHealth(w, health, health.live())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		health := p.Health(r.Context())
+		writeHealth(w, health, health.ready())
+	})
+	mux.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), p.config.DrainTimeout)
+			defer cancel()
+			if err := p.Drain(ctx); err != nil {
+				fmt.Printf("Warning: worker pool drain failed: %v\n", err)
+			}
+		}()
+		health := p.Health(r.Context())
+		health.Draining, health.Status = true, "draining"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(health)
+	})
+	return mux
+}
+
+func writeHealth(w http.ResponseWriter, health WorkerHealth, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
+// ServeHealth serves HealthHandler on addr for Kubernetes liveness and
+// readiness probes. It blocks until the server fails.
+func (p *WorkerPool) ServeHealth(addr string) error {
+	return http.ListenAndServe(addr, p.HealthHandler())
+}
@@ -0,0 +1,358 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DiagramFormat selects the syntax RenderHistory produces
+type DiagramFormat string
+
+const (
+	DiagramMermaid DiagramFormat = "mermaid"
+	DiagramDOT     DiagramFormat = "dot"
+)
+
+// HistoryStep is a step reconstructed from journal events
+type HistoryStep struct {
+	StepID     string
+	StepName   string
+	Attempts   int
+	Failures   int
+	LastError  string
+	Completed  bool
+	Redriven   bool
+	DurationMs int64
+	// After is the step whose completion preceded this step's first attempt.
+	// Steps sharing a predecessor ran as parallel branches.
+	After string
+}
+
+// HistoryGroup is a step group reconstructed from journal events
+type HistoryGroup struct {
+	Name       string
+	Completed  bool
+	Error      string
+	DurationMs int64
+	// Steps and Groups are the IDs of the steps and names of the groups
+	// directly inside the group
+	Steps  []string
+	Groups []string
+	// Parent is the enclosing group, or "" at the top level
+	Parent string
+}
+
+// HistorySavepoint is a savepoint reconstructed from journal events
+type HistorySavepoint struct {
+	SavepointID string
+	StepNumber  int
+	// After is the step that completed before the savepoint was taken
+	After string
+}
+
+// WorkflowHistory is a workflow's steps and savepoints in journal order
+type WorkflowHistory struct {
+	WorkflowID string
+	Steps      []*HistoryStep
+	Groups     []*HistoryGroup
+	Savepoints []HistorySavepoint
+	// LastError, FailedStep and Attempt describe the latest step failure
+	LastError  string
+	FailedStep string
+	Attempt    int
+	// Failure is the error the workflow failed with, if it failed
+	Failure *WireError
+	// ApplicationFailure is the business failure the workflow completed
+	// with, if any
+	ApplicationFailure *WireError
+	// Progress is what the workflow last reported with SetProgress
+	Progress *Progress
+}
+
+// AnalyzeHistory reconstructs the steps, retries, branches and savepoints
+// of a workflow from its journal events. Events of other workflows are ignored.
+func AnalyzeHistory(workflowID string, events []map[string]interface{}) *WorkflowHistory {
+	history := &WorkflowHistory{WorkflowID: workflowID}
+	steps := make(map[string]*HistoryStep)
+	groups := make(map[string]*HistoryGroup)
+	lastCompleted := ""
+
+	step := func(event map[string]interface{}) *HistoryStep {
+		id := getString(event, "step_id")
+		s, ok := steps[id]
+		if !ok {
+			s = &HistoryStep{StepID: id, After: lastCompleted}
+			steps[id] = s
+			history.Steps = append(history.Steps, s)
+			if g := groupOf(groups, id); g != nil {
+				g.Steps = append(g.Steps, id)
+			}
+		}
+		return s
+	}
+	group := func(event map[string]interface{}) *HistoryGroup {
+		name := getString(event, "group")
+		g, ok := groups[name]
+		if !ok {
+			g = &HistoryGroup{Name: name}
+			if parent := groupOf(groups, name); parent != nil {
+				g.Parent = parent.Name
+				parent.Groups = append(parent.Groups, name)
+			}
+			groups[name] = g
+			history.Groups = append(history.Groups, g)
+		}
+		return g
+	}
+
+	for _, event := range events {
+		if getString(event, "workflow_id") != workflowID {
+			continue
+		}
+		switch getString(event, "event_type") {
+		case "step_intention":
+			s := step(event)
+			s.Attempts++
+			if name := getString(event, "step_name"); name != "" {
+				s.StepName = name
+			}
+		case "step_failed":
+			s := step(event)
+			s.Failures++
+			s.LastError = getString(event, "error")
+			history.LastError = s.LastError
+			history.FailedStep = s.StepID
+			history.Attempt = int(getFloat(event, "attempt_id"))
+		case "workflow_failed":
+			history.Failure = wireErrorValue(event["failure"])
+		case "workflow_application_failed":
+			history.ApplicationFailure = wireErrorValue(event["failure"])
+		case "progress_updated":
+			history.Progress = progressValue(event)
+		case "step_completed":
+			s := step(event)
+			s.Completed = true
+			s.DurationMs = int64(getFloat(event, "duration_ms"))
+			lastCompleted = s.StepID
+		case "step_redriven":
+			step(event).Redriven = true
+		case "step_group_started":
+			group(event)
+		case "step_group_completed":
+			g := group(event)
+			g.Completed, g.Error = true, ""
+			g.DurationMs = int64(getFloat(event, "duration_ms"))
+		case "step_group_failed":
+			g := group(event)
+			g.Completed = false
+			g.Error = getString(event, "error")
+			g.DurationMs = int64(getFloat(event, "duration_ms"))
+		case "savepoint_created":
+			history.Savepoints = append(history.Savepoints, HistorySavepoint{
+				SavepointID: getString(event, "savepoint_id"),
+				StepNumber:  int(getFloat(event, "step_number")),
+				After:       lastCompleted,
+			})
+		}
+	}
+	return history
+}
+
+// Render draws the history in the given format
+func (h *WorkflowHistory) Render(format DiagramFormat) (string, error) {
+	switch format {
+	case DiagramMermaid:
+		return h.Mermaid(), nil
+	case DiagramDOT:
+		return h.DOT(), nil
+	}
+	return "", NewConfigurationError(fmt.Sprintf("unknown diagram format %q", format), "format")
+}
+
+// Mermaid draws the history as a Mermaid flowchart
+func (h *WorkflowHistory) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	b.WriteString("    start((start))\n")
+	ids := h.nodeIDs()
+	grouped := h.writeMermaidGroups(&b, ids)
+	for _, s := range h.Steps {
+		if !grouped[s.StepID] {
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids[s.StepID], mermaidEscape(s.label("<br/>")))
+		}
+		fmt.Fprintf(&b, "    %s --> %s\n", h.from(ids, s.After), ids[s.StepID])
+		if s.Failures > 0 && s.Attempts > 1 {
+			fmt.Fprintf(&b, "    %s -. \"retried %dx\" .-> %s\n", ids[s.StepID], s.Attempts-1, ids[s.StepID])
+		}
+		if !s.Completed {
+			fmt.Fprintf(&b, "    class %s failed\n", ids[s.StepID])
+		}
+	}
+	for i, sp := range h.Savepoints {
+		id := fmt.Sprintf("sp%d", i)
+		fmt.Fprintf(&b, "    %s{{\"%s\"}}\n", id, mermaidEscape(sp.label()))
+		fmt.Fprintf(&b, "    %s -.- %s\n", h.from(ids, sp.After), id)
+	}
+	b.WriteString("    classDef failed fill:#fdd,stroke:#c00\n")
+	return b.String()
+}
+
+// DOT draws the history as a Graphviz digraph
+func (h *WorkflowHistory) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(h.WorkflowID))
+	b.WriteString("    rankdir=TB;\n")
+	b.WriteString("    start [shape=circle];\n")
+	ids := h.nodeIDs()
+	for _, s := range h.Steps {
+		attrs := "shape=box"
+		if !s.Completed {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(&b, "    %s [label=%s, %s];\n", ids[s.StepID], dotQuote(s.label("\n")), attrs)
+		fmt.Fprintf(&b, "    %s -> %s;\n", h.from(ids, s.After), ids[s.StepID])
+		if s.Failures > 0 && s.Attempts > 1 {
+			fmt.Fprintf(&b, "    %s -> %s [label=%s, style=dashed];\n", ids[s.StepID], ids[s.StepID], dotQuote(fmt.Sprintf("retried %dx", s.Attempts-1)))
+		}
+	}
+	for i, sp := range h.Savepoints {
+		id := fmt.Sprintf("sp%d", i)
+		fmt.Fprintf(&b, "    %s [label=%s, shape=hexagon];\n", id, dotQuote(sp.label()))
+		fmt.Fprintf(&b, "    %s -> %s [style=dotted, arrowhead=none];\n", h.from(ids, sp.After), id)
+	}
+	h.writeDOTGroups(&b, ids)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeMermaidGroups draws the groups as nested subgraphs declaring their
+// steps, returning the steps it declared
+func (h *WorkflowHistory) writeMermaidGroups(b *strings.Builder, ids map[string]string) map[string]bool {
+	grouped := make(map[string]bool)
+	steps := make(map[string]*HistoryStep, len(h.Steps))
+	for _, s := range h.Steps {
+		steps[s.StepID] = s
+	}
+	h.walkGroups(func(g *HistoryGroup, i, depth int) {
+		indent := strings.Repeat("    ", depth+1)
+		fmt.Fprintf(b, "%ssubgraph g%d[\"%s\"]\n", indent, i, mermaidEscape(g.label("<br/>")))
+		for _, id := range g.Steps {
+			fmt.Fprintf(b, "%s    %s[\"%s\"]\n", indent, ids[id], mermaidEscape(steps[id].label("<br/>")))
+			grouped[id] = true
+		}
+	}, func(g *HistoryGroup, depth int) {
+		fmt.Fprintf(b, "%send\n", strings.Repeat("    ", depth+1))
+	})
+	return grouped
+}
+
+// writeDOTGroups draws the groups as nested clusters of their steps
+func (h *WorkflowHistory) writeDOTGroups(b *strings.Builder, ids map[string]string) {
+	h.walkGroups(func(g *HistoryGroup, i, depth int) {
+		indent := strings.Repeat("    ", depth+1)
+		fmt.Fprintf(b, "%ssubgraph cluster_g%d {\n", indent, i)
+		fmt.Fprintf(b, "%s    label=%s;\n", indent, dotQuote(g.label("\n")))
+		if !g.Completed {
+			fmt.Fprintf(b, "%s    color=red;\n", indent)
+		}
+		for _, id := range g.Steps {
+			fmt.Fprintf(b, "%s    %s;\n", indent, ids[id])
+		}
+	}, func(g *HistoryGroup, depth int) {
+		fmt.Fprintf(b, "%s}\n", strings.Repeat("    ", depth+1))
+	})
+}
+
+// walkGroups visits the groups depth first, calling enter with each
+// group's index in h.Groups before its children and leave after them
+func (h *WorkflowHistory) walkGroups(enter func(g *HistoryGroup, i, depth int), leave func(g *HistoryGroup, depth int)) {
+	index := make(map[string]int, len(h.Groups))
+	for i, g := range h.Groups {
+		index[g.Name] = i
+	}
+	var walk func(name string, depth int)
+	walk = func(name string, depth int) {
+		g := h.Groups[index[name]]
+		enter(g, index[name], depth)
+		for _, child := range g.Groups {
+			walk(child, depth+1)
+		}
+		leave(g, depth)
+	}
+	for _, g := range h.Groups {
+		if g.Parent == "" {
+			walk(g.Name, 0)
+		}
+	}
+}
+
+// nodeIDs assigns diagram-safe identifiers to steps
+func (h *WorkflowHistory) nodeIDs() map[string]string {
+	ids := make(map[string]string, len(h.Steps))
+	for i, s := range h.Steps {
+		ids[s.StepID] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+// from returns the node an edge from stepID starts at
+func (h *WorkflowHistory) from(ids map[string]string, stepID string) string {
+	if id, ok := ids[stepID]; ok {
+		return id
+	}
+	return "start"
+}
+
+func (s *HistoryStep) label(sep string) string {
+	name := s.StepName
+	if name == "" {
+		name = s.StepID
+	}
+	lines := []string{name}
+	if s.Attempts > 1 {
+		lines = append(lines, fmt.Sprintf("%d attempts", s.Attempts))
+	}
+	switch {
+	case s.Completed:
+		lines = append(lines, fmt.Sprintf("%dms", s.DurationMs))
+	case s.Failures > 0:
+		lines = append(lines, "failed: "+s.LastError)
+	default:
+		lines = append(lines, "running")
+	}
+	if s.Redriven {
+		lines = append(lines, "redriven")
+	}
+	return strings.Join(lines, sep)
+}
+
+func (sp HistorySavepoint) label() string {
+	return fmt.Sprintf("savepoint %s @ step %d", sp.SavepointID, sp.StepNumber)
+}
+
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	return strings.ReplaceAll(s, "\n", "<br/>")
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// RenderHistory draws a workflow's journal events as a diagram
+func RenderHistory(workflowID string, events []map[string]interface{}, format DiagramFormat) (string, error) {
+	return AnalyzeHistory(workflowID, events).Render(format)
+}
+
+// WorkflowDiagram downloads a workflow's journal and draws it as a diagram
+func (c *Client) WorkflowDiagram(ctx context.Context, workflowID string, format DiagramFormat) (string, error) {
+	archive, err := c.ExportWorkflow(ctx, workflowID)
+	if err != nil {
+		return "", err
+	}
+	return RenderHistory(workflowID, archive.Events, format)
+}
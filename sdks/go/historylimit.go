@@ -0,0 +1,164 @@
+package contd
+
+import "fmt"
+
+// Default history warning thresholds. Past them restores replay enough of
+// the journal to be noticeably slow.
+const (
+	DefaultHistoryWarnEvents = 10000
+	DefaultHistoryWarnBytes  = 10 << 20
+)
+
+// HistorySize is how much journal a workflow has accumulated
+type HistorySize struct {
+	Events int
+	// Bytes is the JSON-encoded size of the events
+	Bytes int64
+}
+
+// add counts event into the size
+func (s *HistorySize) add(event map[string]interface{}) {
+	s.Events++
+	if n, err := jsonSize(event); err == nil {
+		s.Bytes += int64(n)
+	}
+}
+
+// HistorySizer is implemented by engines that track the size of each
+// workflow's journal as it is appended
+type HistorySizer interface {
+	HistorySize(workflowID string) (HistorySize, error)
+}
+
+// HistoryLimitAction is what a runner does once a workflow's history
+// reaches HistoryLimits.MaxEvents or MaxBytes
+type HistoryLimitAction string
+
+const (
+	// HistoryLimitWarn only logs that the limit was reached
+	HistoryLimitWarn HistoryLimitAction = ""
+	// HistoryLimitSnapshot snapshots every checkpointing step from then on,
+	// whatever the SnapshotPolicy, so restores need not replay the journal,
+	// and compacts the journal on engines implementing Compactor
+	HistoryLimitSnapshot HistoryLimitAction = "snapshot"
+	// HistoryLimitContinueAsNew ends the workflow before its next step and
+	// continues it as a fresh workflow whose input is the workflow's
+	// variables
+	HistoryLimitContinueAsNew HistoryLimitAction = "continue_as_new"
+)
+
+// HistoryLimits bounds how large a workflow's journal may grow. The history
+// is checked before each step executes; zero fields are unlimited.
+type HistoryLimits struct {
+	// WarnEvents and WarnBytes log a warning once reached, and make GetInfo
+	// suggest continuing as new
+	WarnEvents int   `json:"warn_events,omitempty"`
+	WarnBytes  int64 `json:"warn_bytes,omitempty"`
+	// MaxEvents and MaxBytes apply Action once reached
+	MaxEvents int                `json:"max_events,omitempty"`
+	MaxBytes  int64              `json:"max_bytes,omitempty"`
+	Action    HistoryLimitAction `json:"action,omitempty"`
+}
+
+// DefaultHistoryLimits warns at the default thresholds and sets no limit
+func DefaultHistoryLimits() *HistoryLimits {
+	return &HistoryLimits{
+		WarnEvents: DefaultHistoryWarnEvents,
+		WarnBytes:  DefaultHistoryWarnBytes,
+	}
+}
+
+// warns reports whether size has reached the warning thresholds
+func (l *HistoryLimits) warns(size HistorySize) bool {
+	return l != nil && ((l.WarnEvents > 0 && size.Events >= l.WarnEvents) ||
+		(l.WarnBytes > 0 && size.Bytes >= l.WarnBytes))
+}
+
+// exceeds reports whether size has reached the limits
+func (l *HistoryLimits) exceeds(size HistorySize) bool {
+	return l != nil && ((l.MaxEvents > 0 && size.Events >= l.MaxEvents) ||
+		(l.MaxBytes > 0 && size.Bytes >= l.MaxBytes))
+}
+
+// historyGuard applies a run's history limits
+type historyGuard struct {
+	limits   *HistoryLimits
+	warned   bool
+	exceeded bool
+}
+
+// historySize returns the workflow's history size, or false when the
+// engine does not track it
+func historySize(engine Engine, workflowID string) (HistorySize, bool) {
+	sizer, ok := engineAs[HistorySizer](engine)
+	if !ok {
+		return HistorySize{}, false
+	}
+	size, err := sizer.HistorySize(workflowID)
+	if err != nil {
+		fmt.Printf("Failed to read history size of workflow %s: %v\n", workflowID, err)
+		return HistorySize{}, false
+	}
+	return size, true
+}
+
+// checkHistory warns once the workflow's history reaches the warning
+// thresholds and applies the limit action once it reaches the limits. It
+// returns ContinueAsNew when the workflow must continue as new.
+func (ec *ExecutionContext) checkHistory(engine Engine) error {
+	ec.mu.RLock()
+	limits := ec.history.limits
+	ec.mu.RUnlock()
+	if limits == nil {
+		return nil
+	}
+	size, ok := historySize(engine, ec.WorkflowID)
+	if !ok {
+		return nil
+	}
+
+	exceeded := limits.exceeds(size)
+	ec.mu.Lock()
+	warn := limits.warns(size) && !ec.history.warned
+	ec.history.warned = ec.history.warned || warn
+	reached := exceeded && !ec.history.exceeded
+	ec.history.exceeded = ec.history.exceeded || exceeded
+	ec.mu.Unlock()
+
+	if warn {
+		fmt.Printf("Warning: workflow %s history has grown to %d events (%d bytes); consider continuing as new\n", ec.WorkflowID, size.Events, size.Bytes)
+	}
+	if reached {
+		fmt.Printf("Warning: workflow %s history reached its limit at %d events (%d bytes)\n", ec.WorkflowID, size.Events, size.Bytes)
+	}
+	if exceeded && limits.Action == HistoryLimitSnapshot {
+		if compactor, ok := engineAs[Compactor](engine); ok {
+			result, err := compactor.Compact(ec.WorkflowID)
+			if err != nil {
+				fmt.Printf("Failed to compact workflow %s: %v\n", ec.WorkflowID, err)
+			} else {
+				fmt.Printf("Compacted %d events of workflow %s into its snapshot at step %d\n", result.EventsDeleted, ec.WorkflowID, result.StepNumber)
+			}
+		}
+	}
+	if !exceeded || limits.Action != HistoryLimitContinueAsNew {
+		return nil
+	}
+	state, err := ec.GetState()
+	if err != nil {
+		return err
+	}
+	variables := make(map[string]interface{}, len(state.Variables))
+	for k, v := range state.Variables {
+		variables[k] = v
+	}
+	return NewContinueAsNew(ec.WorkflowID, variables, "history_limit")
+}
+
+// historySnapshots reports whether a limit reached under
+// HistoryLimitSnapshot forces every checkpoint to snapshot
+func (ec *ExecutionContext) historySnapshots() bool {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.history.exceeded && ec.history.limits.Action == HistoryLimitSnapshot
+}
@@ -0,0 +1,301 @@
+package contd
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Every step journals events, checksums its state and sizes its delta. The
+// helpers here keep that bookkeeping cheap enough that a no-op step costs
+// microseconds: event IDs come from a pool of random bytes, timestamps are
+// formatted once a second, and plain JSON values are encoded without
+// reflection into pooled buffers.
+
+// eventIDs hands out random bytes for event IDs, refilled in bulk so
+// generating an ID rarely reads the system's random source
+var eventIDs struct {
+	mu   sync.Mutex
+	pool [16 * 256]byte
+	pos  int
+}
+
+func init() {
+	eventIDs.pos = len(eventIDs.pool)
+}
+
+// newEventID returns a random (version 4) UUID for a journal event
+func newEventID() string {
+	var id uuid.UUID
+	eventIDs.mu.Lock()
+	if eventIDs.pos == len(eventIDs.pool) {
+		if _, err := rand.Read(eventIDs.pool[:]); err != nil {
+			eventIDs.mu.Unlock()
+			return uuid.New().String()
+		}
+		eventIDs.pos = 0
+	}
+	copy(id[:], eventIDs.pool[eventIDs.pos:])
+	eventIDs.pos += len(id)
+	eventIDs.mu.Unlock()
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return id.String()
+}
+
+// eventTime is an RFC 3339 timestamp and the second it formats
+type eventTime struct {
+	unix      int64
+	formatted string
+}
+
+var lastEventTime atomic.Pointer[eventTime]
+
+// eventTimestamp returns the current time as journal events record it,
+// reusing the formatted string while the second lasts
+func eventTimestamp() string {
+	now := time.Now().UTC()
+	if last := lastEventTime.Load(); last != nil && last.unix == now.Unix() {
+		return last.formatted
+	}
+	t := &eventTime{unix: now.Unix(), formatted: now.Format(time.RFC3339)}
+	lastEventTime.Store(t)
+	return t.formatted
+}
+
+// eventHeader holds a workflow's identifying event fields boxed once, so
+// events don't each convert them to interfaces
+type eventHeader struct {
+	workflowID, orgID           string
+	boxedWorkflowID, boxedOrgID interface{}
+}
+
+// newEvent returns a journal event of eventType stamped with the context's
+// workflow, org and fencing token, with room for extra more fields
+func (ec *ExecutionContext) newEvent(eventType string, extra int) map[string]interface{} {
+	header := ec.header.Load()
+	if header == nil || header.workflowID != ec.WorkflowID || header.orgID != ec.OrgID {
+		header = &eventHeader{
+			workflowID:      ec.WorkflowID,
+			orgID:           ec.OrgID,
+			boxedWorkflowID: ec.WorkflowID,
+			boxedOrgID:      ec.OrgID,
+		}
+		ec.header.Store(header)
+	}
+	event := make(map[string]interface{}, 6+extra)
+	event["event_id"] = newEventID()
+	event["workflow_id"] = header.boxedWorkflowID
+	event["org_id"] = header.boxedOrgID
+	event["fencing_token"] = ec.fencingToken()
+	event["timestamp"] = eventTimestamp()
+	event["event_type"] = eventType
+	return event
+}
+
+// jsonBuffers pools the buffers plain JSON values are encoded into
+var jsonBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+// pooledJSON encodes v into a pooled buffer, returning false when v is not
+// plain JSON. The buffer must be returned with releaseJSON.
+func pooledJSON(v interface{}) (*[]byte, bool) {
+	buf := jsonBuffers.Get().(*[]byte)
+	data, ok := appendJSON((*buf)[:0], v)
+	*buf = data
+	if !ok {
+		releaseJSON(buf)
+		return nil, false
+	}
+	return buf, true
+}
+
+func releaseJSON(buf *[]byte) {
+	// Don't let one huge value pin its buffer in the pool
+	if cap(*buf) <= 64<<10 {
+		jsonBuffers.Put(buf)
+	}
+}
+
+// jsonSize returns the length of v's JSON encoding
+func jsonSize(v interface{}) (int, error) {
+	if buf, ok := pooledJSON(v); ok {
+		n := len(*buf)
+		releaseJSON(buf)
+		return n, nil
+	}
+	data, err := json.Marshal(v)
+	return len(data), err
+}
+
+// appendJSON appends the JSON encoding of v to buf exactly as json.Marshal
+// would, handling only values built from maps, slices, safe ASCII strings,
+// integers, finite plain floats, booleans and nil. It returns false for
+// anything else, which the caller encodes with encoding/json.
+func appendJSON(buf []byte, v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "null"...), true
+	case string:
+		return appendJSONString(buf, v)
+	case bool:
+		return strconv.AppendBool(buf, v), true
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), true
+	case int64:
+		return strconv.AppendInt(buf, v, 10), true
+	case float64:
+		// encoding/json switches to exponents outside this range
+		abs := math.Abs(v)
+		if math.IsInf(v, 0) || math.IsNaN(v) || (abs != 0 && (abs < 1e-6 || abs >= 1e21)) || (v == 0 && math.Signbit(v)) {
+			return buf, false
+		}
+		return strconv.AppendFloat(buf, v, 'f', -1, 64), true
+	case map[string]interface{}:
+		return appendJSONObject(buf, v)
+	case map[string]string:
+		if v == nil {
+			return append(buf, "null"...), true
+		}
+		var small [16]string
+		keys := small[:0]
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		buf = append(buf, '{')
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var ok bool
+			if buf, ok = appendJSONString(buf, k); !ok {
+				return buf, false
+			}
+			buf = append(buf, ':')
+			if buf, ok = appendJSONString(buf, v[k]); !ok {
+				return buf, false
+			}
+		}
+		return append(buf, '}'), true
+	case []interface{}:
+		if v == nil {
+			return append(buf, "null"...), true
+		}
+		buf = append(buf, '[')
+		for i, item := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var ok bool
+			if buf, ok = appendJSON(buf, item); !ok {
+				return buf, false
+			}
+		}
+		return append(buf, ']'), true
+	case []string:
+		if v == nil {
+			return append(buf, "null"...), true
+		}
+		buf = append(buf, '[')
+		for i, item := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var ok bool
+			if buf, ok = appendJSONString(buf, item); !ok {
+				return buf, false
+			}
+		}
+		return append(buf, ']'), true
+	}
+	return buf, false
+}
+
+// appendJSONObject encodes m with its keys sorted, as json.Marshal does
+func appendJSONObject(buf []byte, m map[string]interface{}) ([]byte, bool) {
+	if m == nil {
+		return append(buf, "null"...), true
+	}
+	var small [16]string
+	keys := small[:0]
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	buf = append(buf, '{')
+	for i, k := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		var ok bool
+		if buf, ok = appendJSONString(buf, k); !ok {
+			return buf, false
+		}
+		buf = append(buf, ':')
+		if buf, ok = appendJSON(buf, m[k]); !ok {
+			return buf, false
+		}
+	}
+	return append(buf, '}'), true
+}
+
+// appendJSONString encodes s when it needs no escaping
+func appendJSONString(buf []byte, s string) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < 0x20 || c >= 0x7f, c == '"', c == '\\', c == '<', c == '>', c == '&':
+			return buf, false
+		}
+	}
+	buf = append(buf, '"')
+	buf = append(buf, s...)
+	return append(buf, '"'), true
+}
+
+// appendState encodes state as json.Marshal would
+func appendState(buf []byte, state *WorkflowState) ([]byte, bool) {
+	var ok bool
+	buf = append(buf, `{"workflow_id":`...)
+	if buf, ok = appendJSONString(buf, state.WorkflowID); !ok {
+		return buf, false
+	}
+	buf = append(buf, `,"step_number":`...)
+	buf = strconv.AppendInt(buf, int64(state.StepNumber), 10)
+	buf = append(buf, `,"variables":`...)
+	if buf, ok = appendJSONObject(buf, state.Variables); !ok {
+		return buf, false
+	}
+	buf = append(buf, `,"metadata":`...)
+	if buf, ok = appendJSONObject(buf, state.Metadata); !ok {
+		return buf, false
+	}
+	buf = append(buf, `,"version":`...)
+	if buf, ok = appendJSONString(buf, state.Version); !ok {
+		return buf, false
+	}
+	buf = append(buf, `,"checksum":`...)
+	if buf, ok = appendJSONString(buf, state.Checksum); !ok {
+		return buf, false
+	}
+	buf = append(buf, `,"org_id":`...)
+	if buf, ok = appendJSONString(buf, state.OrgID); !ok {
+		return buf, false
+	}
+	if state.StateVersion != 0 {
+		buf = append(buf, `,"state_version":`...)
+		buf = strconv.AppendInt(buf, state.StateVersion, 10)
+	}
+	return append(buf, '}'), true
+}
@@ -0,0 +1,143 @@
+package contd
+
+import (
+	"context"
+	"time"
+)
+
+// WorkflowInfo describes the running workflow to its own code
+type WorkflowInfo struct {
+	WorkflowID   string
+	WorkflowName string
+	OrgID        string
+	// RunNumber counts the executions of this workflow ID, starting at 1;
+	// each resume is a new run
+	RunNumber int
+	// Attempt is the workflow retry attempt under WorkflowConfig.RetryPolicy,
+	// starting at 1
+	Attempt int
+	// StartTime is when the workflow's first run started, or zero for
+	// workflows started before it was recorded
+	StartTime time.Time
+	TaskQueue string
+	// ParentWorkflowID is the workflow this one was branched from, if any
+	ParentWorkflowID string
+	// HistoryLength is how many events the workflow's journal holds now,
+	// or zero when the engine cannot count them. It keeps growing as the
+	// workflow runs, so code can start a fresh workflow once it is large.
+	HistoryLength int
+	// HistoryBytes is the journal's size, or zero when the engine does not
+	// track it
+	HistoryBytes int64
+	// ContinueAsNewSuggested reports that the history has reached the
+	// workflow's HistoryLimits warning thresholds
+	ContinueAsNewSuggested bool
+	// ContinuedFrom is the workflow this one continues as new, if any
+	ContinuedFrom string
+}
+
+// HistoryCounter is implemented by engines that can count a workflow's
+// journal events without reading them
+type HistoryCounter interface {
+	// CountEvents returns how many of the workflow's events have one of
+	// eventTypes, or how many it has in all when none are given
+	CountEvents(workflowID string, eventTypes ...string) (int, error)
+}
+
+// countEvents counts the workflow's events whose type is in eventTypes, or
+// all of them when eventTypes is empty
+func countEvents(events []map[string]interface{}, workflowID string, eventTypes []string) int {
+	n := 0
+	for _, event := range events {
+		if event["workflow_id"] != workflowID {
+			continue
+		}
+		if len(eventTypes) == 0 {
+			n++
+			continue
+		}
+		eventType := getString(event, "event_type")
+		for _, t := range eventTypes {
+			if t == eventType {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// runInfo is what a runner knows about the run it started
+type runInfo struct {
+	number    int
+	attempt   int
+	taskQueue string
+}
+
+// GetInfo returns the metadata of the workflow running in ctx
+func GetInfo(ctx context.Context) (WorkflowInfo, error) {
+	ec, err := Current(ctx)
+	if err != nil {
+		return WorkflowInfo{}, err
+	}
+	info := WorkflowInfo{
+		WorkflowID:       ec.WorkflowID,
+		WorkflowName:     ec.WorkflowName,
+		OrgID:            ec.OrgID,
+		RunNumber:        ec.run.number,
+		Attempt:          ec.run.attempt,
+		TaskQueue:        ec.run.taskQueue,
+		ParentWorkflowID: ec.Tags[BranchParentTag],
+		ContinuedFrom:    ec.Tags[ContinuedFromTag],
+	}
+	if state, err := ec.GetState(); err == nil {
+		if at, err := time.Parse(time.RFC3339, getString(state.Metadata, "started_at")); err == nil {
+			info.StartTime = at
+		}
+	}
+	if size, ok := historySize(ec.GetEngine(), ec.WorkflowID); ok {
+		info.HistoryLength, info.HistoryBytes = size.Events, size.Bytes
+		ec.mu.RLock()
+		info.ContinueAsNewSuggested = ec.history.limits.warns(size) || ec.history.limits.exceeds(size)
+		ec.mu.RUnlock()
+	} else if counter, ok := engineAs[HistoryCounter](ec.GetEngine()); ok {
+		if info.HistoryLength, err = counter.CountEvents(ec.WorkflowID); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+// startRun numbers the run after those journaled before it, stamps the
+// first run's start time and journals the run as workflow_run_started
+func (ec *ExecutionContext) startRun(engine Engine, attempt int, queue string) error {
+	if attempt < 1 {
+		attempt = 1
+	}
+	number := 1
+	if counter, ok := engineAs[HistoryCounter](engine); ok {
+		prior, err := counter.CountEvents(ec.WorkflowID, "workflow_run_started")
+		if err != nil {
+			return err
+		}
+		number = prior + 1
+	}
+	ec.run = runInfo{number: number, attempt: attempt, taskQueue: queue}
+	// A workflow started under a given ID restores empty state, so its
+	// first run stamps the start time
+	if state, err := ec.GetState(); err == nil && number == 1 {
+		if _, ok := state.Metadata["started_at"]; !ok {
+			stamped := copyState(state)
+			stamped.Metadata["started_at"] = time.Now().UTC().Format(time.RFC3339)
+			stamped.Checksum = ""
+			stamped.Checksum = computeChecksum(stamped)
+			ec.SetState(stamped)
+		}
+	}
+	return appendEvent(engine, ec, "workflow_run_started", map[string]interface{}{
+		"run_number":  number,
+		"attempt":     attempt,
+		"task_queue":  queue,
+		"executor_id": ec.ExecutorID,
+	})
+}
@@ -0,0 +1,133 @@
+// Package lambda runs Contd workflows on AWS Lambda and other serverless
+// platforms that bound each invocation's duration. Each invocation runs
+// the workflow until shortly before its deadline, then suspends it so the
+// next invocation resumes where it stopped:
+//
+//	handler := lambda.Handler(lambda.Config{
+//		Engine:       engine,
+//		WorkflowName: "research",
+//		Workflow:     research,
+//		Reinvoke:     invokeAsync,
+//	})
+//	awslambda.Start(handler)
+//
+// The handler has the signature the aws-lambda-go runtime expects, so this
+// package does not depend on it.
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+	"github.com/google/uuid"
+)
+
+// DefaultSafetyMargin is how long before the invocation deadline the
+// workflow is suspended by default, leaving time to checkpoint and return
+const DefaultSafetyMargin = 30 * time.Second
+
+// Request is the event a handler is invoked with. A request without a
+// WorkflowID starts a new workflow.
+type Request struct {
+	WorkflowID string      `json:"workflow_id,omitempty"`
+	Input      interface{} `json:"input,omitempty"`
+	// Invocation counts the invocations the workflow has run in, from 1
+	Invocation int `json:"invocation,omitempty"`
+}
+
+// Response is what an invocation returns
+type Response struct {
+	WorkflowID string               `json:"workflow_id"`
+	Status     contd.WorkflowStatus `json:"status"`
+	Result     interface{}          `json:"result,omitempty"`
+	Error      *contd.WireError     `json:"error,omitempty"`
+	// Next is the request continuing a workflow suspended at the end of
+	// its time slice; it has already been passed to Config.Reinvoke if set
+	Next *Request `json:"next,omitempty"`
+}
+
+// Config configures a handler
+type Config struct {
+	Engine         contd.Engine
+	WorkflowName   string
+	Workflow       contd.WorkflowFunc
+	WorkflowConfig contd.WorkflowConfig
+	// SafetyMargin is how long before the invocation deadline the workflow
+	// is suspended (0 uses DefaultSafetyMargin)
+	SafetyMargin time.Duration
+	// Reinvoke starts the invocation continuing a suspended workflow, e.g.
+	// with an asynchronous Lambda Invoke or an SQS message. Without it the
+	// caller continues from Response.Next.
+	Reinvoke func(ctx context.Context, next Request) error
+	// Runner customizes the runner of each invocation, e.g. to set its
+	// registries or capabilities
+	Runner func(runner *contd.WorkflowRunner)
+}
+
+// Handler returns a handler running config.Workflow one time slice per
+// invocation. A workflow that fails is reported in the response rather
+// than as an error, so the platform does not retry it; errors worth
+// retrying, such as a lease still held by a previous invocation, are
+// returned.
+func Handler(config Config) func(ctx context.Context, req Request) (*Response, error) {
+	if config.SafetyMargin <= 0 {
+		config.SafetyMargin = DefaultSafetyMargin
+	}
+	return func(ctx context.Context, req Request) (*Response, error) {
+		if req.WorkflowID == "" {
+			req.WorkflowID = "wf-" + uuid.New().String()
+		}
+		if req.Invocation == 0 {
+			req.Invocation = 1
+		}
+
+		// End the time slice before the platform kills the invocation
+		sliceCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok {
+			reason := fmt.Sprintf("time slice of invocation %d ended", req.Invocation)
+			var cancel context.CancelFunc
+			sliceCtx, cancel = context.WithDeadlineCause(ctx, deadline.Add(-config.SafetyMargin), contd.NewWorkflowSuspended(req.WorkflowID, reason))
+			defer cancel()
+		}
+
+		workflowConfig := config.WorkflowConfig
+		workflowConfig.WorkflowID = req.WorkflowID
+		runner := contd.NewWorkflowRunner(config.Engine, workflowConfig)
+		if config.Runner != nil {
+			config.Runner(runner)
+		}
+		defer runner.Close()
+
+		result, err := runner.Run(sliceCtx, config.WorkflowName, config.Workflow, req.Input)
+		resp := &Response{WorkflowID: req.WorkflowID, Status: contd.WorkflowStatusCompleted, Result: result}
+		if err == nil {
+			return resp, nil
+		}
+
+		var suspended *contd.WorkflowSuspended
+		switch {
+		case errors.As(err, &suspended) && ctx.Err() == nil && sliceCtx.Err() != nil:
+			resp.Status = contd.WorkflowStatusSuspended
+			resp.Next = &Request{WorkflowID: req.WorkflowID, Invocation: req.Invocation + 1, Input: req.Input}
+			if config.Reinvoke != nil {
+				if err := config.Reinvoke(ctx, *resp.Next); err != nil {
+					return nil, fmt.Errorf("failed to reinvoke workflow %s: %w", req.WorkflowID, err)
+				}
+			}
+		case errors.As(err, &suspended):
+			// Suspended by the workflow itself; a signal or Client.Resume
+			// continues it
+			resp.Status = contd.WorkflowStatusSuspended
+			resp.Error = contd.EncodeError(err)
+		case contd.IsRetryable(err) || ctx.Err() != nil:
+			return nil, err
+		default:
+			resp.Status = contd.WorkflowStatusFailed
+			resp.Error = contd.EncodeError(err)
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,122 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultAcquireBackoffBase = 100 * time.Millisecond
+	defaultAcquireBackoffMax  = 5 * time.Second
+)
+
+// LeaseStealer is implemented by lease managers that can take over a lease
+// whose holder let it expire without releasing it
+type LeaseStealer interface {
+	StealExpired(workflowID, ownerID string) (*Lease, error)
+}
+
+// AcquireOptions controls what a runner does when the workflow's lease is
+// held by another worker. The zero value fails immediately with
+// WorkflowLocked.
+type AcquireOptions struct {
+	// Wait is how long to keep retrying before giving up
+	Wait time.Duration `json:"wait,omitempty"`
+	// BlockUntilAcquired retries until the lease is granted or ctx is done,
+	// queueing the worker behind the current holder
+	BlockUntilAcquired bool `json:"block_until_acquired,omitempty"`
+	// BackoffBase is the first delay between attempts, doubled each time up
+	// to BackoffMax (defaults 100ms and 5s)
+	BackoffBase time.Duration `json:"backoff_base,omitempty"`
+	BackoffMax  time.Duration `json:"backoff_max,omitempty"`
+	// StealIfExpired takes over a lease past its expiry instead of waiting
+	// for it to be released. Requires a LeaseStealer; fencing tokens keep the
+	// previous holder from writing afterwards.
+	StealIfExpired bool `json:"steal_if_expired,omitempty"`
+}
+
+// backoff returns the delay before the given retry, with ±25% jitter
+func (o *AcquireOptions) backoff(attempt int) time.Duration {
+	base, max := o.BackoffBase, o.BackoffMax
+	if base <= 0 {
+		base = defaultAcquireBackoffBase
+	}
+	if max <= 0 {
+		max = defaultAcquireBackoffMax
+	}
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/2+1)) - delay/4
+	return delay + jitter
+}
+
+// acquireLease acquires a workflow's lease, waiting or stealing according
+// to opts while another worker holds it
+func acquireLease(ctx context.Context, leases LeaseManager, workflowID, ownerID string, opts *AcquireOptions) (*Lease, error) {
+	var deadline time.Time
+	if opts != nil && opts.Wait > 0 {
+		deadline = time.Now().Add(opts.Wait)
+	}
+
+	for attempt := 0; ; attempt++ {
+		lease, err := leases.Acquire(workflowID, ownerID)
+		if err == nil && lease == nil {
+			err = NewWorkflowLocked(workflowID, "", "")
+		}
+		if err == nil {
+			return lease, nil
+		}
+
+		var locked *WorkflowLocked
+		if opts == nil || !errors.As(err, &locked) {
+			return nil, err
+		}
+
+		if opts.StealIfExpired && leaseExpired(locked) {
+			if stealer, ok := leases.(LeaseStealer); ok {
+				lease, stealErr := stealer.StealExpired(workflowID, ownerID)
+				if stealErr == nil && lease != nil {
+					fmt.Printf("Took over expired lease on %s from %s\n", workflowID, locked.OwnerID)
+					return lease, nil
+				}
+			}
+		}
+
+		delay := opts.backoff(attempt)
+		if !opts.BlockUntilAcquired {
+			remaining := time.Until(deadline)
+			if deadline.IsZero() || remaining <= 0 {
+				return nil, err
+			}
+			if delay > remaining {
+				delay = remaining
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+}
+
+// leaseExpired reports whether a WorkflowLocked error names a lease that
+// is past its expiry
+func leaseExpired(locked *WorkflowLocked) bool {
+	if locked.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339Nano, locked.ExpiresAt)
+	return err == nil && time.Now().After(expiresAt)
+}
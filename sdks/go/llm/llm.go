@@ -0,0 +1,254 @@
+// Package llm runs LLM calls as Contd steps. Calls are journaled with their
+// prompts and responses, identical calls within a workflow are answered from
+// the first one's transcript, and token usage is reported to the workflow's
+// cost accounting.
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a chat completion request
+type Request struct {
+	Model       string                 `json:"model"`
+	System      string                 `json:"system,omitempty"`
+	Messages    []Message              `json:"messages"`
+	MaxTokens   int                    `json:"max_tokens,omitempty"`
+	Temperature *float64               `json:"temperature,omitempty"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+}
+
+// Usage is the token usage a provider reports for a call
+type Usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// Response is a chat completion response
+type Response struct {
+	Model      string `json:"model"`
+	Content    string `json:"content"`
+	StopReason string `json:"stop_reason,omitempty"`
+	Usage      Usage  `json:"usage"`
+	// Cached reports that the response was replayed from an earlier call
+	Cached bool `json:"-"`
+}
+
+// Provider completes chat requests, e.g. an OpenAI or Anthropic API
+type Provider interface {
+	Complete(ctx context.Context, req Request) (*Response, error)
+}
+
+// Price is a model's cost in dollars per million tokens
+type Price struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// Cost returns the dollar cost of usage at this price
+func (p Price) Cost(usage Usage) float64 {
+	return (float64(usage.InputTokens)*p.InputPerMillion + float64(usage.OutputTokens)*p.OutputPerMillion) / 1e6
+}
+
+// Transcript is the journaled record of a call
+type Transcript struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Config configures a Step
+type Config struct {
+	Provider Provider
+	// StepConfig sets the retry policy and timeout of each call
+	StepConfig contd.StepConfig
+	// Pricing maps model names to prices for cost accounting
+	Pricing map[string]Price
+	// Redact lists transcript fields cleared before journaling, e.g.
+	// "system" or "content". Strings become Redacted and other values empty.
+	// Only the journal is redacted: the workflow always gets the provider's
+	// response. A call whose response fields are redacted can't be replayed
+	// from its transcript, so resuming past it fails.
+	Redact []string
+}
+
+// Redacted replaces redacted field values in transcripts
+const Redacted = "[REDACTED]"
+
+// Step runs LLM calls as workflow steps
+type Step struct {
+	config Config
+	runner *contd.StepRunner
+}
+
+// NewStep creates a Step
+func NewStep(config Config) *Step {
+	return &Step{config: config, runner: contd.NewStepRunner(config.StepConfig)}
+}
+
+// Run calls the provider as a step named name. A request identical to one
+// already made in the workflow, including on resume, returns the recorded
+// response without calling the provider, unless Redact cleared it from the
+// transcript.
+func (s *Step) Run(ctx context.Context, name string, req Request) (*Response, error) {
+	ec, err := contd.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Provider == nil {
+		return nil, contd.NewConfigurationError("llm step has no provider", "llm.provider")
+	}
+	key, err := transcriptKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var fresh *Response
+	_, err = s.runner.Run(ctx, name, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		// An identical request made earlier is answered from its transcript
+		if s.replayable() {
+			if t, err := contd.Get[Transcript](ec, key); err == nil {
+				fresh = cachedResponse(t)
+				return nil, nil
+			}
+		}
+		resp, err := s.config.Provider.Complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		usage := contd.StepUsage{
+			Model:        resp.Model,
+			InputTokens:  resp.Usage.InputTokens,
+			OutputTokens: resp.Usage.OutputTokens,
+		}
+		if usage.Model == "" {
+			usage.Model = req.Model
+		}
+		if price, ok := s.config.Pricing[usage.Model]; ok {
+			usage.CostUSD = price.Cost(resp.Usage)
+		}
+		contd.Metrics(ctx).Record(usage)
+
+		transcript, err := redact(Transcript{Request: req, Response: *resp}, s.config.Redact)
+		if err != nil {
+			return nil, err
+		}
+		fresh = resp
+		return map[string]interface{}{key: transcript}, nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if fresh != nil {
+		return fresh, nil
+	}
+
+	// The step completed in an earlier execution
+	if !s.replayable() {
+		return nil, contd.NewContdError(fmt.Sprintf("llm step %s completed earlier but its response was redacted from the journal", name), ec.WorkflowID, map[string]interface{}{"redact": s.config.Redact})
+	}
+	t, err := contd.Get[Transcript](ec, key)
+	if err != nil {
+		return nil, err
+	}
+	return cachedResponse(t), nil
+}
+
+// responseFields are the JSON fields of a Response and its Usage
+var responseFields = map[string]bool{
+	"model": true, "content": true, "stop_reason": true,
+	"usage": true, "input_tokens": true, "output_tokens": true,
+}
+
+// replayable reports whether transcripts keep the whole response, so it can
+// be returned in place of calling the provider
+func (s *Step) replayable() bool {
+	for _, field := range s.config.Redact {
+		if responseFields[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedResponse returns a transcript's response, marked as replayed
+func cachedResponse(t Transcript) *Response {
+	resp := t.Response
+	resp.Cached = true
+	return &resp
+}
+
+// transcriptKey names the variable holding a request's transcript
+func transcriptKey(req Request) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return "llm." + hex.EncodeToString(sum[:8]), nil
+}
+
+// redact replaces the named fields anywhere in the transcript
+func redact(t Transcript, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return t, nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transcript: %w", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("failed to decode transcript: %w", err)
+	}
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		names[f] = true
+	}
+	redactValue(generic, names)
+	return generic, nil
+}
+
+func redactValue(v interface{}, names map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if names[k] {
+				v[k] = redactedValue(child)
+				continue
+			}
+			redactValue(child, names)
+		}
+	case []interface{}:
+		for _, child := range v {
+			redactValue(child, names)
+		}
+	}
+}
+
+// redactedValue replaces a value while keeping its JSON type, so redacted
+// transcripts still decode
+func redactedValue(v interface{}) interface{} {
+	switch v.(type) {
+	case string:
+		return Redacted
+	case []interface{}:
+		return []interface{}{}
+	case map[string]interface{}:
+		return map[string]interface{}{}
+	case float64:
+		return 0
+	}
+	return nil
+}
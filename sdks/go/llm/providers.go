@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ProviderConfig configures an HTTP provider
+type ProviderConfig struct {
+	APIKey  string
+	BaseURL string
+	// HTTPClient sends requests (defaults to http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+func (c ProviderConfig) client() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// OpenAI is a Provider for OpenAI-compatible chat completion APIs
+type OpenAI struct {
+	config ProviderConfig
+}
+
+// NewOpenAI creates an OpenAI-compatible provider. BaseURL defaults to
+// https://api.openai.com.
+func NewOpenAI(config ProviderConfig) *OpenAI {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.openai.com"
+	}
+	return &OpenAI{config: config}
+}
+
+// Complete sends req to the chat completions endpoint
+func (p *OpenAI) Complete(ctx context.Context, req Request) (*Response, error) {
+	messages := make([]Message, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, Message{Role: "system", Content: req.System})
+	}
+	messages = append(messages, req.Messages...)
+
+	body := map[string]interface{}{
+		"model":    req.Model,
+		"messages": messages,
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	for k, v := range req.Params {
+		body[k] = v
+	}
+
+	var result struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message      Message `json:"message"`
+			FinishReason string  `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	header := http.Header{"Authorization": {"Bearer " + p.config.APIKey}}
+	if err := post(ctx, p.config, "/v1/chat/completions", header, body, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("llm: response has no choices")
+	}
+
+	return &Response{
+		Model:      result.Model,
+		Content:    result.Choices[0].Message.Content,
+		StopReason: result.Choices[0].FinishReason,
+		Usage: Usage{
+			InputTokens:  result.Usage.PromptTokens,
+			OutputTokens: result.Usage.CompletionTokens,
+		},
+	}, nil
+}
+
+// AnthropicVersion is the API version Anthropic requests are sent with
+const AnthropicVersion = "2023-06-01"
+
+// defaultAnthropicMaxTokens is used when a request sets no MaxTokens, which
+// the Messages API requires
+const defaultAnthropicMaxTokens = 1024
+
+// Anthropic is a Provider for Anthropic-compatible Messages APIs
+type Anthropic struct {
+	config ProviderConfig
+}
+
+// NewAnthropic creates an Anthropic-compatible provider. BaseURL defaults to
+// https://api.anthropic.com.
+func NewAnthropic(config ProviderConfig) *Anthropic {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.anthropic.com"
+	}
+	return &Anthropic{config: config}
+}
+
+// Complete sends req to the messages endpoint
+func (p *Anthropic) Complete(ctx context.Context, req Request) (*Response, error) {
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	body := map[string]interface{}{
+		"model":      req.Model,
+		"messages":   req.Messages,
+		"max_tokens": maxTokens,
+	}
+	if req.System != "" {
+		body["system"] = req.System
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	for k, v := range req.Params {
+		body[k] = v
+	}
+
+	var result struct {
+		Model   string `json:"model"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+		Usage      struct {
+			InputTokens  int64 `json:"input_tokens"`
+			OutputTokens int64 `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	header := http.Header{
+		"X-Api-Key":         {p.config.APIKey},
+		"Anthropic-Version": {AnthropicVersion},
+	}
+	if err := post(ctx, p.config, "/v1/messages", header, body, &result); err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return &Response{
+		Model:      result.Model,
+		Content:    text.String(),
+		StopReason: result.StopReason,
+		Usage: Usage{
+			InputTokens:  result.Usage.InputTokens,
+			OutputTokens: result.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// post sends a JSON request and decodes the JSON response into out
+func post(ctx context.Context, config ProviderConfig, path string, header http.Header, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(config.BaseURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := config.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("llm: %s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
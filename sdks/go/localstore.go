@@ -0,0 +1,266 @@
+package contd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// localStore keeps what InMemoryEngine and MockEngine store alike: step
+// attempts, artifacts, dead letters, signals, memos, business keys and the
+// outbox. Its methods take the owning engine's lock, so the engine's own
+// methods can use the fields directly while holding it.
+type localStore struct {
+	lock          *sync.RWMutex
+	attempts      map[string]int
+	attemptTokens map[string]int64
+	artifacts     map[string][]byte
+	deadLetters   []DeadLetter
+	signals       map[string][]Signal
+	workflowMemos map[string]map[string]interface{}
+	memos         map[string]MemoEntry
+	businessKeys  map[string]string
+	outbox        map[string]OutboxMessage
+	outboxOrder   []string
+}
+
+// newLocalStore returns an empty store guarded by lock
+func newLocalStore(lock *sync.RWMutex) localStore {
+	return localStore{
+		lock:          lock,
+		attempts:      make(map[string]int),
+		attemptTokens: make(map[string]int64),
+		artifacts:     make(map[string][]byte),
+		signals:       make(map[string][]Signal),
+		workflowMemos: make(map[string]map[string]interface{}),
+		memos:         make(map[string]MemoEntry),
+		businessKeys:  make(map[string]string),
+		outbox:        make(map[string]OutboxMessage),
+	}
+}
+
+// nextAttempt numbers a step's next attempt and remembers the fencing token
+// it was allocated under. Callers must hold the lock.
+func (s *localStore) nextAttempt(workflowID, stepID string, token int64) int {
+	key := workflowID + ":" + stepID
+	s.attempts[key]++
+	s.attemptTokens[key+":"+strconv.Itoa(s.attempts[key])] = token
+	return s.attempts[key]
+}
+
+// attemptToken returns the fencing token an attempt was allocated under.
+// Callers must hold the lock.
+func (s *localStore) attemptToken(workflowID, stepID string, attempt int) int64 {
+	return s.attemptTokens[workflowID+":"+stepID+":"+strconv.Itoa(attempt)]
+}
+
+// dropAttempts forgets a workflow's attempt counts and the fencing tokens
+// they were allocated under. Callers must hold the lock.
+func (s *localStore) dropAttempts(workflowID string) {
+	prefix := workflowID + ":"
+	for key := range s.attempts {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.attempts, key)
+		}
+	}
+	for key := range s.attemptTokens {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.attemptTokens, key)
+		}
+	}
+}
+
+// Artifacts returns the engine's artifact store
+func (s *localStore) Artifacts() ArtifactStore {
+	return localArtifacts{s}
+}
+
+// DeadLetters returns the engine's dead-letter queue
+func (s *localStore) DeadLetters() DeadLetterQueue {
+	return localDeadLetters{s}
+}
+
+// SendSignal stores a signal for a workflow
+func (s *localStore) SendSignal(workflowID string, signal Signal) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.signals[workflowID] = append(s.signals[workflowID], signal)
+	return nil
+}
+
+// SignalAt returns the index'th signal named name sent to a workflow
+func (s *localStore) SignalAt(workflowID, name string, index int) (*Signal, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, signal := range s.signals[workflowID] {
+		if signal.Name != name {
+			continue
+		}
+		if index == 0 {
+			found := signal
+			return &found, nil
+		}
+		index--
+	}
+	return nil, nil
+}
+
+// SetWorkflowMemo stores a copy of a workflow's memo
+func (s *localStore) SetWorkflowMemo(workflowID string, memo map[string]interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stored := make(map[string]interface{}, len(memo))
+	for k, v := range memo {
+		stored[k] = v
+	}
+	s.workflowMemos[workflowID] = stored
+	return nil
+}
+
+// WorkflowMemo returns a copy of a workflow's memo
+func (s *localStore) WorkflowMemo(workflowID string) (map[string]interface{}, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	stored, ok := s.workflowMemos[workflowID]
+	if !ok {
+		return nil, nil
+	}
+	memo := make(map[string]interface{}, len(stored))
+	for k, v := range stored {
+		memo[k] = v
+	}
+	return memo, nil
+}
+
+// LoadMemo returns a memoized step result
+func (s *localStore) LoadMemo(key string) (*MemoEntry, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	entry, ok := s.memos[key]
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// SaveMemo stores a memoized step result
+func (s *localStore) SaveMemo(key string, entry MemoEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.memos[key] = entry
+	return nil
+}
+
+// ClaimBusinessKey maps an org's business key to workflowID unless it is
+// already mapped, and returns the workflow the key maps to
+func (s *localStore) ClaimBusinessKey(orgID, key, workflowID string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	scoped := orgID + "/" + key
+	if existing, ok := s.businessKeys[scoped]; ok {
+		return existing, nil
+	}
+	s.businessKeys[scoped] = workflowID
+	return workflowID, nil
+}
+
+// EnqueueOutbox stores an outbox message unless its ID is already stored
+func (s *localStore) EnqueueOutbox(msg OutboxMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.outbox[msg.ID]; ok {
+		return nil
+	}
+	s.outbox[msg.ID] = msg
+	s.outboxOrder = append(s.outboxOrder, msg.ID)
+	return nil
+}
+
+// DueOutbox returns outbox messages due for delivery, oldest first
+func (s *localStore) DueOutbox(now time.Time, limit int) ([]OutboxMessage, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var due []OutboxMessage
+	for _, id := range s.outboxOrder {
+		msg := s.outbox[id]
+		if msg.DeliveredAt != nil || msg.Failed || msg.NextAttemptAt.After(now) {
+			continue
+		}
+		due = append(due, msg)
+		if limit > 0 && len(due) == limit {
+			break
+		}
+	}
+	return due, nil
+}
+
+// UpdateOutbox saves an outbox message's delivery progress
+func (s *localStore) UpdateOutbox(msg OutboxMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.outbox[msg.ID] = msg
+	return nil
+}
+
+type localArtifacts struct {
+	store *localStore
+}
+
+func (a localArtifacts) Put(key string, data []byte) error {
+	a.store.lock.Lock()
+	defer a.store.lock.Unlock()
+	stored := make([]byte, len(data))
+	copy(stored, data)
+	a.store.artifacts[key] = stored
+	return nil
+}
+
+func (a localArtifacts) Get(key string) ([]byte, error) {
+	a.store.lock.RLock()
+	defer a.store.lock.RUnlock()
+	data, ok := a.store.artifacts[key]
+	if !ok {
+		return nil, fmt.Errorf("artifact not found: %s", key)
+	}
+	return data, nil
+}
+
+type localDeadLetters struct {
+	store *localStore
+}
+
+func (q localDeadLetters) Put(letter DeadLetter) error {
+	q.store.lock.Lock()
+	defer q.store.lock.Unlock()
+	q.store.deadLetters = append(q.store.deadLetters, letter)
+	return nil
+}
+
+func (q localDeadLetters) List(workflowID string) ([]DeadLetter, error) {
+	q.store.lock.RLock()
+	defer q.store.lock.RUnlock()
+	result := make([]DeadLetter, 0)
+	for _, letter := range q.store.deadLetters {
+		if workflowID == "" || letter.WorkflowID == workflowID {
+			result = append(result, letter)
+		}
+	}
+	return result, nil
+}
+
+func (q localDeadLetters) MarkRedriven(workflowID, stepID string, at time.Time) (*DeadLetter, error) {
+	q.store.lock.Lock()
+	defer q.store.lock.Unlock()
+	for i := range q.store.deadLetters {
+		letter := &q.store.deadLetters[i]
+		if letter.WorkflowID == workflowID && letter.StepID == stepID && letter.RedrivenAt == nil {
+			letter.RedrivenAt = &at
+			delete(q.store.attempts, workflowID+":"+stepID)
+			result := *letter
+			return &result, nil
+		}
+	}
+	return nil, NewContdError("dead letter not found", workflowID, map[string]interface{}{"step_id": stepID})
+}
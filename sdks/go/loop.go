@@ -0,0 +1,211 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// loopPrefix prefixes the workflow variables holding loop progress
+const loopPrefix = "_loop."
+
+// loopProgress is a loop's position, committed with the steps it runs
+type loopProgress struct {
+	// Iteration is the iteration in progress, or the count once Done
+	Iteration int `json:"iteration"`
+	// Steps counts the steps the loop ran before Iteration
+	Steps int `json:"steps"`
+	// After is the last step completed before Iteration
+	After string `json:"after,omitempty"`
+	Done  bool   `json:"done,omitempty"`
+}
+
+// stepScope gives the steps run inside a loop iteration or branch IDs
+// that do not depend on how many steps ran before it
+type stepScope struct {
+	prefix string
+	n      int32
+}
+
+type stepScopeKey struct{}
+
+// withStepScope scopes the step IDs generated under ctx by prefix, which
+// scopeName has qualified by any enclosing scope
+func withStepScope(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, stepScopeKey{}, &stepScope{prefix: prefix})
+}
+
+// scopedStepID returns the next step ID of ctx's scope, or "" outside one
+func scopedStepID(ctx context.Context, stepName string) string {
+	scope, ok := ctx.Value(stepScopeKey{}).(*stepScope)
+	if !ok {
+		return ""
+	}
+	n := atomic.AddInt32(&scope.n, 1) - 1
+	return fmt.Sprintf("%s.%s_%d", scope.prefix, stepName, n)
+}
+
+// scopeName returns name qualified by ctx's enclosing scope
+func scopeName(ctx context.Context, name string) string {
+	if outer, ok := ctx.Value(stepScopeKey{}).(*stepScope); ok {
+		return outer.prefix + "/" + name
+	}
+	return name
+}
+
+// claimScope reserves a loop or branch name for this run
+func (ec *ExecutionContext) claimScope(name string) error {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if _, taken := ec.scopes[name]; taken {
+		return NewConfigurationError(fmt.Sprintf("loop or branch %q used twice in one run", name), "loop")
+	}
+	if ec.scopes == nil {
+		ec.scopes = make(map[string]struct{})
+	}
+	ec.scopes[name] = struct{}{}
+	return nil
+}
+
+// resumedLoop returns a loop's progress as of the state the run resumed from
+func (ec *ExecutionContext) resumedLoop(key string) (*loopProgress, bool) {
+	ec.mu.RLock()
+	resumed := ec.resumed
+	ec.mu.RUnlock()
+	if resumed == nil {
+		return nil, false
+	}
+	value, ok := resumed.Variables[key]
+	if !ok {
+		return nil, false
+	}
+	var progress loopProgress
+	if err := convert(nil, value, &progress); err != nil {
+		return nil, false
+	}
+	return &progress, true
+}
+
+// skipTo moves a resumed run past a loop's completed iterations: the step
+// counter advances as if their steps had been replayed and the state is
+// the one the last of them committed
+func (ec *ExecutionContext) skipTo(engine Engine, progress *loopProgress) bool {
+	if progress.Steps == 0 {
+		return progress.Iteration > 0
+	}
+	state, err := engine.Idempotency().CheckCompleted(ec.WorkflowID, progress.After)
+	if err != nil || state == nil {
+		return false
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.state = state
+	ec.stepCounter += progress.Steps
+	ec.lastStepID = progress.After
+	return true
+}
+
+// Loop runs body while cond holds, passing both the iteration number.
+// Steps in each iteration get IDs scoped to the loop and iteration, so
+// adding or removing steps in one iteration does not shift the IDs of
+// the next, and the loop's position is committed with its steps. A
+// resumed workflow continues at the iteration it was in rather than
+// replaying the earlier ones, so keep loop state in workflow variables:
+// Go variables set by skipped iterations are not restored. The name must
+// be unique within the workflow, or within the enclosing loop iteration.
+func Loop(ctx context.Context, name string, cond func(ctx context.Context, i int) (bool, error), body func(ctx context.Context, i int) error) error {
+	ec, err := Current(ctx)
+	if err != nil {
+		return err
+	}
+	engine := ec.GetEngine()
+	if engine == nil {
+		return fmt.Errorf("no execution engine in context")
+	}
+	name = scopeName(ctx, name)
+	if err := ec.claimScope(name); err != nil {
+		return err
+	}
+	key := loopPrefix + name
+
+	ec.mu.RLock()
+	base, last := ec.stepCounter, ec.lastStepID
+	ec.mu.RUnlock()
+	start := 0
+	if progress, ok := ec.resumedLoop(key); ok && ec.skipTo(engine, progress) {
+		if progress.Done {
+			ec.Set(key, *progress)
+			return nil
+		}
+		start, last = progress.Iteration, progress.After
+	}
+
+	i := start
+	for ; ; i++ {
+		ok, err := cond(ctx, i)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		ec.mu.RLock()
+		steps := ec.stepCounter - base
+		if ec.lastStepID != "" {
+			last = ec.lastStepID
+		}
+		ec.mu.RUnlock()
+		ec.Set(key, loopProgress{Iteration: i, Steps: steps, After: last})
+		if !ec.replaying {
+			appendEvent(engine, ec, "loop_iteration_started", map[string]interface{}{"loop": name, "iteration": i})
+		}
+		iterationCtx := withStepScope(ctx, fmt.Sprintf("%s#%d", name, i))
+		if err := body(iterationCtx, i); err != nil {
+			return err
+		}
+	}
+
+	ec.mu.RLock()
+	steps := ec.stepCounter - base
+	if ec.lastStepID != "" {
+		last = ec.lastStepID
+	}
+	ec.mu.RUnlock()
+	ec.Set(key, loopProgress{Iteration: i, Steps: steps, After: last, Done: true})
+	if !ec.replaying {
+		appendEvent(engine, ec, "loop_completed", map[string]interface{}{"loop": name, "iterations": i})
+	}
+	return nil
+}
+
+// If runs then when cond holds and otherwise (which may be nil) when it
+// does not. Steps in each branch get IDs scoped to the branch, so a
+// workflow resumed after the branch was taken finds them regardless of how
+// many steps the other branch has. cond runs outside any step and must be
+// deterministic, e.g. reading workflow variables.
+func If(ctx context.Context, name string, cond func(ctx context.Context) (bool, error), then, otherwise func(ctx context.Context) error) error {
+	ec, err := Current(ctx)
+	if err != nil {
+		return err
+	}
+	name = scopeName(ctx, name)
+	if err := ec.claimScope(name); err != nil {
+		return err
+	}
+	ok, err := cond(ctx)
+	if err != nil {
+		return err
+	}
+	branch, fn := "then", then
+	if !ok {
+		branch, fn = "else", otherwise
+	}
+	if engine := ec.GetEngine(); engine != nil && !ec.replaying {
+		appendEvent(engine, ec, "branch_taken", map[string]interface{}{"branch": name, "taken": branch})
+	}
+	if fn == nil {
+		return nil
+	}
+	branchCtx := withStepScope(ctx, name+"?"+branch)
+	return fn(branchCtx)
+}
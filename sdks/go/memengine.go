@@ -0,0 +1,612 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInMemoryLeaseTTL is how long an InMemoryEngine lease lasts without
+// a heartbeat
+const DefaultInMemoryLeaseTTL = 30 * time.Second
+
+// InMemoryEngine is a complete engine kept in process memory, for examples,
+// quickstarts and single-process tools that need no external services. It
+// supports leases with fencing, the journal and its tails, snapshots with
+// state versioning, rebuilding from the journal, savepoints, artifacts,
+// signals, statuses, memos, business keys, dead letters, the outbox,
+// compaction and export. Timers set with Sleep are kept in workflow state,
+// so they resume with it.
+// Unlike MockEngine it injects no faults and records no test executions.
+// Everything is lost when the process exits; an interrupted workflow can be
+// resumed by running it again under its ID from the same process.
+type InMemoryEngine struct {
+	// LeaseTTL is how long a lease lasts without a heartbeat (defaults to
+	// DefaultInMemoryLeaseTTL)
+	LeaseTTL time.Duration
+
+	mu            sync.RWMutex
+	events        []map[string]interface{}
+	histories     map[string]HistorySize
+	snapshots     map[string]*WorkflowState
+	completed     map[string]*WorkflowState
+	latest        map[string]*WorkflowState
+	leases        map[string]*Lease
+	fencingTokens map[string]int64
+	savepoints    map[string]mockSavepoint
+	statuses      map[string]WorkflowStatus
+	tails         map[*journalTail]struct{}
+	localStore
+}
+
+// NewInMemoryEngine creates an empty in-memory engine
+func NewInMemoryEngine() *InMemoryEngine {
+	engine := &InMemoryEngine{
+		histories:     make(map[string]HistorySize),
+		snapshots:     make(map[string]*WorkflowState),
+		completed:     make(map[string]*WorkflowState),
+		latest:        make(map[string]*WorkflowState),
+		leases:        make(map[string]*Lease),
+		fencingTokens: make(map[string]int64),
+		savepoints:    make(map[string]mockSavepoint),
+		statuses:      make(map[string]WorkflowStatus),
+		tails:         make(map[*journalTail]struct{}),
+	}
+	engine.localStore = newLocalStore(&engine.mu)
+	return engine
+}
+
+// Restore returns the workflow's snapshot. It returns nil when the
+// workflow has journaled steps but no snapshot, so the runner rebuilds it
+// from the journal, and empty state with no org for a new workflow.
+func (e *InMemoryEngine) Restore(workflowID string) (*WorkflowState, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if state, ok := e.snapshots[workflowID]; ok {
+		return copyState(state), nil
+	}
+	for _, event := range e.events {
+		if event["workflow_id"] == workflowID && event["event_type"] == "step_completed" {
+			return nil, nil
+		}
+	}
+	return &WorkflowState{
+		WorkflowID: workflowID,
+		Variables:  make(map[string]interface{}),
+		Metadata:   make(map[string]interface{}),
+		Version:    "1.0",
+	}, nil
+}
+
+// RebuildState folds the journaled deltas over the workflow's snapshot,
+// ignoring a snapshot that fails its checksum
+func (e *InMemoryEngine) RebuildState(workflowID string) (*WorkflowState, error) {
+	e.mu.RLock()
+	base := copyState(e.snapshots[workflowID])
+	if base != nil && verifyChecksum(base, "snapshot") != nil {
+		base = nil
+	}
+	events := e.workflowEvents(workflowID)
+	e.mu.RUnlock()
+	return ReplayDeltas(e, workflowID, base, events)
+}
+
+// Compact folds the workflow's completed steps into its snapshot and drops
+// their journal events. Events appended while it runs are kept.
+func (e *InMemoryEngine) Compact(workflowID string) (CompactionResult, error) {
+	e.mu.RLock()
+	base := copyState(e.snapshots[workflowID])
+	events := e.workflowEvents(workflowID)
+	e.mu.RUnlock()
+	state, dropped, err := compactEvents(e, workflowID, base, events)
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	ids := droppedEventIDs(events, dropped)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// A newer snapshot covers the folded steps already
+	if current := e.snapshots[workflowID]; current == nil || current.StepNumber < state.StepNumber {
+		e.snapshots[workflowID] = state
+	}
+	var size HistorySize
+	kept := e.events[:0]
+	for _, event := range e.events {
+		if event["workflow_id"] == workflowID {
+			if ids[getString(event, "event_id")] {
+				continue
+			}
+			size.add(event)
+		}
+		kept = append(kept, event)
+	}
+	e.events = kept
+	e.histories[workflowID] = size
+	return CompactionResult{EventsDeleted: len(ids), StepNumber: state.StepNumber}, nil
+}
+
+// CompleteWorkflow stamps the workflow's snapshot as completed
+func (e *InMemoryEngine) CompleteWorkflow(workflowID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if state, ok := e.snapshots[workflowID]; ok {
+		completed := copyState(state)
+		completed.Metadata["completed_at"] = time.Now().UTC().Format(time.RFC3339)
+		completed.Checksum = ""
+		completed.Checksum = computeChecksum(completed)
+		e.snapshots[workflowID] = completed
+	}
+	return nil
+}
+
+// MaybeSnapshot stores a snapshot, rejecting one older than the stored
+// snapshot with StateConflict
+func (e *InMemoryEngine) MaybeSnapshot(state *WorkflowState) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := CheckStateVersion(e.snapshots[state.WorkflowID], state); err != nil {
+		return err
+	}
+	e.snapshots[state.WorkflowID] = copyState(state)
+	return nil
+}
+
+// LeaseManager returns the engine's lease manager
+func (e *InMemoryEngine) LeaseManager() LeaseManager {
+	return &inMemoryLeases{engine: e}
+}
+
+// Journal returns the engine's journal
+func (e *InMemoryEngine) Journal() Journal {
+	return &inMemoryJournal{engine: e}
+}
+
+// Idempotency returns the engine's idempotency manager
+func (e *InMemoryEngine) Idempotency() IdempotencyManager {
+	return &inMemoryIdempotency{engine: e}
+}
+
+// CheckHealth always succeeds; there is no connection to lose
+func (e *InMemoryEngine) CheckHealth(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Events returns a workflow's journal events in append order, or every
+// workflow's when workflowID is empty
+func (e *InMemoryEngine) Events(workflowID string) []map[string]interface{} {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.workflowEvents(workflowID)
+}
+
+// workflowEvents copies the workflow's events. Callers must hold e.mu.
+func (e *InMemoryEngine) workflowEvents(workflowID string) []map[string]interface{} {
+	events := make([]map[string]interface{}, 0, len(e.events))
+	for _, event := range e.events {
+		if workflowID == "" || event["workflow_id"] == workflowID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// CountEvents counts a workflow's journal events, only those of the given
+// types if any are given
+func (e *InMemoryEngine) CountEvents(workflowID string, eventTypes ...string) (int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return countEvents(e.events, workflowID, eventTypes), nil
+}
+
+// HistorySize returns how many events, and how many bytes of them, the
+// workflow has journaled
+func (e *InMemoryEngine) HistorySize(workflowID string) (HistorySize, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.histories[workflowID], nil
+}
+
+// ExportWorkflow archives everything the engine holds for a workflow
+func (e *InMemoryEngine) ExportWorkflow(workflowID string) (*WorkflowArchive, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	archive := &WorkflowArchive{
+		FormatVersion:  ArchiveFormatVersion,
+		WorkflowID:     workflowID,
+		ExportedAt:     time.Now().UTC(),
+		Events:         e.workflowEvents(workflowID),
+		Snapshot:       copyState(e.snapshots[workflowID]),
+		CompletedSteps: make(map[string]*WorkflowState),
+		Artifacts:      make(map[string][]byte),
+		Memo:           e.workflowMemos[workflowID],
+	}
+	if len(archive.Events) > 0 {
+		archive.OrgID = getString(archive.Events[0], "org_id")
+	}
+	for _, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			archive.Savepoints = append(archive.Savepoints, ArchivedSavepoint{Info: sp.info, State: copyState(sp.state)})
+		}
+	}
+	sort.Slice(archive.Savepoints, func(i, j int) bool {
+		return archive.Savepoints[i].Info.StepNumber < archive.Savepoints[j].Info.StepNumber
+	})
+	prefix := workflowID + ":"
+	for key, state := range e.completed {
+		if strings.HasPrefix(key, prefix) {
+			archive.CompletedSteps[strings.TrimPrefix(key, prefix)] = copyState(state)
+		}
+	}
+	for ref, data := range e.artifacts {
+		if strings.HasPrefix(ref, workflowID+"/") {
+			archive.Artifacts[ref] = data
+		}
+	}
+	if len(archive.Events) == 0 && archive.Snapshot == nil {
+		return nil, NewWorkflowNotFound(workflowID)
+	}
+	return archive, nil
+}
+
+// ImportWorkflow loads an archive. The workflow must not already exist.
+func (e *InMemoryEngine) ImportWorkflow(archive *WorkflowArchive) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	workflowID := archive.WorkflowID
+	if _, ok := e.snapshots[workflowID]; ok || len(e.workflowEvents(workflowID)) > 0 {
+		return NewContdError("workflow already exists", workflowID, nil)
+	}
+	size := e.histories[workflowID]
+	for _, event := range archive.Events {
+		e.events = append(e.events, event)
+		size.add(event)
+		for tail := range e.tails {
+			tail.offer(event)
+		}
+	}
+	e.histories[workflowID] = size
+	if archive.Snapshot != nil {
+		e.snapshots[workflowID] = copyState(archive.Snapshot)
+	}
+	for _, sp := range archive.Savepoints {
+		e.savepoints[sp.Info.SavepointID] = mockSavepoint{info: sp.Info, state: copyState(sp.State)}
+	}
+	prefix := workflowID + ":"
+	for stepID, state := range archive.CompletedSteps {
+		e.completed[prefix+stepID] = copyState(state)
+	}
+	delete(e.latest, workflowID)
+	for ref, data := range archive.Artifacts {
+		e.artifacts[ref] = data
+	}
+	if archive.Memo != nil {
+		e.workflowMemos[workflowID] = archive.Memo
+	}
+	return nil
+}
+
+// LatestState returns the most recent committed state of a workflow
+func (e *InMemoryEngine) LatestState(workflowID string) *WorkflowState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	latest := e.snapshots[workflowID]
+	prefix := workflowID + ":"
+	for key, state := range e.completed {
+		if strings.HasPrefix(key, prefix) && !isBatchItem(state) && (latest == nil || state.StepNumber > latest.StepNumber) {
+			latest = state
+		}
+	}
+	return copyState(latest)
+}
+
+// TailJournal streams recorded and newly appended events for a workflow
+func (e *InMemoryEngine) TailJournal(ctx context.Context, workflowID string) <-chan map[string]interface{} {
+	e.mu.Lock()
+	tail := newJournalTail(workflowID, e.workflowEvents(workflowID))
+	e.tails[tail] = struct{}{}
+	e.mu.Unlock()
+
+	out := make(chan map[string]interface{})
+	go tail.run(ctx, out, func() {
+		e.mu.Lock()
+		delete(e.tails, tail)
+		e.mu.Unlock()
+	})
+	return out
+}
+
+// SaveSavepoint stores a savepoint and its state
+func (e *InMemoryEngine) SaveSavepoint(info SavepointInfo, state *WorkflowState) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.savepoints[info.SavepointID] = mockSavepoint{info: info, state: copyState(state)}
+	return nil
+}
+
+// LoadSavepoint loads a savepoint and its state
+func (e *InMemoryEngine) LoadSavepoint(workflowID, savepointID string) (*SavepointInfo, *WorkflowState, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	sp, ok := e.savepoints[savepointID]
+	if !ok || sp.info.WorkflowID != workflowID {
+		return nil, nil, NewInvalidSavepoint(workflowID, savepointID, "savepoint not found")
+	}
+	info := sp.info
+	return &info, copyState(sp.state), nil
+}
+
+// ListSavepoints returns a workflow's savepoints in step order
+func (e *InMemoryEngine) ListSavepoints(workflowID string) ([]SavepointInfo, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var infos []SavepointInfo
+	for _, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			infos = append(infos, sp.info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].StepNumber != infos[j].StepNumber {
+			return infos[i].StepNumber < infos[j].StepNumber
+		}
+		return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+	})
+	return infos, nil
+}
+
+// WorkflowStatus returns a workflow's recorded status
+func (e *InMemoryEngine) WorkflowStatus(workflowID string) (WorkflowStatus, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.statuses[workflowID], nil
+}
+
+// SetWorkflowStatus records a workflow's status
+func (e *InMemoryEngine) SetWorkflowStatus(workflowID string, status WorkflowStatus) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.statuses[workflowID] = status
+	return nil
+}
+
+// ResetWorkflow discards everything held for a workflow except its fencing
+// token, so the ID can start a new run
+func (e *InMemoryEngine) ResetWorkflow(workflowID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.snapshots, workflowID)
+	delete(e.leases, workflowID)
+	delete(e.signals, workflowID)
+	delete(e.workflowMemos, workflowID)
+	delete(e.histories, workflowID)
+	kept := e.events[:0]
+	for _, event := range e.events {
+		if event["workflow_id"] != workflowID {
+			kept = append(kept, event)
+		}
+	}
+	e.events = kept
+	prefix := workflowID + ":"
+	for key := range e.completed {
+		if strings.HasPrefix(key, prefix) {
+			delete(e.completed, key)
+		}
+	}
+	delete(e.latest, workflowID)
+	e.dropAttempts(workflowID)
+	for id, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			delete(e.savepoints, id)
+		}
+	}
+	for ref := range e.artifacts {
+		if strings.HasPrefix(ref, workflowID+"/") {
+			delete(e.artifacts, ref)
+		}
+	}
+	return nil
+}
+
+// leaseTTL returns the configured lease lifetime
+func (e *InMemoryEngine) leaseTTL() time.Duration {
+	if e.LeaseTTL > 0 {
+		return e.LeaseTTL
+	}
+	return DefaultInMemoryLeaseTTL
+}
+
+// checkFencing rejects a token older than the workflow's latest lease.
+// Callers must hold e.mu.
+func (e *InMemoryEngine) checkFencing(workflowID, ownerID string, token int64) error {
+	current := e.fencingTokens[workflowID]
+	if token == 0 || token >= current {
+		return nil
+	}
+	return NewStaleLease(workflowID, ownerID, token, current)
+}
+
+// inMemoryLeases grants leases that expire unless heartbeated. An expired
+// lease stays held until released or stolen, and each change of owner
+// issues a higher fencing token.
+type inMemoryLeases struct {
+	engine *InMemoryEngine
+}
+
+func (m *inMemoryLeases) Acquire(workflowID, ownerID string) (*Lease, error) {
+	return m.grant(workflowID, ownerID, false)
+}
+
+// StealExpired takes over a lease whose holder let it expire
+func (m *inMemoryLeases) StealExpired(workflowID, ownerID string) (*Lease, error) {
+	return m.grant(workflowID, ownerID, true)
+}
+
+func (m *inMemoryLeases) grant(workflowID, ownerID string, steal bool) (*Lease, error) {
+	e := m.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	current, held := e.leases[workflowID]
+	if held && current.OwnerID != ownerID && (!steal || now.Before(current.ExpiresAt)) {
+		return nil, NewWorkflowLocked(workflowID, current.OwnerID, current.ExpiresAt.UTC().Format(time.RFC3339Nano))
+	}
+	if !held || current.OwnerID != ownerID {
+		e.fencingTokens[workflowID]++
+	}
+	lease := &Lease{
+		WorkflowID:   workflowID,
+		OwnerID:      ownerID,
+		ExpiresAt:    now.Add(e.leaseTTL()),
+		FencingToken: e.fencingTokens[workflowID],
+	}
+	stored := *lease
+	e.leases[workflowID] = &stored
+	return lease, nil
+}
+
+func (m *inMemoryLeases) Release(lease *Lease) error {
+	e := m.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if current, ok := e.leases[lease.WorkflowID]; ok && current.FencingToken == lease.FencingToken {
+		delete(e.leases, lease.WorkflowID)
+	}
+	return nil
+}
+
+func (m *inMemoryLeases) Heartbeat(lease *Lease) error {
+	e := m.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.checkFencing(lease.WorkflowID, lease.OwnerID, lease.FencingToken); err != nil {
+		return err
+	}
+	if current, ok := e.leases[lease.WorkflowID]; ok && current.FencingToken == lease.FencingToken {
+		current.ExpiresAt = time.Now().Add(e.leaseTTL())
+	}
+	return nil
+}
+
+func (m *inMemoryLeases) HeartbeatInterval() time.Duration {
+	return m.engine.leaseTTL() / 3
+}
+
+// inMemoryJournal appends events in order, rejecting writes fenced off by
+// a newer lease
+type inMemoryJournal struct {
+	engine *InMemoryEngine
+}
+
+func (j *inMemoryJournal) Append(event interface{}) error {
+	m, ok := event.(map[string]interface{})
+	if !ok {
+		return NewPersistenceError(fmt.Sprintf("unsupported journal event %T", event), "", nil)
+	}
+	e := j.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	workflowID, _ := m["workflow_id"].(string)
+	token, _ := m["fencing_token"].(int64)
+	if err := e.checkFencing(workflowID, "", token); err != nil {
+		return err
+	}
+	stored := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		stored[k] = v
+	}
+	e.events = append(e.events, stored)
+	size := e.histories[workflowID]
+	size.add(stored)
+	e.histories[workflowID] = size
+	for tail := range e.tails {
+		tail.offer(stored)
+	}
+	return nil
+}
+
+type inMemoryIdempotency struct {
+	engine *InMemoryEngine
+}
+
+func (m *inMemoryIdempotency) CheckCompleted(workflowID, stepID string) (*WorkflowState, error) {
+	e := m.engine
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return copyState(e.completed[workflowID+":"+stepID]), nil
+}
+
+func (m *inMemoryIdempotency) AllocateAttempt(workflowID, stepID string, lease *Lease) (int, error) {
+	e := m.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var ownerID string
+	var token int64
+	if lease != nil {
+		ownerID, token = lease.OwnerID, lease.FencingToken
+	}
+	if err := e.checkFencing(workflowID, ownerID, token); err != nil {
+		return 0, err
+	}
+	return e.nextAttempt(workflowID, stepID, token), nil
+}
+
+func (m *inMemoryIdempotency) MarkCompleted(workflowID, stepID string, attemptID int, state *WorkflowState) error {
+	e := m.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := workflowID + ":" + stepID
+	if err := e.checkFencing(workflowID, "", e.attemptToken(workflowID, stepID, attemptID)); err != nil {
+		return err
+	}
+	latest := e.latestCompleted(workflowID)
+	if cached := e.completed[key]; cached == nil || cached.Checksum != state.Checksum {
+		if err := CheckStateVersion(latest, state); err != nil {
+			return err
+		}
+	}
+	stored := copyState(state)
+	e.completed[key] = stored
+	if latest == nil || stored.StateVersion >= latest.StateVersion {
+		e.latest[workflowID] = stored
+	}
+	return nil
+}
+
+// latestCompleted returns the completed step state with the highest
+// StateVersion. It is cached in e.latest so committing a step doesn't scan
+// every completed step. Callers must hold e.mu for writing.
+func (e *InMemoryEngine) latestCompleted(workflowID string) *WorkflowState {
+	if latest, ok := e.latest[workflowID]; ok {
+		return latest
+	}
+	prefix := workflowID + ":"
+	var latest *WorkflowState
+	for key, state := range e.completed {
+		if strings.HasPrefix(key, prefix) && (latest == nil || state.StateVersion > latest.StateVersion) {
+			latest = state
+		}
+	}
+	e.latest[workflowID] = latest
+	return latest
+}
+
+// InvalidateAfter forgets completed steps whose state is past stepNumber
+func (m *inMemoryIdempotency) InvalidateAfter(workflowID string, stepNumber int) (int, error) {
+	e := m.engine
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prefix := workflowID + ":"
+	removed := 0
+	for key, state := range e.completed {
+		if strings.HasPrefix(key, prefix) && state.StepNumber > stepNumber {
+			delete(e.completed, key)
+			removed++
+		}
+	}
+	delete(e.latest, workflowID)
+	return removed, nil
+}
@@ -0,0 +1,118 @@
+package contd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StepMemo memoizes a step by content: a successful result is cached under
+// a hash of the step's name, Version and input, and any later run of the
+// same step on the same input reuses it, even from another workflow.
+// Bump Version whenever the step's code changes what it produces.
+type StepMemo struct {
+	// Version identifies the step's code, e.g. a release or a digest of it
+	Version string `json:"version"`
+	// TTL is how long a cached result stays valid (0 keeps it forever)
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+// MemoEntry is a memoized step result with the variables the step set
+type MemoEntry struct {
+	Result    interface{}            `json:"result,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+	Deleted   []string               `json:"deleted,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	ExpiresAt time.Time              `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the entry's TTL has passed
+func (e *MemoEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// MemoStore is implemented by engines that keep memoized step results.
+// Entries are shared by all workflows of an org.
+type MemoStore interface {
+	// LoadMemo returns the entry stored under key, or nil if there is none
+	LoadMemo(key string) (*MemoEntry, error)
+	SaveMemo(key string, entry MemoEntry) error
+}
+
+// memoKey hashes what identifies a memoized step's result. It reports
+// false if the input cannot be encoded, in which case the step runs
+// unmemoized.
+func memoKey(orgID, stepName string, memo *StepMemo, input interface{}) (string, bool) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	for _, part := range []string{orgID, stepName, memo.Version} {
+		fmt.Fprintf(h, "%d:%s", len(part), part)
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// lookupMemo returns the live memoized result for key
+func lookupMemo(store MemoStore, key string) *MemoEntry {
+	entry, err := store.LoadMemo(key)
+	if err != nil {
+		fmt.Printf("Failed to load memoized result %s: %v\n", key, err)
+		return nil
+	}
+	if entry == nil || entry.expired(time.Now()) {
+		return nil
+	}
+	return entry
+}
+
+// saveMemo stores a step's result and variable changes under key
+func saveMemo(store MemoStore, key string, memo *StepMemo, result interface{}, changes map[string]varChange) {
+	entry := MemoEntry{Result: result, CreatedAt: time.Now().UTC()}
+	if memo.TTL > 0 {
+		entry.ExpiresAt = entry.CreatedAt.Add(memo.TTL)
+	}
+	for k, change := range changes {
+		// Side effects belong to the workflow that enqueued them
+		if strings.HasPrefix(k, outboxPrefix) {
+			continue
+		}
+		if change.deleted {
+			entry.Deleted = append(entry.Deleted, k)
+			continue
+		}
+		if entry.Variables == nil {
+			entry.Variables = make(map[string]interface{})
+		}
+		entry.Variables[k] = change.value
+	}
+	if err := store.SaveMemo(key, entry); err != nil {
+		fmt.Printf("Failed to save memoized result %s: %v\n", key, err)
+	}
+}
+
+// applyMemo replays a memoized step's variable changes onto ec
+func (ec *ExecutionContext) applyMemo(entry *MemoEntry) {
+	for k, v := range entry.Variables {
+		ec.Set(k, v)
+	}
+	for _, k := range entry.Deleted {
+		ec.Delete(k)
+	}
+}
+
+// pendingChanges returns a copy of the current step's uncommitted changes
+func (ec *ExecutionContext) pendingChanges() map[string]varChange {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	changes := make(map[string]varChange, len(ec.changes))
+	for k, change := range ec.changes {
+		changes[k] = change
+	}
+	return changes
+}
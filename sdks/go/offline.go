@@ -0,0 +1,254 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BufferedRecord is a journal event, checkpoint or completion held in a
+// LocalBuffer until it is synced. Exactly one of Event, Snapshot and
+// Completed is set.
+type BufferedRecord struct {
+	Seq        uint64                 `json:"seq"`
+	WorkflowID string                 `json:"workflow_id"`
+	Event      map[string]interface{} `json:"event,omitempty"`
+	Snapshot   *WorkflowState         `json:"snapshot,omitempty"`
+	Completed  bool                   `json:"completed,omitempty"`
+}
+
+// LocalBuffer is a durable write-ahead buffer on the executor's disk
+type LocalBuffer interface {
+	// Append durably stores rec, assigning it the next sequence number
+	Append(rec BufferedRecord) (uint64, error)
+	// Pending returns up to limit unsynced records, oldest first (0 for all)
+	Pending(limit int) ([]BufferedRecord, error)
+	// Ack marks every record up to seq as synced
+	Ack(seq uint64) error
+	Close() error
+}
+
+// OfflineConfig configures how an OfflineEngine syncs its buffer
+type OfflineConfig struct {
+	// SyncInterval is how often the buffer is pushed to the remote engine
+	// (defaults to 1s)
+	SyncInterval time.Duration
+	// BatchSize is the most records read from the buffer at once (defaults
+	// to 100)
+	BatchSize int
+	// RetryBackoffMax caps the delay between sync attempts after a failure
+	// (defaults to 30s)
+	RetryBackoffMax time.Duration
+}
+
+// OfflineEngine lets an executor on a flaky network keep running while the
+// remote engine is unreachable. Journal appends, checkpoints and
+// completions are written to a LocalBuffer first, and a background syncer
+// pushes them to the remote engine in the order they were written. A
+// record is acknowledged in the buffer only after the remote accepted it,
+// so a crash mid-sync re-sends at most the records since the last
+// acknowledgement; events keep their event_id, letting the remote journal
+// drop such repeats. Leases and step idempotency still go to the remote
+// engine.
+type OfflineEngine struct {
+	Engine
+	buffer LocalBuffer
+	config OfflineConfig
+
+	syncMu sync.Mutex
+	wake   chan struct{}
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewOfflineEngine wraps remote so writes land in buffer first
+func NewOfflineEngine(remote Engine, buffer LocalBuffer, config OfflineConfig) *OfflineEngine {
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.RetryBackoffMax <= 0 {
+		config.RetryBackoffMax = 30 * time.Second
+	}
+	e := &OfflineEngine{
+		Engine: remote,
+		buffer: buffer,
+		config: config,
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Unwrap returns the remote engine
+func (e *OfflineEngine) Unwrap() Engine {
+	return e.Engine
+}
+
+// Journal returns a journal that appends to the local buffer
+func (e *OfflineEngine) Journal() Journal {
+	return &offlineJournal{engine: e}
+}
+
+// MaybeSnapshot buffers a checkpoint of state
+func (e *OfflineEngine) MaybeSnapshot(state *WorkflowState) error {
+	if state == nil {
+		return nil
+	}
+	return e.append(BufferedRecord{WorkflowID: state.WorkflowID, Snapshot: copyState(state)})
+}
+
+// CompleteWorkflow buffers the workflow's completion, so the remote engine
+// sees it after the workflow's last events
+func (e *OfflineEngine) CompleteWorkflow(workflowID string) error {
+	return e.append(BufferedRecord{WorkflowID: workflowID, Completed: true})
+}
+
+// Restore syncs the buffer and restores the workflow from the remote
+// engine. It fails while any of the workflow's records are unsynced, since
+// the remote state would be stale.
+func (e *OfflineEngine) Restore(workflowID string) (*WorkflowState, error) {
+	e.Sync(context.Background())
+	pending, err := e.buffer.Pending(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range pending {
+		if rec.WorkflowID == workflowID {
+			return nil, NewPersistenceError("workflow has buffered records not yet synced", workflowID, map[string]interface{}{
+				"pending": len(pending),
+			})
+		}
+	}
+	return e.Engine.Restore(workflowID)
+}
+
+// Pending reports how many records await sync
+func (e *OfflineEngine) Pending() (int, error) {
+	pending, err := e.buffer.Pending(0)
+	return len(pending), err
+}
+
+// Sync pushes buffered records to the remote engine until the buffer is
+// empty, a push fails or ctx is done
+func (e *OfflineEngine) Sync(ctx context.Context) error {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	for ctx.Err() == nil {
+		batch, err := e.buffer.Pending(e.config.BatchSize)
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		for _, rec := range batch {
+			if err := e.push(rec); err != nil {
+				return err
+			}
+			if err := e.buffer.Ack(rec.Seq); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// Close syncs what it can before ctx is done, then closes the buffer.
+// Unsynced records stay in the buffer for the next OfflineEngine.
+func (e *OfflineEngine) Close(ctx context.Context) error {
+	e.once.Do(func() { close(e.closed) })
+	<-e.done
+	err := e.Sync(ctx)
+	if cerr := e.buffer.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// push applies a record to the remote engine
+func (e *OfflineEngine) push(rec BufferedRecord) error {
+	switch {
+	case rec.Event != nil:
+		return e.Engine.Journal().Append(rec.Event)
+	case rec.Snapshot != nil:
+		return e.Engine.MaybeSnapshot(rec.Snapshot)
+	case rec.Completed:
+		return e.Engine.CompleteWorkflow(rec.WorkflowID)
+	}
+	return nil
+}
+
+// append buffers a record and nudges the syncer
+func (e *OfflineEngine) append(rec BufferedRecord) error {
+	if _, err := e.buffer.Append(rec); err != nil {
+		return NewPersistenceError(fmt.Sprintf("failed to buffer record: %v", err), rec.WorkflowID, nil)
+	}
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run syncs on every write and interval, backing off while the remote
+// engine is unreachable
+func (e *OfflineEngine) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.SyncInterval)
+	defer ticker.Stop()
+
+	var backoff time.Duration
+	for {
+		select {
+		case <-e.closed:
+			return
+		case <-e.wake:
+		case <-ticker.C:
+		}
+		if err := e.Sync(context.Background()); err != nil {
+			fmt.Printf("Failed to sync buffered records: %v\n", err)
+			backoff = backoff*2 + 100*time.Millisecond
+			if backoff > e.config.RetryBackoffMax {
+				backoff = e.config.RetryBackoffMax
+			}
+			select {
+			case <-e.closed:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+	}
+}
+
+type offlineJournal struct {
+	engine *OfflineEngine
+}
+
+// Append buffers the event
+func (j *offlineJournal) Append(event interface{}) error {
+	m, ok := event.(map[string]interface{})
+	if !ok {
+		if err := convert(nil, event, &m); err != nil {
+			return NewPersistenceError(fmt.Sprintf("failed to encode event: %v", err), "", nil)
+		}
+	}
+	// Copy so later changes by the caller don't race the syncer
+	cp := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	workflowID, _ := cp["workflow_id"].(string)
+	return j.engine.append(BufferedRecord{WorkflowID: workflowID, Event: cp})
+}
+
+// QueueDepth reports how many records await sync
+func (j *offlineJournal) QueueDepth() int {
+	n, _ := j.engine.Pending()
+	return n
+}
@@ -0,0 +1,158 @@
+package contd
+
+import (
+	"context"
+)
+
+// orgHeader carries the org of an org-scoped client's requests
+const orgHeader = "X-Org-ID"
+
+// OrgQuota limits how fast one org may call the API
+type OrgQuota struct {
+	// RequestsPerSecond of zero or less leaves the org unlimited
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// ForOrg returns a client scoped to orgID. It shares the underlying HTTP
+// client and uses the org's API key from OrgAPIKeys when one is configured.
+func (c *Client) ForOrg(orgID string) *Client {
+	scoped := *c
+	scoped.orgID = orgID
+	if key, ok := c.orgKeys[orgID]; ok {
+		scoped.auth = APIKeyAuth(key)
+	}
+	return &scoped
+}
+
+// OrgID returns the org the client is scoped to, if any
+func (c *Client) OrgID() string {
+	return c.orgID
+}
+
+// checkOrg rejects access to a workflow owned by another org. Reading the
+// workflow's status does the check.
+func (c *Client) checkOrg(ctx context.Context, workflowID string) error {
+	if c.orgID == "" {
+		return nil
+	}
+	_, err := c.GetStatus(ctx, workflowID)
+	return err
+}
+
+// sameOrg reports whether a resource owned by resourceOrgID is visible to
+// orgID. Orgs must match exactly: resources of the "default" org, or with
+// no org, belong to no other org.
+func sameOrg(orgID, resourceOrgID string) bool {
+	return resourceOrgID == orgID
+}
+
+// OrgEngine scopes an engine to one org. It stamps the org on every journal
+// event and snapshot, and rejects restoring another org's workflows. The
+// wrapped engine's capabilities, such as signals and dead letters, reject
+// other orgs' workflows too.
+type OrgEngine struct {
+	Engine
+	orgID string
+}
+
+// NewOrgEngine wraps engine so it only serves orgID
+func NewOrgEngine(engine Engine, orgID string) *OrgEngine {
+	return &OrgEngine{Engine: engine, orgID: orgID}
+}
+
+// OrgID returns the org the engine is scoped to
+func (e *OrgEngine) OrgID() string {
+	return e.orgID
+}
+
+// Unwrap returns the wrapped engine
+func (e *OrgEngine) Unwrap() Engine {
+	return e.Engine
+}
+
+// Restore restores workflow state, rejecting workflows owned by another org.
+// A new workflow's empty state has no org yet and is claimed for the
+// engine's.
+func (e *OrgEngine) Restore(workflowID string) (*WorkflowState, error) {
+	state, err := e.Engine.Restore(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && state.OrgID == "" && state.StepNumber == 0 {
+		state.OrgID = e.orgID
+	}
+	if state != nil && !sameOrg(e.orgID, state.OrgID) {
+		return nil, NewOrgMismatch(workflowID, e.orgID, state.OrgID)
+	}
+	return state, nil
+}
+
+// MaybeSnapshot snapshots state, rejecting state owned by another org
+func (e *OrgEngine) MaybeSnapshot(state *WorkflowState) error {
+	if !sameOrg(e.orgID, state.OrgID) {
+		return NewOrgMismatch(state.WorkflowID, e.orgID, state.OrgID)
+	}
+	return e.Engine.MaybeSnapshot(state)
+}
+
+// Journal returns a journal that stamps the engine's org on every event
+func (e *OrgEngine) Journal() Journal {
+	return &orgJournal{journal: e.Engine.Journal(), orgID: e.orgID}
+}
+
+// SaveSavepoint saves savepoint state if the wrapped engine supports it
+func (e *OrgEngine) SaveSavepoint(info SavepointInfo, state *WorkflowState) error {
+	store, ok := engineAs[SavepointStore](e.Engine)
+	if !ok {
+		return NewConfigurationError("engine does not support savepoints", "savepoints")
+	}
+	if state != nil && !sameOrg(e.orgID, state.OrgID) {
+		return NewOrgMismatch(info.WorkflowID, e.orgID, state.OrgID)
+	}
+	return store.SaveSavepoint(info, state)
+}
+
+// LoadSavepoint loads savepoint state, rejecting savepoints owned by another org
+func (e *OrgEngine) LoadSavepoint(workflowID, savepointID string) (*SavepointInfo, *WorkflowState, error) {
+	store, ok := engineAs[SavepointStore](e.Engine)
+	if !ok {
+		return nil, nil, NewConfigurationError("engine does not support savepoint restore", "resume_from_savepoint")
+	}
+	info, state, err := store.LoadSavepoint(workflowID, savepointID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state != nil && !sameOrg(e.orgID, state.OrgID) {
+		return nil, nil, NewOrgMismatch(workflowID, e.orgID, state.OrgID)
+	}
+	return info, state, nil
+}
+
+// orgJournal stamps org_id on events that have none before appending them,
+// and rejects events of another org
+type orgJournal struct {
+	journal Journal
+	orgID   string
+}
+
+func (j *orgJournal) Append(event interface{}) error {
+	if m, ok := event.(map[string]interface{}); ok {
+		orgID, _ := m["org_id"].(string)
+		if orgID == "" {
+			m["org_id"] = j.orgID
+		} else if !sameOrg(j.orgID, orgID) {
+			workflowID, _ := m["workflow_id"].(string)
+			return NewOrgMismatch(workflowID, j.orgID, orgID)
+		}
+	}
+	return j.journal.Append(event)
+}
+
+// QueueDepth reports the wrapped journal's queue depth
+func (j *orgJournal) QueueDepth() int {
+	if q, ok := j.journal.(QueueDepther); ok {
+		return q.QueueDepth()
+	}
+	return 0
+}
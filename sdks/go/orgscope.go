@@ -0,0 +1,347 @@
+package contd
+
+import (
+	"context"
+	"time"
+)
+
+// scopeCapability vets the capabilities engineAs finds beneath the engine.
+// Capabilities that reach workflows by ID are wrapped to reject those of
+// other orgs; ones that act on every org at once, and any this engine
+// doesn't know, are hidden.
+func (e *OrgEngine) scopeCapability(capability interface{}) bool {
+	switch c := capability.(type) {
+	case *StateRebuilder:
+		*c = orgRebuilder{e, *c}
+	case *SavepointLister:
+		*c = orgSavepointLister{e, *c}
+	case *SignalStore:
+		*c = orgSignals{e, *c}
+	case *DeadLetterProvider:
+		*c = orgDeadLetterProvider{e, *c}
+	case *OutboxStore:
+		*c = orgOutbox{e, *c}
+	case *WorkflowStatusStore:
+		*c = orgStatuses{e, *c}
+	case *WorkflowMemoStore:
+		*c = orgWorkflowMemos{e, *c}
+	case *Purger:
+		*c = orgPurger{e, *c}
+	case *HistoryCounter:
+		*c = orgHistoryCounter{e, *c}
+	case *HistorySizer:
+		*c = orgHistorySizer{e, *c}
+	case *Compactor:
+		*c = orgCompactor{e, *c}
+	case *Archiver:
+		*c = orgArchiver{e, *c}
+	case *JournalTailer:
+		*c = orgTailer{e, *c}
+	case *BusinessKeyIndex:
+		*c = orgBusinessKeys{e, *c}
+	case *MemoStore, *ArtifactProvider, *HealthChecker,
+		*StepObserver, *StepInterceptor, *LifecycleObserver:
+		// Memo keys carry the org, artifacts are reached only through
+		// references in the org's own events, and the rest observe the
+		// workflows this engine runs
+	default:
+		return false
+	}
+	return true
+}
+
+// checkOwner rejects a workflow owned by another org. A new workflow has
+// no owner yet and passes.
+func (e *OrgEngine) checkOwner(workflowID string) error {
+	state, err := e.Restore(workflowID)
+	if err != nil || state != nil {
+		return err
+	}
+	// The workflow has journaled steps but no snapshot
+	rebuilder, ok := engineAs[StateRebuilder](e.Engine)
+	if !ok {
+		return NewOrgMismatch(workflowID, e.orgID, "")
+	}
+	if state, err = rebuilder.RebuildState(workflowID); err != nil {
+		return err
+	}
+	if !sameOrg(e.orgID, state.OrgID) {
+		return NewOrgMismatch(workflowID, e.orgID, state.OrgID)
+	}
+	return nil
+}
+
+type orgRebuilder struct {
+	engine *OrgEngine
+	StateRebuilder
+}
+
+func (r orgRebuilder) RebuildState(workflowID string) (*WorkflowState, error) {
+	state, err := r.StateRebuilder.RebuildState(workflowID)
+	if err != nil || state == nil {
+		return state, err
+	}
+	if state.OrgID == "" && state.StepNumber == 0 {
+		state.OrgID = r.engine.orgID
+	}
+	if !sameOrg(r.engine.orgID, state.OrgID) {
+		return nil, NewOrgMismatch(workflowID, r.engine.orgID, state.OrgID)
+	}
+	return state, nil
+}
+
+type orgSavepointLister struct {
+	engine *OrgEngine
+	SavepointLister
+}
+
+func (l orgSavepointLister) ListSavepoints(workflowID string) ([]SavepointInfo, error) {
+	if err := l.engine.checkOwner(workflowID); err != nil {
+		return nil, err
+	}
+	return l.SavepointLister.ListSavepoints(workflowID)
+}
+
+type orgSignals struct {
+	engine *OrgEngine
+	SignalStore
+}
+
+func (s orgSignals) SendSignal(workflowID string, signal Signal) error {
+	if err := s.engine.checkOwner(workflowID); err != nil {
+		return err
+	}
+	return s.SignalStore.SendSignal(workflowID, signal)
+}
+
+func (s orgSignals) SignalAt(workflowID, name string, index int) (*Signal, error) {
+	if err := s.engine.checkOwner(workflowID); err != nil {
+		return nil, err
+	}
+	return s.SignalStore.SignalAt(workflowID, name, index)
+}
+
+type orgDeadLetterProvider struct {
+	engine *OrgEngine
+	DeadLetterProvider
+}
+
+func (p orgDeadLetterProvider) DeadLetters() DeadLetterQueue {
+	return orgDeadLetters{p.engine, p.DeadLetterProvider.DeadLetters()}
+}
+
+// orgDeadLetters lists only the org's dead letters
+type orgDeadLetters struct {
+	engine *OrgEngine
+	DeadLetterQueue
+}
+
+func (q orgDeadLetters) Put(letter DeadLetter) error {
+	if !sameOrg(q.engine.orgID, letter.OrgID) {
+		return NewOrgMismatch(letter.WorkflowID, q.engine.orgID, letter.OrgID)
+	}
+	return q.DeadLetterQueue.Put(letter)
+}
+
+func (q orgDeadLetters) List(workflowID string) ([]DeadLetter, error) {
+	letters, err := q.DeadLetterQueue.List(workflowID)
+	if err != nil {
+		return nil, err
+	}
+	owned := letters[:0]
+	for _, letter := range letters {
+		if sameOrg(q.engine.orgID, letter.OrgID) {
+			owned = append(owned, letter)
+		}
+	}
+	return owned, nil
+}
+
+func (q orgDeadLetters) MarkRedriven(workflowID, stepID string, at time.Time) (*DeadLetter, error) {
+	if err := q.engine.checkOwner(workflowID); err != nil {
+		return nil, err
+	}
+	return q.DeadLetterQueue.MarkRedriven(workflowID, stepID, at)
+}
+
+// orgOutbox delivers only the org's messages. DueOutbox filters the
+// wrapped store's due messages, so it may return fewer than limit while
+// other orgs' messages are due.
+type orgOutbox struct {
+	engine *OrgEngine
+	OutboxStore
+}
+
+func (o orgOutbox) EnqueueOutbox(msg OutboxMessage) error {
+	if !sameOrg(o.engine.orgID, msg.OrgID) {
+		return NewOrgMismatch(msg.WorkflowID, o.engine.orgID, msg.OrgID)
+	}
+	return o.OutboxStore.EnqueueOutbox(msg)
+}
+
+func (o orgOutbox) DueOutbox(now time.Time, limit int) ([]OutboxMessage, error) {
+	due, err := o.OutboxStore.DueOutbox(now, limit)
+	if err != nil {
+		return nil, err
+	}
+	owned := due[:0]
+	for _, msg := range due {
+		if sameOrg(o.engine.orgID, msg.OrgID) {
+			owned = append(owned, msg)
+		}
+	}
+	return owned, nil
+}
+
+func (o orgOutbox) UpdateOutbox(msg OutboxMessage) error {
+	if !sameOrg(o.engine.orgID, msg.OrgID) {
+		return NewOrgMismatch(msg.WorkflowID, o.engine.orgID, msg.OrgID)
+	}
+	return o.OutboxStore.UpdateOutbox(msg)
+}
+
+type orgStatuses struct {
+	engine *OrgEngine
+	WorkflowStatusStore
+}
+
+func (s orgStatuses) WorkflowStatus(workflowID string) (WorkflowStatus, error) {
+	if err := s.engine.checkOwner(workflowID); err != nil {
+		return "", err
+	}
+	return s.WorkflowStatusStore.WorkflowStatus(workflowID)
+}
+
+func (s orgStatuses) SetWorkflowStatus(workflowID string, status WorkflowStatus) error {
+	if err := s.engine.checkOwner(workflowID); err != nil {
+		return err
+	}
+	return s.WorkflowStatusStore.SetWorkflowStatus(workflowID, status)
+}
+
+func (s orgStatuses) ResetWorkflow(workflowID string) error {
+	if err := s.engine.checkOwner(workflowID); err != nil {
+		return err
+	}
+	return s.WorkflowStatusStore.ResetWorkflow(workflowID)
+}
+
+type orgWorkflowMemos struct {
+	engine *OrgEngine
+	WorkflowMemoStore
+}
+
+func (m orgWorkflowMemos) SetWorkflowMemo(workflowID string, memo map[string]interface{}) error {
+	if err := m.engine.checkOwner(workflowID); err != nil {
+		return err
+	}
+	return m.WorkflowMemoStore.SetWorkflowMemo(workflowID, memo)
+}
+
+func (m orgWorkflowMemos) WorkflowMemo(workflowID string) (map[string]interface{}, error) {
+	if err := m.engine.checkOwner(workflowID); err != nil {
+		return nil, err
+	}
+	return m.WorkflowMemoStore.WorkflowMemo(workflowID)
+}
+
+type orgPurger struct {
+	engine *OrgEngine
+	Purger
+}
+
+func (p orgPurger) PurgeWorkflow(workflowID string) error {
+	if err := p.engine.checkOwner(workflowID); err != nil {
+		return err
+	}
+	return p.Purger.PurgeWorkflow(workflowID)
+}
+
+func (p orgPurger) PurgeVariables(workflowID string, keys []string) error {
+	if err := p.engine.checkOwner(workflowID); err != nil {
+		return err
+	}
+	return p.Purger.PurgeVariables(workflowID, keys)
+}
+
+type orgHistoryCounter struct {
+	engine *OrgEngine
+	HistoryCounter
+}
+
+func (c orgHistoryCounter) CountEvents(workflowID string, eventTypes ...string) (int, error) {
+	if err := c.engine.checkOwner(workflowID); err != nil {
+		return 0, err
+	}
+	return c.HistoryCounter.CountEvents(workflowID, eventTypes...)
+}
+
+type orgHistorySizer struct {
+	engine *OrgEngine
+	HistorySizer
+}
+
+func (s orgHistorySizer) HistorySize(workflowID string) (HistorySize, error) {
+	if err := s.engine.checkOwner(workflowID); err != nil {
+		return HistorySize{}, err
+	}
+	return s.HistorySizer.HistorySize(workflowID)
+}
+
+type orgCompactor struct {
+	engine *OrgEngine
+	Compactor
+}
+
+func (c orgCompactor) Compact(workflowID string) (CompactionResult, error) {
+	if err := c.engine.checkOwner(workflowID); err != nil {
+		return CompactionResult{}, err
+	}
+	return c.Compactor.Compact(workflowID)
+}
+
+type orgArchiver struct {
+	engine *OrgEngine
+	Archiver
+}
+
+func (a orgArchiver) ExportWorkflow(workflowID string) (*WorkflowArchive, error) {
+	if err := a.engine.checkOwner(workflowID); err != nil {
+		return nil, err
+	}
+	return a.Archiver.ExportWorkflow(workflowID)
+}
+
+func (a orgArchiver) ImportWorkflow(archive *WorkflowArchive) error {
+	if !sameOrg(a.engine.orgID, archive.OrgID) {
+		return NewOrgMismatch(archive.WorkflowID, a.engine.orgID, archive.OrgID)
+	}
+	return a.Archiver.ImportWorkflow(archive)
+}
+
+type orgTailer struct {
+	engine *OrgEngine
+	JournalTailer
+}
+
+// TailJournal returns a closed channel for another org's workflow
+func (t orgTailer) TailJournal(ctx context.Context, workflowID string) <-chan map[string]interface{} {
+	if err := t.engine.checkOwner(workflowID); err != nil {
+		events := make(chan map[string]interface{})
+		close(events)
+		return events
+	}
+	return t.JournalTailer.TailJournal(ctx, workflowID)
+}
+
+type orgBusinessKeys struct {
+	engine *OrgEngine
+	BusinessKeyIndex
+}
+
+func (b orgBusinessKeys) ClaimBusinessKey(orgID, key, workflowID string) (string, error) {
+	if !sameOrg(b.engine.orgID, orgID) {
+		return "", NewOrgMismatch(workflowID, b.engine.orgID, orgID)
+	}
+	return b.BusinessKeyIndex.ClaimBusinessKey(orgID, key, workflowID)
+}
@@ -0,0 +1,306 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outboxPrefix prefixes the workflow variables holding enqueued messages
+const outboxPrefix = "_outbox."
+
+// OutboxMessage is an external action enqueued by a step
+type OutboxMessage struct {
+	// ID is stable across retries of the step, so handlers can pass it on
+	// as a deduplication key, e.g. a payment provider's idempotency key
+	ID            string      `json:"id"`
+	WorkflowID    string      `json:"workflow_id"`
+	OrgID         string      `json:"org_id,omitempty"`
+	Kind          string      `json:"kind"`
+	Payload       interface{} `json:"payload,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Attempts      int         `json:"attempts,omitempty"`
+	NextAttemptAt time.Time   `json:"next_attempt_at,omitempty"`
+	LastError     string      `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time  `json:"delivered_at,omitempty"`
+	Failed        bool        `json:"failed,omitempty"`
+}
+
+// OutboxStore is implemented by engines that hold outbox messages awaiting
+// delivery
+type OutboxStore interface {
+	// EnqueueOutbox stores msg unless a message with its ID is stored
+	EnqueueOutbox(msg OutboxMessage) error
+	// DueOutbox returns up to limit undelivered, unfailed messages whose
+	// next attempt is due by now, oldest first
+	DueOutbox(now time.Time, limit int) ([]OutboxMessage, error)
+	// UpdateOutbox saves a message's delivery progress
+	UpdateOutbox(msg OutboxMessage) error
+}
+
+// EnqueueOutbox queues an external action from inside a step, returning its
+// ID. The message is committed with the step's state and discarded if the
+// step fails, then handed to the engine's outbox for an OutboxDispatcher
+// to deliver. A crash between the commit and the hand-off is covered by
+// handing off again when the workflow resumes.
+func EnqueueOutbox(ctx context.Context, kind string, payload interface{}) (string, error) {
+	ec, err := Current(ctx)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := engineAs[OutboxStore](ec.GetEngine()); !ok {
+		return "", NewConfigurationError("engine does not support an outbox", "outbox")
+	}
+
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	n := 0
+	for key := range ec.changes {
+		if strings.HasPrefix(key, outboxPrefix) {
+			n++
+		}
+	}
+	msg := OutboxMessage{
+		ID:         fmt.Sprintf("%s:%d:%d", ec.WorkflowID, ec.state.StepNumber, n),
+		WorkflowID: ec.WorkflowID,
+		OrgID:      ec.OrgID,
+		Kind:       kind,
+		Payload:    payload,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if ec.changes == nil {
+		ec.changes = make(map[string]varChange)
+	}
+	ec.changes[outboxPrefix+msg.ID] = varChange{value: msg}
+	return msg.ID, nil
+}
+
+// handOffOutbox moves committed outbox messages among keys into the
+// engine's outbox. Handed-off keys are deleted from the state with the
+// next step's commit.
+func (ec *ExecutionContext) handOffOutbox(engine Engine, state *WorkflowState, keys map[string]struct{}) {
+	store, ok := engineAs[OutboxStore](engine)
+	if !ok || state == nil {
+		return
+	}
+	for key := range keys {
+		value, ok := state.Variables[key]
+		if !ok || !strings.HasPrefix(key, outboxPrefix) {
+			continue
+		}
+		var msg OutboxMessage
+		if typed, ok := value.(OutboxMessage); ok {
+			msg = typed
+		} else if err := convert(nil, value, &msg); err != nil {
+			fmt.Printf("Failed to decode outbox message %s: %v\n", key, err)
+			continue
+		}
+		if err := store.EnqueueOutbox(msg); err != nil {
+			fmt.Printf("Failed to enqueue outbox message %s: %v\n", msg.ID, err)
+			continue
+		}
+		ec.mu.Lock()
+		if ec.handedOff == nil {
+			ec.handedOff = make(map[string]struct{})
+		}
+		ec.handedOff[key] = struct{}{}
+		ec.mu.Unlock()
+	}
+}
+
+// resumeOutbox hands off every outbox message in a restored state
+func (ec *ExecutionContext) resumeOutbox(engine Engine, state *WorkflowState) {
+	if state == nil {
+		return
+	}
+	keys := make(map[string]struct{})
+	for key := range state.Variables {
+		if strings.HasPrefix(key, outboxPrefix) {
+			keys[key] = struct{}{}
+		}
+	}
+	ec.handOffOutbox(engine, state, keys)
+}
+
+// pruneOutbox deletes handed-off messages with the current step's commit,
+// returning the keys so they can be forgotten once it commits
+func (ec *ExecutionContext) pruneOutbox() []string {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	keys := make([]string, 0, len(ec.handedOff))
+	for key := range ec.handedOff {
+		if _, changed := ec.changes[key]; changed {
+			continue
+		}
+		if ec.changes == nil {
+			ec.changes = make(map[string]varChange)
+		}
+		ec.changes[key] = varChange{deleted: true}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// prunedOutbox forgets handed-off messages whose deletion was committed
+func (ec *ExecutionContext) prunedOutbox(keys []string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	for _, key := range keys {
+		delete(ec.handedOff, key)
+	}
+}
+
+// OutboxHandler delivers one outbox message. It may be called more than
+// once for a message, so it should pass msg.ID on as a deduplication key.
+type OutboxHandler func(ctx context.Context, msg OutboxMessage) error
+
+// OutboxConfig configures an OutboxDispatcher
+type OutboxConfig struct {
+	// Handlers deliver messages by kind
+	Handlers map[string]OutboxHandler
+	// PollInterval is how often due messages are looked up (defaults to 1s)
+	PollInterval time.Duration
+	// BatchSize is the most messages delivered per poll (defaults to 100)
+	BatchSize int
+	// Retry decides how failed deliveries are retried; a message failing
+	// MaxAttempts times is dead-lettered (defaults to DefaultRetryPolicy)
+	Retry *RetryPolicy
+}
+
+// OutboxDispatcher delivers outbox messages after their step commits,
+// retrying failures with backoff
+type OutboxDispatcher struct {
+	engine Engine
+	store  OutboxStore
+	config OutboxConfig
+
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewOutboxDispatcher starts delivering engine's outbox messages
+func NewOutboxDispatcher(engine Engine, config OutboxConfig) (*OutboxDispatcher, error) {
+	store, ok := engineAs[OutboxStore](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support an outbox", "outbox")
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.Retry == nil {
+		policy := DefaultRetryPolicy()
+		config.Retry = &policy
+	}
+	d := &OutboxDispatcher{
+		engine: engine,
+		store:  store,
+		config: config,
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d, nil
+}
+
+func (d *OutboxDispatcher) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-d.closed
+		cancel()
+	}()
+	for {
+		if _, err := d.DispatchOnce(ctx); err != nil && ctx.Err() == nil {
+			fmt.Printf("Failed to dispatch outbox: %v\n", err)
+		}
+		select {
+		case <-d.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce delivers the messages due now, returning how many were
+// delivered
+func (d *OutboxDispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	due, err := d.store.DueOutbox(time.Now(), d.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, msg := range due {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+		handler, ok := d.config.Handlers[msg.Kind]
+		var deliverErr error
+		if !ok {
+			deliverErr = fmt.Errorf("no outbox handler for kind %q", msg.Kind)
+		} else {
+			deliverErr = handler(ctx, msg)
+		}
+		msg.Attempts++
+		if deliverErr == nil {
+			now := time.Now().UTC()
+			msg.DeliveredAt = &now
+			msg.LastError = ""
+			delivered++
+		} else {
+			msg.LastError = deliverErr.Error()
+			if d.config.Retry.ShouldRetry(msg.Attempts, deliverErr) {
+				msg.NextAttemptAt = time.Now().Add(retryDelay(deliverErr, d.config.Retry.Backoff(msg.Attempts)))
+			} else {
+				msg.Failed = true
+				d.deadLetter(msg, deliverErr)
+			}
+		}
+		if err := d.store.UpdateOutbox(msg); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// deadLetter records a message that ran out of attempts
+func (d *OutboxDispatcher) deadLetter(msg OutboxMessage, err error) {
+	fmt.Printf("Outbox message %s failed after %d attempts: %v\n", msg.ID, msg.Attempts, err)
+	provider, ok := engineAs[DeadLetterProvider](d.engine)
+	if !ok {
+		return
+	}
+	letter := DeadLetter{
+		WorkflowID: msg.WorkflowID,
+		OrgID:      msg.OrgID,
+		StepID:     msg.ID,
+		StepName:   "outbox:" + msg.Kind,
+		Attempts:   msg.Attempts,
+		Input:      msg.Payload,
+		ErrorChain: errorChain(err),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if putErr := provider.DeadLetters().Put(letter); putErr != nil {
+		fmt.Printf("Failed to dead-letter outbox message %s: %v\n", msg.ID, putErr)
+	}
+}
+
+// Close stops the dispatcher, cancelling an in-progress delivery, and
+// waits for it to return or ctx to be done
+func (d *OutboxDispatcher) Close(ctx context.Context) error {
+	d.once.Do(func() { close(d.closed) })
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,179 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// DefaultPageSize is how many items iterators request per page
+const DefaultPageSize = 100
+
+// pageRequest is the position of the page to fetch
+type pageRequest struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// pageFetcher fetches one page, returning its items, the total item count
+// (0 if unknown) and the cursor of the next page, if any
+type pageFetcher[T any] func(ctx context.Context, page pageRequest) (items []T, total int, next string, err error)
+
+// Iterator walks a paginated listing, fetching pages as needed. It follows
+// cursors when the server returns them and offsets otherwise.
+//
+//	it := client.ListWorkflowsIterator(ctx, contd.ListWorkflowsInput{Status: "running"})
+//	for it.Next() {
+//		fmt.Println(it.Item().WorkflowID)
+//	}
+//	if err := it.Err(); err != nil { ... }
+type Iterator[T any] struct {
+	ctx   context.Context
+	fetch pageFetcher[T]
+	page  pageRequest
+	items []T
+	index int
+	last  bool
+	err   error
+}
+
+func newIterator[T any](ctx context.Context, page pageRequest, fetch pageFetcher[T]) *Iterator[T] {
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageSize
+	}
+	return &Iterator[T]{ctx: ctx, fetch: fetch, page: page, index: -1}
+}
+
+// Next advances to the next item, fetching the next page when the current
+// one is exhausted. It returns false at the end or on error.
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	for it.index >= len(it.items) {
+		if it.last {
+			return false
+		}
+		items, total, next, err := it.fetch(it.ctx, it.page)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.items, it.index = items, 0
+
+		it.page.Offset += len(items)
+		it.page.Cursor = next
+		switch {
+		case len(items) == 0:
+			it.last = true
+			return false
+		case next != "":
+		case total > 0:
+			it.last = it.page.Offset >= total
+		default:
+			it.last = len(items) < it.page.Limit
+		}
+	}
+	return true
+}
+
+// Item returns the current item
+func (it *Iterator[T]) Item() T {
+	if it.index < 0 || it.index >= len(it.items) {
+		var zero T
+		return zero
+	}
+	return it.items[it.index]
+}
+
+// Err returns the error that stopped iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All drains the iterator into a slice
+func (it *Iterator[T]) All() ([]T, error) {
+	var result []T
+	for it.Next() {
+		result = append(result, it.Item())
+	}
+	return result, it.Err()
+}
+
+// ListWorkflowsIterator iterates over every workflow matching input,
+// starting at input's Offset or Cursor. Limit sets the page size.
+func (c *Client) ListWorkflowsIterator(ctx context.Context, input ListWorkflowsInput) *Iterator[WorkflowStatusResponse] {
+	start := pageRequest{Limit: input.Limit, Offset: input.Offset, Cursor: input.Cursor}
+	return newIterator(ctx, start, func(ctx context.Context, page pageRequest) ([]WorkflowStatusResponse, int, string, error) {
+		query := input
+		query.Limit, query.Offset, query.Cursor = page.Limit, page.Offset, page.Cursor
+		output, err := c.ListWorkflows(ctx, query)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return output.Workflows, output.Total, output.NextCursor, nil
+	})
+}
+
+// ListSavepointsInput contains parameters for listing a workflow's savepoints
+type ListSavepointsInput struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// ListSavepointsOutput contains one page of savepoints
+type ListSavepointsOutput struct {
+	Savepoints []SavepointInfo `json:"savepoints"`
+	Total      int             `json:"total"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// ListSavepoints lists one page of a workflow's savepoints
+func (c *Client) ListSavepoints(ctx context.Context, workflowID string, input ListSavepointsInput) (*ListSavepointsOutput, error) {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	if input.Limit > 0 {
+		params.Set("limit", fmt.Sprintf("%d", input.Limit))
+	}
+	if input.Cursor != "" {
+		params.Set("cursor", input.Cursor)
+	} else if input.Offset > 0 {
+		params.Set("offset", fmt.Sprintf("%d", input.Offset))
+	}
+
+	path := fmt.Sprintf("/v1/workflows/%s/savepoints", workflowID)
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, err := c.doRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result ListSavepointsOutput
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// SavepointsIterator iterates over every savepoint of a workflow
+func (c *Client) SavepointsIterator(ctx context.Context, workflowID string, input ListSavepointsInput) *Iterator[SavepointInfo] {
+	start := pageRequest{Limit: input.Limit, Offset: input.Offset, Cursor: input.Cursor}
+	return newIterator(ctx, start, func(ctx context.Context, page pageRequest) ([]SavepointInfo, int, string, error) {
+		output, err := c.ListSavepoints(ctx, workflowID, ListSavepointsInput{Limit: page.Limit, Offset: page.Offset, Cursor: page.Cursor})
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return output.Savepoints, output.Total, output.NextCursor, nil
+	})
+}
@@ -0,0 +1,200 @@
+package contd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// DefaultMaxJournalPayloadBytes is the largest step payload journaled inline
+const DefaultMaxJournalPayloadBytes = 256 * 1024
+
+// overflowPreviewBytes is how much of a truncated payload is kept inline
+const overflowPreviewBytes = 512
+
+// ArtifactStore stores large payloads outside the journal (claim-check)
+type ArtifactStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+}
+
+// ArtifactProvider is implemented by engines that support claim-check storage
+type ArtifactProvider interface {
+	Artifacts() ArtifactStore
+}
+
+// OverflowRef replaces a payload that exceeded the journaling limit
+type OverflowRef struct {
+	Truncated   bool   `json:"_truncated"`
+	Digest      string `json:"digest"`
+	ArtifactRef string `json:"artifact_ref"`
+	SizeBytes   int    `json:"size_bytes"`
+	Preview     string `json:"preview"`
+}
+
+// artifactStoreFor returns the engine's artifact store, if it has one
+func artifactStoreFor(engine Engine) ArtifactStore {
+	if p, ok := engineAs[ArtifactProvider](engine); ok {
+		return p.Artifacts()
+	}
+	return nil
+}
+
+// truncatePayload offloads payload to the artifact store when it exceeds limit.
+// It returns the value to journal inline and the overflow reference, if any.
+// On engines without an artifact store an oversized payload is journaled as
+// a truncated preview with no ArtifactRef, so restoring past it needs a
+// snapshot.
+func truncatePayload(engine Engine, workflowID, stepID string, payload interface{}, limit int) (interface{}, *OverflowRef, error) {
+	if limit <= 0 {
+		limit = DefaultMaxJournalPayloadBytes
+	}
+
+	// Most payloads are small plain values encoded without reflection. An
+	// oversized one keeps its buffer rather than being encoded again.
+	var data []byte
+	if buf, ok := pooledJSON(payload); ok {
+		if len(*buf) <= limit {
+			releaseJSON(buf)
+			return payload, nil, nil
+		}
+		data = *buf
+	} else {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		if len(data) <= limit {
+			return payload, nil, nil
+		}
+	}
+
+	hash := sha256.Sum256(data)
+	overflow := &OverflowRef{
+		Truncated: true,
+		Digest:    hex.EncodeToString(hash[:]),
+		SizeBytes: len(data),
+		Preview:   previewOf(data),
+	}
+	store := artifactStoreFor(engine)
+	if store == nil {
+		fmt.Printf("Warning: payload of step %s in workflow %s is %d bytes, over the %d byte journal limit; journaling a truncated preview as the engine has no artifact store\n", stepID, workflowID, len(data), limit)
+		return overflow, overflow, nil
+	}
+
+	overflow.ArtifactRef = fmt.Sprintf("%s/%s/%s", workflowID, stepID, overflow.Digest)
+	if err := store.Put(overflow.ArtifactRef, data); err != nil {
+		return nil, nil, NewPersistenceError("failed to store overflow payload", workflowID, map[string]interface{}{
+			"step_id":      stepID,
+			"artifact_ref": overflow.ArtifactRef,
+			"error":        err.Error(),
+		})
+	}
+	return overflow, overflow, nil
+}
+
+// previewOf returns the first overflowPreviewBytes of data, cut at a rune
+// boundary
+func previewOf(data []byte) string {
+	if len(data) <= overflowPreviewBytes {
+		return string(data)
+	}
+	end := overflowPreviewBytes
+	for end > 0 && !utf8.RuneStart(data[end]) {
+		end--
+	}
+	return string(data[:end])
+}
+
+// ResolveOverflow loads the full payload behind an overflow reference and
+// verifies it against the recorded digest
+func ResolveOverflow(engine Engine, ref *OverflowRef) (interface{}, error) {
+	if ref.ArtifactRef == "" {
+		return nil, NewPersistenceError("payload was journaled truncated, with no artifact holding it in full", "", map[string]interface{}{
+			"digest":     ref.Digest,
+			"size_bytes": ref.SizeBytes,
+		})
+	}
+	store := artifactStoreFor(engine)
+	if store == nil {
+		return nil, NewConfigurationError("engine does not support artifact storage", "artifacts")
+	}
+
+	data, err := store.Get(ref.ArtifactRef)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	if actual := hex.EncodeToString(hash[:]); actual != ref.Digest {
+		return nil, NewChecksumMismatch("", "artifact", ref.Digest, actual)
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return payload, nil
+}
+
+// RehydratePayload returns the full payload behind an overflow reference,
+// or payload itself if it was journaled inline
+func RehydratePayload(engine Engine, payload interface{}) (interface{}, error) {
+	if ref, ok := AsOverflowRef(payload); ok {
+		return ResolveOverflow(engine, ref)
+	}
+	return payload, nil
+}
+
+// offloadableEventFields are the journal event fields that may hold an
+// overflow reference
+var offloadableEventFields = []string{"state_delta", "result"}
+
+// RehydrateEvent returns a copy of a journal event with every offloaded
+// payload replaced by its full value
+func RehydrateEvent(engine Engine, event map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(event))
+	for k, v := range event {
+		result[k] = v
+	}
+	for _, field := range offloadableEventFields {
+		value, ok := event[field]
+		if !ok {
+			continue
+		}
+		payload, err := RehydratePayload(engine, value)
+		if err != nil {
+			return nil, err
+		}
+		result[field] = payload
+	}
+	return result, nil
+}
+
+// AsOverflowRef reports whether a journaled payload is an overflow reference
+func AsOverflowRef(payload interface{}) (*OverflowRef, bool) {
+	switch v := payload.(type) {
+	case *OverflowRef:
+		return v, v != nil
+	case map[string]interface{}:
+		if truncated, _ := v["_truncated"].(bool); !truncated {
+			return nil, false
+		}
+		ref := &OverflowRef{
+			Truncated:   true,
+			Digest:      getString(v, "digest"),
+			ArtifactRef: getString(v, "artifact_ref"),
+			Preview:     getString(v, "preview"),
+		}
+		switch size := v["size_bytes"].(type) {
+		case int:
+			ref.SizeBytes = size
+		case float64:
+			ref.SizeBytes = int(size)
+		}
+		return ref, true
+	}
+	return nil, false
+}
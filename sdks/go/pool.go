@@ -0,0 +1,373 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultPoolConcurrency is how many workflows a pool runs at once by default
+	DefaultPoolConcurrency = 10
+	// DefaultPoolQueueSize is how many workflows a pool queues by default
+	DefaultPoolQueueSize = 100
+	// DefaultPriorityAging is how long a queued workflow waits before its
+	// priority is raised by one
+	DefaultPriorityAging = 30 * time.Second
+)
+
+// WorkerPoolConfig configures a WorkerPool
+type WorkerPoolConfig struct {
+	// MaxConcurrent caps workflows running at once
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// MaxConcurrentByName caps running workflows per workflow name
+	MaxConcurrentByName map[string]int `json:"max_concurrent_by_name,omitempty"`
+	// QueueSize caps workflows waiting for a slot. When it is full Submit
+	// blocks and TrySubmit fails.
+	QueueSize int `json:"queue_size,omitempty"`
+	// DrainTimeout is how long Shutdown lets in-flight workflows finish
+	// before cancelling them, and how long the /drain endpoint lets their
+	// steps finish (0 uses DefaultCloseTimeout)
+	DrainTimeout time.Duration `json:"drain_timeout,omitempty"`
+	// PriorityAging raises a queued workflow's priority by one for each
+	// interval it waits, so low-priority work is not starved (0 uses
+	// DefaultPriorityAging)
+	PriorityAging time.Duration `json:"priority_aging,omitempty"`
+	// StickyCache keeps workflow state between runs on this pool
+	StickyCache *StickyCache `json:"-"`
+	// Registry runs jobs submitted without a Fn and validates their schemas
+	// (defaults to GlobalRegistry). Pools serving different versions of a
+	// workflow register each version's code under the same name.
+	Registry *Registry `json:"-"`
+	// StepRegistry resolves ExecuteStepByName (defaults to GlobalStepRegistry)
+	StepRegistry *StepRegistry `json:"-"`
+	// Capabilities are what this pool's workers offer; see
+	// WorkflowRunner.SetCapabilities
+	Capabilities []string `json:"capabilities,omitempty"`
+	// TaskQueues are the queues this pool serves; see
+	// WorkflowRunner.SetTaskQueues
+	TaskQueues []string `json:"task_queues,omitempty"`
+	// Semaphores enforces StepConfig.MaxConcurrent across the pool's
+	// workflows (defaults to GlobalSemaphores)
+	Semaphores *Semaphores `json:"-"`
+	// InputRecording decides which steps journal their input
+	InputRecording *InputRecording `json:"-"`
+	// HealthCheck checks the pool's connection for /readyz alongside the
+	// engine's HealthChecker, e.g. a wrapper around Client.Health
+	HealthCheck func(ctx context.Context) error `json:"-"`
+}
+
+// WorkflowJob is a workflow execution submitted to a WorkerPool
+type WorkflowJob struct {
+	WorkflowName string
+	// Fn runs the workflow; nil runs the pool registry's WorkflowName
+	Fn     WorkflowFunc
+	Input  interface{}
+	Config WorkflowConfig
+}
+
+// JobHandle tracks a submitted workflow
+type JobHandle struct {
+	WorkflowName string
+	done         chan struct{}
+	result       interface{}
+	err          error
+}
+
+// Done is closed once the workflow has finished or been rejected
+func (h *JobHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait blocks until the workflow finishes and returns its result
+func (h *JobHandle) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-h.done:
+		return h.result, h.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (h *JobHandle) finish(result interface{}, err error) {
+	h.result, h.err = result, err
+	close(h.done)
+}
+
+// PoolStats reports a pool's queue and the runtime stats of its workflows
+type PoolStats struct {
+	RuntimeStats
+	Queued        int            `json:"queued"`
+	Running       int            `json:"running"`
+	RunningByName map[string]int `json:"running_by_name"`
+	Completed     int64          `json:"completed"`
+	Failed        int64          `json:"failed"`
+}
+
+type poolJob struct {
+	job        WorkflowJob
+	handle     *JobHandle
+	queuedAt   time.Time
+	dispatched bool
+}
+
+// WorkerPool runs many workflows on one engine with bounded concurrency.
+// Submissions beyond MaxConcurrent wait in a bounded queue and start in
+// order of WorkflowConfig.Priority, first come first served within a
+// priority. Workflows whose name is at its limit wait without blocking
+// other names.
+type WorkerPool struct {
+	engine  Engine
+	config  WorkerPoolConfig
+	tracker *resourceTracker
+
+	// slots holds one token per queued workflow, providing backpressure
+	slots chan struct{}
+
+	mu            sync.Mutex
+	queue         []*poolJob
+	running       int
+	runningByName map[string]int
+	closed        bool
+	wg            sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	completed int64
+	failed    int64
+
+	// draining is closed by Drain to park workflows at their next step
+	draining  chan struct{}
+	drainOnce sync.Once
+}
+
+// NewWorkerPool creates a pool that runs workflows on engine
+func NewWorkerPool(engine Engine, config WorkerPoolConfig) *WorkerPool {
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = DefaultPoolConcurrency
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultPoolQueueSize
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = DefaultCloseTimeout
+	}
+	if config.PriorityAging <= 0 {
+		config.PriorityAging = DefaultPriorityAging
+	}
+	if config.Registry == nil {
+		config.Registry = GlobalRegistry
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &WorkerPool{
+		engine:        engine,
+		config:        config,
+		tracker:       &resourceTracker{},
+		slots:         make(chan struct{}, config.QueueSize),
+		runningByName: make(map[string]int),
+		draining:      make(chan struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Submit queues a workflow, blocking while the queue is full
+func (p *WorkerPool) Submit(ctx context.Context, job WorkflowJob) (*JobHandle, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-p.ctx.Done():
+		return nil, NewPoolClosed(job.WorkflowName)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return p.enqueue(job)
+}
+
+// TrySubmit queues a workflow, failing with a ConfigurationError when the
+// queue is full
+func (p *WorkerPool) TrySubmit(job WorkflowJob) (*JobHandle, error) {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return nil, NewConfigurationError("worker pool queue is full", "queue_size")
+	}
+	return p.enqueue(job)
+}
+
+func (p *WorkerPool) enqueue(job WorkflowJob) (*JobHandle, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		<-p.slots
+		return nil, NewPoolClosed(job.WorkflowName)
+	}
+	if queue := taskQueue(job.Config); !subscribed(p.config.TaskQueues, queue) {
+		<-p.slots
+		return nil, notSubscribed(queue)
+	}
+	if missing := missingCapabilities(job.Config.Requires, p.config.Capabilities); len(missing) > 0 {
+		<-p.slots
+		return nil, NewNoCapableWorker(job.Config.WorkflowID, "", job.Config.Requires, missing)
+	}
+	if job.Fn == nil {
+		fn, ok := p.config.Registry.Get(job.WorkflowName)
+		if !ok {
+			<-p.slots
+			return nil, NewConfigurationError(fmt.Sprintf("workflow %s is not registered", job.WorkflowName), "registry")
+		}
+		job.Fn = fn
+	}
+	handle := &JobHandle{WorkflowName: job.WorkflowName, done: make(chan struct{})}
+	p.queue = append(p.queue, &poolJob{job: job, handle: handle, queuedAt: time.Now()})
+	p.dispatch()
+	return handle, nil
+}
+
+// dispatch starts queued workflows, most urgent first, while slots are
+// free, skipping names at their limit. Callers must hold p.mu.
+func (p *WorkerPool) dispatch() {
+	now := time.Now()
+	order := make([]*poolJob, len(p.queue))
+	copy(order, p.queue)
+	sort.SliceStable(order, func(i, j int) bool {
+		return p.priority(order[i], now) > p.priority(order[j], now)
+	})
+	for _, queued := range order {
+		if p.running >= p.config.MaxConcurrent {
+			break
+		}
+		name := queued.job.WorkflowName
+		if limit, limited := p.config.MaxConcurrentByName[name]; limited && p.runningByName[name] >= limit {
+			continue
+		}
+		queued.dispatched = true
+		p.running++
+		p.runningByName[name]++
+		<-p.slots
+		p.wg.Add(1)
+		go p.execute(queued)
+	}
+
+	remaining := p.queue[:0]
+	for _, queued := range p.queue {
+		if !queued.dispatched {
+			remaining = append(remaining, queued)
+		}
+	}
+	for i := len(remaining); i < len(p.queue); i++ {
+		p.queue[i] = nil
+	}
+	p.queue = remaining
+}
+
+// priority is a queued workflow's priority, raised the longer it has waited
+func (p *WorkerPool) priority(queued *poolJob, now time.Time) int {
+	return queued.job.Config.Priority + int(now.Sub(queued.queuedAt)/p.config.PriorityAging)
+}
+
+func (p *WorkerPool) execute(queued *poolJob) {
+	defer p.wg.Done()
+	job := queued.job
+
+	runner := NewWorkflowRunner(p.engine, job.Config)
+	runner.tracker = p.tracker
+	runner.sticky = p.config.StickyCache
+	runner.capabilities = p.config.Capabilities
+	runner.taskQueues = p.config.TaskQueues
+	runner.steps = p.config.StepRegistry
+	runner.registry = p.config.Registry
+	runner.drain = p.draining
+	runner.semaphores = p.config.Semaphores
+	runner.inputs = p.config.InputRecording
+	result, err := runner.Run(p.ctx, job.WorkflowName, job.Fn, job.Input)
+	if err != nil {
+		atomic.AddInt64(&p.failed, 1)
+	} else {
+		atomic.AddInt64(&p.completed, 1)
+	}
+
+	p.mu.Lock()
+	p.running--
+	p.runningByName[job.WorkflowName]--
+	if p.runningByName[job.WorkflowName] == 0 {
+		delete(p.runningByName, job.WorkflowName)
+	}
+	if !p.closed {
+		p.dispatch()
+	}
+	p.mu.Unlock()
+
+	queued.handle.finish(result, err)
+}
+
+// load is how many workflows the pool has queued or running
+func (p *WorkerPool) load() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue) + p.running
+}
+
+// Stats returns the pool's queue depth, running counts and runtime stats
+func (p *WorkerPool) Stats() PoolStats {
+	p.mu.Lock()
+	stats := PoolStats{
+		Queued:        len(p.queue),
+		Running:       p.running,
+		RunningByName: make(map[string]int, len(p.runningByName)),
+	}
+	for name, n := range p.runningByName {
+		stats.RunningByName[name] = n
+	}
+	p.mu.Unlock()
+
+	stats.RuntimeStats = p.tracker.snapshot(p.engine)
+	stats.Completed = atomic.LoadInt64(&p.completed)
+	stats.Failed = atomic.LoadInt64(&p.failed)
+	return stats
+}
+
+// Shutdown stops accepting workflows and rejects queued ones with
+// PoolClosed. In-flight workflows get DrainTimeout to finish; after that
+// they are cancelled at their next step boundary and checkpointed so they
+// can be resumed elsewhere. It returns once every workflow has stopped or
+// ctx is done.
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	queued := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+
+	for _, rejected := range queued {
+		<-p.slots
+		rejected.handle.finish(nil, NewPoolClosed(rejected.job.WorkflowName))
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(p.config.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+		p.cancel(NewPoolClosed(""))
+		return p.tracker.waitIdle(p.engine, DefaultCloseTimeout)
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	p.cancel(NewPoolClosed(""))
+	select {
+	case <-drained:
+		return p.tracker.waitIdle(p.engine, DefaultCloseTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
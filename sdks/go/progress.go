@@ -0,0 +1,138 @@
+package contd
+
+import (
+	"context"
+	"time"
+)
+
+// Progress is what a workflow last reported about how far along it is
+type Progress struct {
+	// Percent is between 0 and 100
+	Percent   float64   `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetProgress reports how far along the workflow is, e.g. for a progress
+// bar, journaling it as a progress_updated event. Percent is clamped to
+// 0-100. Calls repeated while a resumed workflow catches up on steps it had
+// completed are not journaled again.
+func (ec *ExecutionContext) SetProgress(percent float64, message string) error {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	progress := &Progress{Percent: percent, Message: message, UpdatedAt: time.Now().UTC()}
+
+	catchingUp := ec.catchingUp()
+	ec.mu.Lock()
+	ec.progress = progress
+	engine := ec.engine
+	ec.mu.Unlock()
+
+	if engine == nil || catchingUp {
+		return nil
+	}
+	return appendEvent(engine, ec, "progress_updated", map[string]interface{}{
+		"percent":     percent,
+		"message":     message,
+		"step_number": ec.currentStep(),
+	})
+}
+
+// Progress returns what the workflow last reported with SetProgress in
+// this run, or nil
+func (ec *ExecutionContext) Progress() *Progress {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	if ec.progress == nil {
+		return nil
+	}
+	progress := *ec.progress
+	return &progress
+}
+
+// WorkflowWatchEvent is a change in a watched workflow's status. The last
+// event of a watch that failed carries Err.
+type WorkflowWatchEvent struct {
+	Status *WorkflowStatusResponse
+	Err    error
+}
+
+// WatchWorkflow polls a workflow's status, sending it whenever its status,
+// step, progress or last error changes, until the workflow reaches a
+// terminal status, a poll fails or ctx is done. The channel is then closed.
+func (c *Client) WatchWorkflow(ctx context.Context, workflowID string, opts WaitOptions) <-chan WorkflowWatchEvent {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	out := make(chan WorkflowWatchEvent, 1)
+
+	go func() {
+		defer close(out)
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+		send := func(event WorkflowWatchEvent) bool {
+			select {
+			case out <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var last *WorkflowStatusResponse
+		for {
+			status, err := c.GetStatus(ctx, workflowID)
+			if err != nil {
+				if ctx.Err() == nil {
+					send(WorkflowWatchEvent{Err: err})
+				}
+				return
+			}
+			if last == nil || statusChanged(last, status) {
+				if !send(WorkflowWatchEvent{Status: status}) {
+					return
+				}
+			}
+			if status.Status.IsTerminal() {
+				return
+			}
+			last = status
+
+			timer := time.NewTimer(interval)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// statusChanged reports whether a watcher should hear about b after a
+func statusChanged(a, b *WorkflowStatusResponse) bool {
+	if a.Status != b.Status || a.CurrentStep != b.CurrentStep || a.LastError != b.LastError {
+		return true
+	}
+	if (a.Progress == nil) != (b.Progress == nil) {
+		return true
+	}
+	return a.Progress != nil && (a.Progress.Percent != b.Progress.Percent || a.Progress.Message != b.Progress.Message)
+}
+
+// progressValue reads a progress_updated event
+func progressValue(event map[string]interface{}) *Progress {
+	progress := &Progress{Percent: getFloat(event, "percent"), Message: getString(event, "message")}
+	if ts, err := time.Parse(time.RFC3339, getString(event, "timestamp")); err == nil {
+		progress.UpdatedAt = ts
+	}
+	return progress
+}
@@ -0,0 +1,115 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Purger is implemented by engines that can irreversibly delete workflow
+// payloads. Purged journal events stay in place as tombstones, so the
+// journal keeps its order and step structure, and snapshots are
+// re-checksummed, so restoring and rebuilding a purged workflow still pass
+// their integrity checks.
+type Purger interface {
+	// PurgeWorkflow deletes every payload held for a workflow: variables,
+	// step results, inputs, signals, savepoints and artifacts
+	PurgeWorkflow(workflowID string) error
+	// PurgeVariables deletes the given variables from a workflow's
+	// snapshot, savepoints, completed steps and journaled deltas
+	PurgeVariables(workflowID string, keys []string) error
+}
+
+// tombstoneFields are the journal event fields a tombstone keeps: they
+// order and identify events but carry no workflow data
+var tombstoneFields = []string{
+	"event_id", "workflow_id", "org_id", "fencing_token", "timestamp", "event_type",
+	"step_id", "step_name", "step_number", "attempt_id", "savepoint_id", "annotation_id",
+	"duration_ms",
+}
+
+// TombstoneEvent returns a copy of a journal event with its payload
+// removed, keeping only the fields that identify and order it
+func TombstoneEvent(event map[string]interface{}) map[string]interface{} {
+	tombstone := map[string]interface{}{"purged": true}
+	for _, field := range tombstoneFields {
+		if v, ok := event[field]; ok {
+			tombstone[field] = v
+		}
+	}
+	return tombstone
+}
+
+// purgeStateVariables returns a copy of state without keys, re-checksummed.
+// With no keys, every variable is removed along with the metadata.
+func purgeStateVariables(state *WorkflowState, keys []string) *WorkflowState {
+	if state == nil {
+		return nil
+	}
+	cp := copyState(state)
+	if len(keys) == 0 {
+		cp.Variables = make(map[string]interface{})
+		cp.Metadata = make(map[string]interface{})
+	}
+	for _, key := range keys {
+		delete(cp.Variables, key)
+	}
+	cp.Checksum = ""
+	cp.Checksum = computeChecksum(cp)
+	return cp
+}
+
+// PurgeLocal irreversibly deletes a workflow's payloads from a local engine
+func PurgeLocal(engine Engine, workflowID string) error {
+	purger, ok := engineAs[Purger](engine)
+	if !ok {
+		return NewConfigurationError("engine does not support purging", "purge")
+	}
+	return purger.PurgeWorkflow(workflowID)
+}
+
+// PurgeVariablesLocal irreversibly deletes variables of a workflow from a
+// local engine
+func PurgeVariablesLocal(engine Engine, workflowID string, keys []string) error {
+	purger, ok := engineAs[Purger](engine)
+	if !ok {
+		return NewConfigurationError("engine does not support purging", "purge")
+	}
+	return purger.PurgeVariables(workflowID, keys)
+}
+
+// PurgeWorkflow irreversibly deletes every payload the server holds for a
+// workflow, keeping a tombstone of its history. The workflow must not be
+// running.
+func (c *Client) PurgeWorkflow(ctx context.Context, workflowID string) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/purge", workflowID), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PurgeVariables irreversibly deletes variables of a workflow from
+// everything the server holds for it
+func (c *Client) PurgeVariables(ctx context.Context, workflowID string, keys []string) error {
+	if len(keys) == 0 {
+		return NewConfigurationError("at least one variable is required", "keys")
+	}
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/purge-variables", workflowID), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,191 @@
+package contd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a token-bucket rate limiter
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a limiter refilling ratePerSecond tokens up to
+// burst. A rate of zero or less does not limit at all.
+func NewTokenBucket(ratePerSecond float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   ratePerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait for it
+func (b *TokenBucket) reserve() time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token that was not used
+func (b *TokenBucket) cancel() {
+	if b.rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Allow takes a token if one is available without waiting
+func (b *TokenBucket) Allow() bool {
+	if wait := b.reserve(); wait > 0 {
+		b.cancel()
+		return false
+	}
+	return true
+}
+
+// Wait blocks until a token is available or ctx is done
+func (b *TokenBucket) Wait(ctx context.Context) (time.Duration, error) {
+	wait := b.reserve()
+	if wait <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		b.cancel()
+		return 0, ctx.Err()
+	}
+}
+
+// RateLimits holds global, per-org and per-step limiters applied before a
+// step executes
+type RateLimits struct {
+	mu      sync.RWMutex
+	global  *TokenBucket
+	perOrg  map[string]*TokenBucket
+	perStep map[string]*TokenBucket
+}
+
+// NewRateLimits creates an empty set of limits
+func NewRateLimits() *RateLimits {
+	return &RateLimits{
+		perOrg:  make(map[string]*TokenBucket),
+		perStep: make(map[string]*TokenBucket),
+	}
+}
+
+// SetGlobal limits all steps executed by the runner. A rate of zero or
+// less removes the limit.
+func (l *RateLimits) SetGlobal(ratePerSecond float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ratePerSecond <= 0 {
+		l.global = nil
+		return
+	}
+	l.global = NewTokenBucket(ratePerSecond, burst)
+}
+
+// SetOrgLimit limits steps executed for an org. A rate of zero or less
+// removes the limit.
+func (l *RateLimits) SetOrgLimit(orgID string, ratePerSecond float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ratePerSecond <= 0 {
+		delete(l.perOrg, orgID)
+		return
+	}
+	l.perOrg[orgID] = NewTokenBucket(ratePerSecond, burst)
+}
+
+// SetStepLimit limits executions of a step name. A rate of zero or less
+// removes the limit.
+func (l *RateLimits) SetStepLimit(stepName string, ratePerSecond float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ratePerSecond <= 0 {
+		delete(l.perStep, stepName)
+		return
+	}
+	l.perStep[stepName] = NewTokenBucket(ratePerSecond, burst)
+}
+
+// Wait blocks until every applicable limiter admits the step and returns
+// the total time spent waiting
+func (l *RateLimits) Wait(ctx context.Context, orgID, stepName string) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	l.mu.RLock()
+	buckets := make([]*TokenBucket, 0, 3)
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+	if b, ok := l.perOrg[orgID]; ok {
+		buckets = append(buckets, b)
+	}
+	if b, ok := l.perStep[stepName]; ok {
+		buckets = append(buckets, b)
+	}
+	l.mu.RUnlock()
+
+	var total time.Duration
+	for _, b := range buckets {
+		waited, err := b.Wait(ctx)
+		if err != nil {
+			return total, err
+		}
+		total += waited
+	}
+	return total, nil
+}
+
+// throttle waits on the context's rate limits and journals any delay
+func throttle(ctx context.Context, engine Engine, ec *ExecutionContext, stepID, stepName string) error {
+	waited, err := ec.rateLimits.Wait(ctx, ec.OrgID, stepName)
+	if err != nil {
+		return err
+	}
+	if waited > 0 {
+		return appendEvent(engine, ec, "step_throttled", map[string]interface{}{
+			"step_id":   stepID,
+			"step_name": stepName,
+			"waited_ms": waited.Milliseconds(),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package contd
+
+import (
+	"fmt"
+)
+
+// StateRebuilder is implemented by engines that can reconstruct a
+// workflow's state from its journal when the snapshot is unusable
+type StateRebuilder interface {
+	RebuildState(workflowID string) (*WorkflowState, error)
+}
+
+// ReplayDeltas folds the state deltas of journaled step_completed events
+// over base, skipping steps base already includes. Offloaded deltas are
+// loaded from the engine's artifact store. A nil base starts from empty
+// state owned by the org its events were journaled in. Engines implementing
+// StateRebuilder can use it over their journal.
+func ReplayDeltas(engine Engine, workflowID string, base *WorkflowState, events []map[string]interface{}) (*WorkflowState, error) {
+	state := copyState(base)
+	if state == nil {
+		state = &WorkflowState{
+			WorkflowID: workflowID,
+			Variables:  make(map[string]interface{}),
+			Metadata:   make(map[string]interface{}),
+			Version:    "1.0",
+		}
+	}
+
+	stepNumber := state.StepNumber
+	for _, event := range events {
+		if getString(event, "workflow_id") != workflowID {
+			continue
+		}
+		if state.OrgID == "" {
+			state.OrgID = getString(event, "org_id")
+		}
+		// The first run's start stands in for metadata the snapshot lacks
+		if getString(event, "event_type") == "workflow_run_started" {
+			if _, ok := state.Metadata["started_at"]; !ok {
+				state.Metadata["started_at"] = getString(event, "timestamp")
+			}
+			continue
+		}
+		if getString(event, "event_type") != "step_completed" {
+			continue
+		}
+		// Events journaled before step numbers were recorded are counted
+		n, ok := event["step_number"].(int)
+		if !ok {
+			if f := getFloat(event, "step_number"); f > 0 {
+				n = int(f)
+			} else {
+				n = stepNumber + 1
+			}
+		}
+		if n <= state.StepNumber {
+			continue
+		}
+
+		delta, err := RehydratePayload(engine, event["state_delta"])
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := delta.(map[string]interface{}); ok {
+			for k, v := range m {
+				if v == nil {
+					delete(state.Variables, k)
+				} else {
+					state.Variables[k] = v
+				}
+			}
+		}
+		stepNumber = n
+		if v := int64(getFloat(event, "state_version")); v > state.StateVersion {
+			state.StateVersion = v
+		}
+	}
+
+	state.StepNumber = stepNumber
+	state.Checksum = ""
+	state.Checksum = computeChecksum(state)
+	return state, nil
+}
+
+// restoreState restores a workflow's snapshot, rebuilding it from the
+// journal when it is missing or fails its checksum
+func restoreState(engine Engine, workflowID string) (*WorkflowState, error) {
+	state, err := engine.Restore(workflowID)
+	if err == nil && state != nil {
+		if err = verifyChecksum(state, "snapshot"); err == nil {
+			return state, nil
+		}
+	}
+
+	rebuilder, ok := engineAs[StateRebuilder](engine)
+	if !ok {
+		if err == nil {
+			err = NewRecoveryFailed(workflowID, "snapshot is missing", false)
+		}
+		return nil, err
+	}
+	reason := "snapshot is missing"
+	if err != nil {
+		reason = err.Error()
+	}
+	fmt.Printf("Rebuilding state for %s from journal: %s\n", workflowID, reason)
+	return rebuilder.RebuildState(workflowID)
+}
@@ -0,0 +1,150 @@
+package contd
+
+import (
+	"time"
+)
+
+// SavepointRecorder accumulates an agent's epistemic state as it works.
+// Each savepoint created without explicit metadata captures what has been
+// recorded so far. ExecutionContext implements it.
+type SavepointRecorder interface {
+	SetGoal(summary string)
+	RecordHypothesis(hypothesis string)
+	DiscardHypothesis(hypothesis string)
+	OpenQuestion(question string)
+	CloseQuestion(question string)
+	RecordDecision(decision, rationale string)
+	SetNextStep(step string)
+}
+
+var _ SavepointRecorder = (*ExecutionContext)(nil)
+
+// SetGoal records what the agent is trying to achieve
+func (ec *ExecutionContext) SetGoal(summary string) {
+	ec.updateRecorded(func(m *SavepointMetadata) {
+		m.GoalSummary = summary
+	})
+}
+
+// RecordHypothesis adds a hypothesis the agent is working under
+func (ec *ExecutionContext) RecordHypothesis(hypothesis string) {
+	ec.updateRecorded(func(m *SavepointMetadata) {
+		m.Hypotheses = appendUnique(m.Hypotheses, hypothesis)
+	})
+}
+
+// DiscardHypothesis removes a hypothesis the agent has ruled out
+func (ec *ExecutionContext) DiscardHypothesis(hypothesis string) {
+	ec.updateRecorded(func(m *SavepointMetadata) {
+		m.Hypotheses = without(m.Hypotheses, hypothesis)
+	})
+}
+
+// OpenQuestion adds a question the agent has yet to answer
+func (ec *ExecutionContext) OpenQuestion(question string) {
+	ec.updateRecorded(func(m *SavepointMetadata) {
+		m.Questions = appendUnique(m.Questions, question)
+	})
+}
+
+// CloseQuestion removes an answered question
+func (ec *ExecutionContext) CloseQuestion(question string) {
+	ec.updateRecorded(func(m *SavepointMetadata) {
+		m.Questions = without(m.Questions, question)
+	})
+}
+
+// RecordDecision appends a decision and its rationale to the decision log
+func (ec *ExecutionContext) RecordDecision(decision, rationale string) {
+	ec.mu.RLock()
+	step := ec.stepCounter
+	ec.mu.RUnlock()
+	ec.updateRecorded(func(m *SavepointMetadata) {
+		m.Decisions = append(m.Decisions, map[string]interface{}{
+			"decision":    decision,
+			"rationale":   rationale,
+			"step_number": step,
+			"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		})
+	})
+}
+
+// SetNextStep records what the agent plans to do next
+func (ec *ExecutionContext) SetNextStep(step string) {
+	ec.updateRecorded(func(m *SavepointMetadata) {
+		m.NextStep = step
+	})
+}
+
+// RecordedMetadata returns the epistemic state recorded so far, or nil if
+// nothing has been recorded
+func (ec *ExecutionContext) RecordedMetadata() *SavepointMetadata {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return ec.recordedLocked()
+}
+
+// recordedLocked reads the recorded metadata from state metadata, where it
+// is kept so it survives resumes. Must be called with ec.mu held.
+func (ec *ExecutionContext) recordedLocked() *SavepointMetadata {
+	if ec.state == nil {
+		return nil
+	}
+	switch v := ec.state.Metadata["savepoint_metadata"].(type) {
+	case nil:
+		return nil
+	case SavepointMetadata:
+		return &v
+	default:
+		// Metadata restored from a snapshot is decoded generically
+		var m SavepointMetadata
+		if err := convert(nil, v, &m); err != nil {
+			return nil
+		}
+		return &m
+	}
+}
+
+// updateRecorded applies fn to a copy of the recorded metadata and stores
+// it, leaving the metadata captured by earlier savepoints untouched
+func (ec *ExecutionContext) updateRecorded(fn func(m *SavepointMetadata)) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.state == nil {
+		return
+	}
+	var m SavepointMetadata
+	if current := ec.recordedLocked(); current != nil {
+		m = SavepointMetadata{
+			GoalSummary: current.GoalSummary,
+			Hypotheses:  append([]string(nil), current.Hypotheses...),
+			Questions:   append([]string(nil), current.Questions...),
+			Decisions:   append([]map[string]interface{}(nil), current.Decisions...),
+			NextStep:    current.NextStep,
+		}
+	}
+	fn(&m)
+	if ec.state.Metadata == nil {
+		ec.state.Metadata = make(map[string]interface{})
+	}
+	ec.state.Metadata["savepoint_metadata"] = m
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
+
+func without(list []string, item string) []string {
+	result := list[:0]
+	for _, existing := range list {
+		if existing != item {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
@@ -0,0 +1,322 @@
+package contd
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultRedaction replaces redacted values when a rule sets none
+const DefaultRedaction = "[REDACTED]"
+
+// Redactor masks secrets and personal data in a payload before it leaves
+// the process. Payloads are passed in their JSON form: maps, slices,
+// strings, float64s, bools and nils. Redact must not modify value.
+type Redactor interface {
+	Redact(value interface{}) interface{}
+}
+
+// RedactorFunc adapts a function to Redactor
+type RedactorFunc func(value interface{}) interface{}
+
+// Redact calls f
+func (f RedactorFunc) Redact(value interface{}) interface{} {
+	return f(value)
+}
+
+// RedactionRule masks the values a path selects, or the parts of any
+// string matching a pattern. Set one of Path and Pattern.
+type RedactionRule struct {
+	// Path selects values like "$.user.email", "$.cards[*].number" or
+	// "$..password", where * matches any key or index and .. any depth
+	Path string
+	// Pattern is matched against every string value
+	Pattern *regexp.Regexp
+	// Replacement substitutes the value or match (defaults to
+	// DefaultRedaction)
+	Replacement string
+}
+
+// Common patterns for RedactionRule.Pattern
+var (
+	EmailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	CardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	BearerPattern     = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// RuleRedactor is a Redactor applying rules in order
+type RuleRedactor struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	path        []string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// NewRuleRedactor compiles rules into a Redactor
+func NewRuleRedactor(rules ...RedactionRule) (*RuleRedactor, error) {
+	r := &RuleRedactor{}
+	for _, rule := range rules {
+		if (rule.Path == "") == (rule.Pattern == nil) {
+			return nil, NewConfigurationError("a redaction rule needs exactly one of Path and Pattern", "redaction")
+		}
+		compiled := compiledRule{pattern: rule.Pattern, replacement: rule.Replacement}
+		if compiled.replacement == "" {
+			compiled.replacement = DefaultRedaction
+		}
+		if rule.Path != "" {
+			path, err := parseRedactionPath(rule.Path)
+			if err != nil {
+				return nil, err
+			}
+			compiled.path = path
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// parseRedactionPath splits a path into segments, with "**" standing for
+// any depth
+func parseRedactionPath(path string) ([]string, error) {
+	p := strings.TrimPrefix(path, "$")
+	p = strings.ReplaceAll(p, "[", ".")
+	p = strings.ReplaceAll(p, "]", "")
+	p = strings.ReplaceAll(p, "..", ".**.")
+	var segments []string
+	for _, segment := range strings.Split(p, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 || segments[len(segments)-1] == "**" {
+		return nil, NewConfigurationError("invalid redaction path "+strconv.Quote(path), "redaction")
+	}
+	return segments, nil
+}
+
+// Redact returns a copy of value with every rule applied
+func (r *RuleRedactor) Redact(value interface{}) interface{} {
+	for _, rule := range r.rules {
+		if rule.pattern != nil {
+			value = redactPattern(value, rule.pattern, rule.replacement)
+		} else {
+			value = redactPath(value, rule.path, rule.replacement)
+		}
+	}
+	return value
+}
+
+func redactPattern(value interface{}, pattern *regexp.Regexp, replacement string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return pattern.ReplaceAllLiteralString(v, replacement)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = redactPattern(item, pattern, replacement)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = redactPattern(item, pattern, replacement)
+		}
+		return out
+	}
+	return value
+}
+
+func redactPath(value interface{}, path []string, replacement string) interface{} {
+	if len(path) == 0 {
+		return replacement
+	}
+	segment, rest := path[0], path[1:]
+	if segment == "**" {
+		// Match the rest here, or descend and keep looking
+		value = redactPath(value, rest, replacement)
+		return mapChildren(value, func(_ string, child interface{}) interface{} {
+			return redactPath(child, path, replacement)
+		})
+	}
+	return mapChildren(value, func(key string, child interface{}) interface{} {
+		if segment == "*" || segment == key {
+			return redactPath(child, rest, replacement)
+		}
+		return child
+	})
+}
+
+// mapChildren copies a map or slice with fn applied to each element
+func mapChildren(value interface{}, fn func(key string, child interface{}) interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = fn(k, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = fn(strconv.Itoa(i), item)
+		}
+		return out
+	}
+	return value
+}
+
+// redactValue converts value to its JSON form and redacts it. Top-level
+// entries of a map the redactor left alone keep their original values, so
+// fields like a journal event's fencing token keep their Go types.
+func redactValue(redactor Redactor, value interface{}) interface{} {
+	var generic interface{}
+	if err := convert(nil, value, &generic); err != nil {
+		return DefaultRedaction
+	}
+	redacted := redactor.Redact(generic)
+	original, ok := value.(map[string]interface{})
+	if !ok {
+		return redacted
+	}
+	before, _ := generic.(map[string]interface{})
+	after, ok := redacted.(map[string]interface{})
+	if !ok {
+		return redacted
+	}
+	for k, v := range after {
+		if reflect.DeepEqual(v, before[k]) {
+			after[k] = original[k]
+		}
+	}
+	return after
+}
+
+// redactState returns a copy of state with its variables and metadata
+// redacted and its checksum recomputed
+func redactState(redactor Redactor, state *WorkflowState) *WorkflowState {
+	if state == nil {
+		return nil
+	}
+	cp := copyState(state)
+	if vars, ok := redactValue(redactor, cp.Variables).(map[string]interface{}); ok {
+		cp.Variables = vars
+	}
+	if meta, ok := redactValue(redactor, cp.Metadata).(map[string]interface{}); ok {
+		cp.Metadata = meta
+	}
+	cp.Checksum = ""
+	cp.Checksum = computeChecksum(cp)
+	return cp
+}
+
+// redactBody redacts a JSON request body, leaving it unchanged if it is
+// not JSON
+func redactBody(redactor Redactor, body []byte) []byte {
+	if redactor == nil || body == nil {
+		return body
+	}
+	var generic interface{}
+	if err := json.Unmarshal(body, &generic); err != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactor.Redact(generic))
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+// RedactingEngine wraps an engine so journal events, snapshots, savepoints
+// and cached step results are redacted before they are stored. Redacted
+// values are gone for good: a resumed workflow sees the masked values, so
+// redact only data it does not need after a restart.
+type RedactingEngine struct {
+	Engine
+	redactor Redactor
+}
+
+// NewRedactingEngine wraps engine so what it stores is redacted
+func NewRedactingEngine(engine Engine, redactor Redactor) *RedactingEngine {
+	return &RedactingEngine{Engine: engine, redactor: redactor}
+}
+
+// Unwrap returns the wrapped engine
+func (e *RedactingEngine) Unwrap() Engine {
+	return e.Engine
+}
+
+// Journal returns a journal that redacts events before appending them
+func (e *RedactingEngine) Journal() Journal {
+	return &redactingJournal{journal: e.Engine.Journal(), redactor: e.redactor}
+}
+
+// MaybeSnapshot snapshots a redacted copy of state
+func (e *RedactingEngine) MaybeSnapshot(state *WorkflowState) error {
+	return e.Engine.MaybeSnapshot(redactState(e.redactor, state))
+}
+
+// Idempotency returns an idempotency manager that redacts cached results
+func (e *RedactingEngine) Idempotency() IdempotencyManager {
+	return &redactingIdempotency{IdempotencyManager: e.Engine.Idempotency(), redactor: e.redactor}
+}
+
+// SaveSavepoint saves a redacted copy of state if the wrapped engine
+// supports savepoints
+func (e *RedactingEngine) SaveSavepoint(info SavepointInfo, state *WorkflowState) error {
+	store, ok := engineAs[SavepointStore](e.Engine)
+	if !ok {
+		return NewConfigurationError("engine does not support savepoints", "savepoints")
+	}
+	return store.SaveSavepoint(info, redactState(e.redactor, state))
+}
+
+// LoadSavepoint loads savepoint state from the wrapped engine
+func (e *RedactingEngine) LoadSavepoint(workflowID, savepointID string) (*SavepointInfo, *WorkflowState, error) {
+	store, ok := engineAs[SavepointStore](e.Engine)
+	if !ok {
+		return nil, nil, NewConfigurationError("engine does not support savepoint restore", "resume_from_savepoint")
+	}
+	return store.LoadSavepoint(workflowID, savepointID)
+}
+
+type redactingJournal struct {
+	journal  Journal
+	redactor Redactor
+}
+
+// Append redacts the event and appends it
+func (j *redactingJournal) Append(event interface{}) error {
+	return j.journal.Append(redactValue(j.redactor, event))
+}
+
+// QueueDepth reports the wrapped journal's queue depth
+func (j *redactingJournal) QueueDepth() int {
+	if q, ok := j.journal.(QueueDepther); ok {
+		return q.QueueDepth()
+	}
+	return 0
+}
+
+type redactingIdempotency struct {
+	IdempotencyManager
+	redactor Redactor
+}
+
+// MarkCompleted caches a redacted copy of the step's resulting state
+func (m *redactingIdempotency) MarkCompleted(workflowID, stepID string, attemptID int, state *WorkflowState) error {
+	return m.IdempotencyManager.MarkCompleted(workflowID, stepID, attemptID, redactState(m.redactor, state))
+}
+
+// InvalidateAfter forwards to the wrapped manager if it can invalidate
+func (m *redactingIdempotency) InvalidateAfter(workflowID string, stepNumber int) (int, error) {
+	inv, ok := m.IdempotencyManager.(IdempotencyInvalidator)
+	if !ok {
+		return 0, NewConfigurationError("idempotency manager cannot invalidate steps", "resume_from_savepoint")
+	}
+	return inv.InvalidateAfter(workflowID, stepNumber)
+}
@@ -1,13 +1,48 @@
 package contd
 
 import (
+	"sort"
 	"sync"
+	"time"
 )
 
 // Registry holds registered workflows
 type Registry struct {
 	mu        sync.RWMutex
 	workflows map[string]WorkflowFunc
+	schemas   map[string]WorkflowSchemas
+	options   map[string]WorkflowOptions
+}
+
+// WorkflowOptions describes a registered workflow
+type WorkflowOptions struct {
+	Version     string
+	Description string
+	// Config is used by StartWorkflow when the input carries no config
+	Config *WorkflowConfig
+	// InputSchema and OutputSchema are registered as with SetSchemas
+	InputSchema  *Schema
+	OutputSchema *Schema
+	// MaxDuration applies when the runner's config sets none
+	MaxDuration time.Duration
+}
+
+// WorkflowDescription is what a worker publishes about a registered
+// workflow
+type WorkflowDescription struct {
+	Name          string          `json:"name"`
+	Version       string          `json:"version,omitempty"`
+	Description   string          `json:"description,omitempty"`
+	Config        *WorkflowConfig `json:"config,omitempty"`
+	InputSchema   *Schema         `json:"input_schema,omitempty"`
+	OutputSchema  *Schema         `json:"output_schema,omitempty"`
+	MaxDurationMs int64           `json:"max_duration_ms,omitempty"`
+}
+
+// WorkflowSchemas holds the optional input and output schemas for a workflow
+type WorkflowSchemas struct {
+	Input  *Schema
+	Output *Schema
 }
 
 // GlobalRegistry is the default workflow registry
@@ -17,14 +52,87 @@ var GlobalRegistry = NewRegistry()
 func NewRegistry() *Registry {
 	return &Registry{
 		workflows: make(map[string]WorkflowFunc),
+		schemas:   make(map[string]WorkflowSchemas),
+		options:   make(map[string]WorkflowOptions),
 	}
 }
 
-// Register registers a workflow function
-func (r *Registry) Register(name string, fn WorkflowFunc) {
+// Register registers a workflow function, with options describing it
+func (r *Registry) Register(name string, fn WorkflowFunc, opts ...WorkflowOptions) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.workflows[name] = fn
+	delete(r.options, name)
+	for _, o := range opts {
+		r.options[name] = o
+		if o.InputSchema != nil || o.OutputSchema != nil {
+			r.schemas[name] = WorkflowSchemas{Input: o.InputSchema, Output: o.OutputSchema}
+		}
+	}
+}
+
+// Describe returns what is registered for a workflow
+func (r *Registry) Describe(name string) (*WorkflowDescription, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.workflows[name]; !ok {
+		return nil, false
+	}
+	opts := r.options[name]
+	schemas := r.schemas[name]
+	description := &WorkflowDescription{
+		Name:          name,
+		Version:       opts.Version,
+		Description:   opts.Description,
+		Config:        opts.Config,
+		InputSchema:   schemas.Input,
+		OutputSchema:  schemas.Output,
+		MaxDurationMs: opts.MaxDuration.Milliseconds(),
+	}
+	if description.MaxDurationMs == 0 && opts.Config != nil {
+		description.MaxDurationMs = opts.Config.MaxDuration.Milliseconds()
+	}
+	return description, true
+}
+
+// DescribeAll returns descriptions of every registered workflow, by name
+func (r *Registry) DescribeAll() []WorkflowDescription {
+	names := r.Names()
+	sort.Strings(names)
+	descriptions := make([]WorkflowDescription, 0, len(names))
+	for _, name := range names {
+		if d, ok := r.Describe(name); ok {
+			descriptions = append(descriptions, *d)
+		}
+	}
+	return descriptions
+}
+
+// defaultConfig returns a copy of a workflow's registered config, with its
+// registered MaxDuration applied, or nil if it has neither
+func (r *Registry) defaultConfig(name string) *WorkflowConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	opts := r.options[name]
+	if opts.Config == nil && opts.MaxDuration == 0 {
+		return nil
+	}
+	config := WorkflowConfig{}
+	if opts.Config != nil {
+		config = *opts.Config
+	}
+	if config.MaxDuration == 0 {
+		config.MaxDuration = opts.MaxDuration
+	}
+	return &config
+}
+
+// maxDuration returns a workflow's registered MaxDuration
+func (r *Registry) maxDuration(name string) time.Duration {
+	if config := r.defaultConfig(name); config != nil {
+		return config.MaxDuration
+	}
+	return 0
 }
 
 // Get retrieves a workflow function by name
@@ -59,11 +167,37 @@ func (r *Registry) Clear() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.workflows = make(map[string]WorkflowFunc)
+	r.schemas = make(map[string]WorkflowSchemas)
+	r.options = make(map[string]WorkflowOptions)
+}
+
+// SetSchemas registers input and output schemas for a workflow; either may be nil
+func (r *Registry) SetSchemas(name string, input, output *Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[name] = WorkflowSchemas{Input: input, Output: output}
+}
+
+// Schemas returns the schemas registered for a workflow
+func (r *Registry) Schemas(name string) WorkflowSchemas {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.schemas[name]
+}
+
+// ValidateInput validates a workflow input against its registered schema
+func (r *Registry) ValidateInput(name string, input interface{}) error {
+	return validatePayload(name, "input", r.Schemas(name).Input, input)
+}
+
+// ValidateOutput validates a workflow output against its registered schema
+func (r *Registry) ValidateOutput(name string, output interface{}) error {
+	return validatePayload(name, "output", r.Schemas(name).Output, output)
 }
 
 // RegisterWorkflow registers a workflow in the global registry
-func RegisterWorkflow(name string, fn WorkflowFunc) {
-	GlobalRegistry.Register(name, fn)
+func RegisterWorkflow(name string, fn WorkflowFunc, opts ...WorkflowOptions) {
+	GlobalRegistry.Register(name, fn, opts...)
 }
 
 // GetWorkflow retrieves a workflow from the global registry
@@ -0,0 +1,62 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestResumeReplaysStepIDs checks that a resumed workflow gives its steps
+// the IDs of the original run, so completed steps are served from cache
+// instead of running again
+func TestResumeReplaysStepIDs(t *testing.T) {
+	engine := NewInMemoryEngine()
+	calls := map[string]int{}
+	failLast := true
+	workflow := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		for _, name := range []string{"fetch", "transform", "store"} {
+			name := name
+			if _, err := Step(ctx, name, func(context.Context, interface{}) (interface{}, error) {
+				calls[name]++
+				if name == "store" && failLast {
+					return nil, errors.New("store unavailable")
+				}
+				return map[string]interface{}{name: true}, nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	if _, err := Execute(context.Background(), engine, "resume", workflow, nil, WithWorkflowID("resume-1")); err == nil {
+		t.Fatal("first run: expected the last step to fail")
+	}
+	failLast = false
+	if _, err := Execute(context.Background(), engine, "resume", workflow, nil, WithWorkflowID("resume-1")); err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+
+	want := map[string]int{"fetch": 1, "transform": 1, "store": 2}
+	for name, n := range want {
+		if calls[name] != n {
+			t.Errorf("step %s ran %d times, want %d", name, calls[name], n)
+		}
+	}
+
+	archive, err := ExportLocal(engine, "resume-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, event := range archive.Events {
+		if getString(event, "event_type") == "step_completed" {
+			ids[getString(event, "step_id")] = true
+		}
+	}
+	for _, id := range []string{"fetch_0", "transform_1", "store_2"} {
+		if !ids[id] {
+			t.Errorf("no step_completed event for %s; got %v", id, ids)
+		}
+	}
+}
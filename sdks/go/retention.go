@@ -0,0 +1,181 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy bounds how long an engine keeps workflow data. A zero TTL
+// keeps that data forever.
+type RetentionPolicy struct {
+	// JournalTTL is how long journal events are kept. Events of a running
+	// workflow are kept until it has a snapshot to resume from.
+	JournalTTL time.Duration
+	// SnapshotTTL is how long savepoint snapshots are kept
+	SnapshotTTL time.Duration
+	// CompletedWorkflowTTL is how long everything held for a workflow is
+	// kept once it completes, fails, is cancelled or terminated
+	CompletedWorkflowTTL time.Duration
+}
+
+// retentionWire is a RetentionPolicy as the API encodes it
+type retentionWire struct {
+	JournalTTLMs           int64 `json:"journal_ttl_ms"`
+	SnapshotTTLMs          int64 `json:"snapshot_ttl_ms"`
+	CompletedWorkflowTTLMs int64 `json:"completed_workflow_ttl_ms"`
+}
+
+func (p RetentionPolicy) wire() retentionWire {
+	return retentionWire{
+		JournalTTLMs:           p.JournalTTL.Milliseconds(),
+		SnapshotTTLMs:          p.SnapshotTTL.Milliseconds(),
+		CompletedWorkflowTTLMs: p.CompletedWorkflowTTL.Milliseconds(),
+	}
+}
+
+func (w retentionWire) policy() *RetentionPolicy {
+	return &RetentionPolicy{
+		JournalTTL:           time.Duration(w.JournalTTLMs) * time.Millisecond,
+		SnapshotTTL:          time.Duration(w.SnapshotTTLMs) * time.Millisecond,
+		CompletedWorkflowTTL: time.Duration(w.CompletedWorkflowTTLMs) * time.Millisecond,
+	}
+}
+
+// VacuumResult counts what a vacuum deleted
+type VacuumResult struct {
+	EventsDeleted     int `json:"events_deleted"`
+	SavepointsDeleted int `json:"savepoints_deleted"`
+	WorkflowsDeleted  int `json:"workflows_deleted"`
+}
+
+// Vacuumer is implemented by engines that can delete data a retention
+// policy no longer keeps
+type Vacuumer interface {
+	// Vacuum deletes what policy no longer keeps as of now
+	Vacuum(policy RetentionPolicy, now time.Time) (VacuumResult, error)
+}
+
+// VacuumLocal applies policy to a local engine once
+func VacuumLocal(engine Engine, policy RetentionPolicy) (*VacuumResult, error) {
+	vacuumer, ok := engineAs[Vacuumer](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support retention", "retention")
+	}
+	result, err := vacuumer.Vacuum(policy, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// VacuumConfig configures a VacuumJob
+type VacuumConfig struct {
+	Policy RetentionPolicy
+	// Interval is how often the engine is vacuumed (defaults to 1h)
+	Interval time.Duration
+}
+
+// VacuumJob applies a retention policy to a local engine periodically
+type VacuumJob struct {
+	vacuumer Vacuumer
+	config   VacuumConfig
+
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewVacuumJob starts vacuuming engine, first right away and then every
+// config.Interval
+func NewVacuumJob(engine Engine, config VacuumConfig) (*VacuumJob, error) {
+	vacuumer, ok := engineAs[Vacuumer](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support retention", "retention")
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	j := &VacuumJob{
+		vacuumer: vacuumer,
+		config:   config,
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go j.run()
+	return j, nil
+}
+
+func (j *VacuumJob) run() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+	for {
+		result, err := j.vacuumer.Vacuum(j.config.Policy, time.Now())
+		if err != nil {
+			fmt.Printf("Failed to vacuum engine: %v\n", err)
+		} else if result != (VacuumResult{}) {
+			fmt.Printf("Vacuumed %d events, %d savepoints and %d workflows\n", result.EventsDeleted, result.SavepointsDeleted, result.WorkflowsDeleted)
+		}
+		select {
+		case <-j.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops the job and waits for a vacuum in progress to finish or ctx
+// to be done
+func (j *VacuumJob) Close(ctx context.Context) error {
+	j.once.Do(func() { close(j.closed) })
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetRetention returns the org's retention policy on the server
+func (c *Client) GetRetention(ctx context.Context) (*RetentionPolicy, error) {
+	resp, err := c.doRequest(ctx, "GET", "/v1/retention", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result retentionWire
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.policy(), nil
+}
+
+// SetRetention replaces the org's retention policy on the server, which
+// enforces it with its own vacuum job
+func (c *Client) SetRetention(ctx context.Context, policy RetentionPolicy) (*RetentionPolicy, error) {
+	if policy.JournalTTL < 0 || policy.SnapshotTTL < 0 || policy.CompletedWorkflowTTL < 0 {
+		return nil, NewConfigurationError("retention TTLs must not be negative", "retention")
+	}
+	body, err := json.Marshal(policy.wire())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "PUT", "/v1/retention", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result retentionWire
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.policy(), nil
+}
@@ -0,0 +1,78 @@
+package contd
+
+import (
+	"errors"
+	"time"
+)
+
+// NonRetryable marks err as permanent, so retry policies give up on it at
+// once instead of spending their remaining attempts:
+//
+//	if resp.StatusCode == http.StatusBadRequest {
+//	    return nil, contd.NonRetryable(fmt.Errorf("invalid order: %s", body))
+//	}
+//
+// The returned error wraps err, so errors.Is and errors.As still see it.
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err: err}
+}
+
+// RetryableAfter asks retry policies to wait d before retrying err, in
+// place of their backoff, as when a vendor announces a maintenance window.
+// The retry still counts toward the policy's MaxAttempts.
+func RetryableAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, after: d}
+}
+
+// IsNonRetryable reports whether err, or an error it wraps, was marked with
+// NonRetryable or is an ApplicationFailure
+func IsNonRetryable(err error) bool {
+	var permanent *nonRetryableError
+	return errors.As(err, &permanent) || errors.Is(err, ErrApplicationFailure)
+}
+
+// deadLettered reports whether a step that failed with err on the given
+// attempt has failed permanently under policy
+func deadLettered(policy *RetryPolicy, attempt int, err error) bool {
+	if policy == nil || errors.Is(err, ErrApplicationFailure) {
+		return false
+	}
+	var permanent *nonRetryableError
+	return attempt >= policy.MaxAttempts || errors.As(err, &permanent)
+}
+
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string { return e.err.Error() }
+func (e *nonRetryableError) Unwrap() error { return e.err }
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// retryDelay is how long to wait before retrying err: the delay its step
+// asked for with RetryableAfter, otherwise the backoff, or longer if a
+// server rate limit asked for it
+func retryDelay(err error, backoff time.Duration) time.Duration {
+	var after *retryAfterError
+	if errors.As(err, &after) {
+		return after.after
+	}
+	var limited *RateLimited
+	if errors.As(err, &limited) && limited.RetryAfter > backoff {
+		return limited.RetryAfter
+	}
+	return backoff
+}
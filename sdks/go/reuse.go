@@ -0,0 +1,94 @@
+package contd
+
+import (
+	"fmt"
+)
+
+// IDReusePolicy decides whether a run may start under the ID of an earlier
+// one. Without a policy, running an existing ID always resumes it. With one,
+// a workflow that is still open is resumed as usual, and a closed workflow
+// (completed, failed or cancelled) is handled by the policy.
+type IDReusePolicy string
+
+const (
+	// IDReuseAllowDuplicate starts a new run once the previous one closed
+	IDReuseAllowDuplicate IDReusePolicy = "allow_duplicate"
+	// IDReuseRejectDuplicate never starts a second run under an ID
+	IDReuseRejectDuplicate IDReusePolicy = "reject_duplicate"
+	// IDReuseAllowDuplicateFailedOnly starts a new run only if the previous
+	// one failed or was cancelled
+	IDReuseAllowDuplicateFailedOnly IDReusePolicy = "allow_duplicate_failed_only"
+	// IDReuseTerminateIfRunning terminates an open run and starts a new one
+	IDReuseTerminateIfRunning IDReusePolicy = "terminate_if_running"
+)
+
+// WorkflowStatusStore is implemented by engines that track the status of
+// each workflow ID, which the runner needs to enforce IDReusePolicy
+type WorkflowStatusStore interface {
+	// WorkflowStatus returns the workflow's status, or "" if the ID is unused
+	WorkflowStatus(workflowID string) (WorkflowStatus, error)
+	SetWorkflowStatus(workflowID string, status WorkflowStatus) error
+	// ResetWorkflow discards the workflow's state, journal, completed steps
+	// and lease so its ID can start a new run. The fencing token is kept, so
+	// a terminated holder cannot write afterwards.
+	ResetWorkflow(workflowID string) error
+}
+
+// enforceIDReuse applies policy to an existing workflow ID, reporting
+// whether the run starts fresh rather than resuming
+func enforceIDReuse(engine Engine, workflowID string, policy IDReusePolicy) (bool, error) {
+	store, ok := engineAs[WorkflowStatusStore](engine)
+	if !ok {
+		return false, NewConfigurationError("engine does not track workflow status for IDReusePolicy", "id_reuse_policy")
+	}
+	status, err := store.WorkflowStatus(workflowID)
+	if err != nil {
+		return false, err
+	}
+	if status == "" {
+		return false, nil
+	}
+
+	var fresh bool
+	switch policy {
+	case IDReuseAllowDuplicate:
+		fresh = status.IsTerminal()
+	case IDReuseRejectDuplicate:
+		if status.IsTerminal() {
+			return false, NewWorkflowAlreadyExists(workflowID, status, policy)
+		}
+	case IDReuseAllowDuplicateFailedOnly:
+		if status == WorkflowStatusCompleted {
+			return false, NewWorkflowAlreadyExists(workflowID, status, policy)
+		}
+		fresh = status.IsTerminal()
+	case IDReuseTerminateIfRunning:
+		if !status.IsTerminal() {
+			if err := store.SetWorkflowStatus(workflowID, WorkflowStatusTerminated); err != nil {
+				return false, err
+			}
+			fmt.Printf("Terminated workflow %s to start a new run\n", workflowID)
+		}
+		fresh = true
+	default:
+		return false, NewConfigurationError(fmt.Sprintf("unknown IDReusePolicy %q", policy), "id_reuse_policy")
+	}
+
+	if fresh {
+		if err := store.ResetWorkflow(workflowID); err != nil {
+			return false, err
+		}
+	}
+	return fresh, nil
+}
+
+// recordStatus stores a workflow's status if the engine tracks it
+func recordStatus(engine Engine, workflowID string, status WorkflowStatus) {
+	store, ok := engineAs[WorkflowStatusStore](engine)
+	if !ok {
+		return
+	}
+	if err := store.SetWorkflowStatus(workflowID, status); err != nil {
+		fmt.Printf("Failed to record status %s for workflow %s: %v\n", status, workflowID, err)
+	}
+}
@@ -0,0 +1,130 @@
+package contd
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+)
+
+// RolloutTag is the tag recording which version a routed workflow started on
+const RolloutTag = "workflow_version"
+
+// RolloutSplit sends a share of a workflow's starts to the workers of one
+// version, which register that version's code and subscribe to TaskQueue
+type RolloutSplit struct {
+	Version   string `json:"version"`
+	TaskQueue string `json:"task_queue"`
+	// Weight is the split's share relative to the other splits' weights,
+	// e.g. 95 and 5 canary a version on 5% of starts
+	Weight int `json:"weight"`
+}
+
+// Rollout splits the starts of workflows across versions. Routing applies
+// only to starts without a TaskQueue; a started workflow keeps its queue,
+// so changing the splits affects new starts only and rolling back is a
+// matter of setting the old version's weight to everything. It is safe
+// for concurrent use.
+type Rollout struct {
+	mu     sync.RWMutex
+	splits map[string][]RolloutSplit
+}
+
+// NewRollout creates a rollout with no splits
+func NewRollout() *Rollout {
+	return &Rollout{splits: make(map[string][]RolloutSplit)}
+}
+
+// Set replaces the splits of a workflow's starts
+func (r *Rollout) Set(workflowName string, splits ...RolloutSplit) error {
+	total := 0
+	for _, split := range splits {
+		if split.Weight < 0 {
+			return NewConfigurationError(fmt.Sprintf("rollout of %s has negative weight for version %s", workflowName, split.Version), "rollout.weight")
+		}
+		total += split.Weight
+	}
+	if total == 0 {
+		return NewConfigurationError(fmt.Sprintf("rollout of %s needs a positive weight", workflowName), "rollout.weight")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.splits[workflowName] = append([]RolloutSplit(nil), splits...)
+	return nil
+}
+
+// Clear removes a workflow's splits, so its starts use their own TaskQueue
+func (r *Rollout) Clear(workflowName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.splits, workflowName)
+}
+
+// Splits returns a workflow's splits
+func (r *Rollout) Splits(workflowName string) []RolloutSplit {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]RolloutSplit(nil), r.splits[workflowName]...)
+}
+
+// Route picks the split for a start of workflowName. The same non-empty
+// key, such as the workflow ID, always picks the same split while the
+// splits are unchanged; an empty key picks at random.
+func (r *Rollout) Route(workflowName, key string) (RolloutSplit, bool) {
+	if r == nil {
+		return RolloutSplit{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	splits := r.splits[workflowName]
+	total := 0
+	for _, split := range splits {
+		total += split.Weight
+	}
+	if total == 0 {
+		return RolloutSplit{}, false
+	}
+
+	var n int
+	if key == "" {
+		n = rand.Intn(total)
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		n = int(h.Sum32() % uint32(total))
+	}
+	for _, split := range splits {
+		if n < split.Weight {
+			return split, true
+		}
+		n -= split.Weight
+	}
+	return splits[len(splits)-1], true
+}
+
+// route applies the rollout to a workflow started without a TaskQueue,
+// returning config routed to the chosen version
+func (r *Rollout) route(workflowName, key string, config WorkflowConfig) WorkflowConfig {
+	if config.TaskQueue != "" {
+		return config
+	}
+	split, ok := r.Route(workflowName, key)
+	if !ok {
+		return config
+	}
+	config.TaskQueue = split.TaskQueue
+	tags := make(map[string]string, len(config.Tags)+1)
+	for k, v := range config.Tags {
+		tags[k] = v
+	}
+	tags[RolloutTag] = split.Version
+	config.Tags = tags
+	return config
+}
+
+// SetRollout splits the starts submitted to the dispatcher across versions
+func (d *Dispatcher) SetRollout(rollout *Rollout) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rollout = rollout
+}
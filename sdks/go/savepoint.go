@@ -0,0 +1,103 @@
+package contd
+
+import (
+	"fmt"
+)
+
+// SavepointStore is implemented by engines that persist savepoint state,
+// enabling local time-travel via WorkflowConfig.ResumeFromSavepoint
+type SavepointStore interface {
+	SaveSavepoint(info SavepointInfo, state *WorkflowState) error
+	LoadSavepoint(workflowID, savepointID string) (*SavepointInfo, *WorkflowState, error)
+}
+
+// SavepointLister is implemented by savepoint stores that can list a
+// workflow's savepoints, oldest first
+type SavepointLister interface {
+	ListSavepoints(workflowID string) ([]SavepointInfo, error)
+}
+
+// IdempotencyInvalidator is implemented by idempotency managers that can
+// forget completed steps, so they re-execute after a rewind
+type IdempotencyInvalidator interface {
+	InvalidateAfter(workflowID string, stepNumber int) (int, error)
+}
+
+// copyState returns a copy of state whose Variables and Metadata maps are
+// not shared with the original
+func copyState(state *WorkflowState) *WorkflowState {
+	if state == nil {
+		return nil
+	}
+	cp := *state
+	cp.Variables = make(map[string]interface{}, len(state.Variables))
+	for k, v := range state.Variables {
+		cp.Variables[k] = v
+	}
+	cp.Metadata = make(map[string]interface{}, len(state.Metadata))
+	for k, v := range state.Metadata {
+		cp.Metadata[k] = v
+	}
+	return &cp
+}
+
+// verifyChecksum checks a state's checksum against its contents
+func verifyChecksum(state *WorkflowState, resourceType string) error {
+	if state.Checksum == "" {
+		return nil
+	}
+	unsigned := *state
+	unsigned.Checksum = ""
+	if actual := computeChecksum(&unsigned); actual != state.Checksum {
+		return NewChecksumMismatch(state.WorkflowID, resourceType, state.Checksum, actual)
+	}
+	return nil
+}
+
+// restoreFromSavepoint loads a savepoint's state, verifies it and rewinds
+// idempotency records past it
+func restoreFromSavepoint(engine Engine, ec *ExecutionContext, savepointID string) (*WorkflowState, error) {
+	store, ok := engineAs[SavepointStore](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support savepoint restore", "resume_from_savepoint")
+	}
+
+	info, state, err := store.LoadSavepoint(ec.WorkflowID, savepointID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, NewInvalidSavepoint(ec.WorkflowID, savepointID, "no state recorded for savepoint")
+	}
+	if state.WorkflowID != ec.WorkflowID {
+		return nil, NewInvalidSavepoint(ec.WorkflowID, savepointID, fmt.Sprintf("savepoint belongs to workflow %s", state.WorkflowID))
+	}
+	if err := verifyChecksum(state, "savepoint"); err != nil {
+		return nil, err
+	}
+
+	invalidated := 0
+	if inv, ok := engine.Idempotency().(IdempotencyInvalidator); ok {
+		if invalidated, err = inv.InvalidateAfter(ec.WorkflowID, state.StepNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := appendEvent(engine, ec, "resumed_from_savepoint", map[string]interface{}{
+		"savepoint_id":      savepointID,
+		"step_number":       info.StepNumber,
+		"invalidated_steps": invalidated,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Make the rewound state the latest snapshot for future restores,
+	// versioned past the state it replaces
+	if latest, err := engine.Restore(ec.WorkflowID); err == nil && latest != nil {
+		state = nextStateVersion(state, latest)
+	}
+	if err := engine.MaybeSnapshot(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
@@ -0,0 +1,168 @@
+package contd
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StartOptions delays the start of a workflow run. Set at most one field.
+type StartOptions struct {
+	// Delay starts the run this long after it is scheduled
+	Delay time.Duration
+	// At starts the run at this time; a time in the past starts it at once
+	At time.Time
+}
+
+// startTime returns when the run should start
+func (o StartOptions) startTime(now time.Time) (time.Time, error) {
+	if o.Delay != 0 && !o.At.IsZero() {
+		return time.Time{}, NewConfigurationError("set only one of Delay and At", "start_at")
+	}
+	if o.Delay < 0 {
+		return time.Time{}, NewConfigurationError("start delay must not be negative", "start_delay")
+	}
+	if !o.At.IsZero() {
+		return o.At, nil
+	}
+	return now.Add(o.Delay), nil
+}
+
+// ScheduledStart is a workflow run waiting for its start time
+type ScheduledStart struct {
+	WorkflowID string
+	StartAt    time.Time
+
+	mu        sync.Mutex
+	fired     bool
+	cancelled bool
+	cancel    chan struct{}
+	done      chan struct{}
+	result    interface{}
+	err       error
+}
+
+// Cancel stops the run from starting, reporting false if it already has
+func (s *ScheduledStart) Cancel() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fired || s.cancelled {
+		return s.cancelled
+	}
+	s.cancelled = true
+	close(s.cancel)
+	return true
+}
+
+// Wait waits for the run to finish and returns its result. A cancelled
+// start returns an error.
+func (s *ScheduledStart) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-s.done:
+		return s.result, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// scheduleSet holds a runner's pending scheduled starts
+type scheduleSet struct {
+	mu      sync.Mutex
+	pending map[*ScheduledStart]struct{}
+}
+
+func (s *scheduleSet) add(start *ScheduledStart) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[*ScheduledStart]struct{})
+	}
+	s.pending[start] = struct{}{}
+}
+
+func (s *scheduleSet) remove(start *ScheduledStart) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, start)
+}
+
+// cancelAll cancels every start that has not fired yet
+func (s *scheduleSet) cancelAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for start := range s.pending {
+		start.Cancel()
+	}
+}
+
+// Schedule enqueues a workflow run to start later. The schedule is journaled
+// as a workflow_scheduled event, and the run can be cancelled until it
+// starts. The timer lives in this process: Close cancels pending starts,
+// and a start still pending when the process exits does not fire.
+func (r *WorkflowRunner) Schedule(ctx context.Context, workflowName string, fn WorkflowFunc, input interface{}, opts StartOptions) (*ScheduledStart, error) {
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return nil, NewContdError("workflow runner is closed", r.config.WorkflowID, nil)
+	}
+	startAt, err := opts.startTime(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := r.registry.ValidateInput(workflowName, input); err != nil {
+		return nil, err
+	}
+
+	workflowID := r.config.WorkflowID
+	if workflowID == "" {
+		workflowID = newWorkflowID()
+	}
+	ec := NewExecutionContext(workflowID, r.config.OrgID, workflowName, r.config.Tags)
+	if err := appendEvent(r.engine, ec, "workflow_scheduled", map[string]interface{}{
+		"workflow_name": workflowName,
+		"start_at":      startAt.UTC().Format(time.RFC3339Nano),
+	}); err != nil {
+		return nil, err
+	}
+	recordStatus(r.engine, workflowID, WorkflowStatusPending)
+
+	s := &ScheduledStart{
+		WorkflowID: workflowID,
+		StartAt:    startAt,
+		cancel:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	runner := *r
+	runner.config.WorkflowID = workflowID
+	r.schedules.add(s)
+
+	go func() {
+		defer close(s.done)
+		defer r.schedules.remove(s)
+		timer := time.NewTimer(time.Until(startAt))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			s.Cancel()
+		case <-s.cancel:
+		}
+
+		s.mu.Lock()
+		if !s.cancelled {
+			s.fired = true
+		}
+		s.mu.Unlock()
+		if !s.fired {
+			appendEvent(r.engine, ec, "workflow_schedule_cancelled", nil)
+			recordStatus(r.engine, workflowID, WorkflowStatusCancelled)
+			s.err = NewContdError("Scheduled start was cancelled", workflowID, nil)
+			return
+		}
+		if atomic.LoadInt32(&r.closed) == 1 {
+			s.err = NewContdError("workflow runner is closed", workflowID, nil)
+			return
+		}
+		s.result, s.err = runner.Run(ctx, workflowName, fn, input)
+	}()
+	return s, nil
+}
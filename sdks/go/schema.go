@@ -0,0 +1,255 @@
+package contd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Schema is a JSON Schema document. The supported subset covers type,
+// properties, required, additionalProperties, items, enum, minimum/maximum,
+// minLength/maxLength, minItems/maxItems and pattern.
+type Schema struct {
+	Type                 interface{}        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// ParseSchema parses a JSON Schema document
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	return &s, nil
+}
+
+// FieldViolation describes a single schema violation
+type FieldViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Validate checks a value against the schema and returns all violations.
+// Values are normalized through JSON so structs validate like their encoding.
+func (s *Schema) Validate(value interface{}) ([]FieldViolation, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal value: %w", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("failed to decode value: %w", err)
+	}
+
+	var violations []FieldViolation
+	s.validate("$", generic, &violations)
+	return violations, nil
+}
+
+func (s *Schema) validate(path string, value interface{}, violations *[]FieldViolation) {
+	if s == nil {
+		return
+	}
+	add := func(format string, args ...interface{}) {
+		*violations = append(*violations, FieldViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := s.types(); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			add("expected %s, got %s", joinTypes(types), jsonType(value))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, candidate := range s.Enum {
+			if enumEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("value %v is not one of %v", value, s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				*violations = append(*violations, FieldViolation{Path: path + "." + key, Message: "required field is missing"})
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(path+"."+k, v[k], violations)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*violations = append(*violations, FieldViolation{Path: path + "." + k, Message: "additional property not allowed"})
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			add("expected at least %d items, got %d", *s.MinItems, len(v))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add("expected at most %d items, got %d", *s.MaxItems, len(v))
+		}
+		for i, item := range v {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, violations)
+		}
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			add("expected length >= %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && len([]rune(v)) > *s.MaxLength {
+			add("expected length <= %d", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := compilePattern(s.Pattern)
+			if err != nil {
+				add("invalid pattern %q: %v", s.Pattern, err)
+			} else if !re.MatchString(v) {
+				add("value does not match pattern %q", s.Pattern)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			add("expected value >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			add("expected value <= %v", *s.Maximum)
+		}
+	}
+}
+
+// enumEqual reports whether value equals an enum candidate as JSON, so the
+// string "1" and the number 1 differ but the ints and floats a schema built
+// in Go may hold still match decoded numbers
+func enumEqual(candidate, value interface{}) bool {
+	a, err := json.Marshal(candidate)
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
+}
+
+// compiledPattern is a schema pattern compiled once
+type compiledPattern struct {
+	re  *regexp.Regexp
+	err error
+}
+
+// patterns caches compiled schema patterns by source
+var patterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patterns.Load(pattern); ok {
+		c := cached.(*compiledPattern)
+		return c.re, c.err
+	}
+	re, err := regexp.Compile(pattern)
+	patterns.Store(pattern, &compiledPattern{re: re, err: err})
+	return re, err
+}
+
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	case []string:
+		return t
+	}
+	return nil
+}
+
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == t
+	}
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
+
+// validatePayload validates a workflow payload against an optional schema
+func validatePayload(workflowName, direction string, schema *Schema, value interface{}) error {
+	if schema == nil {
+		return nil
+	}
+	violations, err := schema.Validate(value)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return NewValidationError(workflowName, direction, violations)
+	}
+	return nil
+}
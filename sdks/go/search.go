@@ -0,0 +1,222 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchAttributeType is the indexed type of a search attribute
+type SearchAttributeType string
+
+const (
+	SearchAttributeInt         SearchAttributeType = "int"
+	SearchAttributeFloat       SearchAttributeType = "float"
+	SearchAttributeTime        SearchAttributeType = "time"
+	SearchAttributeKeyword     SearchAttributeType = "keyword"
+	SearchAttributeKeywordList SearchAttributeType = "keyword_list"
+)
+
+// SearchAttribute is a typed, indexed workflow field that ListWorkflows
+// can filter on. Create one with IntAttribute, FloatAttribute, TimeAttribute,
+// KeywordAttribute or KeywordListAttribute.
+type SearchAttribute struct {
+	Type  SearchAttributeType `json:"type"`
+	Value interface{}         `json:"value"`
+}
+
+// IntAttribute returns an integer search attribute
+func IntAttribute(v int64) SearchAttribute {
+	return SearchAttribute{Type: SearchAttributeInt, Value: v}
+}
+
+// FloatAttribute returns a floating-point search attribute
+func FloatAttribute(v float64) SearchAttribute {
+	return SearchAttribute{Type: SearchAttributeFloat, Value: v}
+}
+
+// TimeAttribute returns a timestamp search attribute
+func TimeAttribute(v time.Time) SearchAttribute {
+	return SearchAttribute{Type: SearchAttributeTime, Value: v.UTC().Format(time.RFC3339Nano)}
+}
+
+// KeywordAttribute returns an exact-match string search attribute
+func KeywordAttribute(v string) SearchAttribute {
+	return SearchAttribute{Type: SearchAttributeKeyword, Value: v}
+}
+
+// KeywordListAttribute returns a search attribute matching any of its keywords
+func KeywordListAttribute(v ...string) SearchAttribute {
+	return SearchAttribute{Type: SearchAttributeKeywordList, Value: v}
+}
+
+// SearchAttributeSyncer receives search attribute changes made during
+// workflow execution
+type SearchAttributeSyncer interface {
+	UpsertSearchAttributes(ctx context.Context, workflowID string, attrs map[string]SearchAttribute) error
+}
+
+// UpsertSearchAttributes sets search attributes on the workflow. Changes are
+// pushed to the server at the next checkpoint when the runner has a
+// SearchAttributeSyncer.
+func (ec *ExecutionContext) UpsertSearchAttributes(attrs map[string]SearchAttribute) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if ec.pendingSearchAttrs == nil {
+		ec.pendingSearchAttrs = make(map[string]SearchAttribute)
+	}
+	for k, v := range attrs {
+		ec.pendingSearchAttrs[k] = v
+	}
+
+	if ec.state != nil {
+		metadata := ec.state.Metadata
+		if metadata == nil {
+			metadata = make(map[string]interface{})
+		}
+		current, _ := metadata["search_attributes"].(map[string]SearchAttribute)
+		if current == nil {
+			// Attributes restored from a snapshot are decoded generically
+			if restored, ok := metadata["search_attributes"]; ok {
+				convert(nil, restored, &current)
+			}
+			if current == nil {
+				current = make(map[string]SearchAttribute)
+			}
+		}
+		for k, v := range attrs {
+			current[k] = v
+		}
+		metadata["search_attributes"] = current
+		ec.state.Metadata = metadata
+	}
+}
+
+// syncSearchAttributes pushes search attribute changes made since the last
+// sync. Failed pushes are kept and retried at the next checkpoint.
+func (ec *ExecutionContext) syncSearchAttributes(ctx context.Context) {
+	ec.mu.Lock()
+	pending := ec.pendingSearchAttrs
+	syncer := ec.searchAttrSyncer
+	if syncer == nil || len(pending) == 0 {
+		ec.mu.Unlock()
+		return
+	}
+	ec.pendingSearchAttrs = nil
+	ec.mu.Unlock()
+
+	if err := syncer.UpsertSearchAttributes(ctx, ec.WorkflowID, pending); err != nil {
+		fmt.Printf("Failed to sync search attributes for workflow %s: %v\n", ec.WorkflowID, err)
+		ec.mu.Lock()
+		if ec.pendingSearchAttrs == nil {
+			ec.pendingSearchAttrs = make(map[string]SearchAttribute)
+		}
+		for k, v := range pending {
+			if _, newer := ec.pendingSearchAttrs[k]; !newer {
+				ec.pendingSearchAttrs[k] = v
+			}
+		}
+		ec.mu.Unlock()
+	}
+}
+
+// UpsertSearchAttributes merges search attributes into a workflow's on the server
+func (c *Client) UpsertSearchAttributes(ctx context.Context, workflowID string, attrs map[string]SearchAttribute) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"search_attributes": attrs})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "PATCH", fmt.Sprintf("/v1/workflows/%s/search_attributes", workflowID), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SearchCondition is a ListWorkflows query over search attributes, e.g.
+// And(Attr("cost").Gt(10), Attr("model").Eq("gpt-4"))
+type SearchCondition string
+
+// String returns the query text for ListWorkflowsInput.Query
+func (c SearchCondition) String() string {
+	return string(c)
+}
+
+// SearchField is a search attribute referenced in a query
+type SearchField string
+
+// Attr references a search attribute by name
+func Attr(name string) SearchField {
+	return SearchField(name)
+}
+
+// Eq matches workflows whose attribute equals v
+func (f SearchField) Eq(v interface{}) SearchCondition { return f.compare("=", v) }
+
+// Ne matches workflows whose attribute differs from v
+func (f SearchField) Ne(v interface{}) SearchCondition { return f.compare("!=", v) }
+
+// Gt matches workflows whose attribute is greater than v
+func (f SearchField) Gt(v interface{}) SearchCondition { return f.compare(">", v) }
+
+// Gte matches workflows whose attribute is at least v
+func (f SearchField) Gte(v interface{}) SearchCondition { return f.compare(">=", v) }
+
+// Lt matches workflows whose attribute is less than v
+func (f SearchField) Lt(v interface{}) SearchCondition { return f.compare("<", v) }
+
+// Lte matches workflows whose attribute is at most v
+func (f SearchField) Lte(v interface{}) SearchCondition { return f.compare("<=", v) }
+
+// Contains matches workflows whose keyword list includes v
+func (f SearchField) Contains(v string) SearchCondition { return f.compare("contains", v) }
+
+func (f SearchField) compare(op string, v interface{}) SearchCondition {
+	return SearchCondition(fmt.Sprintf("%s %s %s", f, op, searchLiteral(v)))
+}
+
+// And matches workflows satisfying every condition
+func And(conds ...SearchCondition) SearchCondition {
+	return joinConditions(" && ", conds)
+}
+
+// Or matches workflows satisfying at least one condition
+func Or(conds ...SearchCondition) SearchCondition {
+	return joinConditions(" || ", conds)
+}
+
+func joinConditions(sep string, conds []SearchCondition) SearchCondition {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	parts := make([]string, len(conds))
+	for i, c := range conds {
+		parts[i] = string(c)
+	}
+	return SearchCondition("(" + strings.Join(parts, sep) + ")")
+}
+
+// searchLiteral formats a value for a query, quoting strings and times
+func searchLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case time.Time:
+		return strconv.Quote(v.UTC().Format(time.RFC3339Nano))
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
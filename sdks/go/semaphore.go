@@ -0,0 +1,203 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Semaphore is a weighted semaphore that admits waiters in FIFO order
+type Semaphore struct {
+	mu       sync.Mutex
+	capacity int64
+	held     int64
+	waiters  []*semaphoreWaiter
+}
+
+type semaphoreWaiter struct {
+	weight int64
+	ready  chan struct{}
+}
+
+// NewSemaphore creates a semaphore admitting up to capacity units at once
+func NewSemaphore(capacity int64) *Semaphore {
+	return &Semaphore{capacity: capacity}
+}
+
+// Acquire blocks until weight units are free or ctx is done. A weight
+// above the capacity fails with a ConfigurationError rather than blocking
+// forever.
+func (s *Semaphore) Acquire(ctx context.Context, weight int64) error {
+	s.mu.Lock()
+	if weight > s.capacity {
+		s.mu.Unlock()
+		return NewConfigurationError(fmt.Sprintf("weight %d exceeds semaphore capacity %d", weight, s.capacity), "max_concurrent")
+	}
+	if len(s.waiters) == 0 && s.held+weight <= s.capacity {
+		s.held += weight
+		s.mu.Unlock()
+		return nil
+	}
+	waiter := &semaphoreWaiter{weight: weight, ready: make(chan struct{})}
+	s.waiters = append(s.waiters, waiter)
+	s.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-waiter.ready:
+			// Admitted while giving up; hand the units back
+			s.held -= weight
+		default:
+			for i, w := range s.waiters {
+				if w == waiter {
+					s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		s.admit()
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes weight units if they are free without waiting
+func (s *Semaphore) TryAcquire(weight int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiters) > 0 || s.held+weight > s.capacity {
+		return false
+	}
+	s.held += weight
+	return true
+}
+
+// Release returns weight units and admits waiters they make room for
+func (s *Semaphore) Release(weight int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held -= weight
+	if s.held < 0 {
+		panic("contd: semaphore released more than held")
+	}
+	s.admit()
+}
+
+// setCapacity changes the capacity, admitting waiters if it grew
+func (s *Semaphore) setCapacity(capacity int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capacity = capacity
+	s.admit()
+}
+
+// admit wakes waiters in order while they fit. Callers must hold s.mu.
+func (s *Semaphore) admit() {
+	for len(s.waiters) > 0 {
+		next := s.waiters[0]
+		if s.held+next.weight > s.capacity {
+			return
+		}
+		s.held += next.weight
+		s.waiters[0] = nil
+		s.waiters = s.waiters[1:]
+		close(next.ready)
+	}
+}
+
+// Semaphores holds the named semaphores that cap concurrent steps across
+// every workflow a worker runs
+type Semaphores struct {
+	mu    sync.Mutex
+	named map[string]*Semaphore
+}
+
+// GlobalSemaphores is the default set of step semaphores
+var GlobalSemaphores = NewSemaphores()
+
+// NewSemaphores creates an empty set of semaphores
+func NewSemaphores() *Semaphores {
+	return &Semaphores{named: make(map[string]*Semaphore)}
+}
+
+// SetLimit sets the capacity of the named semaphore, overriding the
+// MaxConcurrent of steps that use it
+func (s *Semaphores) SetLimit(name string, capacity int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sem, ok := s.named[name]; ok {
+		sem.setCapacity(capacity)
+		return
+	}
+	s.named[name] = NewSemaphore(capacity)
+}
+
+// Get returns the named semaphore, creating it with capacity if it does
+// not exist yet
+func (s *Semaphores) Get(name string, capacity int64) *Semaphore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.named[name]
+	if !ok {
+		sem = NewSemaphore(capacity)
+		s.named[name] = sem
+	}
+	return sem
+}
+
+// concurrencyKey is the semaphore a step's MaxConcurrent applies to
+func (r *StepRunner) concurrencyKey(stepName string) string {
+	if r.config.ConcurrencyKey != "" {
+		return r.config.ConcurrencyKey
+	}
+	return stepName
+}
+
+// acquireSlot waits for room under the step's MaxConcurrent, journaling
+// any delay, and returns the func that releases the slot
+func (r *StepRunner) acquireSlot(ctx context.Context, engine Engine, ec *ExecutionContext, stepID, stepName string) (func(), error) {
+	if r.config.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	semaphores := ec.semaphores
+	if semaphores == nil {
+		semaphores = GlobalSemaphores
+	}
+	weight := int64(r.config.ConcurrencyWeight)
+	if weight <= 0 {
+		weight = 1
+	}
+	sem := semaphores.Get(r.concurrencyKey(stepName), int64(r.config.MaxConcurrent))
+	if sem.TryAcquire(weight) {
+		return func() { sem.Release(weight) }, nil
+	}
+
+	ec.updateActivity(stepID, stepName, func(a *PendingActivity) { a.Kind = ActivityConcurrency })
+	start := time.Now()
+	if err := sem.Acquire(ctx, weight); err != nil {
+		return nil, err
+	}
+	ec.updateActivity(stepID, stepName, func(a *PendingActivity) { a.Kind = ActivityStep })
+	release := func() { sem.Release(weight) }
+	if err := appendEvent(engine, ec, "step_concurrency_waited", map[string]interface{}{
+		"step_id":         stepID,
+		"step_name":       stepName,
+		"concurrency_key": r.concurrencyKey(stepName),
+		"waited_ms":       time.Since(start).Milliseconds(),
+	}); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// SetSemaphores sets the semaphores enforcing StepConfig.MaxConcurrent
+// (defaults to GlobalSemaphores, shared by every runner in the process)
+func (r *WorkflowRunner) SetSemaphores(semaphores *Semaphores) {
+	r.semaphores = semaphores
+}
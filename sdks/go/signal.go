@@ -0,0 +1,173 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Signal is a named message delivered to a running workflow
+type Signal struct {
+	Name    string      `json:"signal_name"`
+	Payload interface{} `json:"payload,omitempty"`
+	SentAt  time.Time   `json:"sent_at"`
+}
+
+// SignalStore is implemented by engines that keep a workflow's signals.
+// Signals are never removed; each workflow tracks how many of each name it
+// has received, so receiving is deterministic across resumes.
+type SignalStore interface {
+	SendSignal(workflowID string, signal Signal) error
+	// SignalAt returns the index'th signal named name sent to the workflow,
+	// or nil if it has not been sent yet
+	SignalAt(workflowID, name string, index int) (*Signal, error)
+}
+
+// signalCursor is the per-name receive position kept in workflow variables
+type signalCursor struct {
+	Next     int         `json:"next"`
+	Received bool        `json:"received"`
+	Payload  interface{} `json:"payload,omitempty"`
+}
+
+func signalKey(name string) string {
+	return "_signals." + name
+}
+
+// SignalLocal sends a signal to a workflow of a local engine
+func SignalLocal(engine Engine, workflowID, name string, payload interface{}) error {
+	store, ok := engineAs[SignalStore](engine)
+	if !ok {
+		return NewConfigurationError("engine does not support signals", "signal")
+	}
+	return store.SendSignal(workflowID, Signal{Name: name, Payload: payload, SentAt: time.Now().UTC()})
+}
+
+// ReceiveSignal takes the next signal named name sent to the workflow,
+// decoding its payload into T. It reports false when none is waiting. The
+// receive runs as a step, so a resumed workflow sees the same signals in
+// the same order.
+func ReceiveSignal[T any](ctx context.Context, name string) (T, bool, error) {
+	var out T
+	ec, err := Current(ctx)
+	if err != nil {
+		return out, false, err
+	}
+	store, ok := engineAs[SignalStore](ec.GetEngine())
+	if !ok {
+		return out, false, NewConfigurationError("engine does not support signals", "signal")
+	}
+
+	key := signalKey(name)
+	_, err = NewStepRunner(DefaultStepConfig()).Run(ctx, "signal:"+name, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		cursor, _ := Get[signalCursor](ec, key)
+		signal, err := store.SignalAt(ec.WorkflowID, name, cursor.Next)
+		if err != nil {
+			return nil, err
+		}
+		if signal == nil {
+			cursor.Received, cursor.Payload = false, nil
+		} else {
+			cursor.Next++
+			cursor.Received, cursor.Payload = true, signal.Payload
+		}
+		ec.Set(key, cursor)
+		return nil, nil
+	}, nil)
+	if err != nil {
+		return out, false, err
+	}
+
+	cursor, err := Get[signalCursor](ec, key)
+	if err != nil || !cursor.Received {
+		return out, false, err
+	}
+	if typed, ok := cursor.Payload.(T); ok {
+		return typed, true, nil
+	}
+	if err := convert(nil, cursor.Payload, &out); err != nil {
+		return out, false, fmt.Errorf("signal %q: %w", name, err)
+	}
+	return out, true, nil
+}
+
+// SignalWithStart delivers a signal to the runner's workflow, then runs it,
+// creating the workflow if it does not exist. WorkflowConfig.WorkflowID is
+// required. If the workflow is already running on another worker, the
+// signal is still delivered and WorkflowLocked is returned.
+func (r *WorkflowRunner) SignalWithStart(ctx context.Context, workflowName string, fn WorkflowFunc, signalName string, payload, input interface{}) (interface{}, error) {
+	if r.config.WorkflowID == "" {
+		return nil, NewConfigurationError("SignalWithStart requires a WorkflowID", "workflow_id")
+	}
+	if err := SignalLocal(r.engine, r.config.WorkflowID, signalName, payload); err != nil {
+		return nil, err
+	}
+	return r.Run(ctx, workflowName, fn, input)
+}
+
+// Signal sends a signal to a running workflow
+func (c *Client) Signal(ctx context.Context, workflowID, signalName string, payload interface{}) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"signal_name": signalName,
+		"payload":     payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/workflows/%s/signals", workflowID), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SignalWithStart atomically starts workflowID if it does not exist and
+// delivers a signal to it, returning the workflow ID. Unlike calling
+// StartWorkflow then Signal, a concurrent start cannot make either fail.
+func (c *Client) SignalWithStart(ctx context.Context, workflowName, workflowID, signalName string, payload interface{}, input map[string]interface{}) (string, error) {
+	if workflowID == "" {
+		return "", NewConfigurationError("SignalWithStart requires a workflow ID", "workflow_id")
+	}
+	if err := c.registry.ValidateInput(workflowName, input); err != nil {
+		return "", err
+	}
+	config := WorkflowConfig{WorkflowID: workflowID, OrgID: c.orgID}
+
+	requestID := uuid.New().String()
+	body, err := json.Marshal(map[string]interface{}{
+		"workflow_name":  workflowName,
+		"input":          input,
+		"config":         config,
+		"signal_name":    signalName,
+		"signal_payload": payload,
+		"request_id":     requestID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequestWithHeader(ctx, "POST", "/v1/workflows/signal-with-start", body, http.Header{idempotencyKeyHeader: {requestID}})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		WorkflowID string `json:"workflow_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.WorkflowID, nil
+}
@@ -0,0 +1,200 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// JournalSink receives batches of journal events, e.g. to mirror them to a
+// message bus for analytics. Publish must not return until the batch is
+// durably accepted, since failed batches are retried.
+type JournalSink interface {
+	Publish(ctx context.Context, events []map[string]interface{}) error
+	Close() error
+}
+
+// SinkConfig configures how journal events are mirrored to a sink
+type SinkConfig struct {
+	// BatchSize is the most events published at once (defaults to 100)
+	BatchSize int
+	// FlushInterval bounds how long an event waits for a full batch
+	// (defaults to 1s)
+	FlushInterval time.Duration
+	// BufferSize is how many events may await publishing before appends
+	// block (defaults to 10000)
+	BufferSize int
+	// RetryBackoffMax caps the delay between publish retries (defaults to 30s)
+	RetryBackoffMax time.Duration
+}
+
+// SinkEngine wraps an engine and mirrors every journal append to a
+// JournalSink asynchronously. Delivery is at-least-once: failed batches are
+// retried until they succeed or the engine is closed, and appends block
+// while the buffer is full rather than dropping events.
+type SinkEngine struct {
+	Engine
+	sink   JournalSink
+	config SinkConfig
+
+	events chan map[string]interface{}
+	closed chan struct{}
+	done   chan struct{}
+	stop   context.CancelFunc
+	ctx    context.Context
+	once   sync.Once
+}
+
+// NewSinkEngine wraps engine so its journal is mirrored to sink
+func NewSinkEngine(engine Engine, sink JournalSink, config SinkConfig) *SinkEngine {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 10000
+	}
+	if config.RetryBackoffMax <= 0 {
+		config.RetryBackoffMax = 30 * time.Second
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	e := &SinkEngine{
+		Engine: engine,
+		sink:   sink,
+		config: config,
+		events: make(chan map[string]interface{}, config.BufferSize),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		stop:   stop,
+	}
+	go e.run()
+	return e
+}
+
+// Unwrap returns the wrapped engine
+func (e *SinkEngine) Unwrap() Engine {
+	return e.Engine
+}
+
+// Journal returns a journal that mirrors appended events to the sink
+func (e *SinkEngine) Journal() Journal {
+	return &sinkJournal{journal: e.Engine.Journal(), engine: e}
+}
+
+// Close publishes buffered events and closes the sink. Events appended
+// after Close, or still unpublished when ctx is done, are dropped.
+func (e *SinkEngine) Close(ctx context.Context) error {
+	e.once.Do(func() { close(e.closed) })
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		e.stop()
+		<-e.done
+	}
+	return e.sink.Close()
+}
+
+// run batches buffered events and publishes them
+func (e *SinkEngine) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]map[string]interface{}, 0, e.config.BatchSize)
+	for {
+		select {
+		case event := <-e.events:
+			batch = append(batch, event)
+			if len(batch) < e.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-e.closed:
+			e.drain(batch)
+			return
+		}
+		e.publish(batch)
+		batch = batch[:0]
+	}
+}
+
+// drain publishes the batch and every buffered event
+func (e *SinkEngine) drain(batch []map[string]interface{}) {
+	for {
+		select {
+		case event := <-e.events:
+			batch = append(batch, event)
+			if len(batch) >= e.config.BatchSize {
+				e.publish(batch)
+				batch = batch[:0]
+			}
+		default:
+			e.publish(batch)
+			return
+		}
+	}
+}
+
+// publish sends a batch, retrying with backoff until it succeeds or the
+// engine is stopped
+func (e *SinkEngine) publish(batch []map[string]interface{}) {
+	if len(batch) == 0 {
+		return
+	}
+	events := append([]map[string]interface{}(nil), batch...)
+	backoff := 100 * time.Millisecond
+	for {
+		err := e.sink.Publish(e.ctx, events)
+		if err == nil {
+			return
+		}
+		fmt.Printf("Failed to publish %d journal events: %v\n", len(events), err)
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > e.config.RetryBackoffMax {
+			backoff = e.config.RetryBackoffMax
+		}
+	}
+}
+
+type sinkJournal struct {
+	journal Journal
+	engine  *SinkEngine
+}
+
+// Append journals the event and, once it is durable, queues it for the sink
+func (j *sinkJournal) Append(event interface{}) error {
+	if err := j.journal.Append(event); err != nil {
+		return err
+	}
+	m, ok := event.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	// Copy so later changes by the caller don't race the publisher
+	cp := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	select {
+	case j.engine.events <- cp:
+	case <-j.engine.closed:
+	}
+	return nil
+}
+
+// QueueDepth reports the wrapped journal's queue depth
+func (j *sinkJournal) QueueDepth() int {
+	if q, ok := j.journal.(QueueDepther); ok {
+		return q.QueueDepth()
+	}
+	return 0
+}
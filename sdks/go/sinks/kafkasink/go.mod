@@ -0,0 +1,16 @@
+module github.com/bhavdeep98/contd.ai/sdks/go/sinks/kafkasink
+
+go 1.23
+
+require (
+	github.com/bhavdeep98/contd.ai/sdks/go v0.0.0
+	github.com/segmentio/kafka-go v0.4.50
+)
+
+require (
+	github.com/google/uuid v1.5.0 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+)
+
+replace github.com/bhavdeep98/contd.ai/sdks/go => ../..
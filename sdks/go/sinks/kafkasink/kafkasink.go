@@ -0,0 +1,46 @@
+// Package kafkasink mirrors the Contd journal to Kafka. Each event is
+// written as JSON, keyed by workflow ID so a workflow's events stay ordered
+// within a partition.
+package kafkasink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+	"github.com/segmentio/kafka-go"
+)
+
+// Sink is a contd.JournalSink that writes to a Kafka topic
+type Sink struct {
+	writer *kafka.Writer
+}
+
+// New returns a sink writing through writer. The writer's topic and
+// balancer are used as configured; use a hash balancer to keep each
+// workflow on one partition.
+func New(writer *kafka.Writer) *Sink {
+	return &Sink{writer: writer}
+}
+
+var _ contd.JournalSink = (*Sink)(nil)
+
+// Publish writes a batch of events, returning once Kafka acknowledges it
+func (s *Sink) Publish(ctx context.Context, events []map[string]interface{}) error {
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		workflowID, _ := event["workflow_id"].(string)
+		msgs = append(msgs, kafka.Message{Key: []byte(workflowID), Value: value})
+	}
+	return s.writer.WriteMessages(ctx, msgs...)
+}
+
+// Close closes the writer
+func (s *Sink) Close() error {
+	return s.writer.Close()
+}
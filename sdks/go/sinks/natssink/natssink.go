@@ -0,0 +1,82 @@
+// Package natssink mirrors the Contd journal to NATS JetStream. Each event
+// is published as JSON on "<prefix>.<workflow_id>", so consumers can
+// subscribe to one workflow or, with a wildcard, to all of them.
+package natssink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	contd "github.com/bhavdeep98/contd.ai/sdks/go"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultSubjectPrefix is used when Config.SubjectPrefix is empty
+const DefaultSubjectPrefix = "contd.journal"
+
+// Config configures a NATS sink
+type Config struct {
+	// SubjectPrefix prefixes event subjects (defaults to "contd.journal").
+	// A JetStream stream must capture the subjects under it.
+	SubjectPrefix string
+}
+
+// Sink is a contd.JournalSink that publishes to JetStream
+type Sink struct {
+	js     nats.JetStreamContext
+	conn   *nats.Conn
+	prefix string
+}
+
+// New returns a sink publishing through conn's JetStream context
+func New(conn *nats.Conn, config Config) (*Sink, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jetstream context: %w", err)
+	}
+	if config.SubjectPrefix == "" {
+		config.SubjectPrefix = DefaultSubjectPrefix
+	}
+	return &Sink{js: js, conn: conn, prefix: config.SubjectPrefix}, nil
+}
+
+var _ contd.JournalSink = (*Sink)(nil)
+
+// Publish sends a batch of events and waits until JetStream acknowledges
+// every one of them
+func (s *Sink) Publish(ctx context.Context, events []map[string]interface{}) error {
+	futures := make([]nats.PubAckFuture, 0, len(events))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		workflowID, _ := event["workflow_id"].(string)
+		if workflowID == "" {
+			workflowID = "unknown"
+		}
+		future, err := s.js.PublishMsgAsync(&nats.Msg{Subject: s.prefix + "." + workflowID, Data: data})
+		if err != nil {
+			return err
+		}
+		futures = append(futures, future)
+	}
+
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close waits for outstanding acknowledgements and drains the connection
+func (s *Sink) Close() error {
+	<-s.js.PublishAsyncComplete()
+	return s.conn.Drain()
+}
@@ -0,0 +1,127 @@
+package contd
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SnapshotInfo describes a committed step a SnapshotPolicy decides on
+type SnapshotInfo struct {
+	WorkflowID string
+	StepNumber int
+	// StepsSinceSnapshot counts committed steps, including this one, whose
+	// state has not been snapshotted
+	StepsSinceSnapshot int
+	// SinceSnapshot is the time since the last snapshot, or since the run
+	// started if none was taken
+	SinceSnapshot time.Duration
+	// DeltaBytes is the journaled state delta size accumulated since the
+	// last snapshot
+	DeltaBytes int
+	// Savepoint reports whether the step creates a savepoint
+	Savepoint bool
+}
+
+// SnapshotPolicy decides whether a checkpointing step snapshots its state.
+// Skipped snapshots are recovered by replaying the journal, so policies
+// trade snapshot overhead against recovery time.
+type SnapshotPolicy interface {
+	ShouldSnapshot(info SnapshotInfo) bool
+}
+
+// SnapshotPolicyFunc adapts a function to a SnapshotPolicy
+type SnapshotPolicyFunc func(info SnapshotInfo) bool
+
+// ShouldSnapshot calls f
+func (f SnapshotPolicyFunc) ShouldSnapshot(info SnapshotInfo) bool {
+	return f(info)
+}
+
+// SnapshotEveryStep snapshots after every checkpointing step, the default
+func SnapshotEveryStep() SnapshotPolicy {
+	return SnapshotPolicyFunc(func(SnapshotInfo) bool { return true })
+}
+
+// SnapshotEveryNSteps snapshots once n steps have committed since the last one
+func SnapshotEveryNSteps(n int) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		return info.StepsSinceSnapshot >= n
+	})
+}
+
+// SnapshotEvery snapshots once d has passed since the last snapshot
+func SnapshotEvery(d time.Duration) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		return info.SinceSnapshot >= d
+	})
+}
+
+// SnapshotWhenDeltaExceeds snapshots once more than bytes of state deltas
+// have been journaled since the last snapshot
+func SnapshotWhenDeltaExceeds(bytes int) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		return info.DeltaBytes > bytes
+	})
+}
+
+// SnapshotOnSavepoint only snapshots steps that create savepoints
+func SnapshotOnSavepoint() SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		return info.Savepoint
+	})
+}
+
+// SnapshotAny snapshots when any of the policies would
+func SnapshotAny(policies ...SnapshotPolicy) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		for _, policy := range policies {
+			if policy.ShouldSnapshot(info) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// snapshotTracker accumulates what has changed since the last snapshot
+type snapshotTracker struct {
+	policy SnapshotPolicy
+	steps  int
+	bytes  int
+	since  time.Time
+}
+
+// shouldSnapshot records a committed step and applies the policy. Without a
+// policy every step is snapshotted.
+func (ec *ExecutionContext) shouldSnapshot(stepNumber int, delta interface{}, savepoint bool) bool {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	t := &ec.snapshots
+	if t.policy == nil {
+		return true
+	}
+	if t.since.IsZero() {
+		t.since = time.Now()
+	}
+	t.steps++
+	if data, err := json.Marshal(delta); err == nil {
+		t.bytes += len(data)
+	}
+	return t.policy.ShouldSnapshot(SnapshotInfo{
+		WorkflowID:         ec.WorkflowID,
+		StepNumber:         stepNumber,
+		StepsSinceSnapshot: t.steps,
+		SinceSnapshot:      time.Since(t.since),
+		DeltaBytes:         t.bytes,
+		Savepoint:          savepoint,
+	})
+}
+
+// snapshotTaken resets the accumulated changes after a snapshot
+func (ec *ExecutionContext) snapshotTaken() {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.snapshots.steps = 0
+	ec.snapshots.bytes = 0
+	ec.snapshots.since = time.Now()
+}
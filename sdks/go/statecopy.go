@@ -0,0 +1,113 @@
+package contd
+
+import "reflect"
+
+// Committed workflow state is immutable. Values enter it deep-copied when a
+// step commits and leave it deep-copied through Get and ExtractState, so
+// code holding a step's result or a variable can't change state behind the
+// journal's back, and successive states share the values neither changed.
+
+// deepCopyValue copies v's maps, slices and arrays recursively. Other
+// values are returned as they are: scalars are immutable, and structs and
+// pointers are shared, so values stored in state should be plain data.
+func deepCopyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return v
+	case map[string]interface{}:
+		return deepCopyMap(v)
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		cp := make([]interface{}, len(v))
+		for i, item := range v {
+			cp[i] = deepCopyValue(item)
+		}
+		return cp
+	case map[string]string:
+		if v == nil {
+			return v
+		}
+		cp := make(map[string]string, len(v))
+		for k, s := range v {
+			cp[k] = s
+		}
+		return cp
+	case []string:
+		if v == nil {
+			return v
+		}
+		return append([]string(nil), v...)
+	}
+	return deepCopyReflect(reflect.ValueOf(v)).Interface()
+}
+
+// deepCopyMap copies m and its values recursively
+func deepCopyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	cp := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cp[k] = deepCopyValue(v)
+	}
+	return cp
+}
+
+// deepCopyReflect copies the maps, slices and arrays of typed values
+func deepCopyReflect(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), deepCopyElem(iter.Value()))
+		}
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopyElem(v.Index(i)))
+		}
+		return cp
+	case reflect.Array:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopyElem(v.Index(i)))
+		}
+		return cp
+	}
+	return v
+}
+
+// deepCopyElem copies an element of a typed map, slice or array, unboxing
+// interface elements
+func deepCopyElem(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Interface {
+		return deepCopyReflect(v)
+	}
+	if v.IsNil() {
+		return v
+	}
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(reflect.ValueOf(deepCopyValue(v.Interface())))
+	return cp
+}
+
+// deepCopyState copies state with its variables and metadata deep-copied
+func deepCopyState(state *WorkflowState) *WorkflowState {
+	if state == nil {
+		return nil
+	}
+	cp := *state
+	cp.Variables = deepCopyMap(state.Variables)
+	cp.Metadata = deepCopyMap(state.Metadata)
+	return &cp
+}
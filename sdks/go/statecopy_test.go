@@ -0,0 +1,90 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestUpdateTagsKeepsSnapshotValid checks that tagging a workflow after a
+// checkpoint leaves the engine's snapshot matching its checksum, so a resume
+// restores it instead of rebuilding from the journal
+func TestUpdateTagsKeepsSnapshotValid(t *testing.T) {
+	engine := NewMockEngine()
+	failLast := true
+	workflow := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		if _, err := Step(ctx, "reserve", func(context.Context, interface{}) (interface{}, error) {
+			return map[string]interface{}{"reserved": true}, nil
+		}); err != nil {
+			return nil, err
+		}
+		ec, err := Current(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ec.UpdateTags(map[string]string{"tier": "gold"})
+		return Step(ctx, "ship", func(context.Context, interface{}) (interface{}, error) {
+			if failLast {
+				return nil, errors.New("carrier unavailable")
+			}
+			return nil, nil
+		})
+	}
+
+	if _, err := Execute(context.Background(), engine, "tags", workflow, nil, WithWorkflowID("tags-1")); err == nil {
+		t.Fatal("first run: expected ship to fail")
+	}
+	snapshot, err := engine.Restore("tags-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyChecksum(snapshot, "snapshot"); err != nil {
+		t.Fatalf("snapshot after UpdateTags: %v", err)
+	}
+	failLast = false
+	if _, err := Execute(context.Background(), engine, "tags", workflow, nil, WithWorkflowID("tags-1")); err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+}
+
+// benchState returns a state of n variables, each a nested map holding a
+// payload of payloadBytes
+func benchState(n, payloadBytes int) *WorkflowState {
+	payload := strings.Repeat("x", payloadBytes)
+	variables := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		variables[fmt.Sprintf("var_%d", i)] = map[string]interface{}{
+			"payload": payload,
+			"items":   []interface{}{i, payload, map[string]interface{}{"n": i}},
+		}
+	}
+	return &WorkflowState{WorkflowID: "bench", Variables: variables, Metadata: map[string]interface{}{}}
+}
+
+// BenchmarkStateCopy measures the copy handed out with a state against no
+// copy and a copy of only the top-level maps, which left nested values
+// shared between states. Each run also checksums the state, as every
+// commit does, to show the copy's overhead relative to that work.
+func BenchmarkStateCopy(b *testing.B) {
+	copies := []struct {
+		name string
+		copy func(*WorkflowState) *WorkflowState
+	}{
+		{"none", func(state *WorkflowState) *WorkflowState { return state }},
+		{"shallow", copyState},
+		{"deep", deepCopyState},
+	}
+	for _, n := range []int{10, 100} {
+		state := benchState(n, 256)
+		for _, c := range copies {
+			b.Run(fmt.Sprintf("%s/%d", c.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					computeChecksum(c.copy(state))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package contd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CheckStateVersion reports a StateConflict if incoming would overwrite a
+// stored state it did not build on: one with a newer StateVersion, or a
+// different state at the same version. Engines call it on MaybeSnapshot
+// and MarkCompleted. States without a version are always accepted.
+func CheckStateVersion(stored, incoming *WorkflowState) error {
+	if stored == nil || incoming == nil || incoming.StateVersion == 0 {
+		return nil
+	}
+	if incoming.StateVersion > stored.StateVersion {
+		return nil
+	}
+	if incoming.StateVersion == stored.StateVersion && incoming.Checksum == stored.Checksum {
+		return nil
+	}
+	return NewStateConflict(incoming.WorkflowID, stored.StateVersion, incoming.StateVersion)
+}
+
+// nextStateVersion returns state versioned one past prev, copying it when
+// the version changes
+func nextStateVersion(state, prev *WorkflowState) *WorkflowState {
+	version := versionAfter(prev)
+	if state.StateVersion >= version {
+		return state
+	}
+	next := *state
+	next.StateVersion = version
+	next.Checksum = ""
+	next.Checksum = computeChecksum(&next)
+	return &next
+}
+
+// versionAfter returns the state version following prev
+func versionAfter(prev *WorkflowState) int64 {
+	if prev == nil {
+		return 1
+	}
+	return prev.StateVersion + 1
+}
+
+// keepStateVersion returns a cached state replayed over current, versioned
+// no lower than current so replaying never moves the version back
+func keepStateVersion(cached, current *WorkflowState) *WorkflowState {
+	if current == nil || cached.StateVersion >= current.StateVersion {
+		return cached
+	}
+	kept := *cached
+	kept.StateVersion = current.StateVersion
+	kept.Checksum = ""
+	kept.Checksum = computeChecksum(&kept)
+	return &kept
+}
+
+// reloadOnConflict restores the latest state after a write lost to another
+// executor, so nothing more is built on the stale one
+func (ec *ExecutionContext) reloadOnConflict(engine Engine, err error) error {
+	if !errors.Is(err, ErrStateConflict) {
+		return err
+	}
+	state, rerr := restoreState(engine, ec.WorkflowID)
+	if rerr != nil || state == nil {
+		fmt.Printf("Warning: failed to restore %s after state conflict: %v\n", ec.WorkflowID, rerr)
+		return err
+	}
+	ec.SetState(state)
+	appendEvent(engine, ec, "state_conflict", map[string]interface{}{
+		"error":         err.Error(),
+		"state_version": state.StateVersion,
+	})
+	return err
+}
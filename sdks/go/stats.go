@@ -0,0 +1,117 @@
+package contd
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCloseTimeout is how long Close waits for goroutines to terminate
+const DefaultCloseTimeout = 5 * time.Second
+
+// RuntimeStats reports goroutines and queues owned by a runner
+type RuntimeStats struct {
+	ActiveWorkflows     int `json:"active_workflows"`
+	HeartbeatGoroutines int `json:"heartbeat_goroutines"`
+	StepGoroutines      int `json:"step_goroutines"`
+	// AbandonedSteps counts step goroutines still running after their timeout fired
+	AbandonedSteps    int `json:"abandoned_steps"`
+	JournalQueueDepth int `json:"journal_queue_depth"`
+}
+
+// Idle reports whether nothing is running or queued
+func (s RuntimeStats) Idle() bool {
+	return s.ActiveWorkflows == 0 && s.HeartbeatGoroutines == 0 && s.StepGoroutines == 0 && s.JournalQueueDepth == 0
+}
+
+// QueueDepther is implemented by journals that buffer events before writing
+type QueueDepther interface {
+	QueueDepth() int
+}
+
+// resourceTracker counts goroutines started on behalf of a runner
+type resourceTracker struct {
+	activeWorkflows int64
+	heartbeats      int64
+	stepGoroutines  int64
+	abandonedSteps  int64
+
+	running runningSet
+}
+
+// trackedResource identifies a counter in resourceTracker
+type trackedResource int
+
+const (
+	trackedWorkflows trackedResource = iota
+	trackedHeartbeats
+	trackedStepGoroutines
+	trackedAbandonedSteps
+)
+
+// add adjusts a counter; it is a no-op on a nil tracker
+func (t *resourceTracker) add(resource trackedResource, delta int64) {
+	if t == nil {
+		return
+	}
+	switch resource {
+	case trackedWorkflows:
+		atomic.AddInt64(&t.activeWorkflows, delta)
+	case trackedHeartbeats:
+		atomic.AddInt64(&t.heartbeats, delta)
+	case trackedStepGoroutines:
+		atomic.AddInt64(&t.stepGoroutines, delta)
+	case trackedAbandonedSteps:
+		atomic.AddInt64(&t.abandonedSteps, delta)
+	}
+}
+
+func (t *resourceTracker) snapshot(engine Engine) RuntimeStats {
+	stats := RuntimeStats{
+		ActiveWorkflows:     int(atomic.LoadInt64(&t.activeWorkflows)),
+		HeartbeatGoroutines: int(atomic.LoadInt64(&t.heartbeats)),
+		StepGoroutines:      int(atomic.LoadInt64(&t.stepGoroutines)),
+		AbandonedSteps:      int(atomic.LoadInt64(&t.abandonedSteps)),
+	}
+	if engine != nil {
+		if q, ok := engine.Journal().(QueueDepther); ok {
+			stats.JournalQueueDepth = q.QueueDepth()
+		}
+	}
+	return stats
+}
+
+// waitIdle polls until the tracker is idle or the timeout elapses
+func (t *resourceTracker) waitIdle(engine Engine, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		stats := t.snapshot(engine)
+		if stats.Idle() {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return NewContdError(fmt.Sprintf("resources still active after %v", timeout), "", map[string]interface{}{
+				"active_workflows":     stats.ActiveWorkflows,
+				"heartbeat_goroutines": stats.HeartbeatGoroutines,
+				"step_goroutines":      stats.StepGoroutines,
+				"abandoned_steps":      stats.AbandonedSteps,
+				"journal_queue_depth":  stats.JournalQueueDepth,
+			})
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Stats returns the runner's live goroutine and queue counts
+func (r *WorkflowRunner) Stats() RuntimeStats {
+	return r.tracker.snapshot(r.engine)
+}
+
+// Close stops the runner from accepting new workflows, cancels scheduled
+// starts that have not fired and verifies that every goroutine it started
+// has terminated
+func (r *WorkflowRunner) Close() error {
+	atomic.StoreInt32(&r.closed, 1)
+	r.schedules.cancelAll()
+	return r.tracker.waitIdle(r.engine, DefaultCloseTimeout)
+}
@@ -0,0 +1,83 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StepGroupInfo is a step group's aggregated outcome, as reported in a
+// workflow's status
+type StepGroupInfo struct {
+	Name       string `json:"name"`
+	Steps      int    `json:"steps"`
+	Completed  bool   `json:"completed"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+// StepGroup runs fn as a named group of steps. Steps in the group get IDs
+// scoped to it, e.g. "checkout.charge_0", and groups nest: a group inside
+// "checkout" named "payment" is "checkout/payment". The group's duration
+// and outcome are journaled, so histories and diagrams show it as one
+// section. The name must be unique within the workflow, or within the
+// enclosing group or loop iteration.
+func StepGroup(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	ec, err := Current(ctx)
+	if err != nil {
+		return err
+	}
+	name = scopeName(ctx, name)
+	if err := ec.claimScope(name); err != nil {
+		return err
+	}
+	engine := ec.GetEngine()
+	journal := engine != nil && !ec.replaying
+	if journal {
+		appendEvent(engine, ec, "step_group_started", map[string]interface{}{"group": name})
+	}
+
+	started := time.Now()
+	base := ec.currentStep()
+	err = fn(withStepScope(ctx, name))
+	if !journal {
+		return err
+	}
+	fields := map[string]interface{}{
+		"group":       name,
+		"steps":       ec.currentStep() - base,
+		"duration_ms": time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		fields["code"] = errorCode(err)
+		appendEvent(engine, ec, "step_group_failed", fields)
+		return err
+	}
+	appendEvent(engine, ec, "step_group_completed", fields)
+	return nil
+}
+
+// groupOf returns the innermost group a step or group ID is scoped to, or
+// nil outside any group
+func groupOf(groups map[string]*HistoryGroup, id string) *HistoryGroup {
+	for i := len(id) - 1; i > 0; i-- {
+		if id[i] != '.' && id[i] != '/' {
+			continue
+		}
+		if g, ok := groups[id[:i]]; ok {
+			return g
+		}
+	}
+	return nil
+}
+
+func (g *HistoryGroup) label(sep string) string {
+	switch {
+	case g.Completed:
+		return fmt.Sprintf("%s%s%dms", g.Name, sep, g.DurationMs)
+	case g.Error != "":
+		return g.Name + sep + "failed"
+	}
+	return g.Name + sep + "running"
+}
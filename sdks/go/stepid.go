@@ -0,0 +1,147 @@
+package contd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// StepIDStrategy decides how steps without an explicit ID are identified.
+// A step's ID is what its cached result is found by when a workflow
+// resumes.
+type StepIDStrategy string
+
+const (
+	// StepIDSequence numbers steps in the order they run, e.g. "fetch_3".
+	// Reordering steps changes the IDs of those that moved.
+	StepIDSequence StepIDStrategy = ""
+	// StepIDCallSite identifies a step by the function calling it and how
+	// many times that function ran a step of the same name, so steps keep
+	// their IDs when code elsewhere adds, removes or reorders steps
+	StepIDCallSite StepIDStrategy = "call_site"
+	// StepIDExplicit requires every step to set StepConfig.IdempotencyKey
+	StepIDExplicit StepIDStrategy = "explicit"
+)
+
+// stepMetadataKey is the state metadata naming the step that produced it,
+// which a cached result is checked against on replay
+const stepMetadataKey = "step"
+
+// contdFuncPrefix prefixes the names of this package's functions
+var contdFuncPrefix = reflect.TypeOf(StepRunner{}).PkgPath() + "."
+
+// stepCallSite names the function outside this package that ran a step
+func stepCallSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, contdFuncPrefix) {
+			return frame.Function
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// stepID picks a step's ID under the workflow's strategy
+func (r *StepRunner) stepID(ctx context.Context, ec *ExecutionContext, stepName string) (string, error) {
+	if key := r.config.IdempotencyKey; key != "" {
+		if scope, ok := ctx.Value(stepScopeKey{}).(*stepScope); ok {
+			key = scope.prefix + "." + key
+		}
+		return key, nil
+	}
+	if id := scopedStepID(ctx, stepName); id != "" {
+		return id, nil
+	}
+	switch ec.stepIDs {
+	case StepIDExplicit:
+		return "", NewConfigurationError(fmt.Sprintf("step %s needs an explicit ID (StepConfig.IdempotencyKey)", stepName), "step_id_strategy")
+	case StepIDCallSite:
+		hash := sha256.Sum256([]byte(stepCallSite()))
+		site := stepName + "@" + hex.EncodeToString(hash[:4])
+		ec.mu.Lock()
+		defer ec.mu.Unlock()
+		id := fmt.Sprintf("%s_%d", site, ec.siteCounts[site])
+		if ec.stepSites == nil {
+			ec.stepSites = make(map[string]string)
+		}
+		ec.stepSites[id] = site
+		return id, nil
+	}
+	return ec.GenerateStepID(stepName), nil
+}
+
+// siteCompleted counts a completed step against its call site. Sites are
+// counted on completion so a step retried after a failure keeps its ID.
+func (ec *ExecutionContext) siteCompleted(stepID string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	site, ok := ec.stepSites[stepID]
+	if !ok {
+		return
+	}
+	delete(ec.stepSites, stepID)
+	if ec.siteCounts == nil {
+		ec.siteCounts = make(map[string]int)
+	}
+	ec.siteCounts[site]++
+}
+
+// claimStepID fails if a step with stepID already completed in this run,
+// since running it again would silently return the other step's result
+func (ec *ExecutionContext) claimStepID(stepID, stepName string) error {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	if _, done := ec.completedIDs[stepID]; done {
+		return NewNonDeterminism(ec.WorkflowID, stepID, stepName, "", "step ID already used in this run")
+	}
+	return nil
+}
+
+// markStepID records that stepID completed in this run
+func (ec *ExecutionContext) markStepID(stepID string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.completedIDs == nil {
+		ec.completedIDs = make(map[string]struct{})
+	}
+	ec.completedIDs[stepID] = struct{}{}
+}
+
+// stampStep returns state with its metadata naming the step that produced
+// it and versioned one past prev, signed once, leaving state unchanged
+func stampStep(state *WorkflowState, stepID, stepName string, prev *WorkflowState) *WorkflowState {
+	stamped := *state
+	stamped.Metadata = make(map[string]interface{}, len(state.Metadata)+1)
+	for k, v := range state.Metadata {
+		stamped.Metadata[k] = v
+	}
+	stamped.Metadata[stepMetadataKey] = map[string]interface{}{"id": stepID, "name": stepName}
+	if version := versionAfter(prev); stamped.StateVersion < version {
+		stamped.StateVersion = version
+	}
+	stamped.Checksum = ""
+	stamped.Checksum = computeChecksum(&stamped)
+	return &stamped
+}
+
+// checkCachedStep fails if a cached result was produced by a step of
+// another name, meaning the code now runs a different step at this ID
+func checkCachedStep(workflowID, stepID, stepName string, cached *WorkflowState) error {
+	stamp, ok := cached.Metadata[stepMetadataKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	recorded, _ := stamp["name"].(string)
+	if id, _ := stamp["id"].(string); id != stepID || recorded == "" || recorded == stepName {
+		return nil
+	}
+	return NewNonDeterminism(workflowID, stepID, stepName, recorded, "cached result was produced by another step")
+}
@@ -0,0 +1,129 @@
+package contd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxRecordedInputBytes is the largest step input journaled in full
+const DefaultMaxRecordedInputBytes = 16 * 1024
+
+// InputRecordMode decides whether a step journals its input
+type InputRecordMode string
+
+const (
+	// InputRecordInherit follows the org's or runner's InputRecording
+	InputRecordInherit InputRecordMode = ""
+	// InputRecordOn journals the step's input
+	InputRecordOn InputRecordMode = "on"
+	// InputRecordOff never journals the step's input
+	InputRecordOff InputRecordMode = "off"
+)
+
+// InputRecording decides which steps journal their input in their
+// step_intention event, for replays and debugging. Recorded inputs are
+// redacted and capped at MaxBytes; a larger input is replaced by an
+// OverflowRef carrying its digest and a preview, with no ArtifactRef.
+type InputRecording struct {
+	// MaxBytes caps a recorded input (0 uses DefaultMaxRecordedInputBytes)
+	MaxBytes int
+	// Redactor masks secrets in inputs before they are journaled
+	Redactor Redactor
+
+	mu      sync.RWMutex
+	enabled bool
+	orgs    map[string]bool
+}
+
+// NewInputRecording creates a policy recording inputs for every org when
+// enabled, and for none otherwise until SetOrg opts one in
+func NewInputRecording(enabled bool, redactor Redactor) *InputRecording {
+	return &InputRecording{Redactor: redactor, enabled: enabled, orgs: make(map[string]bool)}
+}
+
+// SetOrg turns input recording on or off for orgID's workflows
+func (p *InputRecording) SetOrg(orgID string, enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.orgs[orgID] = enabled
+}
+
+// records reports whether steps of orgID journal their input under mode
+func (p *InputRecording) records(orgID string, mode InputRecordMode) bool {
+	switch mode {
+	case InputRecordOn:
+		return true
+	case InputRecordOff:
+		return false
+	}
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if enabled, ok := p.orgs[orgID]; ok {
+		return enabled
+	}
+	return p.enabled
+}
+
+// record returns input as journaled: redacted, in its JSON form, and
+// replaced by an OverflowRef when it exceeds the size cap
+func (p *InputRecording) record(input interface{}) (interface{}, error) {
+	var redactor Redactor
+	limit := DefaultMaxRecordedInputBytes
+	if p != nil {
+		redactor = p.Redactor
+		if p.MaxBytes > 0 {
+			limit = p.MaxBytes
+		}
+	}
+
+	var value interface{}
+	if redactor != nil {
+		value = redactValue(redactor, input)
+	} else if err := convert(nil, input, &value); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= limit {
+		return value, nil
+	}
+
+	hash := sha256.Sum256(data)
+	if limit > overflowPreviewBytes {
+		limit = overflowPreviewBytes
+	}
+	return &OverflowRef{
+		Truncated: true,
+		Digest:    hex.EncodeToString(hash[:]),
+		SizeBytes: len(data),
+		Preview:   string(data[:limit]),
+	}, nil
+}
+
+// recordInput adds the step's input to its intention event when the step
+// or its org records inputs
+func (r *StepRunner) recordInput(ec *ExecutionContext, event map[string]interface{}, stepName string, input interface{}) {
+	if input == nil || !ec.inputs.records(ec.OrgID, r.config.RecordInput) {
+		return
+	}
+	recorded, err := ec.inputs.record(input)
+	if err != nil {
+		fmt.Printf("Warning: not recording input of step %s: %v\n", stepName, err)
+		return
+	}
+	event["input"] = recorded
+}
+
+// SetInputRecording sets which steps journal their input; steps can
+// override it with StepConfig.RecordInput
+func (r *WorkflowRunner) SetInputRecording(policy *InputRecording) {
+	r.inputs = policy
+}
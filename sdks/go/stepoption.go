@@ -0,0 +1,154 @@
+package contd
+
+import (
+	"context"
+	"time"
+)
+
+// StepOption configures a step run with Step
+type StepOption func(*stepOptions)
+
+// stepOptions is what a Step call's options set
+type stepOptions struct {
+	config       StepConfig
+	input        interface{}
+	compensation StepFunc
+}
+
+// Step runs fn as a durable step named name. Steps checkpoint by default;
+// options set everything else:
+//
+//	result, err := contd.Step(ctx, "charge", charge,
+//	    contd.WithInput(order),
+//	    contd.WithRetry(contd.DefaultRetryPolicy()),
+//	    contd.WithTimeout(30*time.Second),
+//	    contd.WithCompensation(refund))
+//
+// The result is kept in state under "_step.<step ID>", so a resumed
+// workflow gets it back from cache rather than the committed state.
+// NewStepRunner with a StepConfig remains available for runners reused
+// across many steps.
+func Step(ctx context.Context, name string, fn StepFunc, opts ...StepOption) (interface{}, error) {
+	options := stepOptions{config: DefaultStepConfig()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	result, err := NewStepRunner(options.config).Run(ctx, name, storingResult(fn), options.input)
+	if err != nil {
+		return nil, err
+	}
+	// A step served from cache returns the state it committed
+	if state, ok := result.(*WorkflowState); ok {
+		result = storedResult(state)
+	}
+	if options.compensation != nil {
+		if err := Compensate(ctx, name, options.compensation, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// stepResultPrefix prefixes the workflow variables holding the results of
+// steps run with Step
+const stepResultPrefix = "_step."
+
+// storingResult runs fn and keeps its result in state under the step's ID,
+// so a resumed workflow gets the result back rather than the state
+func storingResult(fn StepFunc) StepFunc {
+	return func(ctx context.Context, input interface{}) (interface{}, error) {
+		result, err := fn(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := result.(*WorkflowState); ok {
+			return result, nil
+		}
+		stepID, _ := ctx.Value(stepIDKey).(string)
+		if err := SetVar(ctx, stepResultPrefix+stepID, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// storedResult returns the result a cached step kept in the state it
+// committed
+func storedResult(state *WorkflowState) interface{} {
+	stamp, _ := state.Metadata[stepMetadataKey].(map[string]interface{})
+	stepID, _ := stamp["id"].(string)
+	return state.Variables[stepResultPrefix+stepID]
+}
+
+// WithStepConfig starts from config instead of DefaultStepConfig; options
+// after it override its fields
+func WithStepConfig(config StepConfig) StepOption {
+	return func(o *stepOptions) { o.config = config }
+}
+
+// WithInput passes input to the step function
+func WithInput(input interface{}) StepOption {
+	return func(o *stepOptions) { o.input = input }
+}
+
+// WithCheckpoint sets whether the step's state is snapshotted on completion
+func WithCheckpoint(checkpoint bool) StepOption {
+	return func(o *stepOptions) { o.config.Checkpoint = checkpoint }
+}
+
+// WithRetry retries the failed step under policy
+func WithRetry(policy RetryPolicy) StepOption {
+	return func(o *stepOptions) { o.config.Retry = &policy }
+}
+
+// WithTimeout fails the step once it has run for timeout
+func WithTimeout(timeout time.Duration) StepOption {
+	return func(o *stepOptions) { o.config.Timeout = timeout }
+}
+
+// WithSavepoint creates a savepoint once the step completes
+func WithSavepoint() StepOption {
+	return func(o *stepOptions) { o.config.Savepoint = true }
+}
+
+// WithIdempotencyKey gives the step an explicit ID, which must be unique
+// within the run
+func WithIdempotencyKey(key string) StepOption {
+	return func(o *stepOptions) { o.config.IdempotencyKey = key }
+}
+
+// WithCompensation registers fn to undo the step if the workflow is later
+// cancelled, as Compensate does. fn receives the step's result.
+func WithCompensation(fn StepFunc) StepOption {
+	return func(o *stepOptions) { o.compensation = fn }
+}
+
+// WithMemo reuses the result of an earlier run of the step on the same input
+func WithMemo(memo StepMemo) StepOption {
+	return func(o *stepOptions) { o.config.Memo = &memo }
+}
+
+// WithCircuitBreaker short-circuits the step while breaker is open
+func WithCircuitBreaker(breaker *CircuitBreaker) StepOption {
+	return func(o *stepOptions) { o.config.CircuitBreaker = breaker }
+}
+
+// WithMaxConcurrent caps how many runs of the step, or of every step
+// sharing key when it is set, run at once on the worker
+func WithMaxConcurrent(limit int, key string) StepOption {
+	return func(o *stepOptions) {
+		o.config.MaxConcurrent = limit
+		o.config.ConcurrencyKey = key
+	}
+}
+
+// WithRequires lists capabilities the worker running the step must offer
+func WithRequires(capabilities ...string) StepOption {
+	return func(o *stepOptions) { o.config.Requires = capabilities }
+}
+
+// WithRecordInput sets whether the step's input is journaled with its
+// intention
+func WithRecordInput(mode InputRecordMode) StepOption {
+	return func(o *stepOptions) { o.config.RecordInput = mode }
+}
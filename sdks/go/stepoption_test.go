@@ -0,0 +1,55 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestStepResumeCompensatesWithResult checks that a step served from cache
+// returns the result of its first run, and that its compensation receives
+// that result rather than the committed state
+func TestStepResumeCompensatesWithResult(t *testing.T) {
+	engine := NewInMemoryEngine()
+	var results []interface{}
+	var compensated interface{}
+	cancelShip := false
+	workflow := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		result, err := Step(ctx, "reserve", func(context.Context, interface{}) (interface{}, error) {
+			return "reservation-1", nil
+		}, WithCompensation(func(_ context.Context, input interface{}) (interface{}, error) {
+			compensated = input
+			return nil, nil
+		}))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		return Step(ctx, "ship", func(ctx context.Context, _ interface{}) (interface{}, error) {
+			if !cancelShip {
+				return nil, errors.New("carrier unavailable")
+			}
+			if err := CancelLocal(engine, "step-resume-1", "customer cancelled"); err != nil {
+				return nil, err
+			}
+			<-ctx.Done()
+			return nil, context.Cause(ctx)
+		})
+	}
+
+	if _, err := Execute(context.Background(), engine, "step-resume", workflow, nil, WithWorkflowID("step-resume-1")); err == nil {
+		t.Fatal("first run: expected ship to fail")
+	}
+	cancelShip = true
+	var cancelled *WorkflowCancelled
+	if _, err := Execute(context.Background(), engine, "step-resume", workflow, nil, WithWorkflowID("step-resume-1")); !errors.As(err, &cancelled) {
+		t.Fatalf("resumed run: expected WorkflowCancelled, got %v", err)
+	}
+
+	if len(results) != 2 || results[0] != "reservation-1" || results[1] != "reservation-1" {
+		t.Errorf("reserve results = %v, want reservation-1 on both runs", results)
+	}
+	if compensated != "reservation-1" {
+		t.Errorf("compensation input = %#v, want reservation-1", compensated)
+	}
+}
@@ -0,0 +1,96 @@
+package contd
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// StepRegistry holds steps that can be invoked by name, so a workflow's
+// step sequence can come from configuration or a planner
+type StepRegistry struct {
+	mu    sync.RWMutex
+	steps map[string]registeredStep
+}
+
+type registeredStep struct {
+	fn     StepFunc
+	config StepConfig
+}
+
+// GlobalStepRegistry is the default step registry
+var GlobalStepRegistry = NewStepRegistry()
+
+// NewStepRegistry creates a new step registry
+func NewStepRegistry() *StepRegistry {
+	return &StepRegistry{steps: make(map[string]registeredStep)}
+}
+
+// Register registers a step function under name. Invocations use config,
+// or DefaultStepConfig when none is given.
+func (r *StepRegistry) Register(name string, fn StepFunc, config ...StepConfig) {
+	step := registeredStep{fn: fn, config: DefaultStepConfig()}
+	if len(config) > 0 {
+		step.config = config[0]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps[name] = step
+}
+
+// Get retrieves a step function and its config by name
+func (r *StepRegistry) Get(name string) (StepFunc, StepConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	step, ok := r.steps[name]
+	return step.fn, step.config, ok
+}
+
+// Has checks if a step is registered
+func (r *StepRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.steps[name]
+	return ok
+}
+
+// Names returns all registered step names, sorted
+func (r *StepRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.steps))
+	for name := range r.steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Execute runs the step registered under name as a durable step
+func (r *StepRegistry) Execute(ctx context.Context, name string, input interface{}) (interface{}, error) {
+	fn, config, ok := r.Get(name)
+	if !ok {
+		return nil, NewConfigurationError("step "+strconv.Quote(name)+" is not registered", "step")
+	}
+	return NewStepRunner(config).Run(ctx, name, fn, input)
+}
+
+// RegisterStep registers a step in the global step registry
+func RegisterStep(name string, fn StepFunc, config ...StepConfig) {
+	GlobalStepRegistry.Register(name, fn, config...)
+}
+
+// ExecuteStepByName runs a registered step inside a workflow. Steps are
+// looked up in the runner's step registry, GlobalStepRegistry by default.
+func ExecuteStepByName(ctx context.Context, name string, input interface{}) (interface{}, error) {
+	ec, err := Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	registry := ec.steps
+	if registry == nil {
+		registry = GlobalStepRegistry
+	}
+	return registry.Execute(ctx, name, input)
+}
@@ -0,0 +1,135 @@
+package contd
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// DefaultStickyCacheSize is how many workflows a StickyCache keeps by default
+const DefaultStickyCacheSize = 1000
+
+// StickyCache keeps the state of workflows this worker ran recently, so
+// running one again skips restoring it from the engine. A cached state is
+// only used when the new lease's fencing token is the next one after the
+// cached run's, proving no other worker held the lease in between; lease
+// managers that don't number leases consecutively never hit the cache.
+// Entries are dropped when a lease is lost.
+type StickyCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	hits    int64
+	misses  int64
+}
+
+type stickyEntry struct {
+	workflowID   string
+	state        *WorkflowState
+	fencingToken int64
+}
+
+// StickyCacheStats reports how often a StickyCache avoided a restore
+type StickyCacheStats struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// NewStickyCache creates a cache holding up to maxEntries workflows, evicting
+// the least recently used (0 uses DefaultStickyCacheSize)
+func NewStickyCache(maxEntries int) *StickyCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultStickyCacheSize
+	}
+	return &StickyCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Invalidate drops a workflow's cached state
+func (c *StickyCache) Invalidate(workflowID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[workflowID]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, workflowID)
+	}
+}
+
+// Stats returns the cache's size and hit counts
+func (c *StickyCache) Stats() StickyCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return StickyCacheStats{Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
+
+// get returns a copy of the cached state if lease directly follows the
+// cached run's lease. The entry is consumed either way, since the new run
+// will change the state.
+func (c *StickyCache) get(workflowID string, lease *Lease) (*WorkflowState, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[workflowID]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.order.Remove(elem)
+	delete(c.entries, workflowID)
+	entry := elem.Value.(*stickyEntry)
+	if lease == nil || lease.FencingToken != entry.fencingToken+1 {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	return copyState(entry.state), true
+}
+
+// put caches a workflow's state as of the end of a run under token
+func (c *StickyCache) put(workflowID string, state *WorkflowState, token int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[workflowID]; ok {
+		c.order.Remove(elem)
+	}
+	c.entries[workflowID] = c.order.PushFront(&stickyEntry{workflowID: workflowID, state: copyState(state), fencingToken: token})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*stickyEntry).workflowID)
+	}
+}
+
+// retain caches the state a run ended with, unless the run may not have
+// persisted it: the worker crashed, lost its lease or failed to write
+func (c *StickyCache) retain(ec *ExecutionContext, err error) {
+	if c == nil {
+		return
+	}
+	if ec.leaseLost() || errors.Is(err, ErrStaleLease) || errors.Is(err, ErrPersistence) ||
+		errors.Is(err, ErrWorkflowInterrupted) || errors.Is(err, ErrIntegrity) {
+		c.Invalidate(ec.WorkflowID)
+		return
+	}
+	state, stateErr := ec.GetState()
+	if stateErr != nil || state == nil {
+		return
+	}
+	c.put(ec.WorkflowID, state, ec.fencingToken())
+}
+
+// SetStickyCache keeps the state of workflows between runs on this worker
+func (r *WorkflowRunner) SetStickyCache(cache *StickyCache) {
+	r.sticky = cache
+}
@@ -0,0 +1,68 @@
+package contd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TagMatchMode controls how ListWorkflowsInput.Tags are combined
+type TagMatchMode string
+
+const (
+	// TagMatchAll matches workflows having every tag (AND)
+	TagMatchAll TagMatchMode = "all"
+	// TagMatchAny matches workflows having at least one tag (OR)
+	TagMatchAny TagMatchMode = "any"
+)
+
+// TagSyncer receives tag changes made during workflow execution
+type TagSyncer interface {
+	UpdateTags(ctx context.Context, workflowID string, tags map[string]string) error
+}
+
+// UpdateTags merges tags into a workflow's tags on the server
+func (c *Client) UpdateTags(ctx context.Context, workflowID string, tags map[string]string) error {
+	if err := c.checkOrg(ctx, workflowID); err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{"tags": tags})
+	if err != nil {
+		return fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "PATCH", fmt.Sprintf("/v1/workflows/%s/tags", workflowID), body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// syncTags pushes tag changes made since the last sync. Failed pushes are
+// kept and retried at the next checkpoint.
+func (ec *ExecutionContext) syncTags(ctx context.Context) {
+	ec.mu.Lock()
+	pending := ec.pendingTags
+	syncer := ec.tagSyncer
+	if syncer == nil || len(pending) == 0 {
+		ec.mu.Unlock()
+		return
+	}
+	ec.pendingTags = nil
+	ec.mu.Unlock()
+
+	if err := syncer.UpdateTags(ctx, ec.WorkflowID, pending); err != nil {
+		fmt.Printf("Failed to sync tags for workflow %s: %v\n", ec.WorkflowID, err)
+		ec.mu.Lock()
+		if ec.pendingTags == nil {
+			ec.pendingTags = make(map[string]string)
+		}
+		for k, v := range pending {
+			if _, newer := ec.pendingTags[k]; !newer {
+				ec.pendingTags[k] = v
+			}
+		}
+		ec.mu.Unlock()
+	}
+}
@@ -0,0 +1,79 @@
+package contd
+
+import (
+	"context"
+	"sync"
+)
+
+// JournalTailer is implemented by engines that can stream journal events
+// as they are appended
+type JournalTailer interface {
+	TailJournal(ctx context.Context, workflowID string) <-chan map[string]interface{}
+}
+
+// TailJournal streams a workflow's journal events from the engine: first
+// those already recorded, then each new one as it is appended. The channel
+// is closed when ctx is done. An empty workflowID tails every workflow.
+// Offloaded payloads are not rehydrated; use RehydrateEvent for that.
+func TailJournal(ctx context.Context, engine Engine, workflowID string) (<-chan map[string]interface{}, error) {
+	tailer, ok := engineAs[JournalTailer](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not support journal tailing", "journal")
+	}
+	return tailer.TailJournal(ctx, workflowID), nil
+}
+
+// journalTail buffers events for one subscriber so appends never block on
+// a slow reader
+type journalTail struct {
+	workflowID string
+	mu         sync.Mutex
+	pending    []map[string]interface{}
+	notify     chan struct{}
+}
+
+func newJournalTail(workflowID string, backlog []map[string]interface{}) *journalTail {
+	return &journalTail{workflowID: workflowID, pending: backlog, notify: make(chan struct{}, 1)}
+}
+
+// offer queues event if it belongs to the tailed workflow
+func (t *journalTail) offer(event map[string]interface{}) {
+	if t.workflowID != "" && event["workflow_id"] != t.workflowID {
+		return
+	}
+	t.mu.Lock()
+	t.pending = append(t.pending, event)
+	t.mu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued events to out until ctx is done, then calls done
+func (t *journalTail) run(ctx context.Context, out chan<- map[string]interface{}, done func()) {
+	defer close(out)
+	defer done()
+	for {
+		t.mu.Lock()
+		batch := t.pending
+		t.pending = nil
+		t.mu.Unlock()
+
+		for _, event := range batch {
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(batch) > 0 {
+			continue
+		}
+		select {
+		case <-t.notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package contd
+
+import "fmt"
+
+// DefaultTaskQueue is the task queue of workflows that don't name one, and
+// the only queue served by workers that don't subscribe to any
+const DefaultTaskQueue = "default"
+
+// taskQueue returns the queue a workflow is routed to
+func taskQueue(config WorkflowConfig) string {
+	if config.TaskQueue == "" {
+		return DefaultTaskQueue
+	}
+	return config.TaskQueue
+}
+
+// subscribed reports whether workers subscribed to queues serve queue
+func subscribed(queues []string, queue string) bool {
+	if len(queues) == 0 {
+		return queue == DefaultTaskQueue
+	}
+	for _, q := range queues {
+		if q == queue {
+			return true
+		}
+	}
+	return false
+}
+
+// notSubscribed is the error for a workflow routed to a queue no worker
+// serves
+func notSubscribed(queue string) error {
+	return NewConfigurationError(fmt.Sprintf("no worker is subscribed to task queue %q", queue), "task_queue")
+}
+
+// SetTaskQueues subscribes this worker to task queues, e.g. "gpu" or
+// "eu-only"; it then refuses workflows routed elsewhere. A worker without
+// queues serves DefaultTaskQueue.
+func (r *WorkflowRunner) SetTaskQueues(queues ...string) {
+	r.taskQueues = queues
+}
@@ -2,7 +2,11 @@ package contd
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -41,10 +45,19 @@ type MockEngine struct {
 	interruptAtStep *int
 	failAtStep      *int
 	failWith        error
+	journalFaultAt  *int
+	commitsSeen     int
 	recordedEvents  []interface{}
-	stepCounter     int
 	states          map[string]*WorkflowState
 	completedSteps  map[string]*WorkflowState
+	savepoints      map[string]mockSavepoint
+	steps           []StepExecution
+	leases          map[string]*Lease
+	fencingTokens   map[string]int64
+	tails           map[*journalTail]struct{}
+	statuses        map[string]WorkflowStatus
+	finishedAt      map[string]time.Time
+	localStore
 
 	leaseManager      *MockLeaseManager
 	journal           *MockJournal
@@ -57,19 +70,33 @@ func NewMockEngine() *MockEngine {
 		recordedEvents: make([]interface{}, 0),
 		states:         make(map[string]*WorkflowState),
 		completedSteps: make(map[string]*WorkflowState),
+		savepoints:     make(map[string]mockSavepoint),
+		leases:         make(map[string]*Lease),
+		fencingTokens:  make(map[string]int64),
+		tails:          make(map[*journalTail]struct{}),
+		statuses:       make(map[string]WorkflowStatus),
+		finishedAt:     make(map[string]time.Time),
 	}
+	engine.localStore = newLocalStore(&engine.mu)
 	engine.leaseManager = &MockLeaseManager{engine: engine}
 	engine.journal = &MockJournal{engine: engine}
 	engine.idempotencyMgr = &MockIdempotencyManager{engine: engine}
 	return engine
 }
 
-// Restore restores workflow state
+// Restore restores workflow state. It returns nil when the workflow has
+// journaled steps but no snapshot, so the runner rebuilds from the journal,
+// and empty state with no org for a new workflow.
 func (e *MockEngine) Restore(workflowID string) (*WorkflowState, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 	if state, ok := e.states[workflowID]; ok {
-		return state, nil
+		return copyState(state), nil
+	}
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && m["workflow_id"] == workflowID && m["event_type"] == "step_completed" {
+			return nil, nil
+		}
 	}
 	return &WorkflowState{
 		WorkflowID: workflowID,
@@ -77,25 +104,84 @@ func (e *MockEngine) Restore(workflowID string) (*WorkflowState, error) {
 		Variables:  make(map[string]interface{}),
 		Metadata:   make(map[string]interface{}),
 		Version:    "1.0",
-		OrgID:      "default",
 	}, nil
 }
 
+// RebuildState folds the journaled deltas over the workflow's snapshot,
+// ignoring a snapshot that fails its checksum
+func (e *MockEngine) RebuildState(workflowID string) (*WorkflowState, error) {
+	e.mu.RLock()
+	base := copyState(e.states[workflowID])
+	if base != nil && verifyChecksum(base, "snapshot") != nil {
+		base = nil
+	}
+	events := make([]map[string]interface{}, 0, len(e.recordedEvents))
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok {
+			events = append(events, m)
+		}
+	}
+	e.mu.RUnlock()
+	return ReplayDeltas(e, workflowID, base, events)
+}
+
+// Compact folds the workflow's completed steps into its snapshot and drops
+// their recorded events
+func (e *MockEngine) Compact(workflowID string) (CompactionResult, error) {
+	e.mu.RLock()
+	base := copyState(e.states[workflowID])
+	events := make([]map[string]interface{}, 0, len(e.recordedEvents))
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && m["workflow_id"] == workflowID {
+			events = append(events, m)
+		}
+	}
+	e.mu.RUnlock()
+	state, dropped, err := compactEvents(e, workflowID, base, events)
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	ids := droppedEventIDs(events, dropped)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if current := e.states[workflowID]; current == nil || current.StepNumber < state.StepNumber {
+		e.states[workflowID] = state
+	}
+	kept := e.recordedEvents[:0]
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && m["workflow_id"] == workflowID && ids[getString(m, "event_id")] {
+			continue
+		}
+		kept = append(kept, event)
+	}
+	e.recordedEvents = kept
+	return CompactionResult{EventsDeleted: len(ids), StepNumber: state.StepNumber}, nil
+}
+
 // CompleteWorkflow marks a workflow as complete
 func (e *MockEngine) CompleteWorkflow(workflowID string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	if state, ok := e.states[workflowID]; ok {
-		state.Metadata["completed_at"] = time.Now().UTC().Format(time.RFC3339)
+		completed := copyState(state)
+		completed.Metadata["completed_at"] = time.Now().UTC().Format(time.RFC3339)
+		completed.Checksum = ""
+		completed.Checksum = computeChecksum(completed)
+		e.states[workflowID] = completed
 	}
 	return nil
 }
 
-// MaybeSnapshot stores a snapshot
+// MaybeSnapshot stores a snapshot, rejecting one older than the stored
+// snapshot with StateConflict
 func (e *MockEngine) MaybeSnapshot(state *WorkflowState) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.states[state.WorkflowID] = state
+	if err := CheckStateVersion(e.states[state.WorkflowID], state); err != nil {
+		return err
+	}
+	e.states[state.WorkflowID] = copyState(state)
 	return nil
 }
 
@@ -114,6 +200,67 @@ func (e *MockEngine) Idempotency() IdempotencyManager {
 	return e.idempotencyMgr
 }
 
+// mockSavepoint is a savepoint recorded by the mock engine
+type mockSavepoint struct {
+	info  SavepointInfo
+	state *WorkflowState
+}
+
+// SaveSavepoint stores a savepoint and its state
+func (e *MockEngine) SaveSavepoint(info SavepointInfo, state *WorkflowState) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.savepoints[info.SavepointID] = mockSavepoint{info: info, state: copyState(state)}
+	return nil
+}
+
+// LoadSavepoint loads a savepoint and its state
+func (e *MockEngine) LoadSavepoint(workflowID, savepointID string) (*SavepointInfo, *WorkflowState, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	sp, ok := e.savepoints[savepointID]
+	if !ok || sp.info.WorkflowID != workflowID {
+		return nil, nil, NewInvalidSavepoint(workflowID, savepointID, "savepoint not found")
+	}
+	info := sp.info
+	return &info, copyState(sp.state), nil
+}
+
+// ListSavepoints returns a workflow's savepoints in step order
+func (e *MockEngine) ListSavepoints(workflowID string) ([]SavepointInfo, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var infos []SavepointInfo
+	for _, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			infos = append(infos, sp.info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].StepNumber != infos[j].StepNumber {
+			return infos[i].StepNumber < infos[j].StepNumber
+		}
+		return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+	})
+	return infos, nil
+}
+
+// ObserveStep records a step execution
+func (e *MockEngine) ObserveStep(execution StepExecution) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.steps = append(e.steps, execution)
+}
+
+// StepExecutions returns every step execution recorded since the last reset
+func (e *MockEngine) StepExecutions() []StepExecution {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	result := make([]StepExecution, len(e.steps))
+	copy(result, e.steps)
+	return result
+}
+
 // SetInterruptAt configures interruption at a specific step
 func (e *MockEngine) SetInterruptAt(stepNumber int) {
 	e.mu.Lock()
@@ -129,6 +276,77 @@ func (e *MockEngine) SetFailAt(stepNumber int, err error) {
 	e.failWith = err
 }
 
+// ClearFaults removes configured interruptions and failures
+func (e *MockEngine) ClearFaults() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.interruptAtStep = nil
+	e.failAtStep = nil
+	e.failWith = nil
+	e.journalFaultAt = nil
+	e.commitsSeen = 0
+}
+
+// SetInterruptJournalAt interrupts the workflow while journaling the commit
+// of the nth step executed from now (0-based), after the step has run but
+// before its result is recorded
+func (e *MockEngine) SetInterruptJournalAt(commit int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.journalFaultAt = &commit
+	e.commitsSeen = 0
+}
+
+// CountEvents counts a workflow's recorded events, only those of the given
+// types if any are given
+func (e *MockEngine) CountEvents(workflowID string, eventTypes ...string) (int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	events := make([]map[string]interface{}, 0, len(e.recordedEvents))
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok {
+			events = append(events, m)
+		}
+	}
+	return countEvents(events, workflowID, eventTypes), nil
+}
+
+// HistorySize returns how many events, and how many bytes of them, the
+// workflow has recorded
+func (e *MockEngine) HistorySize(workflowID string) (HistorySize, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var size HistorySize
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && m["workflow_id"] == workflowID {
+			size.add(m)
+		}
+	}
+	return size, nil
+}
+
+// LatestState returns the most recent committed state of a workflow
+func (e *MockEngine) LatestState(workflowID string) *WorkflowState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	latest := e.states[workflowID]
+	prefix := workflowID + ":"
+	for key, state := range e.completedSteps {
+		if strings.HasPrefix(key, prefix) && !isBatchItem(state) && (latest == nil || state.StepNumber > latest.StepNumber) {
+			latest = state
+		}
+	}
+	return copyState(latest)
+}
+
+// InterceptStep applies configured interruptions and failures before a step
+func (e *MockEngine) InterceptStep(workflowID, stepID string, stepNumber int) error {
+	if err := e.CheckInterrupt(stepNumber, workflowID); err != nil {
+		return err
+	}
+	return e.CheckFailure(stepNumber)
+}
+
 // CheckInterrupt checks if workflow should be interrupted
 func (e *MockEngine) CheckInterrupt(stepNumber int, workflowID string) error {
 	e.mu.RLock()
@@ -175,10 +393,378 @@ func (e *MockEngine) Reset() {
 	e.interruptAtStep = nil
 	e.failAtStep = nil
 	e.failWith = nil
+	e.journalFaultAt = nil
+	e.commitsSeen = 0
 	e.recordedEvents = make([]interface{}, 0)
-	e.stepCounter = 0
+	e.localStore = newLocalStore(&e.mu)
 	e.states = make(map[string]*WorkflowState)
 	e.completedSteps = make(map[string]*WorkflowState)
+	e.savepoints = make(map[string]mockSavepoint)
+	e.steps = nil
+	e.leases = make(map[string]*Lease)
+	e.fencingTokens = make(map[string]int64)
+	e.statuses = make(map[string]WorkflowStatus)
+	e.finishedAt = make(map[string]time.Time)
+}
+
+// WorkflowStatus returns a workflow's recorded status
+func (e *MockEngine) WorkflowStatus(workflowID string) (WorkflowStatus, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.statuses[workflowID], nil
+}
+
+// SetWorkflowStatus records a workflow's status
+func (e *MockEngine) SetWorkflowStatus(workflowID string, status WorkflowStatus) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.statuses[workflowID] = status
+	if status.IsTerminal() {
+		e.finishedAt[workflowID] = time.Now()
+	} else {
+		delete(e.finishedAt, workflowID)
+	}
+	return nil
+}
+
+// ResetWorkflow discards everything held for a workflow except its fencing
+// token, so the ID can start a new run
+func (e *MockEngine) ResetWorkflow(workflowID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dropWorkflow(workflowID)
+	return nil
+}
+
+// dropWorkflow discards a workflow's state, journal, steps, savepoints and
+// artifacts. The caller holds e.mu.
+func (e *MockEngine) dropWorkflow(workflowID string) {
+	delete(e.states, workflowID)
+	delete(e.leases, workflowID)
+	delete(e.signals, workflowID)
+	delete(e.workflowMemos, workflowID)
+	kept := e.recordedEvents[:0]
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && m["workflow_id"] == workflowID {
+			continue
+		}
+		kept = append(kept, event)
+	}
+	e.recordedEvents = kept
+	prefix := workflowID + ":"
+	for key := range e.completedSteps {
+		if strings.HasPrefix(key, prefix) {
+			delete(e.completedSteps, key)
+		}
+	}
+	e.dropAttempts(workflowID)
+	for id, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			delete(e.savepoints, id)
+		}
+	}
+	for ref := range e.artifacts {
+		if strings.HasPrefix(ref, workflowID+"/") {
+			delete(e.artifacts, ref)
+		}
+	}
+}
+
+// Vacuum deletes what policy no longer keeps as of now
+func (e *MockEngine) Vacuum(policy RetentionPolicy, now time.Time) (VacuumResult, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var result VacuumResult
+
+	if policy.CompletedWorkflowTTL > 0 {
+		for workflowID, finished := range e.finishedAt {
+			if now.Sub(finished) < policy.CompletedWorkflowTTL {
+				continue
+			}
+			e.dropWorkflow(workflowID)
+			delete(e.statuses, workflowID)
+			delete(e.finishedAt, workflowID)
+			result.WorkflowsDeleted++
+		}
+	}
+
+	if policy.SnapshotTTL > 0 {
+		for id, sp := range e.savepoints {
+			if now.Sub(sp.info.CreatedAt) >= policy.SnapshotTTL {
+				delete(e.savepoints, id)
+				result.SavepointsDeleted++
+			}
+		}
+	}
+
+	if policy.JournalTTL > 0 {
+		kept := e.recordedEvents[:0]
+		for _, event := range e.recordedEvents {
+			m, ok := event.(map[string]interface{})
+			if ok {
+				workflowID := getString(m, "workflow_id")
+				_, snapshotted := e.states[workflowID]
+				at, err := time.Parse(time.RFC3339, getString(m, "timestamp"))
+				if err == nil && now.Sub(at) >= policy.JournalTTL && (snapshotted || e.statuses[workflowID].IsTerminal()) {
+					result.EventsDeleted++
+					continue
+				}
+			}
+			kept = append(kept, event)
+		}
+		e.recordedEvents = kept
+	}
+	return result, nil
+}
+
+// PurgeWorkflow replaces a finished workflow's events with tombstones and
+// deletes its variables, savepoint contents, signals and artifacts
+func (e *MockEngine) PurgeWorkflow(workflowID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.statuses[workflowID] == WorkflowStatusRunning {
+		return NewContdError("cannot purge a running workflow", workflowID, nil)
+	}
+	found := false
+	for i, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && m["workflow_id"] == workflowID {
+			e.recordedEvents[i] = TombstoneEvent(m)
+			found = true
+		}
+	}
+	if state, ok := e.states[workflowID]; ok {
+		e.states[workflowID] = purgeStateVariables(state, nil)
+		found = true
+	}
+	if !found {
+		return NewWorkflowNotFound(workflowID)
+	}
+	for id, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			sp.info.Metadata = SavepointMetadata{}
+			e.savepoints[id] = mockSavepoint{info: sp.info, state: purgeStateVariables(sp.state, nil)}
+		}
+	}
+	prefix := workflowID + ":"
+	for key, state := range e.completedSteps {
+		if strings.HasPrefix(key, prefix) {
+			e.completedSteps[key] = purgeStateVariables(state, nil)
+		}
+	}
+	for ref := range e.artifacts {
+		if strings.HasPrefix(ref, workflowID+"/") {
+			delete(e.artifacts, ref)
+		}
+	}
+	delete(e.signals, workflowID)
+	delete(e.workflowMemos, workflowID)
+	for i := range e.deadLetters {
+		if e.deadLetters[i].WorkflowID == workflowID {
+			e.deadLetters[i].Input = nil
+			e.deadLetters[i].State = purgeStateVariables(e.deadLetters[i].State, nil)
+		}
+	}
+	for id, msg := range e.outbox {
+		if msg.WorkflowID == workflowID {
+			msg.Payload = nil
+			e.outbox[id] = msg
+		}
+	}
+	e.appendTombstone(workflowID, "workflow_purged", nil)
+	return nil
+}
+
+// PurgeVariables deletes variables from a workflow's snapshot, savepoints,
+// completed steps and journaled deltas
+func (e *MockEngine) PurgeVariables(workflowID string, keys []string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, event := range e.recordedEvents {
+		m, ok := event.(map[string]interface{})
+		if !ok || m["workflow_id"] != workflowID || m["state_delta"] == nil {
+			continue
+		}
+		delta := m["state_delta"]
+		if ref, ok := AsOverflowRef(delta); ok {
+			var full interface{}
+			if err := json.Unmarshal(e.artifacts[ref.ArtifactRef], &full); err != nil {
+				return NewPersistenceError("failed to load offloaded delta", workflowID, map[string]interface{}{"artifact_ref": ref.ArtifactRef})
+			}
+			delete(e.artifacts, ref.ArtifactRef)
+			delta = full
+		}
+		vars, ok := delta.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		purged := make(map[string]interface{}, len(vars))
+		for k, v := range vars {
+			purged[k] = v
+		}
+		for _, key := range keys {
+			delete(purged, key)
+		}
+		cp := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			cp[k] = v
+		}
+		cp["state_delta"] = purged
+		delete(cp, "overflow_ref")
+		delete(cp, "overflow_digest")
+		e.recordedEvents[i] = cp
+	}
+	if state, ok := e.states[workflowID]; ok {
+		e.states[workflowID] = purgeStateVariables(state, keys)
+	}
+	for id, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			e.savepoints[id] = mockSavepoint{info: sp.info, state: purgeStateVariables(sp.state, keys)}
+		}
+	}
+	prefix := workflowID + ":"
+	for key, state := range e.completedSteps {
+		if strings.HasPrefix(key, prefix) {
+			e.completedSteps[key] = purgeStateVariables(state, keys)
+		}
+	}
+	e.appendTombstone(workflowID, "variables_purged", map[string]interface{}{"keys": keys})
+	return nil
+}
+
+// appendTombstone journals that a workflow was purged. The caller holds
+// e.mu.
+func (e *MockEngine) appendTombstone(workflowID, eventType string, fields map[string]interface{}) {
+	event := map[string]interface{}{
+		"event_id":    uuid.New().String(),
+		"workflow_id": workflowID,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"event_type":  eventType,
+	}
+	for k, v := range fields {
+		event[k] = v
+	}
+	e.recordedEvents = append(e.recordedEvents, event)
+	for tail := range e.tails {
+		tail.offer(event)
+	}
+}
+
+// OutboxMessages returns every outbox message, delivered or not
+func (e *MockEngine) OutboxMessages() []OutboxMessage {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	messages := make([]OutboxMessage, 0, len(e.outboxOrder))
+	for _, id := range e.outboxOrder {
+		messages = append(messages, e.outbox[id])
+	}
+	return messages
+}
+
+// ExportWorkflow archives everything the engine holds for a workflow
+func (e *MockEngine) ExportWorkflow(workflowID string) (*WorkflowArchive, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	archive := &WorkflowArchive{
+		FormatVersion:  ArchiveFormatVersion,
+		WorkflowID:     workflowID,
+		ExportedAt:     time.Now().UTC(),
+		Snapshot:       copyState(e.states[workflowID]),
+		CompletedSteps: make(map[string]*WorkflowState),
+		Artifacts:      make(map[string][]byte),
+	}
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && m["workflow_id"] == workflowID {
+			archive.Events = append(archive.Events, m)
+			if archive.OrgID == "" {
+				archive.OrgID, _ = m["org_id"].(string)
+			}
+		}
+	}
+	for _, sp := range e.savepoints {
+		if sp.info.WorkflowID == workflowID {
+			archive.Savepoints = append(archive.Savepoints, ArchivedSavepoint{Info: sp.info, State: copyState(sp.state)})
+		}
+	}
+	sort.Slice(archive.Savepoints, func(i, j int) bool {
+		return archive.Savepoints[i].Info.StepNumber < archive.Savepoints[j].Info.StepNumber
+	})
+	prefix := workflowID + ":"
+	for key, state := range e.completedSteps {
+		if strings.HasPrefix(key, prefix) {
+			archive.CompletedSteps[strings.TrimPrefix(key, prefix)] = copyState(state)
+		}
+	}
+	for ref, data := range e.artifacts {
+		if strings.HasPrefix(ref, workflowID+"/") {
+			archive.Artifacts[ref] = data
+		}
+	}
+	archive.Memo = e.workflowMemos[workflowID]
+	if len(archive.Events) == 0 && archive.Snapshot == nil {
+		return nil, NewWorkflowNotFound(workflowID)
+	}
+	return archive, nil
+}
+
+// ImportWorkflow loads an archive. The workflow must not already exist.
+func (e *MockEngine) ImportWorkflow(archive *WorkflowArchive) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	workflowID := archive.WorkflowID
+	if _, ok := e.states[workflowID]; ok {
+		return NewContdError("workflow already exists", workflowID, nil)
+	}
+	prefix := workflowID + ":"
+	for key := range e.completedSteps {
+		if strings.HasPrefix(key, prefix) {
+			return NewContdError("workflow already exists", workflowID, nil)
+		}
+	}
+
+	for _, event := range archive.Events {
+		e.recordedEvents = append(e.recordedEvents, event)
+		for tail := range e.tails {
+			tail.offer(event)
+		}
+	}
+	if archive.Snapshot != nil {
+		e.states[workflowID] = copyState(archive.Snapshot)
+	}
+	for _, sp := range archive.Savepoints {
+		e.savepoints[sp.Info.SavepointID] = mockSavepoint{info: sp.Info, state: copyState(sp.State)}
+	}
+	for stepID, state := range archive.CompletedSteps {
+		e.completedSteps[prefix+stepID] = copyState(state)
+	}
+	for ref, data := range archive.Artifacts {
+		e.artifacts[ref] = data
+	}
+	if archive.Memo != nil {
+		e.workflowMemos[workflowID] = archive.Memo
+	}
+	return nil
+}
+
+// TailJournal streams recorded and newly appended events for a workflow
+func (e *MockEngine) TailJournal(ctx context.Context, workflowID string) <-chan map[string]interface{} {
+	e.mu.Lock()
+	var backlog []map[string]interface{}
+	for _, event := range e.recordedEvents {
+		if m, ok := event.(map[string]interface{}); ok && (workflowID == "" || m["workflow_id"] == workflowID) {
+			backlog = append(backlog, m)
+		}
+	}
+	tail := newJournalTail(workflowID, backlog)
+	e.tails[tail] = struct{}{}
+	e.mu.Unlock()
+
+	out := make(chan map[string]interface{})
+	go tail.run(ctx, out, func() {
+		e.mu.Lock()
+		delete(e.tails, tail)
+		e.mu.Unlock()
+	})
+	return out
 }
 
 // MockLeaseManager is a mock lease manager
@@ -186,22 +772,79 @@ type MockLeaseManager struct {
 	engine *MockEngine
 }
 
+// Acquire grants the lease unless another owner holds it. Like a real
+// lease store, a lease that expired without being released stays held until
+// it is stolen. Each change of owner issues a higher fencing token.
 func (m *MockLeaseManager) Acquire(workflowID, ownerID string) (*Lease, error) {
-	return &Lease{
-		WorkflowID: workflowID,
-		OwnerID:    ownerID,
-		ExpiresAt:  time.Now().Add(time.Minute),
-	}, nil
+	return m.engine.grantLease(workflowID, ownerID, time.Minute, false)
 }
 
+// StealExpired takes over a lease whose holder let it expire
+func (m *MockLeaseManager) StealExpired(workflowID, ownerID string) (*Lease, error) {
+	return m.engine.grantLease(workflowID, ownerID, time.Minute, true)
+}
+
+// Release frees the lease if it is still the current one
 func (m *MockLeaseManager) Release(lease *Lease) error {
+	m.engine.mu.Lock()
+	defer m.engine.mu.Unlock()
+	if current, ok := m.engine.leases[lease.WorkflowID]; ok && current.FencingToken == lease.FencingToken {
+		delete(m.engine.leases, lease.WorkflowID)
+	}
 	return nil
 }
 
 func (m *MockLeaseManager) Heartbeat(lease *Lease) error {
+	m.engine.mu.Lock()
+	defer m.engine.mu.Unlock()
+	if err := m.engine.checkFencing(lease.WorkflowID, lease.OwnerID, lease.FencingToken); err != nil {
+		return err
+	}
+	if current, ok := m.engine.leases[lease.WorkflowID]; ok && current.FencingToken == lease.FencingToken {
+		current.ExpiresAt = time.Now().Add(time.Minute)
+	}
 	return nil
 }
 
+// HoldLease simulates another worker holding a workflow's lease for ttl
+func (e *MockEngine) HoldLease(workflowID, ownerID string, ttl time.Duration) (*Lease, error) {
+	return e.grantLease(workflowID, ownerID, ttl, false)
+}
+
+func (e *MockEngine) grantLease(workflowID, ownerID string, ttl time.Duration, steal bool) (*Lease, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	current, held := e.leases[workflowID]
+	if held && current.OwnerID != ownerID {
+		if !steal || now.Before(current.ExpiresAt) {
+			return nil, NewWorkflowLocked(workflowID, current.OwnerID, current.ExpiresAt.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	if !held || current.OwnerID != ownerID {
+		e.fencingTokens[workflowID]++
+	}
+	lease := &Lease{
+		WorkflowID:   workflowID,
+		OwnerID:      ownerID,
+		ExpiresAt:    now.Add(ttl),
+		FencingToken: e.fencingTokens[workflowID],
+	}
+	stored := *lease
+	e.leases[workflowID] = &stored
+	return lease, nil
+}
+
+// checkFencing rejects a token older than the workflow's latest lease.
+// Callers must hold e.mu.
+func (e *MockEngine) checkFencing(workflowID, ownerID string, token int64) error {
+	current := e.fencingTokens[workflowID]
+	if token == 0 || token >= current {
+		return nil
+	}
+	return NewStaleLease(workflowID, ownerID, token, current)
+}
+
 func (m *MockLeaseManager) HeartbeatInterval() time.Duration {
 	return 10 * time.Second
 }
@@ -214,7 +857,26 @@ type MockJournal struct {
 func (m *MockJournal) Append(event interface{}) error {
 	m.engine.mu.Lock()
 	defer m.engine.mu.Unlock()
+	if e, ok := event.(map[string]interface{}); ok {
+		workflowID, _ := e["workflow_id"].(string)
+		token, _ := e["fencing_token"].(int64)
+		if err := m.engine.checkFencing(workflowID, "", token); err != nil {
+			return err
+		}
+	}
+	if e, ok := event.(map[string]interface{}); ok && e["event_type"] == "step_completed" && m.engine.journalFaultAt != nil {
+		if m.engine.commitsSeen == *m.engine.journalFaultAt {
+			workflowID, _ := e["workflow_id"].(string)
+			return NewWorkflowInterrupted(workflowID, m.engine.commitsSeen)
+		}
+		m.engine.commitsSeen++
+	}
 	m.engine.recordedEvents = append(m.engine.recordedEvents, event)
+	if e, ok := event.(map[string]interface{}); ok {
+		for tail := range m.engine.tails {
+			tail.offer(e)
+		}
+	}
 	return nil
 }
 
@@ -227,24 +889,67 @@ func (m *MockIdempotencyManager) CheckCompleted(workflowID, stepID string) (*Wor
 	m.engine.mu.RLock()
 	defer m.engine.mu.RUnlock()
 	key := fmt.Sprintf("%s:%s", workflowID, stepID)
-	return m.engine.completedSteps[key], nil
+	return copyState(m.engine.completedSteps[key]), nil
 }
 
 func (m *MockIdempotencyManager) AllocateAttempt(workflowID, stepID string, lease *Lease) (int, error) {
 	m.engine.mu.Lock()
 	defer m.engine.mu.Unlock()
-	m.engine.stepCounter++
-	return m.engine.stepCounter, nil
+	var ownerID string
+	var token int64
+	if lease != nil {
+		ownerID, token = lease.OwnerID, lease.FencingToken
+	}
+	if err := m.engine.checkFencing(workflowID, ownerID, token); err != nil {
+		return 0, err
+	}
+	return m.engine.nextAttempt(workflowID, stepID, token), nil
+}
+
+// InvalidateAfter forgets completed steps whose state is past stepNumber
+func (m *MockIdempotencyManager) InvalidateAfter(workflowID string, stepNumber int) (int, error) {
+	m.engine.mu.Lock()
+	defer m.engine.mu.Unlock()
+	prefix := workflowID + ":"
+	removed := 0
+	for key, state := range m.engine.completedSteps {
+		if strings.HasPrefix(key, prefix) && state.StepNumber > stepNumber {
+			delete(m.engine.completedSteps, key)
+			removed++
+		}
+	}
+	return removed, nil
 }
 
 func (m *MockIdempotencyManager) MarkCompleted(workflowID, stepID string, attemptID int, state *WorkflowState) error {
 	m.engine.mu.Lock()
 	defer m.engine.mu.Unlock()
 	key := fmt.Sprintf("%s:%s", workflowID, stepID)
-	m.engine.completedSteps[key] = state
+	if err := m.engine.checkFencing(workflowID, "", m.engine.attemptToken(workflowID, stepID, attemptID)); err != nil {
+		return err
+	}
+	if cached := m.engine.completedSteps[key]; cached == nil || cached.Checksum != state.Checksum {
+		if err := CheckStateVersion(m.engine.latestCompleted(workflowID), state); err != nil {
+			return err
+		}
+	}
+	m.engine.completedSteps[key] = copyState(state)
 	return nil
 }
 
+// latestCompleted returns the completed step state with the highest
+// StateVersion. Callers must hold e.mu.
+func (e *MockEngine) latestCompleted(workflowID string) *WorkflowState {
+	prefix := workflowID + ":"
+	var latest *WorkflowState
+	for key, state := range e.completedSteps {
+		if strings.HasPrefix(key, prefix) && (latest == nil || state.StateVersion > latest.StateVersion) {
+			latest = state
+		}
+	}
+	return latest
+}
+
 // TestCase is a test harness for workflow testing
 type TestCase struct {
 	Engine           *MockEngine
@@ -282,6 +987,10 @@ type RunWorkflowOptions struct {
 
 // RunWorkflow runs a workflow with optional interruption or failure injection
 func (tc *TestCase) RunWorkflow(ctx context.Context, workflowName string, fn WorkflowFunc, opts RunWorkflowOptions) (interface{}, error) {
+	return tc.runWorkflow(ctx, "wf-"+uuid.New().String(), workflowName, fn, opts)
+}
+
+func (tc *TestCase) runWorkflow(ctx context.Context, workflowID, workflowName string, fn WorkflowFunc, opts RunWorkflowOptions) (interface{}, error) {
 	// Configure mock engine
 	if opts.InterruptAtStep != nil {
 		tc.Engine.SetInterruptAt(*opts.InterruptAtStep)
@@ -291,26 +1000,27 @@ func (tc *TestCase) RunWorkflow(ctx context.Context, workflowName string, fn Wor
 	}
 
 	// Create execution record
-	execution := WorkflowExecution{
-		WorkflowID:   "wf-" + uuid.New().String(),
+	tc.Executions = append(tc.Executions, WorkflowExecution{
+		WorkflowID:   workflowID,
 		WorkflowName: workflowName,
 		StartedAt:    time.Now(),
 		Status:       "running",
 		Steps:        make([]StepExecution, 0),
-	}
-	tc.CurrentExecution = &execution
-	tc.Executions = append(tc.Executions, execution)
+	})
+	execution := &tc.Executions[len(tc.Executions)-1]
+	tc.CurrentExecution = execution
 
-	// Run workflow
-	runner := NewWorkflowRunner(tc.Engine, WorkflowConfig{})
+	// Run workflow, collecting the steps it executes
+	observed := len(tc.Engine.StepExecutions())
+	runner := NewWorkflowRunner(tc.Engine, WorkflowConfig{WorkflowID: workflowID})
 	result, err := runner.Run(ctx, workflowName, fn, opts.Input)
+	execution.Steps = append(execution.Steps, tc.Engine.StepExecutions()[observed:]...)
 
 	if err != nil {
-		if _, ok := err.(*WorkflowInterrupted); ok {
+		var ie *WorkflowInterrupted
+		if errors.As(err, &ie) {
 			execution.Status = "interrupted"
-			if ie, ok := err.(*WorkflowInterrupted); ok {
-				execution.InterruptedAtStep = &ie.StepNumber
-			}
+			execution.InterruptedAtStep = &ie.StepNumber
 			return nil, nil
 		}
 		execution.Status = "failed"
@@ -323,13 +1033,42 @@ func (tc *TestCase) RunWorkflow(ctx context.Context, workflowName string, fn Wor
 	execution.Status = "completed"
 	now := time.Now()
 	execution.CompletedAt = &now
+	execution.FinalState = tc.Engine.LatestState(workflowID)
 	return result, nil
 }
 
-// ResumeWorkflow resumes an interrupted workflow
+// ResumeWorkflow resumes the last, interrupted workflow under the same
+// WorkflowID. Journal, snapshots and completed steps are kept, so steps that
+// completed before the interruption must be served from cache; it returns an
+// error if any of them executed again.
 func (tc *TestCase) ResumeWorkflow(ctx context.Context, workflowName string, fn WorkflowFunc, input interface{}) (interface{}, error) {
-	tc.Engine.Reset()
-	return tc.RunWorkflow(ctx, workflowName, fn, RunWorkflowOptions{Input: input})
+	interrupted := tc.CurrentExecution
+	if interrupted == nil {
+		return nil, fmt.Errorf("no workflow execution to resume")
+	}
+	if interrupted.Status != "interrupted" {
+		return nil, fmt.Errorf("workflow not interrupted: status=%s", interrupted.Status)
+	}
+
+	completed := make(map[string]string)
+	for _, step := range interrupted.Steps {
+		if step.CompletedAt != nil {
+			completed[step.StepID] = step.StepName
+		}
+	}
+
+	tc.Engine.ClearFaults()
+	result, err := tc.runWorkflow(ctx, interrupted.WorkflowID, workflowName, fn, RunWorkflowOptions{Input: input})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range tc.CurrentExecution.Steps {
+		if name, ok := completed[step.StepID]; ok && !step.WasCached {
+			return result, fmt.Errorf("step %s (%s) completed before the interruption but executed again on resume", name, step.StepID)
+		}
+	}
+	return result, nil
 }
 
 // AssertCompleted asserts that the last workflow completed
@@ -371,6 +1110,73 @@ func (tc *TestCase) AssertFailed(errorContains string) error {
 	return nil
 }
 
+// AssertStepExecuted asserts that a step ran exactly times times in the last
+// workflow, counting each attempt but not cached replays
+func (tc *TestCase) AssertStepExecuted(stepName string, times int) error {
+	if tc.CurrentExecution == nil {
+		return fmt.Errorf("no workflow execution to check")
+	}
+	executed := 0
+	for _, step := range tc.CurrentExecution.Steps {
+		if step.StepName == stepName && !step.WasCached {
+			executed++
+		}
+	}
+	if executed != times {
+		return fmt.Errorf("step %s executed %d times, expected %d", stepName, executed, times)
+	}
+	return nil
+}
+
+// AssertStepSkipped asserts that a step was served from cache in the last
+// workflow without executing
+func (tc *TestCase) AssertStepSkipped(stepName string) error {
+	if tc.CurrentExecution == nil {
+		return fmt.Errorf("no workflow execution to check")
+	}
+	cached := false
+	for _, step := range tc.CurrentExecution.Steps {
+		if step.StepName != stepName {
+			continue
+		}
+		if !step.WasCached {
+			return fmt.Errorf("step %s executed (attempt %d), expected it to be skipped", stepName, step.Attempt)
+		}
+		cached = true
+	}
+	if !cached {
+		return fmt.Errorf("step %s was not reached", stepName)
+	}
+	return nil
+}
+
+// AssertStepOrder asserts that the given steps first ran, or were replayed,
+// in this order in the last workflow. Other steps may run in between.
+func (tc *TestCase) AssertStepOrder(stepNames ...string) error {
+	if tc.CurrentExecution == nil {
+		return fmt.Errorf("no workflow execution to check")
+	}
+	seen := make(map[string]bool)
+	order := make([]string, 0, len(tc.CurrentExecution.Steps))
+	for _, step := range tc.CurrentExecution.Steps {
+		if !seen[step.StepName] {
+			seen[step.StepName] = true
+			order = append(order, step.StepName)
+		}
+	}
+
+	next := 0
+	for _, name := range order {
+		if next < len(stepNames) && name == stepNames[next] {
+			next++
+		}
+	}
+	if next < len(stepNames) {
+		return fmt.Errorf("steps out of order: expected %v, actual %v", stepNames, order)
+	}
+	return nil
+}
+
 // GetEvents returns recorded events
 func (tc *TestCase) GetEvents(eventType string) []interface{} {
 	events := tc.Engine.GetRecordedEvents()
@@ -0,0 +1,60 @@
+package contd
+
+import (
+	"context"
+	"time"
+)
+
+func timerKey(name string) string {
+	return "_timers." + name
+}
+
+// Sleep pauses the workflow for d. The wake-up time is recorded by a step
+// when the workflow first reaches the timer, so a resumed workflow only
+// waits out what is left of it and a timer that has fired doesn't wait
+// again. While it waits the workflow reports an ActivityTimer pending
+// activity. The name must be unique within the workflow. Sleep returns
+// early with ctx's cause when ctx ends.
+func Sleep(ctx context.Context, name string, d time.Duration) error {
+	ec, err := Current(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := timerKey(name)
+	_, err = NewStepRunner(DefaultStepConfig()).Run(ctx, "timer:"+name, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		ec.Set(key, time.Now().Add(d).UTC().Format(time.RFC3339Nano))
+		return nil, nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	fireAt, err := Get[string](ec, key)
+	if err != nil {
+		return err
+	}
+	until, err := time.Parse(time.RFC3339Nano, fireAt)
+	if err != nil {
+		return err
+	}
+	wait := time.Until(until)
+	if wait <= 0 {
+		return nil
+	}
+
+	id := "timer:" + name
+	ec.updateActivity(id, name, func(a *PendingActivity) {
+		a.Kind, a.StartedAt, a.WaitingUntil, a.Detail = ActivityTimer, time.Now(), &until, name
+	})
+	defer ec.clearActivity(id)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
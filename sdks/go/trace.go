@@ -0,0 +1,380 @@
+package contd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// TraceFormatVersion is the version of the trace format this SDK writes
+const TraceFormatVersion = 1
+
+// TraceFormat selects how an ExecutionTrace is written
+type TraceFormat string
+
+const (
+	// TraceFormatJSON writes the trace as this SDK's JSON
+	TraceFormatJSON TraceFormat = "json"
+	// TraceFormatOTLP writes the trace as OTLP/JSON spans, readable by
+	// OpenTelemetry tools, with the workflow archive as a resource attribute
+	TraceFormatOTLP TraceFormat = "otlp"
+)
+
+// traceArchiveAttribute is the OTLP resource attribute holding the archive
+const traceArchiveAttribute = "contd.archive"
+
+// ExecutionTrace is a self-contained record of a workflow execution for
+// attaching to bug reports: a summary of its steps, timings, retries and
+// state sizes, with the archive needed to replay it
+type ExecutionTrace struct {
+	FormatVersion int       `json:"format_version"`
+	WorkflowID    string    `json:"workflow_id"`
+	OrgID         string    `json:"org_id,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	EndedAt       time.Time `json:"ended_at"`
+	// Failure is the error the workflow failed with, if it failed
+	Failure *WireError  `json:"failure,omitempty"`
+	Steps   []TraceStep `json:"steps"`
+	// Archive is the workflow's journal, snapshot, savepoints, completed
+	// steps and artifacts
+	Archive *WorkflowArchive `json:"archive"`
+}
+
+// TraceStep summarizes one step of an ExecutionTrace
+type TraceStep struct {
+	StepID    string    `json:"step_id"`
+	StepName  string    `json:"step_name,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at,omitempty"`
+	// DurationMs is how long the completing attempt ran
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	Attempts   int   `json:"attempts"`
+	// Errors are the failed attempts' errors, in order
+	Errors    []string `json:"errors,omitempty"`
+	Completed bool     `json:"completed"`
+	// StateBytes is the size of the state delta the step committed
+	StateBytes int `json:"state_bytes,omitempty"`
+}
+
+// NewExecutionTrace summarizes an archived workflow as a trace
+func NewExecutionTrace(archive *WorkflowArchive) *ExecutionTrace {
+	trace := &ExecutionTrace{
+		FormatVersion: TraceFormatVersion,
+		WorkflowID:    archive.WorkflowID,
+		OrgID:         archive.OrgID,
+		Archive:       archive,
+	}
+	index := make(map[string]int)
+	step := func(event map[string]interface{}) *TraceStep {
+		id := getString(event, "step_id")
+		i, ok := index[id]
+		if !ok {
+			i = len(trace.Steps)
+			index[id] = i
+			trace.Steps = append(trace.Steps, TraceStep{StepID: id})
+		}
+		return &trace.Steps[i]
+	}
+
+	for _, event := range archive.Events {
+		if getString(event, "workflow_id") != archive.WorkflowID {
+			continue
+		}
+		at, _ := time.Parse(time.RFC3339, getString(event, "timestamp"))
+		if !at.IsZero() && (trace.StartedAt.IsZero() || at.Before(trace.StartedAt)) {
+			trace.StartedAt = at
+		}
+		if at.After(trace.EndedAt) {
+			trace.EndedAt = at
+		}
+		switch getString(event, "event_type") {
+		case "step_intention":
+			s := step(event)
+			s.Attempts++
+			if name := getString(event, "step_name"); name != "" {
+				s.StepName = name
+			}
+			if s.StartedAt.IsZero() {
+				s.StartedAt = at
+			}
+		case "step_failed":
+			s := step(event)
+			s.Errors = append(s.Errors, getString(event, "error"))
+			s.EndedAt = at
+		case "step_completed":
+			s := step(event)
+			s.Completed = true
+			s.EndedAt = at
+			s.DurationMs = int64(getFloat(event, "duration_ms"))
+			s.StateBytes = deltaBytes(archive, event)
+		case "workflow_failed":
+			trace.Failure = wireErrorValue(event["failure"])
+		}
+	}
+	return trace
+}
+
+// deltaBytes is the size of a step_completed event's state delta, counting
+// an offloaded delta at its artifact's size
+func deltaBytes(archive *WorkflowArchive, event map[string]interface{}) int {
+	if ref := getString(event, "overflow_ref"); ref != "" {
+		return len(archive.Artifacts[ref])
+	}
+	data, err := json.Marshal(event["state_delta"])
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// TraceLocal traces a workflow held by a local engine
+func TraceLocal(engine Engine, workflowID string) (*ExecutionTrace, error) {
+	archive, err := ExportLocal(engine, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return NewExecutionTrace(archive), nil
+}
+
+// TraceWorkflow traces a workflow from its archive on the server
+func (c *Client) TraceWorkflow(ctx context.Context, workflowID string) (*ExecutionTrace, error) {
+	archive, err := c.ExportWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	return NewExecutionTrace(archive), nil
+}
+
+// Encode writes the trace in the given format
+func (t *ExecutionTrace) Encode(w io.Writer, format TraceFormat) error {
+	switch format {
+	case TraceFormatJSON, "":
+		return json.NewEncoder(w).Encode(t)
+	case TraceFormatOTLP:
+		spans, err := t.otlp()
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(spans)
+	}
+	return NewConfigurationError(fmt.Sprintf("unknown trace format %q", format), "format")
+}
+
+// ReadTrace reads a trace written by Encode in either format
+func ReadTrace(r io.Reader) (*ExecutionTrace, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("failed to decode trace: %w", err)
+	}
+	if len(probe.ResourceSpans) > 0 {
+		for _, attr := range probe.ResourceSpans[0].Resource.Attributes {
+			if attr.Key == traceArchiveAttribute && attr.Value.StringValue != nil {
+				archive, err := ReadArchive(bytes.NewReader([]byte(*attr.Value.StringValue)))
+				if err != nil {
+					return nil, err
+				}
+				return NewExecutionTrace(archive), nil
+			}
+		}
+		return nil, NewConfigurationError("OTLP trace has no workflow archive", "format")
+	}
+
+	var trace ExecutionTrace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("failed to decode trace: %w", err)
+	}
+	if trace.FormatVersion > TraceFormatVersion {
+		return nil, NewConfigurationError(fmt.Sprintf("trace format %d is newer than supported format %d", trace.FormatVersion, TraceFormatVersion), "format_version")
+	}
+	if trace.Archive == nil {
+		return nil, NewConfigurationError("trace has no workflow archive", "format")
+	}
+	return &trace, nil
+}
+
+// LoadTrace loads a trace's workflow into a fresh MockEngine, where a
+// WorkflowRunner configured with the trace's WorkflowID and OrgID resumes
+// it: completed steps return their recorded results and the rest run
+func LoadTrace(trace *ExecutionTrace) (*MockEngine, error) {
+	engine := NewMockEngine()
+	if err := engine.ImportWorkflow(trace.Archive); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// ReplayTrace runs fn against a trace loaded into a fresh MockEngine and
+// returns its result with the engine, whose recorded steps show what the
+// replay ran. Input is the workflow's original input, which the trace does
+// not hold.
+func ReplayTrace(ctx context.Context, trace *ExecutionTrace, workflowName string, fn WorkflowFunc, input interface{}) (interface{}, *MockEngine, error) {
+	engine, err := LoadTrace(trace)
+	if err != nil {
+		return nil, nil, err
+	}
+	runner := NewWorkflowRunner(engine, WorkflowConfig{WorkflowID: trace.WorkflowID, OrgID: trace.OrgID})
+	result, err := runner.Run(ctx, workflowName, fn, input)
+	return result, engine, err
+}
+
+// OTLP/JSON trace encoding, as written by OpenTelemetry's file exporter
+
+type otlpTrace struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpAttribute {
+	s := strconv.FormatInt(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+func otlpBool(key string, value bool) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{BoolValue: &value}}
+}
+
+// otlpID derives a stable hex ID of n bytes from parts
+func otlpID(n int, parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:n])
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlp encodes the trace as one workflow span with a child span per step
+func (t *ExecutionTrace) otlp() (*otlpTrace, error) {
+	var archive bytes.Buffer
+	if err := t.Archive.Encode(&archive); err != nil {
+		return nil, err
+	}
+	traceID := otlpID(16, t.WorkflowID)
+	rootID := otlpID(8, t.WorkflowID)
+
+	root := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            rootID,
+		Name:              "workflow " + t.WorkflowID,
+		Kind:              1,
+		StartTimeUnixNano: unixNano(t.StartedAt),
+		EndTimeUnixNano:   unixNano(t.EndedAt),
+		Attributes:        []otlpAttribute{otlpString("contd.workflow_id", t.WorkflowID)},
+		Status:            otlpStatus{Code: 1},
+	}
+	if t.Failure != nil {
+		root.Status = otlpStatus{Code: 2, Message: t.Failure.Message}
+	}
+	spans := []otlpSpan{root}
+	for _, s := range t.Steps {
+		end := s.EndedAt
+		if end.IsZero() {
+			end = t.EndedAt
+		}
+		span := otlpSpan{
+			TraceID:           traceID,
+			SpanID:            otlpID(8, t.WorkflowID, s.StepID),
+			ParentSpanID:      rootID,
+			Name:              s.StepName,
+			Kind:              1,
+			StartTimeUnixNano: unixNano(s.StartedAt),
+			EndTimeUnixNano:   unixNano(end),
+			Attributes: []otlpAttribute{
+				otlpString("contd.step_id", s.StepID),
+				otlpInt("contd.attempts", int64(s.Attempts)),
+				otlpInt("contd.duration_ms", s.DurationMs),
+				otlpInt("contd.state_bytes", int64(s.StateBytes)),
+				otlpBool("contd.completed", s.Completed),
+			},
+			Status: otlpStatus{Code: 1},
+		}
+		if span.Name == "" {
+			span.Name = s.StepID
+		}
+		if !s.Completed && len(s.Errors) > 0 {
+			span.Status = otlpStatus{Code: 2, Message: s.Errors[len(s.Errors)-1]}
+		}
+		spans = append(spans, span)
+	}
+
+	return &otlpTrace{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			otlpString("service.name", "contd"),
+			otlpString("contd.workflow_id", t.WorkflowID),
+			otlpString("contd.org_id", t.OrgID),
+			otlpString(traceArchiveAttribute, archive.String()),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/bhavdeep98/contd.ai/sdks/go"},
+			Spans: spans,
+		}},
+	}}}, nil
+}
@@ -0,0 +1,68 @@
+package contd
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost keeps enough idle connections for a worker
+	// issuing many journal and idempotency calls at once; net/http keeps 2
+	DefaultMaxIdleConnsPerHost = 64
+	// DefaultIdleConnTimeout is how long an idle connection is kept open
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// ConnectionConfig tunes the connection pool of the client's default
+// transport. It is ignored when ClientConfig.Transport is set or
+// ClientConfig.HTTPClient brings its own transport.
+type ConnectionConfig struct {
+	// MaxIdleConns caps idle connections across hosts (0 uses
+	// MaxIdleConnsPerHost)
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps idle connections kept per host (0 uses
+	// DefaultMaxIdleConnsPerHost)
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps connections per host, idle or not (0 is unlimited)
+	MaxConnsPerHost int
+	// IdleConnTimeout closes connections idle this long (0 uses
+	// DefaultIdleConnTimeout)
+	IdleConnTimeout time.Duration
+	// DisableHTTP2 keeps HTTPS connections on HTTP/1.1. HTTP/2 is otherwise
+	// negotiated, multiplexing requests over one connection per host.
+	DisableHTTP2 bool
+	// DialContext dials connections, e.g. through a proxy or with custom
+	// timeouts (nil uses a net.Dialer with a 30s timeout and keep-alive)
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// newTransport builds the client's default transport from config
+func newTransport(config ConnectionConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	if t.MaxIdleConnsPerHost <= 0 {
+		t.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	t.MaxIdleConns = config.MaxIdleConns
+	if t.MaxIdleConns <= 0 {
+		t.MaxIdleConns = t.MaxIdleConnsPerHost
+	}
+	t.MaxConnsPerHost = config.MaxConnsPerHost
+	t.IdleConnTimeout = config.IdleConnTimeout
+	if t.IdleConnTimeout <= 0 {
+		t.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if config.DialContext != nil {
+		t.DialContext = config.DialContext
+	}
+	if config.DisableHTTP2 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else {
+		t.ForceAttemptHTTP2 = true
+	}
+	return t
+}
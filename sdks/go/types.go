@@ -16,6 +16,8 @@ const (
 	WorkflowStatusCompleted WorkflowStatus = "completed"
 	WorkflowStatusFailed    WorkflowStatus = "failed"
 	WorkflowStatusCancelled WorkflowStatus = "cancelled"
+	// WorkflowStatusTerminated is a workflow stopped without cleanup
+	WorkflowStatusTerminated WorkflowStatus = "terminated"
 )
 
 // StepStatus represents the status of a step
@@ -47,9 +49,10 @@ func DefaultRetryPolicy() RetryPolicy {
 	}
 }
 
-// ShouldRetry determines if a retry should be attempted
+// ShouldRetry determines if a retry should be attempted. Errors marked
+// with NonRetryable are never retried.
 func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
-	return attempt < p.MaxAttempts
+	return attempt < p.MaxAttempts && !IsNonRetryable(err)
 }
 
 // Backoff calculates the backoff duration for an attempt
@@ -71,20 +74,96 @@ func (p RetryPolicy) Backoff(attempt int) time.Duration {
 
 // WorkflowConfig configures workflow execution
 type WorkflowConfig struct {
-	WorkflowID  string            `json:"workflow_id,omitempty"`
-	MaxDuration time.Duration     `json:"max_duration,omitempty"`
+	WorkflowID  string        `json:"workflow_id,omitempty"`
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+	// RetryPolicy reruns a failed workflow up to MaxAttempts runs in all,
+	// backing off between them
 	RetryPolicy *RetryPolicy      `json:"retry_policy,omitempty"`
 	Tags        map[string]string `json:"tags,omitempty"`
 	OrgID       string            `json:"org_id,omitempty"`
+	// ResumeFromSavepoint rewinds WorkflowID to the given savepoint before running
+	ResumeFromSavepoint string `json:"resume_from_savepoint,omitempty"`
+	// ExtendDeadline is consulted when MaxDuration is reached
+	ExtendDeadline DeadlineExtender `json:"-"`
+	// DeterminismCheck replays each successful run to detect nondeterministic
+	// workflow code. The workflow body runs twice: steps are served from
+	// cache, but logging, client calls and other code outside steps run
+	// again. For tests and development only.
+	DeterminismCheck DeterminismMode `json:"-"`
+	// Acquire controls waiting for a lease held by another worker; nil fails
+	// immediately with WorkflowLocked
+	Acquire *AcquireOptions `json:"acquire,omitempty"`
+	// SnapshotPolicy decides which checkpointing steps snapshot state; nil
+	// snapshots after every one
+	SnapshotPolicy SnapshotPolicy `json:"-"`
+	// MaxPayloadBytes is the inline journal payload limit for steps that
+	// don't set their own (0 uses DefaultMaxJournalPayloadBytes)
+	MaxPayloadBytes int `json:"max_payload_bytes,omitempty"`
+	// Budget suspends the workflow once its reported usage exceeds it
+	Budget *Budget `json:"budget,omitempty"`
+	// BusinessKey starts the workflow only if none exists for the key yet;
+	// otherwise the existing workflow is resumed. Ignored with WorkflowID.
+	BusinessKey string `json:"business_key,omitempty"`
+	// IDReusePolicy decides whether a closed workflow's ID may start a new
+	// run; empty always resumes the existing workflow
+	IDReusePolicy IDReusePolicy `json:"id_reuse_policy,omitempty"`
+	// Priority orders queued workflows; higher starts sooner, and the
+	// default is 0. Negative values suit bulk background runs.
+	Priority int `json:"priority,omitempty"`
+	// Requires lists capabilities the worker running this workflow must offer
+	Requires []string `json:"requires,omitempty"`
+	// StepIDStrategy decides how steps without an explicit ID are
+	// identified; changing it makes a resumed workflow rerun its steps
+	StepIDStrategy StepIDStrategy `json:"step_id_strategy,omitempty"`
+	// TaskQueue routes the workflow to workers subscribed to the queue
+	// (empty uses DefaultTaskQueue)
+	TaskQueue string `json:"task_queue,omitempty"`
+	// RetryFrom decides where a run retried under RetryPolicy starts
+	RetryFrom WorkflowRetryFrom `json:"retry_from,omitempty"`
+	// Memo annotates the workflow with values that are stored with it but
+	// not indexed like tags, e.g. a caption or an owner's email
+	Memo map[string]interface{} `json:"memo,omitempty"`
+	// HistoryLimits bounds the workflow's journal; nil warns at the default
+	// thresholds
+	HistoryLimits *HistoryLimits `json:"history_limits,omitempty"`
 }
 
 // StepConfig configures step execution
 type StepConfig struct {
-	Checkpoint     bool          `json:"checkpoint"`
+	Checkpoint bool `json:"checkpoint"`
+	// IdempotencyKey is the step's explicit ID, overriding the workflow's
+	// StepIDStrategy; it must be unique within the run
 	IdempotencyKey string        `json:"idempotency_key,omitempty"`
 	Retry          *RetryPolicy  `json:"retry,omitempty"`
 	Timeout        time.Duration `json:"timeout,omitempty"`
 	Savepoint      bool          `json:"savepoint"`
+	// MaxPayloadBytes caps the journaled result size; larger results are
+	// offloaded to the engine's artifact store (0 uses the workflow's limit)
+	MaxPayloadBytes int `json:"max_payload_bytes,omitempty"`
+	// CircuitBreaker short-circuits the step while its failure rate is too high
+	CircuitBreaker *CircuitBreaker `json:"-"`
+	// CancelGrace is how long a timed-out step may take to return after its
+	// context is cancelled before it is abandoned
+	CancelGrace time.Duration `json:"cancel_grace,omitempty"`
+	// HardStop waits for a timed-out step to return before failing it, so no
+	// step goroutine outlives its timeout. The step must honour ctx.
+	HardStop bool `json:"hard_stop,omitempty"`
+	// Memo reuses the result of an earlier run of this step on the same input
+	Memo *StepMemo `json:"memo,omitempty"`
+	// Requires lists capabilities the worker running this step must offer
+	Requires []string `json:"requires,omitempty"`
+	// MaxConcurrent caps how many of this step run at once across every
+	// workflow on the worker, e.g. 2 for a memory-hungry model training step
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// ConcurrencyKey names the semaphore MaxConcurrent applies to, letting
+	// different steps share one (defaults to the step name)
+	ConcurrencyKey string `json:"concurrency_key,omitempty"`
+	// ConcurrencyWeight is how many of the semaphore's slots the step takes
+	// (defaults to 1)
+	ConcurrencyWeight int `json:"concurrency_weight,omitempty"`
+	// RecordInput journals the step's input with its intention, overriding
+	// the runner's InputRecording
+	RecordInput InputRecordMode `json:"record_input,omitempty"`
 }
 
 // DefaultStepConfig returns a sensible default step config
@@ -104,6 +183,9 @@ type WorkflowState struct {
 	Version    string                 `json:"version"`
 	Checksum   string                 `json:"checksum"`
 	OrgID      string                 `json:"org_id"`
+	// StateVersion increases with every committed state and, unlike
+	// StepNumber, never goes back, so engines can reject stale writes
+	StateVersion int64 `json:"state_version,omitempty"`
 }
 
 // SavepointMetadata contains rich metadata for savepoints
@@ -131,10 +213,17 @@ type WorkflowResult struct {
 	Status      WorkflowStatus         `json:"status"`
 	Result      map[string]interface{} `json:"result,omitempty"`
 	Error       string                 `json:"error,omitempty"`
+	Failure     *WireError             `json:"failure,omitempty"`
 	StartedAt   time.Time              `json:"started_at"`
 	CompletedAt *time.Time             `json:"completed_at,omitempty"`
 	DurationMs  int64                  `json:"duration_ms,omitempty"`
 	StepCount   int                    `json:"step_count"`
+	// FailedStep and Attempt locate the step failure that failed the
+	// workflow
+	FailedStep string `json:"failed_step,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+
+	codec Codec
 }
 
 // StepResult represents the result of a step execution
@@ -147,22 +236,40 @@ type StepResult struct {
 	Error      string      `json:"error,omitempty"`
 	DurationMs int64       `json:"duration_ms"`
 	WasCached  bool        `json:"was_cached"`
+
+	codec Codec
 }
 
 // WorkflowStatusResponse represents the response for workflow status queries
 type WorkflowStatusResponse struct {
-	WorkflowID         string          `json:"workflow_id"`
-	OrgID              string          `json:"org_id"`
-	Status             WorkflowStatus  `json:"status"`
-	CurrentStep        int             `json:"current_step"`
-	TotalSteps         *int            `json:"total_steps,omitempty"`
-	HasLease           bool            `json:"has_lease"`
-	LeaseOwner         string          `json:"lease_owner,omitempty"`
-	LeaseExpiresAt     *time.Time      `json:"lease_expires_at,omitempty"`
-	EventCount         int             `json:"event_count"`
-	SnapshotCount      int             `json:"snapshot_count"`
-	LatestSnapshotStep *int            `json:"latest_snapshot_step,omitempty"`
-	Savepoints         []SavepointInfo `json:"savepoints"`
+	WorkflowID         string                     `json:"workflow_id"`
+	OrgID              string                     `json:"org_id"`
+	Status             WorkflowStatus             `json:"status"`
+	CurrentStep        int                        `json:"current_step"`
+	TotalSteps         *int                       `json:"total_steps,omitempty"`
+	HasLease           bool                       `json:"has_lease"`
+	LeaseOwner         string                     `json:"lease_owner,omitempty"`
+	LeaseExpiresAt     *time.Time                 `json:"lease_expires_at,omitempty"`
+	EventCount         int                        `json:"event_count"`
+	SnapshotCount      int                        `json:"snapshot_count"`
+	LatestSnapshotStep *int                       `json:"latest_snapshot_step,omitempty"`
+	Savepoints         []SavepointInfo            `json:"savepoints"`
+	Tags               map[string]string          `json:"tags,omitempty"`
+	SearchAttributes   map[string]SearchAttribute `json:"search_attributes,omitempty"`
+	Usage              *WorkflowUsage             `json:"usage,omitempty"`
+	// LastError, FailedStep and Attempt describe the most recent step
+	// failure, even if the step was retried successfully since
+	LastError  string `json:"last_error,omitempty"`
+	FailedStep string `json:"failed_step,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+	// Failure is the error a failed workflow ended with, with its causes
+	Failure *WireError `json:"failure,omitempty"`
+	// Progress is what the workflow last reported with SetProgress
+	Progress *Progress `json:"progress,omitempty"`
+	// Groups are the workflow's step groups, in the order they started
+	Groups []StepGroupInfo `json:"groups,omitempty"`
+	// Memo is the memo the workflow was started with
+	Memo map[string]interface{} `json:"memo,omitempty"`
 }
 
 // HealthCheck represents a health check response
@@ -177,4 +284,16 @@ type Lease struct {
 	WorkflowID string    `json:"workflow_id"`
 	OwnerID    string    `json:"owner_id"`
 	ExpiresAt  time.Time `json:"expires_at"`
+	// FencingToken increases every time the workflow's lease changes hands.
+	// Writes carrying an older token are rejected with StaleLease.
+	FencingToken int64 `json:"fencing_token"`
+}
+
+// Annotation is an operator note attached to a workflow's history
+type Annotation struct {
+	AnnotationID string    `json:"annotation_id,omitempty"`
+	Author       string    `json:"author"`
+	Text         string    `json:"text"`
+	Labels       []string  `json:"labels,omitempty"`
+	CreatedAt    time.Time `json:"created_at,omitempty"`
 }
@@ -0,0 +1,89 @@
+package contd
+
+import (
+	"fmt"
+)
+
+// varChange is a variable write not yet committed by a step
+type varChange struct {
+	value   interface{}
+	deleted bool
+}
+
+// Set records a workflow variable. The change is committed with the state of
+// the step that makes it, and discarded if that step fails.
+func (ec *ExecutionContext) Set(key string, value interface{}) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.changes == nil {
+		ec.changes = make(map[string]varChange)
+	}
+	ec.changes[key] = varChange{value: value}
+}
+
+// Delete removes a workflow variable when the current step commits
+func (ec *ExecutionContext) Delete(key string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.changes == nil {
+		ec.changes = make(map[string]varChange)
+	}
+	ec.changes[key] = varChange{deleted: true}
+}
+
+// lookup returns a variable, including uncommitted changes
+func (ec *ExecutionContext) lookup(key string) (interface{}, bool) {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	if change, ok := ec.changes[key]; ok {
+		return change.value, !change.deleted
+	}
+	if ec.state == nil {
+		return nil, false
+	}
+	value, ok := ec.state.Variables[key]
+	return value, ok
+}
+
+// Get returns a workflow variable as T. Values restored from a snapshot or
+// journal are decoded into T, so structs round-trip through their JSON form.
+// Maps and slices are copied, so modifying them doesn't change the state.
+func Get[T any](ec *ExecutionContext, key string) (T, error) {
+	var out T
+	value, ok := ec.lookup(key)
+	if !ok {
+		return out, fmt.Errorf("variable %q is not set", key)
+	}
+	if _, ok := value.(T); ok {
+		return deepCopyValue(value).(T), nil
+	}
+	if err := convert(nil, value, &out); err != nil {
+		return out, fmt.Errorf("variable %q: %w", key, err)
+	}
+	return out, nil
+}
+
+// applyChanges applies uncommitted changes to vars, returning the keys
+// they touched. Must be called with ec.mu held.
+func (ec *ExecutionContext) applyChanges(vars map[string]interface{}) map[string]struct{} {
+	if len(ec.changes) == 0 {
+		return nil
+	}
+	dirty := make(map[string]struct{}, len(ec.changes))
+	for k, change := range ec.changes {
+		if change.deleted {
+			delete(vars, k)
+		} else {
+			vars[k] = deepCopyValue(change.value)
+		}
+		dirty[k] = struct{}{}
+	}
+	return dirty
+}
+
+// discardChanges drops the uncommitted changes of a failed step
+func (ec *ExecutionContext) discardChanges() {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.changes = nil
+}
@@ -0,0 +1,232 @@
+package contd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// MergeStrategy decides what happens when parallel branches write the same
+// variable
+type MergeStrategy string
+
+const (
+	// MergeLastWriteWins keeps the value of the branch that commits last
+	MergeLastWriteWins MergeStrategy = ""
+	// MergeError fails the step whose write conflicts with another branch's
+	MergeError MergeStrategy = "error"
+	// MergeCustom resolves conflicts with the group's MergeFunc
+	MergeCustom MergeStrategy = "custom"
+)
+
+// MergeFunc combines a branch's write with the value another branch
+// committed for the same key
+type MergeFunc func(key string, current, incoming interface{}) (interface{}, error)
+
+// BranchGroup tracks the variable writes of steps running in parallel, so
+// two branches writing the same key is noticed rather than silently
+// resolved by commit order. Every conflict is journaled as a
+// variable_conflict event. Conflicts are tracked within one run: a resumed
+// workflow does not compare against branches committed before it resumed.
+type BranchGroup struct {
+	name     string
+	strategy MergeStrategy
+	merge    MergeFunc
+
+	mu      sync.Mutex
+	written map[string]string
+}
+
+// NewBranchGroup creates a group whose conflicts are resolved with
+// strategy; merge is required for MergeCustom
+func NewBranchGroup(name string, strategy MergeStrategy, merge MergeFunc) *BranchGroup {
+	return &BranchGroup{name: name, strategy: strategy, merge: merge, written: make(map[string]string)}
+}
+
+// branchScope holds one branch's uncommitted variable writes
+type branchScope struct {
+	name  string
+	group *BranchGroup
+
+	mu      sync.Mutex
+	changes map[string]varChange
+}
+
+type branchScopeKey struct{}
+
+// Branch returns a context for the branch's steps. Variables written with
+// SetVar and DeleteVar under it stay in the branch's namespace until one of
+// its steps commits, and are then merged under the group's strategy.
+func (g *BranchGroup) Branch(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, branchScopeKey{}, &branchScope{name: name, group: g})
+}
+
+func branchOf(ctx context.Context) *branchScope {
+	scope, _ := ctx.Value(branchScopeKey{}).(*branchScope)
+	return scope
+}
+
+// SetVar records a workflow variable like ExecutionContext.Set, keeping it
+// in the enclosing parallel branch's namespace until the branch's step
+// commits
+func SetVar(ctx context.Context, key string, value interface{}) error {
+	return writeVar(ctx, key, varChange{value: value})
+}
+
+// DeleteVar removes a workflow variable like ExecutionContext.Delete,
+// scoped to the enclosing parallel branch
+func DeleteVar(ctx context.Context, key string) error {
+	return writeVar(ctx, key, varChange{deleted: true})
+}
+
+func writeVar(ctx context.Context, key string, change varChange) error {
+	ec, err := Current(ctx)
+	if err != nil {
+		return err
+	}
+	scope := branchOf(ctx)
+	if scope == nil {
+		if change.deleted {
+			ec.Delete(key)
+		} else {
+			ec.Set(key, change.value)
+		}
+		return nil
+	}
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	if scope.changes == nil {
+		scope.changes = make(map[string]varChange)
+	}
+	scope.changes[key] = change
+	return nil
+}
+
+// GetVar returns a workflow variable as T, seeing the enclosing parallel
+// branch's uncommitted writes
+func GetVar[T any](ctx context.Context, key string) (T, error) {
+	var out T
+	ec, err := Current(ctx)
+	if err != nil {
+		return out, err
+	}
+	if scope := branchOf(ctx); scope != nil {
+		scope.mu.Lock()
+		change, ok := scope.changes[key]
+		scope.mu.Unlock()
+		if ok {
+			if change.deleted {
+				return out, fmt.Errorf("variable %q is not set", key)
+			}
+			if typed, ok := change.value.(T); ok {
+				return typed, nil
+			}
+			if err := convert(nil, change.value, &out); err != nil {
+				return out, fmt.Errorf("variable %q: %w", key, err)
+			}
+			return out, nil
+		}
+	}
+	return Get[T](ec, key)
+}
+
+// discard drops a failed step's branch writes
+func (s *branchScope) discard() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = nil
+}
+
+// mergeBranch moves the writes of ctx's branch, including a map result's
+// keys, into ec's pending changes, resolving and journaling conflicts with
+// other branches. Callers must hold ec.commitMu.
+func (ec *ExecutionContext) mergeBranch(ctx context.Context, engine Engine, stepID string, result interface{}) error {
+	scope := branchOf(ctx)
+	if scope == nil {
+		return nil
+	}
+	scope.mu.Lock()
+	writes := make(map[string]varChange, len(scope.changes))
+	for k, change := range scope.changes {
+		writes[k] = change
+	}
+	scope.mu.Unlock()
+	if m, ok := result.(map[string]interface{}); ok {
+		for k, v := range m {
+			if _, set := writes[k]; !set {
+				writes[k] = varChange{value: v}
+			}
+		}
+	}
+
+	group := scope.group
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	keys := make([]string, 0, len(writes))
+	for k := range writes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	resolved := make(map[string]varChange, len(writes))
+	for _, key := range keys {
+		incoming := writes[key]
+		resolved[key] = incoming
+		other, written := group.written[key]
+		if !written || other == scope.name {
+			continue
+		}
+		current, exists := ec.lookup(key)
+		if exists == !incoming.deleted && reflect.DeepEqual(current, incoming.value) {
+			continue
+		}
+
+		conflict := map[string]interface{}{
+			"group":    group.name,
+			"key":      key,
+			"step_id":  stepID,
+			"branches": []string{other, scope.name},
+			"strategy": string(group.strategy),
+		}
+		switch group.strategy {
+		case MergeError:
+			conflict["resolution"] = "failed"
+			appendEvent(engine, ec, "variable_conflict", conflict)
+			return NewVariableConflict(ec.WorkflowID, key, []string{other, scope.name})
+		case MergeCustom:
+			if group.merge == nil {
+				return NewConfigurationError("MergeCustom requires a MergeFunc", "merge")
+			}
+			merged, err := group.merge(key, current, incoming.value)
+			if err != nil {
+				return err
+			}
+			resolved[key] = varChange{value: merged}
+			conflict["resolution"] = "merged"
+		default:
+			conflict["resolution"] = "last_write_wins"
+		}
+		if err := appendEvent(engine, ec, "variable_conflict", conflict); err != nil {
+			return err
+		}
+	}
+
+	ec.mu.Lock()
+	if ec.changes == nil {
+		ec.changes = make(map[string]varChange)
+	}
+	for key, change := range resolved {
+		ec.changes[key] = change
+	}
+	ec.mu.Unlock()
+	for key := range resolved {
+		group.written[key] = scope.name
+	}
+	scope.discard()
+	return nil
+}
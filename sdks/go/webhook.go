@@ -0,0 +1,312 @@
+package contd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookEvent names a workflow lifecycle event webhooks can subscribe to
+type WebhookEvent string
+
+const (
+	WebhookWorkflowCompleted WebhookEvent = "workflow_completed"
+	WebhookWorkflowFailed    WebhookEvent = "workflow_failed"
+	WebhookSavepointCreated  WebhookEvent = "savepoint_created"
+	WebhookLeaseLost         WebhookEvent = "lease_lost"
+	WebhookWorkflowCancelled WebhookEvent = "workflow_cancelled"
+	WebhookWorkflowSuspended WebhookEvent = "workflow_suspended"
+)
+
+// Webhook signature headers sent with every delivery
+const (
+	WebhookSignatureHeader = "X-Contd-Signature"
+	WebhookEventHeader     = "X-Contd-Event"
+	WebhookDeliveryHeader  = "X-Contd-Delivery"
+)
+
+// Webhook is an endpoint notified of lifecycle events. An empty Events
+// list subscribes to all of them.
+type Webhook struct {
+	WebhookID string         `json:"webhook_id,omitempty"`
+	URL       string         `json:"url"`
+	Events    []WebhookEvent `json:"events,omitempty"`
+	// Secret signs deliveries with HMAC-SHA256; it is never returned by the server
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// subscribes reports whether the webhook wants event
+func (w Webhook) subscribes(event WebhookEvent) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// LifecycleEvent is a workflow lifecycle event, delivered as a webhook body
+type LifecycleEvent struct {
+	EventID    string                 `json:"event_id"`
+	Event      WebhookEvent           `json:"event"`
+	WorkflowID string                 `json:"workflow_id"`
+	OrgID      string                 `json:"org_id,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// LifecycleObserver is implemented by engines notified of workflow
+// lifecycle events, such as WebhookEngine
+type LifecycleObserver interface {
+	ObserveLifecycle(event LifecycleEvent)
+}
+
+// notifyLifecycle reports a lifecycle event to the engine if it observes them
+func notifyLifecycle(engine Engine, ec *ExecutionContext, event WebhookEvent, data map[string]interface{}) {
+	observer, ok := engineAs[LifecycleObserver](engine)
+	if !ok {
+		return
+	}
+	observer.ObserveLifecycle(LifecycleEvent{
+		EventID:    uuid.New().String(),
+		Event:      event,
+		WorkflowID: ec.WorkflowID,
+		OrgID:      ec.OrgID,
+		Timestamp:  time.Now().UTC(),
+		Data:       data,
+	})
+}
+
+// SignWebhook returns the signature header value for a delivery body
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature is valid for body, for use by
+// webhook receivers
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
+
+// WebhookConfig configures webhook delivery
+type WebhookConfig struct {
+	// HTTPClient sends deliveries (defaults to a client with a 10s timeout)
+	HTTPClient *http.Client
+	// MaxAttempts bounds delivery attempts before dead-lettering (defaults to 5)
+	MaxAttempts int
+	// BackoffBase and BackoffMax bound the delay between attempts
+	// (default 500ms and 30s)
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// WebhookEngine wraps an engine and delivers its workflows' lifecycle
+// events to webhooks. Deliveries that keep failing are dead-lettered to the
+// wrapped engine's DeadLetterQueue when it has one.
+type WebhookEngine struct {
+	Engine
+	config WebhookConfig
+
+	mu       sync.RWMutex
+	webhooks []Webhook
+	wg       sync.WaitGroup
+}
+
+// NewWebhookEngine wraps engine so lifecycle events are sent to webhooks
+func NewWebhookEngine(engine Engine, config WebhookConfig, webhooks ...Webhook) *WebhookEngine {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.BackoffBase <= 0 {
+		config.BackoffBase = 500 * time.Millisecond
+	}
+	if config.BackoffMax <= 0 {
+		config.BackoffMax = 30 * time.Second
+	}
+	e := &WebhookEngine{Engine: engine, config: config}
+	for _, webhook := range webhooks {
+		e.Register(webhook)
+	}
+	return e
+}
+
+// Unwrap returns the wrapped engine
+func (e *WebhookEngine) Unwrap() Engine {
+	return e.Engine
+}
+
+// Register adds a webhook
+func (e *WebhookEngine) Register(webhook Webhook) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if webhook.WebhookID == "" {
+		webhook.WebhookID = uuid.New().String()
+	}
+	e.webhooks = append(e.webhooks, webhook)
+}
+
+// ObserveLifecycle delivers event to every subscribed webhook in the background
+func (e *WebhookEngine) ObserveLifecycle(event LifecycleEvent) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, webhook := range e.webhooks {
+		if !webhook.subscribes(event.Event) {
+			continue
+		}
+		e.wg.Add(1)
+		go func(webhook Webhook) {
+			defer e.wg.Done()
+			e.deliver(webhook, event)
+		}(webhook)
+	}
+}
+
+// Flush waits for in-flight deliveries, including their retries
+func (e *WebhookEngine) Flush() {
+	e.wg.Wait()
+}
+
+// deliver posts event to webhook, retrying with backoff
+func (e *WebhookEngine) deliver(webhook Webhook, event LifecycleEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("Failed to encode webhook event %s: %v\n", event.EventID, err)
+		return
+	}
+
+	var errs []string
+	for attempt := 1; attempt <= e.config.MaxAttempts; attempt++ {
+		err := e.post(webhook, event, body)
+		if err == nil {
+			return
+		}
+		errs = append(errs, err.Error())
+		if attempt < e.config.MaxAttempts {
+			time.Sleep(e.backoff(attempt))
+		}
+	}
+
+	fmt.Printf("Webhook %s failed for event %s after %d attempts\n", webhook.URL, event.Event, e.config.MaxAttempts)
+	provider, ok := engineAs[DeadLetterProvider](e.Engine)
+	if !ok {
+		return
+	}
+	letter := DeadLetter{
+		WorkflowID: event.WorkflowID,
+		OrgID:      event.OrgID,
+		StepID:     "webhook:" + webhook.WebhookID,
+		StepName:   string(event.Event),
+		Attempts:   e.config.MaxAttempts,
+		Input:      event,
+		ErrorChain: errs,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := provider.DeadLetters().Put(letter); err != nil {
+		fmt.Printf("Failed to dead-letter webhook event %s: %v\n", event.EventID, err)
+	}
+}
+
+func (e *WebhookEngine) post(webhook Webhook, event LifecycleEvent, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), "POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(event.Event))
+	req.Header.Set(WebhookDeliveryHeader, event.EventID)
+	if webhook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, body))
+	}
+
+	resp, err := e.config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff returns the delay before the next attempt, with ±25% jitter
+func (e *WebhookEngine) backoff(attempt int) time.Duration {
+	delay := e.config.BackoffBase << (attempt - 1)
+	if delay <= 0 || delay > e.config.BackoffMax {
+		delay = e.config.BackoffMax
+	}
+	jitter := time.Duration((rand.Float64() - 0.5) * 0.5 * float64(delay))
+	return delay + jitter
+}
+
+// RegisterWebhook subscribes url to lifecycle events of the client's
+// workflows. Deliveries are signed with secret when it is non-empty.
+func (c *Client) RegisterWebhook(ctx context.Context, url string, events []WebhookEvent, secret string) (*Webhook, error) {
+	if url == "" {
+		return nil, NewConfigurationError("webhook url is required", "url")
+	}
+	body, err := json.Marshal(Webhook{URL: url, Events: events, Secret: secret})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	resp, err := c.doRequest(ctx, "POST", "/v1/webhooks", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result Webhook
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// ListWebhooks lists the registered webhooks
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	resp, err := c.doRequest(ctx, "GET", "/v1/webhooks", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Webhooks, nil
+}
+
+// DeleteWebhook unregisters a webhook
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
+	resp, err := c.doRequest(ctx, "DELETE", fmt.Sprintf("/v1/webhooks/%s", webhookID), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
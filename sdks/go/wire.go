@@ -0,0 +1,392 @@
+package contd
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrorCode identifies an error kind on the wire
+type ErrorCode string
+
+const (
+	CodeUnknown                  ErrorCode = "unknown"
+	CodeWorkflowLocked           ErrorCode = "workflow_locked"
+	CodeNoActiveWorkflow         ErrorCode = "no_active_workflow"
+	CodeWorkflowNotFound         ErrorCode = "workflow_not_found"
+	CodeWorkflowAlreadyCompleted ErrorCode = "workflow_already_completed"
+	CodeWorkflowTimeout          ErrorCode = "workflow_timeout"
+	CodeStepError                ErrorCode = "step_error"
+	CodeStepTimeout              ErrorCode = "step_timeout"
+	CodeTooManyAttempts          ErrorCode = "too_many_attempts"
+	CodeStepExecutionFailed      ErrorCode = "step_execution_failed"
+	CodeStepPanic                ErrorCode = "step_panic"
+	CodeCircuitOpen              ErrorCode = "circuit_open"
+	CodeBatchFailed              ErrorCode = "batch_failed"
+	CodeIntegrityError           ErrorCode = "integrity_error"
+	CodeChecksumMismatch         ErrorCode = "checksum_mismatch"
+	CodePersistenceError         ErrorCode = "persistence_error"
+	CodeRecoveryError            ErrorCode = "recovery_error"
+	CodeRecoveryFailed           ErrorCode = "recovery_failed"
+	CodeInvalidSavepoint         ErrorCode = "invalid_savepoint"
+	CodeConfigurationError       ErrorCode = "configuration_error"
+	CodeOrgMismatch              ErrorCode = "org_mismatch"
+	CodeStaleLease               ErrorCode = "stale_lease"
+	CodePoolClosed               ErrorCode = "pool_closed"
+	CodeValidationError          ErrorCode = "validation_error"
+	CodeWorkflowInterrupted      ErrorCode = "workflow_interrupted"
+	CodeBudgetExceeded           ErrorCode = "budget_exceeded"
+	CodeWorkflowAlreadyExists    ErrorCode = "workflow_already_exists"
+	CodeNoCapableWorker          ErrorCode = "no_capable_worker"
+	CodeWorkflowCancelled        ErrorCode = "workflow_cancelled"
+	CodeWorkflowTerminated       ErrorCode = "workflow_terminated"
+	CodeNonDeterminism           ErrorCode = "non_determinism"
+	CodeWorkflowSuspended        ErrorCode = "workflow_suspended"
+	CodeVariableConflict         ErrorCode = "variable_conflict"
+	CodeStateConflict            ErrorCode = "state_conflict"
+	CodeContinueAsNew            ErrorCode = "continue_as_new"
+	CodeRateLimited              ErrorCode = "rate_limited"
+	CodeApplicationFailure       ErrorCode = "application_failure"
+)
+
+// WireError is the serialized form of an SDK error
+type WireError struct {
+	Code       ErrorCode              `json:"code"`
+	Message    string                 `json:"message"`
+	Retryable  bool                   `json:"retryable"`
+	WorkflowID string                 `json:"workflow_id,omitempty"`
+	StepID     string                 `json:"step_id,omitempty"`
+	StepName   string                 `json:"step_name,omitempty"`
+	Attempt    int                    `json:"attempt,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Cause      *WireError             `json:"cause,omitempty"`
+}
+
+// IsRetryable reports whether an error is transient and worth retrying
+func IsRetryable(err error) bool {
+	var recovery *RecoveryFailed
+	var after *retryAfterError
+	switch {
+	case IsNonRetryable(err):
+		return false
+	case errors.As(err, &after):
+		return true
+	case errors.As(err, &recovery):
+		return recovery.Recoverable
+	case errors.Is(err, ErrWorkflowLocked),
+		errors.Is(err, ErrStepTimeout),
+		errors.Is(err, ErrCircuitOpen),
+		errors.Is(err, ErrPersistence),
+		errors.Is(err, ErrRateLimited):
+		return true
+	}
+	return false
+}
+
+// EncodeError converts an error into its wire form
+func EncodeError(err error) *WireError {
+	if err == nil {
+		return nil
+	}
+
+	w := &WireError{
+		Code:      CodeUnknown,
+		Message:   err.Error(),
+		Retryable: IsRetryable(err),
+	}
+
+	var base *ContdError
+	if errors.As(err, &base) {
+		w.Message = base.Message
+		w.WorkflowID = base.WorkflowID
+		if len(base.Details) > 0 {
+			w.Details = make(map[string]interface{}, len(base.Details))
+			for k, v := range base.Details {
+				w.Details[k] = v
+			}
+		}
+	}
+	var step *StepError
+	if errors.As(err, &step) {
+		w.StepID = step.StepID
+		w.StepName = step.StepName
+		w.Attempt = step.Attempt
+	}
+
+	w.Code = errorCode(err)
+
+	// Match through wrapping, as errorCode does, so a wrapped error keeps
+	// the payload its code implies
+	var failed *StepExecutionFailed
+	if errors.As(err, &failed) {
+		w.Cause = EncodeError(failed.OriginalError)
+	}
+	var checksum *ChecksumMismatch
+	if errors.As(err, &checksum) {
+		w.detail("expected_full", checksum.Expected)
+		w.detail("actual_full", checksum.Actual)
+	}
+	var batch *BatchError
+	if errors.As(err, &batch) {
+		w.detail("total", batch.Total)
+	}
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		w.detail("violations", validation.Violations)
+	}
+	return w
+}
+
+func (w *WireError) detail(key string, value interface{}) {
+	if w.Details == nil {
+		w.Details = make(map[string]interface{})
+	}
+	w.Details[key] = value
+}
+
+// errorCode returns the code of the most specific error kind in err's chain
+func errorCode(err error) ErrorCode {
+	kinds := []struct {
+		sentinel error
+		code     ErrorCode
+	}{
+		{ErrWorkflowLocked, CodeWorkflowLocked},
+		{ErrNoActiveWorkflow, CodeNoActiveWorkflow},
+		{ErrWorkflowNotFound, CodeWorkflowNotFound},
+		{ErrWorkflowAlreadyCompleted, CodeWorkflowAlreadyCompleted},
+		{ErrWorkflowTimeout, CodeWorkflowTimeout},
+		{ErrStepExecutionFailed, CodeStepExecutionFailed},
+		{ErrStepPanic, CodeStepPanic},
+		{ErrStepTimeout, CodeStepTimeout},
+		{ErrTooManyAttempts, CodeTooManyAttempts},
+		{ErrCircuitOpen, CodeCircuitOpen},
+		{ErrBatch, CodeBatchFailed},
+		{ErrStep, CodeStepError},
+		{ErrChecksumMismatch, CodeChecksumMismatch},
+		{ErrIntegrity, CodeIntegrityError},
+		{ErrPersistence, CodePersistenceError},
+		{ErrRecoveryFailed, CodeRecoveryFailed},
+		{ErrInvalidSavepoint, CodeInvalidSavepoint},
+		{ErrRecovery, CodeRecoveryError},
+		{ErrConfiguration, CodeConfigurationError},
+		{ErrOrgMismatch, CodeOrgMismatch},
+		{ErrStaleLease, CodeStaleLease},
+		{ErrPoolClosed, CodePoolClosed},
+		{ErrValidation, CodeValidationError},
+		{ErrWorkflowInterrupted, CodeWorkflowInterrupted},
+		{ErrBudgetExceeded, CodeBudgetExceeded},
+		{ErrWorkflowAlreadyExists, CodeWorkflowAlreadyExists},
+		{ErrNoCapableWorker, CodeNoCapableWorker},
+		{ErrWorkflowCancelled, CodeWorkflowCancelled},
+		{ErrWorkflowTerminated, CodeWorkflowTerminated},
+		{ErrNonDeterminism, CodeNonDeterminism},
+		{ErrWorkflowSuspended, CodeWorkflowSuspended},
+		{ErrVariableConflict, CodeVariableConflict},
+		{ErrStateConflict, CodeStateConflict},
+		{ErrContinueAsNew, CodeContinueAsNew},
+		{ErrRateLimited, CodeRateLimited},
+		{ErrApplicationFailure, CodeApplicationFailure},
+	}
+	for _, kind := range kinds {
+		if errors.Is(err, kind.sentinel) {
+			return kind.code
+		}
+	}
+	return CodeUnknown
+}
+
+// DecodeError reconstructs the typed error described by a wire error
+func DecodeError(w *WireError) error {
+	if w == nil {
+		return nil
+	}
+
+	details := w.Details
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	base := ContdError{Message: w.Message, WorkflowID: w.WorkflowID, Details: details}
+	step := StepError{ContdError: base, StepID: w.StepID, StepName: w.StepName, Attempt: w.Attempt}
+
+	switch w.Code {
+	case CodeWorkflowLocked:
+		return &WorkflowLocked{ContdError: base, OwnerID: getString(details, "current_owner"), ExpiresAt: getString(details, "expires_at")}
+	case CodeNoActiveWorkflow:
+		return &NoActiveWorkflow{ContdError: base}
+	case CodeWorkflowNotFound:
+		return &WorkflowNotFound{ContdError: base}
+	case CodeWorkflowAlreadyCompleted:
+		return &WorkflowAlreadyCompleted{ContdError: base, CompletedAt: getString(details, "completed_at")}
+	case CodeWorkflowTimeout:
+		return &WorkflowTimeout{
+			ContdError:  base,
+			MaxDuration: time.Duration(getFloat(details, "max_duration_ms")) * time.Millisecond,
+			Elapsed:     time.Duration(getFloat(details, "elapsed_ms")) * time.Millisecond,
+		}
+	case CodeStepError:
+		return &step
+	case CodeStepTimeout:
+		return &StepTimeout{StepError: step, TimeoutSeconds: getFloat(details, "timeout_seconds"), ElapsedSeconds: getFloat(details, "elapsed_seconds")}
+	case CodeTooManyAttempts:
+		return &TooManyAttempts{StepError: step, MaxAttempts: int(getFloat(details, "max_attempts")), LastError: getString(details, "last_error")}
+	case CodeStepExecutionFailed:
+		cause := DecodeError(w.Cause)
+		step.Cause = cause
+		return &StepExecutionFailed{StepError: step, OriginalError: cause}
+	case CodeStepPanic:
+		return &StepPanic{StepError: step, Value: w.Message, Stack: getString(details, "stack")}
+	case CodeCircuitOpen:
+		retryAt, _ := time.Parse(time.RFC3339, getString(details, "retry_at"))
+		return &CircuitOpen{StepError: step, RetryAt: retryAt}
+	case CodeBatchFailed:
+		return &BatchError{StepError: step, Total: int(getFloat(details, "total"))}
+	case CodeIntegrityError:
+		return &IntegrityError{ContdError: base}
+	case CodeChecksumMismatch:
+		return &ChecksumMismatch{
+			IntegrityError: IntegrityError{ContdError: base},
+			ResourceType:   getString(details, "resource_type"),
+			Expected:       getString(details, "expected_full"),
+			Actual:         getString(details, "actual_full"),
+		}
+	case CodePersistenceError:
+		return &PersistenceError{ContdError: base}
+	case CodeRecoveryError:
+		return &RecoveryError{ContdError: base}
+	case CodeRecoveryFailed:
+		recoverable, _ := details["recoverable"].(bool)
+		return &RecoveryFailed{RecoveryError: RecoveryError{ContdError: base}, Recoverable: recoverable}
+	case CodeInvalidSavepoint:
+		return &InvalidSavepoint{RecoveryError: RecoveryError{ContdError: base}, SavepointID: getString(details, "savepoint_id")}
+	case CodeConfigurationError:
+		return &ConfigurationError{ContdError: base, ConfigKey: getString(details, "config_key")}
+	case CodeOrgMismatch:
+		return &OrgMismatch{ContdError: base, OrgID: getString(details, "org_id"), ResourceOrgID: getString(details, "resource_org_id")}
+	case CodeStaleLease:
+		return &StaleLease{
+			ContdError:   base,
+			OwnerID:      getString(details, "owner_id"),
+			Token:        int64(getFloat(details, "token")),
+			CurrentToken: int64(getFloat(details, "current_token")),
+		}
+	case CodePoolClosed:
+		return &PoolClosed{ContdError: base, WorkflowName: getString(details, "workflow_name")}
+	case CodeValidationError:
+		return &ValidationError{
+			ContdError:   base,
+			WorkflowName: getString(details, "workflow_name"),
+			Direction:    getString(details, "direction"),
+			Violations:   decodeViolations(details["violations"]),
+		}
+	case CodeWorkflowInterrupted:
+		return &WorkflowInterrupted{ContdError: base, StepNumber: int(getFloat(details, "interrupted_at_step"))}
+	case CodeBudgetExceeded:
+		return &BudgetExceeded{
+			ContdError: base,
+			Limit:      getString(details, "limit"),
+			Used:       getFloat(details, "used"),
+			Max:        getFloat(details, "max"),
+		}
+	case CodeWorkflowSuspended:
+		return &WorkflowSuspended{ContdError: base, Reason: getString(details, "reason")}
+	case CodeWorkflowAlreadyExists:
+		return &WorkflowAlreadyExists{
+			ContdError: base,
+			Status:     WorkflowStatus(getString(details, "status")),
+			Policy:     IDReusePolicy(getString(details, "policy")),
+		}
+	case CodeNoCapableWorker:
+		return &NoCapableWorker{
+			ContdError: base,
+			StepName:   getString(details, "step_name"),
+			Required:   getStrings(details, "required"),
+			Missing:    getStrings(details, "missing"),
+		}
+	case CodeWorkflowCancelled, CodeWorkflowTerminated:
+		return &WorkflowCancelled{
+			ContdError: base,
+			Reason:     getString(details, "reason"),
+			Terminated: w.Code == CodeWorkflowTerminated,
+		}
+	case CodeNonDeterminism:
+		return &NonDeterminism{
+			ContdError: base,
+			StepID:     getString(details, "step_id"),
+			StepName:   getString(details, "step_name"),
+			Recorded:   getString(details, "recorded_step_name"),
+		}
+	case CodeVariableConflict:
+		return &VariableConflict{
+			ContdError: base,
+			Key:        getString(details, "key"),
+			Branches:   getStrings(details, "branches"),
+		}
+	case CodeStateConflict:
+		return &StateConflict{
+			ContdError:       base,
+			CurrentVersion:   int64(getFloat(details, "current_version")),
+			AttemptedVersion: int64(getFloat(details, "attempted_version")),
+		}
+	case CodeContinueAsNew:
+		return &ContinueAsNew{
+			ContdError:     base,
+			Reason:         getString(details, "reason"),
+			NextWorkflowID: getString(details, "next_workflow_id"),
+		}
+	case CodeRateLimited:
+		return &RateLimited{
+			ContdError: base,
+			RetryAfter: time.Duration(getFloat(details, "retry_after_ms")) * time.Millisecond,
+		}
+	case CodeApplicationFailure:
+		return &ApplicationFailure{ContdError: base, Type: getString(details, "failure_type")}
+	}
+
+	if w.Cause != nil {
+		base.Cause = DecodeError(w.Cause)
+	}
+	return &base
+}
+
+func getStrings(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func getFloat(m map[string]interface{}, key string) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+func decodeViolations(value interface{}) []FieldViolation {
+	switch v := value.(type) {
+	case []FieldViolation:
+		return v
+	case []interface{}:
+		violations := make([]FieldViolation, 0, len(v))
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				violations = append(violations, FieldViolation{Path: getString(m, "path"), Message: getString(m, "message")})
+			}
+		}
+		return violations
+	}
+	return nil
+}
@@ -2,10 +2,11 @@ package contd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
+	"sync/atomic"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 // WorkflowFunc is the signature for workflow functions
@@ -16,35 +17,170 @@ type StepFunc func(ctx context.Context, input interface{}) (interface{}, error)
 
 // WorkflowRunner executes workflows with the Contd runtime
 type WorkflowRunner struct {
-	engine Engine
-	config WorkflowConfig
+	engine   Engine
+	config   WorkflowConfig
+	registry *Registry
+	tracker  *resourceTracker
+	closed   int32
+
+	rateLimits       *RateLimits
+	tagSyncer        TagSyncer
+	searchAttrSyncer SearchAttributeSyncer
+	schedules        *scheduleSet
+	sticky           *StickyCache
+	capabilities     []string
+	taskQueues       []string
+	steps            *StepRegistry
+	drain            <-chan struct{}
+	semaphores       *Semaphores
+	inputs           *InputRecording
+	// attempt is the workflow retry attempt this runner starts
+	attempt int
 }
 
 // NewWorkflowRunner creates a new workflow runner
 func NewWorkflowRunner(engine Engine, config WorkflowConfig) *WorkflowRunner {
 	return &WorkflowRunner{
-		engine: engine,
-		config: config,
+		engine:    engine,
+		config:    config,
+		registry:  GlobalRegistry,
+		tracker:   &resourceTracker{},
+		schedules: &scheduleSet{},
 	}
 }
 
-// Run executes a workflow function
+// SetRegistry sets the registry used for schema validation
+func (r *WorkflowRunner) SetRegistry(registry *Registry) {
+	r.registry = registry
+}
+
+// SetStepRegistry sets the registry ExecuteStepByName looks steps up in
+func (r *WorkflowRunner) SetStepRegistry(registry *StepRegistry) {
+	r.steps = registry
+}
+
+// SetRateLimits sets the limits applied to every step this runner executes
+func (r *WorkflowRunner) SetRateLimits(limits *RateLimits) {
+	r.rateLimits = limits
+}
+
+// SetTagSyncer sets where tag changes made with ExecutionContext.UpdateTags
+// are pushed, typically a Client
+func (r *WorkflowRunner) SetTagSyncer(syncer TagSyncer) {
+	r.tagSyncer = syncer
+}
+
+// SetSearchAttributeSyncer sets where changes made with
+// ExecutionContext.UpsertSearchAttributes are pushed, typically a Client
+func (r *WorkflowRunner) SetSearchAttributeSyncer(syncer SearchAttributeSyncer) {
+	r.searchAttrSyncer = syncer
+}
+
+// Run executes a workflow function, retrying failed runs under the
+// config's RetryPolicy and following workflows that continue as new
 func (r *WorkflowRunner) Run(ctx context.Context, workflowName string, fn WorkflowFunc, input interface{}) (interface{}, error) {
+	runner := r
+	for {
+		result, err := runner.runChain(ctx, workflowName, fn, input)
+		var next *ContinueAsNew
+		if !errors.As(err, &next) || next.NextWorkflowID == "" {
+			return result, err
+		}
+		continued := *runner
+		continued.config = continuedConfig(runner.config, next)
+		continued.attempt = 0
+		runner, input = &continued, next.Input
+	}
+}
+
+// runChain runs one workflow, retrying it under the config's RetryPolicy
+func (r *WorkflowRunner) runChain(ctx context.Context, workflowName string, fn WorkflowFunc, input interface{}) (interface{}, error) {
+	if policy := r.config.RetryPolicy; policy != nil && policy.MaxAttempts > 1 {
+		return r.runWithRetries(ctx, workflowName, fn, input, *policy)
+	}
+	return r.runOnce(ctx, workflowName, fn, input, nil)
+}
+
+// runOnce executes one run of a workflow, storing its ID in ran if set
+func (r *WorkflowRunner) runOnce(ctx context.Context, workflowName string, fn WorkflowFunc, input interface{}, ran *string) (interface{}, error) {
 	startTime := time.Now()
 
-	// Create execution context
-	ec := NewExecutionContext(r.config.WorkflowID, r.config.OrgID, workflowName, r.config.Tags)
-	ec.SetEngine(r.engine)
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return nil, NewContdError("workflow runner is closed", r.config.WorkflowID, nil)
+	}
+	r.tracker.add(trackedWorkflows, 1)
+	defer r.tracker.add(trackedWorkflows, -1)
 
-	// Acquire lease
-	lease, err := r.engine.LeaseManager().Acquire(ec.WorkflowID, ec.ExecutorID)
-	if err != nil {
+	if err := r.registry.ValidateInput(workflowName, input); err != nil {
 		return nil, err
 	}
-	if lease == nil {
-		return nil, NewWorkflowLocked(ec.WorkflowID, "", "")
+	if queue := taskQueue(r.config); !subscribed(r.taskQueues, queue) {
+		return nil, notSubscribed(queue)
+	}
+	if missing := missingCapabilities(r.config.Requires, r.capabilities); len(missing) > 0 {
+		return nil, NewNoCapableWorker(r.config.WorkflowID, "", r.config.Requires, missing)
+	}
+
+	// Org-scoped engines own the org of every workflow they run
+	orgID := r.config.OrgID
+	if scoped, ok := engineAs[*OrgEngine](r.engine); ok {
+		if orgID != "" && !sameOrg(scoped.OrgID(), orgID) {
+			return nil, NewOrgMismatch(r.config.WorkflowID, scoped.OrgID(), orgID)
+		}
+		orgID = scoped.OrgID()
+	}
+
+	// Create execution context, continuing the business key's workflow if
+	// one was already started
+	workflowID, isNew := r.config.WorkflowID, r.config.WorkflowID == ""
+	var err error
+	if isNew && r.config.BusinessKey != "" {
+		workflowID, isNew, err = claimBusinessKey(r.engine, orgID, r.config.BusinessKey)
+		if err != nil {
+			return nil, err
+		}
+	} else if isNew {
+		workflowID = newWorkflowID()
+	}
+	if !isNew && r.config.IDReusePolicy != "" {
+		if isNew, err = enforceIDReuse(r.engine, workflowID, r.config.IDReusePolicy); err != nil {
+			return nil, err
+		}
+	}
+	if ran != nil {
+		*ran = workflowID
+	}
+	ec := newExecutionContext(workflowID, orgID, workflowName, r.config.Tags, isNew)
+	ec.SetEngine(r.engine)
+	ec.tracker = r.tracker
+	ec.rateLimits = r.rateLimits
+	ec.tagSyncer = r.tagSyncer
+	ec.searchAttrSyncer = r.searchAttrSyncer
+	ec.snapshots.policy = r.config.SnapshotPolicy
+	ec.history.limits = r.config.HistoryLimits
+	if ec.history.limits == nil {
+		ec.history.limits = DefaultHistoryLimits()
+	}
+	ec.maxPayload = r.config.MaxPayloadBytes
+	ec.budget = r.config.Budget
+	ec.capabilities = r.capabilities
+	ec.steps = r.steps
+	ec.stepIDs = r.config.StepIDStrategy
+	ec.drain = r.drain
+	ec.semaphores = r.semaphores
+	ec.inputs = r.inputs
+
+	// Acquire lease, waiting for it if configured to
+	lease, err := acquireLease(ctx, r.engine.LeaseManager(), ec.WorkflowID, ec.ExecutorID, r.config.Acquire)
+	if err != nil {
+		return nil, err
 	}
 	ec.SetLease(lease)
+	ec.sticky = r.sticky
+	recordStatus(r.engine, ec.WorkflowID, WorkflowStatusRunning)
+	recordMemo(r.engine, ec.WorkflowID, r.config.Memo)
+	r.tracker.running.add(ec)
+	defer r.tracker.running.remove(ec)
 
 	defer func() {
 		ec.StopHeartbeat()
@@ -55,36 +191,176 @@ func (r *WorkflowRunner) Run(ctx context.Context, workflowName string, fn Workfl
 	ec.StartHeartbeat(lease, r.engine)
 
 	// Check if resuming
-	if ec.IsResuming() {
-		state, err := r.engine.Restore(ec.WorkflowID)
+	if r.config.ResumeFromSavepoint != "" {
+		if !ec.IsResuming() {
+			return nil, NewConfigurationError("ResumeFromSavepoint requires an existing WorkflowID", "resume_from_savepoint")
+		}
+		r.sticky.Invalidate(ec.WorkflowID)
+		state, err := restoreFromSavepoint(r.engine, ec, r.config.ResumeFromSavepoint)
 		if err != nil {
 			return nil, err
 		}
 		ec.SetState(state)
+		fmt.Printf("Resumed workflow %s from savepoint %s at step %d\n", ec.WorkflowID, r.config.ResumeFromSavepoint, state.StepNumber)
+	} else if ec.IsResuming() {
+		state, cached := r.sticky.get(ec.WorkflowID, lease)
+		if !cached {
+			if state, err = restoreState(r.engine, ec.WorkflowID); err != nil {
+				return nil, err
+			}
+		}
+		ec.SetState(state)
+		ec.resumed = state
 		fmt.Printf("Resumed workflow %s from step %d\n", ec.WorkflowID, state.StepNumber)
 	}
+	if ec.IsResuming() {
+		state, _ := ec.GetState()
+		ec.resumeOutbox(r.engine, state)
+	}
+	if err := ec.startRun(r.engine, r.attempt, taskQueue(r.config)); err != nil {
+		return nil, err
+	}
+
+	// A cancel or terminate request cancels the run with a WorkflowCancelled
+	// cause
+	runCtx, cancelRun := context.WithCancelCause(ctx)
+	defer cancelRun(nil)
+	ec.cancelRun = cancelRun
+	defer ec.watchStop(r.engine)()
+	ec.checkStop()
+
+	// Execute workflow with context, bounded by MaxDuration across resumes
+	workflowCtx := WithContext(runCtx, ec)
+	var deadline *workflowDeadline
+	maxDuration := r.config.MaxDuration
+	if maxDuration == 0 {
+		maxDuration = r.registry.maxDuration(workflowName)
+	}
+	if maxDuration > 0 {
+		state, _ := ec.GetState()
+		workflowCtx, deadline = startDeadline(workflowCtx, ec.WorkflowID, priorElapsed(state), maxDuration, r.config.ExtendDeadline)
+		defer deadline.Stop()
+	}
+
+	var initial *WorkflowState
+	if r.config.DeterminismCheck != DeterminismOff {
+		state, _ := ec.GetState()
+		initial = copyState(state)
+	}
 
-	// Execute workflow with context
-	workflowCtx := WithContext(ctx, ec)
 	result, err := fn(workflowCtx, input)
+	if deadline != nil {
+		if perr := persistElapsed(r.engine, ec, deadline.Elapsed()); perr != nil && err == nil {
+			err = perr
+		}
+		if err != nil && deadline.Exceeded() {
+			timeout := NewWorkflowTimeout(ec.WorkflowID, deadline.Limit(), deadline.Elapsed())
+			recordFailure(r.engine, ec, timeout)
+			recordStatus(r.engine, ec.WorkflowID, WorkflowStatusFailed)
+			r.sticky.retain(ec, err)
+			return nil, timeout
+		}
+	}
+	if stop := stopped(runCtx); stop != nil && err != nil {
+		r.sticky.retain(ec, err)
+		return nil, r.finishStop(ctx, ec, stop)
+	}
+	// A caller cancelling ctx with a WorkflowSuspended cause parks the
+	// workflow, e.g. at the end of a serverless time slice
+	var parked *WorkflowSuspended
+	if err != nil && errors.As(context.Cause(ctx), &parked) {
+		err = NewWorkflowSuspended(ec.WorkflowID, parked.Reason)
+	}
+	var next *ContinueAsNew
+	if errors.As(err, &next) {
+		return nil, r.finishContinueAsNew(ec, next)
+	}
+	var failure *ApplicationFailure
+	if errors.As(err, &failure) {
+		return nil, r.finishApplicationFailure(ec, failure)
+	}
 	if err != nil {
+		if errors.Is(err, ErrBudgetExceeded) || errors.Is(err, ErrWorkflowSuspended) {
+			r.suspend(ec, err)
+			recordStatus(r.engine, ec.WorkflowID, WorkflowStatusSuspended)
+		} else if errors.Is(err, ErrNoCapableWorker) {
+			// The workflow stays open for a worker that can run the step
+			if state, _ := ec.GetState(); state != nil {
+				r.engine.MaybeSnapshot(state)
+			}
+			fmt.Printf("Workflow %s needs another worker: %v\n", ec.WorkflowID, err)
+		} else {
+			// Interrupted and cancelled runs stay open so they can resume, as
+			// do runs that lost a state conflict to another executor
+			if ctx.Err() == nil && !errors.Is(err, ErrWorkflowInterrupted) && !errors.Is(err, ErrStateConflict) {
+				recordFailure(r.engine, ec, err)
+				recordStatus(r.engine, ec.WorkflowID, WorkflowStatusFailed)
+			}
+			notifyLifecycle(r.engine, ec, WebhookWorkflowFailed, map[string]interface{}{
+				"error": err.Error(),
+				"code":  errorCode(err),
+			})
+		}
+		// A cancelled workflow is checkpointed so resuming it is cheap
+		if ctx.Err() != nil {
+			if state, _ := ec.GetState(); state != nil {
+				r.engine.MaybeSnapshot(state)
+			}
+		}
+		r.sticky.retain(ec, err)
+		return nil, err
+	}
+	if err := r.registry.ValidateOutput(workflowName, result); err != nil {
 		return nil, err
 	}
+	if r.config.DeterminismCheck != DeterminismOff {
+		if err := r.checkDeterminism(ctx, ec, workflowName, fn, input, initial, result); err != nil {
+			return nil, err
+		}
+	}
+	ec.syncTags(ctx)
+	ec.syncSearchAttributes(ctx)
 
 	// Mark complete
 	if err := r.engine.CompleteWorkflow(ec.WorkflowID); err != nil {
 		return nil, err
 	}
+	recordStatus(r.engine, ec.WorkflowID, WorkflowStatusCompleted)
+	r.sticky.retain(ec, nil)
 
 	duration := time.Since(startTime)
+	notifyLifecycle(r.engine, ec, WebhookWorkflowCompleted, map[string]interface{}{
+		"duration_ms": duration.Milliseconds(),
+	})
 	fmt.Printf("Workflow %s completed in %v\n", ec.WorkflowID, duration)
 
 	return result, nil
 }
 
+// StepObserver is implemented by engines that record each step execution,
+// such as the test harness's MockEngine
+type StepObserver interface {
+	ObserveStep(execution StepExecution)
+}
+
+// StepInterceptor is implemented by engines that can stop a step before it
+// executes, such as the test harness's MockEngine injecting interruptions
+type StepInterceptor interface {
+	InterceptStep(workflowID, stepID string, stepNumber int) error
+}
+
+// observeStep reports a step execution to the engine if it observes steps
+func observeStep(engine Engine, execution StepExecution) {
+	if observer, ok := engineAs[StepObserver](engine); ok {
+		observer.ObserveStep(execution)
+	}
+}
+
 // StepRunner executes steps within a workflow
 type StepRunner struct {
 	config StepConfig
+	// unthrottled skips rate limits, for wrapper steps whose children are limited
+	unthrottled bool
 }
 
 // NewStepRunner creates a new step runner
@@ -94,6 +370,11 @@ func NewStepRunner(config StepConfig) *StepRunner {
 
 // Run executes a step function
 func (r *StepRunner) Run(ctx context.Context, stepName string, fn StepFunc, input interface{}) (interface{}, error) {
+	return r.run(ctx, stepName, "", fn, input)
+}
+
+// run executes a step under an explicit step ID, generating one when empty
+func (r *StepRunner) run(ctx context.Context, stepName, stepID string, fn StepFunc, input interface{}) (interface{}, error) {
 	ec, err := Current(ctx)
 	if err != nil {
 		return nil, err
@@ -105,7 +386,16 @@ func (r *StepRunner) Run(ctx context.Context, stepName string, fn StepFunc, inpu
 	}
 
 	lease := ec.GetLease()
-	stepID := ec.GenerateStepID(stepName)
+	if stepID == "" {
+		if stepID, err = r.stepID(ctx, ec, stepName); err != nil {
+			return nil, err
+		}
+	}
+	if err := ec.claimStepID(stepID, stepName); err != nil {
+		return nil, err
+	}
+
+	ec.recordStep(stepID, input)
 
 	// Check idempotency
 	cachedResult, err := engine.Idempotency().CheckCompleted(ec.WorkflowID, stepID)
@@ -113,28 +403,137 @@ func (r *StepRunner) Run(ctx context.Context, stepName string, fn StepFunc, inpu
 		return nil, err
 	}
 	if cachedResult != nil {
+		if err := checkCachedStep(ec.WorkflowID, stepID, stepName, cachedResult); err != nil {
+			return nil, err
+		}
+		current, _ := ec.GetState()
+		ec.SetState(keepStateVersion(cachedResult, current))
+		ec.stepCompleted(stepID)
+		ec.siteCompleted(stepID)
+		ec.markStepID(stepID)
+		if ec.replaying {
+			return cachedResult, nil
+		}
 		fmt.Printf("Step %s already completed, returning cached result\n", stepID)
-		ec.SetState(cachedResult)
+		now := time.Now()
+		observeStep(engine, StepExecution{
+			StepName:    stepName,
+			StepID:      stepID,
+			StartedAt:   now,
+			CompletedAt: &now,
+			Result:      cachedResult,
+			WasCached:   true,
+		})
 		return cachedResult, nil
 	}
 
+	if ec.replaying {
+		return nil, NewContdError(fmt.Sprintf("Step %s was not run by the original execution", stepID), ec.WorkflowID, nil)
+	}
+
+	// A step needing what this worker lacks is left for one that has it
+	if missing := missingCapabilities(r.config.Requires, ec.capabilities); len(missing) > 0 {
+		return nil, NewNoCapableWorker(ec.WorkflowID, stepName, r.config.Requires, missing)
+	}
+
+	if interceptor, ok := engineAs[StepInterceptor](engine); ok {
+		if err := interceptor.InterceptStep(ec.WorkflowID, stepID, ec.currentStep()); err != nil {
+			return nil, err
+		}
+	}
+
+	// A step that outlived its parent's timeout must not start new work
+	if fenced(ctx) {
+		return nil, context.Cause(ctx)
+	}
+
+	// An over-budget workflow is suspended before it spends more
+	if err := ec.checkBudget(); err != nil {
+		return nil, err
+	}
+	if err := ec.checkDrain(); err != nil {
+		return nil, err
+	}
+	if err := ec.checkHistory(engine); err != nil {
+		return nil, err
+	}
+
 	// Allocate attempt
 	attemptID, err := engine.Idempotency().AllocateAttempt(ec.WorkflowID, stepID, lease)
 	if err != nil {
 		return nil, err
 	}
+	ec.updateActivity(stepID, stepName, func(a *PendingActivity) {
+		a.Kind, a.Attempt, a.StartedAt, a.WaitingUntil = ActivityStep, attemptID, time.Now(), nil
+	})
+	defer ec.clearActivity(stepID)
+
+	// Don't start new steps once the workflow has been cancelled
+	ec.checkStop()
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+
+	// A memoized result stands in for running the step
+	var memoStore MemoStore
+	var memoID string
+	var memoized *MemoEntry
+	if r.config.Memo != nil {
+		if store, ok := engineAs[MemoStore](engine); ok {
+			if key, ok := memoKey(ec.OrgID, stepName, r.config.Memo, input); ok {
+				memoStore, memoID = store, key
+				memoized = lookupMemo(store, key)
+			}
+		}
+	}
+
+	// Short-circuit while the step's circuit is open. A step that stops
+	// before its outcome is recorded gives up a half-open trial it holds.
+	var unrecorded *CircuitBreaker
+	if memoized == nil && r.config.CircuitBreaker != nil {
+		trial, err := r.config.CircuitBreaker.allow(ec.WorkflowID, stepID, stepName)
+		if err != nil {
+			appendEvent(engine, ec, "step_short_circuited", map[string]interface{}{
+				"step_id":   stepID,
+				"step_name": stepName,
+			})
+			return nil, err
+		}
+		unrecorded = r.config.CircuitBreaker
+		if trial {
+			defer func() {
+				if unrecorded != nil {
+					unrecorded.release(stepName)
+				}
+			}()
+		}
+	}
+
+	// Apply rate limits before declaring the intention
+	if memoized == nil && !r.unthrottled {
+		ec.updateActivity(stepID, stepName, func(a *PendingActivity) { a.Kind = ActivityRateLimit })
+		if err := throttle(ctx, engine, ec, stepID, stepName); err != nil {
+			return nil, err
+		}
+		ec.updateActivity(stepID, stepName, func(a *PendingActivity) { a.Kind = ActivityStep })
+	}
+
+	// Wait for a slot under the step's worker-wide concurrency limit
+	release := func() {}
+	if memoized == nil {
+		if release, err = r.acquireSlot(ctx, engine, ec, stepID, stepName); err != nil {
+			return nil, err
+		}
+	}
 
 	// Write intention
-	if err := engine.Journal().Append(map[string]interface{}{
-		"event_id":    uuid.New().String(),
-		"workflow_id": ec.WorkflowID,
-		"org_id":      ec.OrgID,
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-		"event_type":  "step_intention",
-		"step_id":     stepID,
-		"step_name":   stepName,
-		"attempt_id":  attemptID,
-	}); err != nil {
+	intention := ec.newEvent("step_intention", 4)
+	intention["step_id"] = stepID
+	intention["step_name"] = stepName
+	intention["attempt_id"] = attemptID
+	r.recordInput(ec, intention, stepName, input)
+	if err := engine.Journal().Append(intention); err != nil {
+		release()
 		return nil, err
 	}
 
@@ -143,79 +542,183 @@ func (r *StepRunner) Run(ctx context.Context, stepName string, fn StepFunc, inpu
 	var result interface{}
 	var execErr error
 
-	if r.config.Timeout > 0 {
-		result, execErr = r.executeWithTimeout(ctx, fn, input, r.config.Timeout, ec.WorkflowID, stepID, stepName)
+	metrics := &StepMetrics{}
+	stepCtx := context.WithValue(ctx, stepMetricsKey, metrics)
+	stepCtx = context.WithValue(stepCtx, stepIDKey, stepID)
+	if memoized != nil {
+		result = memoized.Result
+		ec.applyMemo(memoized)
+	} else if r.config.Timeout > 0 {
+		result, execErr = r.executeWithTimeout(stepCtx, fn, input, r.config.Timeout, ec.WorkflowID, stepID, stepName)
 	} else {
-		result, execErr = fn(ctx, input)
+		result, execErr = callStep(stepCtx, fn, input, ec.WorkflowID, stepID, stepName)
+	}
+	release()
+	if memoStore != nil && memoized == nil && execErr == nil {
+		if _, ok := result.(*WorkflowState); !ok {
+			saveMemo(memoStore, memoID, r.config.Memo, result, ec.pendingChanges())
+		}
 	}
 
 	durationMs := time.Since(startTime).Milliseconds()
 
+	// Usage counts against the budget whether or not the step succeeded
+	usage := metrics.total()
+	if usage != nil {
+		ec.addUsage(*usage)
+	}
+
+	execution := StepExecution{
+		StepName:   stepName,
+		StepID:     stepID,
+		Attempt:    attemptID,
+		StartedAt:  startTime,
+		DurationMs: durationMs,
+		Result:     result,
+		WasCached:  memoized != nil,
+	}
+	// A successful step only counts as completed once its result is committed
+	committed := false
 	if execErr != nil {
+		execution.Error = execErr.Error()
+		observeStep(engine, execution)
+	} else {
+		defer func() {
+			if committed {
+				completedAt := time.Now()
+				execution.CompletedAt = &completedAt
+			} else {
+				execution.Error = "step result was not committed"
+			}
+			observeStep(engine, execution)
+		}()
+	}
+
+	if unrecorded != nil {
+		unrecorded.Record(stepName, execErr == nil)
+		unrecorded = nil
+	}
+
+	if execErr != nil {
+		// A branch's step drops only its branch's writes: the pending
+		// changes may hold writes other branches merged but haven't
+		// committed yet
+		if scope := branchOf(ctx); scope != nil {
+			scope.discard()
+		} else {
+			ec.commitMu.Lock()
+			ec.discardChanges()
+			ec.commitMu.Unlock()
+		}
+
 		// Log failure
-		engine.Journal().Append(map[string]interface{}{
-			"event_id":    uuid.New().String(),
-			"workflow_id": ec.WorkflowID,
-			"org_id":      ec.OrgID,
-			"timestamp":   time.Now().UTC().Format(time.RFC3339),
-			"event_type":  "step_failed",
-			"step_id":     stepID,
-			"attempt_id":  attemptID,
-			"error":       execErr.Error(),
-		})
+		failed := ec.newEvent("step_failed", 8)
+		failed["step_id"] = stepID
+		failed["step_name"] = stepName
+		failed["attempt_id"] = attemptID
+		failed["error"] = execErr.Error()
+		failed["code"] = errorCode(execErr)
+		if usage != nil {
+			failed["usage"] = usage
+		}
+		var panicErr *StepPanic
+		if errors.As(execErr, &panicErr) {
+			failed["panic"] = true
+			failed["stack"] = panicErr.Stack
+		}
+		engine.Journal().Append(failed)
 
 		// Check retry policy
 		if r.config.Retry != nil && r.config.Retry.ShouldRetry(attemptID, execErr) {
-			backoff := r.config.Retry.Backoff(attemptID)
+			backoff := retryDelay(execErr, r.config.Retry.Backoff(attemptID))
 			fmt.Printf("Retrying step %s, attempt %d after %v\n", stepID, attemptID+1, backoff)
+			until := time.Now().Add(backoff)
+			ec.updateActivity(stepID, stepName, func(a *PendingActivity) {
+				a.Kind, a.LastError, a.WaitingUntil = ActivityRetryBackoff, execErr.Error(), &until
+			})
 			time.Sleep(backoff)
-			return r.Run(ctx, stepName, fn, input)
+			return r.run(ctx, stepName, stepID, fn, input)
 		}
 
 		// Check max attempts
-		if r.config.Retry != nil && attemptID >= r.config.Retry.MaxAttempts {
-			return nil, NewTooManyAttempts(ec.WorkflowID, stepID, stepName, r.config.Retry.MaxAttempts, execErr.Error())
+		if deadLettered(r.config.Retry, attemptID, execErr) {
+			deadLetter(engine, ec, stepID, stepName, attemptID, input, execErr)
+			if attemptID >= r.config.Retry.MaxAttempts {
+				return nil, NewTooManyAttempts(ec.WorkflowID, stepID, stepName, r.config.Retry.MaxAttempts, execErr.Error())
+			}
 		}
 
 		return nil, NewStepExecutionFailed(ec.WorkflowID, stepID, stepName, attemptID, execErr)
 	}
 
-	// Extract new state
-	newState := ec.ExtractState(result)
+	// Serialize state commits from concurrently running steps
+	ec.commitMu.Lock()
+	defer ec.commitMu.Unlock()
+	if fenced(ctx) {
+		return nil, context.Cause(ctx)
+	}
+
+	// Merge the writes of a parallel branch, failing on conflicts it forbids
+	if err := ec.mergeBranch(ctx, engine, stepID, result); err != nil {
+		return nil, err
+	}
+
+	// Extract new state, dropping outbox messages already handed off
+	pruned := ec.pruneOutbox()
+	newState, dirty := ec.extractState(result)
 	oldState, _ := ec.GetState()
+	newState = stampStep(newState, stepID, stepName, oldState)
 
-	// Compute delta
-	delta := computeDelta(oldState, newState)
+	// Compute delta, offloading it if it exceeds the journaling limit
+	delta, overflow, err := truncatePayload(engine, ec.WorkflowID, stepID, computeDelta(oldState, newState, dirty), r.payloadLimit(ec))
+	if err != nil {
+		return nil, err
+	}
 
 	// Write completion
-	if err := engine.Journal().Append(map[string]interface{}{
-		"event_id":    uuid.New().String(),
-		"workflow_id": ec.WorkflowID,
-		"org_id":      ec.OrgID,
-		"timestamp":   time.Now().UTC().Format(time.RFC3339),
-		"event_type":  "step_completed",
-		"step_id":     stepID,
-		"attempt_id":  attemptID,
-		"state_delta": delta,
-		"duration_ms": durationMs,
-	}); err != nil {
+	completed := ec.newEvent("step_completed", 10)
+	completed["step_id"] = stepID
+	completed["attempt_id"] = attemptID
+	completed["state_delta"] = delta
+	completed["step_number"] = newState.StepNumber
+	completed["state_version"] = newState.StateVersion
+	completed["duration_ms"] = durationMs
+	if usage != nil {
+		completed["usage"] = usage
+	}
+	if memoized != nil {
+		completed["memo_key"] = memoID
+	}
+	if overflow != nil {
+		completed["overflow_digest"] = overflow.Digest
+		completed["overflow_ref"] = overflow.ArtifactRef
+	}
+	if err := engine.Journal().Append(completed); err != nil {
 		return nil, err
 	}
 
 	// Mark completed
 	if err := engine.Idempotency().MarkCompleted(ec.WorkflowID, stepID, attemptID, newState); err != nil {
-		return nil, err
+		return nil, ec.reloadOnConflict(engine, err)
 	}
+	committed = true
+	ec.prunedOutbox(pruned)
+	ec.handOffOutbox(engine, newState, dirty)
 
 	// Update context
 	ec.SetState(newState)
-	ec.IncrementStep()
-
-	// Checkpoint if configured
-	if r.config.Checkpoint {
+	ec.stepCompleted(stepID)
+	ec.siteCompleted(stepID)
+	ec.markStepID(stepID)
+	ec.syncTags(ctx)
+	ec.syncSearchAttributes(ctx)
+
+	// Checkpoint if configured and the snapshot policy calls for it
+	if r.config.Checkpoint && (ec.shouldSnapshot(newState.StepNumber, delta, r.config.Savepoint) || ec.historySnapshots()) {
 		if err := engine.MaybeSnapshot(newState); err != nil {
-			return nil, err
+			return nil, ec.reloadOnConflict(engine, err)
 		}
+		ec.snapshotTaken()
 	}
 
 	// Savepoint if configured
@@ -228,33 +731,129 @@ func (r *StepRunner) Run(ctx context.Context, stepName string, fn StepFunc, inpu
 	return result, nil
 }
 
+// suspend journals that an over-budget or parked workflow stopped and
+// checkpoints it, so it resumes from where it stopped when run again
+func (r *WorkflowRunner) suspend(ec *ExecutionContext, cause error) {
+	appendEvent(r.engine, ec, "workflow_suspended", map[string]interface{}{
+		"reason": cause.Error(),
+		"code":   errorCode(cause),
+	})
+	if state, _ := ec.GetState(); state != nil {
+		r.engine.MaybeSnapshot(state)
+	}
+	notifyLifecycle(r.engine, ec, WebhookWorkflowSuspended, map[string]interface{}{
+		"reason": cause.Error(),
+	})
+	fmt.Printf("Suspended workflow %s: %v\n", ec.WorkflowID, cause)
+}
+
+// payloadLimit returns the step's inline payload limit, falling back to
+// the workflow's
+func (r *StepRunner) payloadLimit(ec *ExecutionContext) int {
+	if r.config.MaxPayloadBytes > 0 {
+		return r.config.MaxPayloadBytes
+	}
+	return ec.maxPayload
+}
+
+// callStep runs a step function, converting a panic into a *StepPanic
+func callStep(ctx context.Context, fn StepFunc, input interface{}, workflowID, stepID, stepName string) (result interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			result = nil
+			err = NewStepPanic(workflowID, stepID, stepName, v, string(debug.Stack()))
+		}
+	}()
+	return fn(ctx, input)
+}
+
+// stepIDKey carries the ID of the step a context belongs to
+const stepIDKey contextKey = "contd_step_id"
+
+// stepFenceKey marks a step's context; the fence is raised when the step
+// times out so it cannot commit nested steps afterwards
+const stepFenceKey contextKey = "contd_step_fence"
+
+// fenced reports whether ctx belongs to a step that has timed out
+func fenced(ctx context.Context) bool {
+	fence, ok := ctx.Value(stepFenceKey).(*int32)
+	return ok && atomic.LoadInt32(fence) == 1
+}
+
 func (r *StepRunner) executeWithTimeout(ctx context.Context, fn StepFunc, input interface{}, timeout time.Duration, workflowID, stepID, stepName string) (interface{}, error) {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	startTime := time.Now()
+	timeoutErr := NewStepTimeout(workflowID, stepID, stepName, timeout.Seconds(), timeout.Seconds())
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, timeoutErr)
 	defer cancel()
 
-	resultCh := make(chan interface{}, 1)
-	errCh := make(chan error, 1)
+	ec, _ := Current(ctx)
+	var tracker *resourceTracker
+	if ec != nil {
+		tracker = ec.tracker
+	}
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	var fence, abandoned int32
+	ctx = context.WithValue(ctx, stepFenceKey, &fence)
 
+	tracker.add(trackedStepGoroutines, 1)
 	go func() {
-		result, err := fn(ctx, input)
-		if err != nil {
-			errCh <- err
-		} else {
-			resultCh <- result
-		}
+		defer func() {
+			tracker.add(trackedStepGoroutines, -1)
+			if !atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+				tracker.add(trackedAbandonedSteps, -1)
+			}
+		}()
+		result, err := callStep(ctx, fn, input, workflowID, stepID, stepName)
+		done <- outcome{result, err}
 	}()
 
 	select {
-	case result := <-resultCh:
-		return result, nil
-	case err := <-errCh:
-		return nil, err
+	case out := <-done:
+		return out.result, out.err
 	case <-ctx.Done():
-		return nil, NewStepTimeout(workflowID, stepID, stepName, timeout.Seconds(), timeout.Seconds())
 	}
+
+	// Raise the fence under the commit lock, so a nested step that is already
+	// committing finishes first and none can commit afterwards
+	if ec != nil {
+		ec.commitMu.Lock()
+		atomic.StoreInt32(&fence, 1)
+		ec.commitMu.Unlock()
+	} else {
+		atomic.StoreInt32(&fence, 1)
+	}
+
+	switch {
+	case r.config.HardStop:
+		<-done
+	case r.config.CancelGrace > 0:
+		timer := time.NewTimer(r.config.CancelGrace)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+	}
+	if atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+		tracker.add(trackedAbandonedSteps, 1)
+	}
+
+	// The parent context may have been cancelled rather than timing out
+	if cause := context.Cause(ctx); cause != timeoutErr {
+		return nil, cause
+	}
+	elapsed := time.Since(startTime)
+	return nil, NewStepTimeout(workflowID, stepID, stepName, timeout.Seconds(), elapsed.Seconds())
 }
 
-func computeDelta(oldState, newState *WorkflowState) map[string]interface{} {
+// computeDelta diffs two states. Dirty keys are always included, since a
+// value mutated in place compares equal to itself.
+func computeDelta(oldState, newState *WorkflowState, dirty map[string]struct{}) map[string]interface{} {
 	delta := make(map[string]interface{})
 
 	if oldState == nil {
@@ -263,7 +862,8 @@ func computeDelta(oldState, newState *WorkflowState) map[string]interface{} {
 
 	// Find changed/added keys
 	for k, v := range newState.Variables {
-		if oldV, exists := oldState.Variables[k]; !exists || !equal(oldV, v) {
+		_, changed := dirty[k]
+		if oldV, exists := oldState.Variables[k]; changed || !exists || !equal(oldV, v) {
 			delta[k] = v
 		}
 	}
@@ -0,0 +1,31 @@
+package contd
+
+import "fmt"
+
+// WorkflowMemoStore is implemented by engines that keep a workflow's memo
+// apart from its state, so it can be read without restoring the workflow
+type WorkflowMemoStore interface {
+	SetWorkflowMemo(workflowID string, memo map[string]interface{}) error
+	// WorkflowMemo returns the workflow's memo, or nil if it has none
+	WorkflowMemo(workflowID string) (map[string]interface{}, error)
+}
+
+// recordMemo stores a workflow's memo if the engine keeps memos
+func recordMemo(engine Engine, workflowID string, memo map[string]interface{}) {
+	store, ok := engineAs[WorkflowMemoStore](engine)
+	if !ok || memo == nil {
+		return
+	}
+	if err := store.SetWorkflowMemo(workflowID, memo); err != nil {
+		fmt.Printf("Failed to record memo for workflow %s: %v\n", workflowID, err)
+	}
+}
+
+// WorkflowMemoLocal reads the memo of a workflow run on a local engine
+func WorkflowMemoLocal(engine Engine, workflowID string) (map[string]interface{}, error) {
+	store, ok := engineAs[WorkflowMemoStore](engine)
+	if !ok {
+		return nil, NewConfigurationError("engine does not store workflow memos", "memo")
+	}
+	return store.WorkflowMemo(workflowID)
+}
@@ -0,0 +1,124 @@
+package contd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WorkflowRetryFrom decides where a retried workflow run starts
+type WorkflowRetryFrom string
+
+const (
+	// RetryFromStart reruns the workflow from the beginning under a new
+	// workflow ID
+	RetryFromStart WorkflowRetryFrom = ""
+	// RetryFromSavepoint rewinds the failed workflow to its latest
+	// savepoint, starting over like RetryFromStart when it has none
+	RetryFromSavepoint WorkflowRetryFrom = "savepoint"
+)
+
+// retryableRun reports whether a failed run may be retried. Runs that
+// stopped without failing, such as interrupted, cancelled or suspended
+// ones, stay open to resume instead.
+func retryableRun(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	for _, target := range []error{
+		ErrWorkflowInterrupted,
+		ErrWorkflowCancelled,
+		ErrWorkflowTerminated,
+		ErrBudgetExceeded,
+		ErrWorkflowSuspended,
+		ErrNoCapableWorker,
+		ErrWorkflowLocked,
+		ErrWorkflowAlreadyExists,
+		ErrConfiguration,
+		ErrOrgMismatch,
+		ErrStateConflict,
+		ErrContinueAsNew,
+		ErrApplicationFailure,
+	} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// latestSavepoint returns the ID of a workflow's latest savepoint, or ""
+func latestSavepoint(engine Engine, workflowID string) string {
+	lister, ok := engineAs[SavepointLister](engine)
+	if !ok {
+		return ""
+	}
+	infos, err := lister.ListSavepoints(workflowID)
+	if err != nil || len(infos) == 0 {
+		return ""
+	}
+	return infos[len(infos)-1].SavepointID
+}
+
+// runWithRetries runs a workflow until a run succeeds, fails for good or
+// policy.MaxAttempts runs have failed. Each retry is journaled on the
+// failed run with the ID of the run replacing it, and a run started under
+// a new ID journals the runs it retries.
+func (r *WorkflowRunner) runWithRetries(ctx context.Context, workflowName string, fn WorkflowFunc, input interface{}, policy RetryPolicy) (interface{}, error) {
+	runner := *r
+	var firstID string
+	for attempt := 1; ; attempt++ {
+		var workflowID string
+		result, err := runner.runOnce(ctx, workflowName, fn, input, &workflowID)
+		if err == nil || workflowID == "" || !policy.ShouldRetry(attempt, err) || !retryableRun(ctx, err) {
+			return result, err
+		}
+		if firstID == "" {
+			firstID = workflowID
+		}
+
+		next := runner.config
+		next.BusinessKey, next.IDReusePolicy, next.ResumeFromSavepoint = "", "", ""
+		if r.config.RetryFrom == RetryFromSavepoint {
+			next.ResumeFromSavepoint = latestSavepoint(r.engine, workflowID)
+		}
+		if next.ResumeFromSavepoint != "" {
+			next.WorkflowID = workflowID
+		} else {
+			next.WorkflowID = newWorkflowID()
+		}
+
+		backoff := retryDelay(err, policy.Backoff(attempt))
+		failed := NewExecutionContext(workflowID, next.OrgID, workflowName, next.Tags)
+		if jerr := appendEvent(r.engine, failed, "workflow_retry_scheduled", map[string]interface{}{
+			"attempt":          attempt + 1,
+			"next_workflow_id": next.WorkflowID,
+			"savepoint_id":     next.ResumeFromSavepoint,
+			"error":            err.Error(),
+			"code":             errorCode(err),
+			"backoff_ms":       backoff.Milliseconds(),
+		}); jerr != nil {
+			return nil, jerr
+		}
+		if next.WorkflowID != workflowID {
+			retry := NewExecutionContext(next.WorkflowID, next.OrgID, workflowName, next.Tags)
+			if jerr := appendEvent(r.engine, retry, "workflow_retry_started", map[string]interface{}{
+				"attempt":           attempt + 1,
+				"retry_of":          workflowID,
+				"first_workflow_id": firstID,
+			}); jerr != nil {
+				return nil, jerr
+			}
+		}
+		fmt.Printf("Workflow %s failed (attempt %d/%d), retrying as %s in %v: %v\n", workflowID, attempt, policy.MaxAttempts, next.WorkflowID, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		runner.config = next
+		runner.attempt = attempt + 1
+	}
+}